@@ -54,6 +54,14 @@ document.addEventListener('DOMContentLoaded', function () {
     });
   }
 
+  // Headers of requests made for the logged in user, with the token from /login
+  function authHeaders() {
+    return {
+      'Content-Type': 'application/json',
+      Authorization: `Bearer ${userData.token}`,
+    };
+  }
+
   async function renderDashboard() {
     const formatter = new Intl.NumberFormat('en-US', {
       style: 'currency',
@@ -138,7 +146,7 @@ document.addEventListener('DOMContentLoaded', function () {
       console.log(userData) ;
       const transactionsResponse = await fetch(
         `${baseURL}/transactions?sender_id=${userData.user_id}`,
-        { method: 'GET', headers: { 'Content-Type': 'application/json' } }
+        { method: 'GET', headers: authHeaders() }
       );
 
       let transactions = staticTransactions;
@@ -270,14 +278,14 @@ document.addEventListener('DOMContentLoaded', function () {
             account_number: receiverAccount,
             amount: amount,
             remarks: `Transfer of $${amount.toFixed(2)} from ${userData.name} to ${receiverNameInput.value}`,
-            dateTimeStamp: Math.floor(Date.now() / 1000), // Current Unix timestamp
+            requested_at: Math.floor(Date.now() / 1000), // Shown with the transaction, the server dates it
           };
   
           try {
             // Hit the /handletransaction API
             const response = await fetch(`${baseURL}/transaction`, {
               method: 'POST',
-              headers: { 'Content-Type': 'application/json' },
+              headers: authHeaders(),
               body: JSON.stringify(payload),
             });
   
@@ -332,7 +340,7 @@ document.addEventListener('DOMContentLoaded', function () {
 
               // Format the amount for display
               const amountStyle = amount < 0 ? 'color: red;' : '';
-              const statusIcon = (txn.status == 'completed' || txn.status == 'success') ? '✔' : '✘';
+              const statusIcon = ['settled', 'reversed', 'completed', 'success'].includes(txn.status) ? '✔' : (txn.status == 'authorized' || txn.status == 'pending') ? '…' : '✘';
 
               return `
                 <tr>
@@ -364,7 +372,7 @@ document.addEventListener('DOMContentLoaded', function () {
     }
 
     const url = `${baseURL}/monthdata?user_id=${userData.user_id}&month=${month}&year=${year}`;
-    fetch(url)
+    fetch(url, { headers: authHeaders() })
       .then((response) => {
         if (!response.ok) {
           return response.json().then((data) => {
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"cse512/audit"
+	"cse512/db"
+	"cse512/repository"
+	"flag"
+	"fmt"
+)
+
+// runVerifyAudit checks the hash chain of the whole audit log and fails at
+// the first event that was changed, removed or reordered
+func runVerifyAudit(args []string) error {
+	flags := flag.NewFlagSet("verify-audit", flag.ExitOnError)
+	flags.Parse(args)
+
+	store := repository.NewMongoStore(db.GetDatabase())
+	verified, err := audit.Verify(context.Background(), store.Audit())
+	if err != nil {
+		return fmt.Errorf("audit log verified up to event %d: %w", verified, err)
+	}
+	fmt.Printf("Verified %d audit events.\n", verified)
+	return nil
+}
@@ -0,0 +1,176 @@
+// Package audit records security and money events in the hash-chained audit
+// log and verifies that the log has not been tampered with. Events are
+// queued by the work they record and chained onto the log afterwards by Run,
+// so units of work do not take turns on the head of the log.
+package audit
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Origin is who a unit of work is done for and the request it serves
+type Origin struct {
+	ActorID   int    // User ID of the caller, 0 without a token
+	IP        string // Address the request came from
+	RequestID string // ID of the request
+}
+
+type originKey struct{}
+
+// WithOrigin returns ctx carrying origin, for the events recorded with it
+func WithOrigin(ctx context.Context, origin Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// OriginFrom returns the origin ctx carries, or the zero origin of work the
+// server does by itself
+func OriginFrom(ctx context.Context) Origin {
+	origin, _ := ctx.Value(originKey{}).(Origin)
+	return origin
+}
+
+// Record queues event for log, stamped with the origin of ctx. The actor of
+// the origin is used unless event names one, and the current time unless
+// event has one. Pass the context of a unit of work to record the event only
+// if the work commits.
+func Record(ctx context.Context, log repository.AuditRepository, event datamodels.AuditEvent) error {
+	origin := OriginFrom(ctx)
+	if event.ActorID == 0 {
+		event.ActorID = origin.ActorID
+	}
+	event.IP = origin.IP
+	event.RequestID = origin.RequestID
+	if event.At == 0 {
+		event.At = time.Now().Unix()
+	}
+	return log.Append(ctx, event)
+}
+
+// Options configures the worker chaining queued events
+type Options struct {
+	Interval time.Duration // How often queued events are chained, defaults to a second
+	Batch    int           // Events chained at a time, defaults to 100
+}
+
+func (opts *Options) setDefaults() {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.Batch <= 0 {
+		opts.Batch = 100
+	}
+}
+
+// Run chains the queued events of auditLog every opts.Interval until ctx is
+// cancelled
+func Run(ctx context.Context, auditLog repository.AuditRepository, opts Options) {
+	opts.setDefaults()
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := Flush(ctx, auditLog, opts); err != nil && ctx.Err() == nil {
+			log.Printf("Audit chaining: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush chains every event queued on log and returns the number chained
+func Flush(ctx context.Context, log repository.AuditRepository, opts Options) (int, error) {
+	opts.setDefaults()
+
+	flushed := 0
+	for ctx.Err() == nil {
+		chained, err := log.ChainQueued(ctx, opts.Batch)
+		flushed += chained
+		if err != nil {
+			return flushed, fmt.Errorf("chaining audit events: %w", err)
+		}
+		if chained < opts.Batch {
+			break
+		}
+	}
+	return flushed, ctx.Err()
+}
+
+// Snapshot returns the JSON of value, for the Before and After of an event
+func Snapshot(value any) string {
+	data, _ := json.Marshal(value) // Snapshots are of plain data, which always encodes
+	return string(data)
+}
+
+// RecordConfig records the configuration a server starts with if it differs
+// from the last one recorded, with that one as the event's Before. Queued
+// events are chained first so the last one is on the log.
+func RecordConfig(ctx context.Context, log repository.AuditRepository, config any) error {
+	if _, err := Flush(ctx, log, Options{}); err != nil {
+		return err
+	}
+	configs, err := log.Find(ctx, repository.AuditQuery{Action: datamodels.AuditConfig})
+	if err != nil {
+		return err
+	}
+	event := datamodels.AuditEvent{Action: datamodels.AuditConfig, After: Snapshot(config)}
+	if len(configs) > 0 {
+		event.Before = configs[len(configs)-1].After
+	}
+	if event.Before == event.After {
+		return nil
+	}
+	return Record(ctx, log, event)
+}
+
+// ErrTampered is returned by Verify when the log is not the chain it wrote
+var ErrTampered = errors.New("audit: log has been tampered with")
+
+// Verify walks the whole log checking that its events are numbered without a
+// gap, that each holds the hash of the one before and hashes to its own hash,
+// and that the log ends at its head. It returns the number of events checked
+// and, for the first break in the chain, an error wrapping ErrTampered.
+func Verify(ctx context.Context, log repository.AuditRepository) (int64, error) {
+	// The head is read first so events appended while the log is read do
+	// not count as a log longer than its head
+	head, err := log.Head(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var last datamodels.AuditEvent
+	errStop := errors.New("stop")
+	err = log.ForEach(ctx, func(event datamodels.AuditEvent) error {
+		if event.Seq > head.Seq {
+			return errStop
+		}
+		switch {
+		case event.Seq != last.Seq+1:
+			return fmt.Errorf("event %d follows event %d: %w", event.Seq, last.Seq, ErrTampered)
+		case event.PrevHash != last.Hash:
+			return fmt.Errorf("event %d is not chained to event %d: %w", event.Seq, last.Seq, ErrTampered)
+		case event.Hash != event.ComputeHash():
+			return fmt.Errorf("event %d does not match its hash: %w", event.Seq, ErrTampered)
+		}
+		last = event
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStop) {
+		return last.Seq, err
+	}
+
+	if last.Seq != head.Seq || last.Hash != head.Hash {
+		return last.Seq, fmt.Errorf("log ends at event %d but its head is event %d: %w", last.Seq, head.Seq, ErrTampered)
+	}
+	return last.Seq, nil
+}
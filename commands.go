@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// command is a subcommand of the server binary, run as "server <name> [flags]"
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"gen":          {usage: "Generate deterministic mock users and transactions", run: runGen},
+	"migrate":      {usage: "Apply pending schema migrations", run: runMigrate},
+	"reconcile":    {usage: "Check balances against the transaction ledger", run: runReconcile},
+	"seed":         {usage: "Bulk load users and transactions from JSON files", run: runSeed},
+	"set-role":     {usage: "Change the role of a user, e.g. to make them an admin", run: runSetRole},
+	"verify-audit": {usage: "Check that the audit log has not been tampered with", run: runVerifyAudit},
+}
+
+func runCommand(name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		printCommands()
+		return fmt.Errorf("unknown command %q", name)
+	}
+	return cmd.run(args)
+}
+
+func printCommands() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println("Commands:")
+	for _, name := range names {
+		fmt.Printf("  %-12s %s\n", name, commands[name].usage)
+	}
+}
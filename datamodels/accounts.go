@@ -0,0 +1,35 @@
+package datamodels
+
+import "strconv"
+
+// Account types
+const (
+	AccountChecking = "checking"
+	AccountSavings  = "savings"
+)
+
+// AccountTypes lists the types an account can be opened with
+var AccountTypes = []string{AccountChecking, AccountSavings}
+
+type Account struct {
+	AccountNumber int64  `json:"account_number" bson:"account_number"` // Unique number of the account
+	UserID        int    `json:"user_id" bson:"user_id"`               // ID of the user owning the account
+	Type          string `json:"type" bson:"type"`                     // One of the account type constants
+	Balance       Money  `json:"balance" bson:"balance"`               // Ledger balance, its currency is the account's
+	Held          Money  `json:"held" bson:"held,omitempty"`           // Reserved by authorizations, see Available
+	Frozen        bool   `json:"frozen" bson:"frozen,omitempty"`       // Set by an admin, no money moves in or out while it is
+}
+
+// Available returns the part of the balance that is not held and can be spent
+func (a Account) Available() Money {
+	available, err := a.Balance.Sub(a.Held)
+	if err != nil {
+		return a.Balance
+	}
+	return available
+}
+
+// LedgerAccount returns the ledger account of a customer account
+func LedgerAccount(accountNumber int64) string {
+	return "account:" + strconv.FormatInt(accountNumber, 10)
+}
@@ -0,0 +1,66 @@
+package datamodels
+
+// AttemptCodeUnknown is the failure code of attempts refused for no known
+// reason, such as those recorded before codes existed
+const AttemptCodeUnknown = "UNKNOWN"
+
+// Attempt is a request to move money that was refused before anything was
+// posted. Attempts are kept apart from the ledger, which only holds
+// transactions that moved or hold money.
+type Attempt struct {
+	SenderID        int             `json:"sender_id" bson:"sender_id"`                                   // ID of the sender
+	SenderAccount   int64           `json:"sender_account,omitempty" bson:"sender_account,omitempty"`     // Account the money would have been taken from
+	Amount          Money           `json:"amount" bson:"amount"`                                         // Amount asked for, negative for withdrawals
+	ReceiverID      int             `json:"receiver_id" bson:"receiver_id"`                               // ID of the receiver
+	ReceiverAccount int64           `json:"receiver_account,omitempty" bson:"receiver_account,omitempty"` // Account the money would have been paid into
+	Remarks         string          `json:"remarks" bson:"remarks"`                                       // Description or notes about the transaction
+	DateTimeStamp   int64           `json:"dateTimeStamp" bson:"dateTimeStamp"`                           // When the server received the request
+	RequestedAt     int64           `json:"requested_at,omitempty" bson:"requested_at,omitempty"`         // The client's time when it was sent, for display only
+	Type            string          `json:"type" bson:"type,omitempty"`                                   // One of the Type constants
+	Postings        []Posting       `json:"postings,omitempty" bson:"postings,omitempty"`                 // The movement asked for, never applied
+	Schedule        *ScheduleRun    `json:"schedule,omitempty" bson:"schedule,omitempty"`                 // Set when made by a scheduled transfer
+	Risk            *RiskAssessment `json:"risk,omitempty" bson:"risk,omitempty"`                         // Set when the transfer was screened for fraud
+	Code            string          `json:"code" bson:"code"`                                             // Error code returned to the client
+	Message         string          `json:"message,omitempty" bson:"message,omitempty"`                   // Error message returned to the client
+}
+
+// AttemptOf records the refusal of t with the error code and message the
+// client was given
+func AttemptOf(t Transaction, code, message string) Attempt {
+	return Attempt{
+		SenderID:        t.SenderID,
+		SenderAccount:   t.SenderAccount,
+		Amount:          t.Amount,
+		ReceiverID:      t.ReceiverID,
+		ReceiverAccount: t.ReceiverAccount,
+		Remarks:         t.Remarks,
+		DateTimeStamp:   t.DateTimeStamp,
+		RequestedAt:     t.RequestedAt,
+		Type:            t.EffectiveType(),
+		Postings:        t.LedgerPostings(),
+		Schedule:        t.Schedule,
+		Risk:            t.Risk,
+		Code:            code,
+		Message:         message,
+	}
+}
+
+// Transaction returns the attempt as a failed transaction, for statements
+// that list attempts beside the ledger
+func (a Attempt) Transaction() Transaction {
+	return Transaction{
+		SenderID:        a.SenderID,
+		SenderAccount:   a.SenderAccount,
+		Amount:          a.Amount,
+		ReceiverID:      a.ReceiverID,
+		ReceiverAccount: a.ReceiverAccount,
+		Remarks:         a.Remarks,
+		DateTimeStamp:   a.DateTimeStamp,
+		RequestedAt:     a.RequestedAt,
+		Status:          StatusFailed,
+		Type:            a.Type,
+		Postings:        a.Postings,
+		Schedule:        a.Schedule,
+		Risk:            a.Risk,
+	}
+}
@@ -0,0 +1,64 @@
+package datamodels
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditFreeze            = "freeze_account"
+	AuditUnfreeze          = "unfreeze_account"
+	AuditAdjustBalance     = "adjust_balance"
+	AuditSetLimits         = "set_limits"
+	AuditApproveReview     = "approve_review"
+	AuditRejectReview      = "reject_review"
+	AuditSetRole           = "set_role"
+	AuditAccess            = "privileged_access" // A route used through the caller's role rather than as themselves
+	AuditLogin             = "login"
+	AuditLoginFailed       = "login_failed"
+	AuditTransaction       = "transaction"        // A transaction was recorded or changed status
+	AuditTransactionFailed = "transaction_failed" // An attempt that moved no money was recorded
+	AuditConfig            = "config"             // A server started with a configuration unlike the last one recorded
+)
+
+// AuditEvent records a login, a movement of money, an action taken through
+// the admin API, a change of configuration or a use of another user's data.
+// Events form a chain: each holds the hash of the one before it, so changing
+// or removing any event breaks every hash after it.
+type AuditEvent struct {
+	Seq           int64  `json:"seq" bson:"seq"`                                           // Position in the log, from 1
+	At            int64  `json:"at" bson:"at"`                                             // Unix time of the action
+	ActorID       int    `json:"actor_id" bson:"actor_id"`                                 // User ID of who acted, 0 for the server itself or a request without a token
+	Action        string `json:"action" bson:"action"`                                     // One of the Audit constants
+	IP            string `json:"ip,omitempty" bson:"ip,omitempty"`                         // Address the request came from
+	RequestID     string `json:"request_id,omitempty" bson:"request_id,omitempty"`         // ID of the request, as in its X-Request-ID header
+	UserID        int    `json:"user_id,omitempty" bson:"user_id,omitempty"`               // User acted on
+	AccountNumber int64  `json:"account_number,omitempty" bson:"account_number,omitempty"` // Account acted on
+	TransactionID int    `json:"transaction_id,omitempty" bson:"transaction_id,omitempty"` // Transaction made or decided
+	Reason        string `json:"reason,omitempty" bson:"reason,omitempty"`                 // Why, as given by the admin, or why an attempt failed
+	Detail        string `json:"detail,omitempty" bson:"detail,omitempty"`                 // What changed
+	Before        string `json:"before,omitempty" bson:"before,omitempty"`                 // JSON of the values changed, before the change
+	After         string `json:"after,omitempty" bson:"after,omitempty"`                   // JSON of the values changed, after the change
+	PrevHash      string `json:"prev_hash" bson:"prev_hash"`                               // Hash of the event before, empty for the first
+	Hash          string `json:"hash" bson:"hash"`                                         // ComputeHash of this event
+}
+
+// ComputeHash returns the hex SHA-256 of the event's JSON encoding without its
+// Hash. The encoding of a struct is stable, so the hash only changes with the
+// content of the event or the hash it is chained to.
+func (e AuditEvent) ComputeHash() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e) // Strings and integers always encode
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Chain makes e the event after head, the last event of the log or the zero
+// event if the log is empty, and seals it with its hash
+func (e *AuditEvent) Chain(head AuditEvent) {
+	e.Seq = head.Seq + 1
+	e.PrevHash = head.Hash
+	e.Hash = e.ComputeHash()
+}
@@ -0,0 +1,42 @@
+package datamodels
+
+import "time"
+
+// Windows over which the rolling transfer limits are counted
+const (
+	DailyWindow    = 24 * time.Hour
+	MonthlyWindow  = 30 * 24 * time.Hour
+	VelocityWindow = time.Hour
+)
+
+// CommittedStatuses are the statuses of transactions that moved or hold
+// money. Transfers are only stored as pending while held for review.
+var CommittedStatuses = append([]string{StatusPending, StatusAuthorized}, PostedStatuses...)
+
+// TransferLimits caps what a user can send to other users. Amounts are whole
+// units of the currency of the account the money comes from, totals count
+// each currency separately and a limit of 0 is no limit.
+type TransferLimits struct {
+	UserID   int   `json:"user_id,omitempty" bson:"user_id"`   // Set on limits stored for a single user
+	Single   int64 `json:"single" bson:"single,omitempty"`     // Largest single transfer
+	Daily    int64 `json:"daily" bson:"daily,omitempty"`       // Total sent over DailyWindow
+	Monthly  int64 `json:"monthly" bson:"monthly,omitempty"`   // Total sent over MonthlyWindow
+	Velocity int   `json:"velocity" bson:"velocity,omitempty"` // Number of transfers over VelocityWindow
+}
+
+// Override returns l with the limits set in o in place of its own
+func (l TransferLimits) Override(o TransferLimits) TransferLimits {
+	if o.Single != 0 {
+		l.Single = o.Single
+	}
+	if o.Daily != 0 {
+		l.Daily = o.Daily
+	}
+	if o.Monthly != 0 {
+		l.Monthly = o.Monthly
+	}
+	if o.Velocity != 0 {
+		l.Velocity = o.Velocity
+	}
+	return l
+}
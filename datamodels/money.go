@@ -0,0 +1,324 @@
+package datamodels
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// DefaultCurrency is the currency of amounts written before currencies
+// existed, which were whole dollars
+const DefaultCurrency = "USD"
+
+// Money errors
+var (
+	ErrOverflow         = errors.New("money: amount out of range")
+	ErrCurrencyMismatch = errors.New("money: currencies do not match")
+	ErrInvalidMoney     = errors.New("money: invalid amount")
+)
+
+// Money is an exact amount in a single currency. Amounts are counted in the
+// currency's minor units (cents for USD, yen for JPY) so no precision is lost.
+//
+// In JSON a Money is a plain number in major units, e.g. 12.34, read in
+// DefaultCurrency; {"amount": 12.34, "currency": "EUR"} selects another
+// currency. In BSON it is a {minor_units, currency} document, and legacy
+// numbers are read as whole units of DefaultCurrency.
+type Money struct {
+	Minor    int64  // Amount in minor units
+	Currency string // ISO 4217 code, "" only for the zero value
+}
+
+// NewMoney returns minor units of currency
+func NewMoney(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+// FromMajor returns amount whole units of currency
+func FromMajor(amount int64, currency string) (Money, error) {
+	scale, err := Scale(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	minor := amount
+	for range scale {
+		if minor > math.MaxInt64/10 || minor < math.MinInt64/10 {
+			return Money{}, ErrOverflow
+		}
+		minor *= 10
+	}
+	return Money{Minor: minor, Currency: currency}, nil
+}
+
+// ParseMoney parses a decimal amount in major units such as "-12.34". More
+// fraction digits than the currency has minor units are rejected rather than
+// rounded.
+func ParseMoney(s, currency string) (Money, error) {
+	scale, err := Scale(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	negative := strings.HasPrefix(s, "-")
+	whole, fraction, hasPoint := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	if whole == "" || (hasPoint && fraction == "") || len(fraction) > scale || !digits(whole) || !digits(fraction) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidMoney, s)
+	}
+	fraction += strings.Repeat("0", scale-len(fraction))
+
+	minor, err := strconv.ParseUint(whole+fraction, 10, 64)
+	if err != nil || minor > math.MaxInt64 {
+		return Money{}, ErrOverflow
+	}
+	if negative {
+		return Money{Minor: -int64(minor), Currency: currency}, nil
+	}
+	return Money{Minor: int64(minor), Currency: currency}, nil
+}
+
+func digits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Scale returns the number of minor unit digits of an ISO 4217 currency
+func Scale(code string) (int, error) {
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return 0, fmt.Errorf("%w: unknown currency %q", ErrInvalidMoney, code)
+	}
+	scale, _ := currency.Standard.Rounding(unit)
+	return scale, nil
+}
+
+// combine checks that m and o can be added, returning their common currency.
+// The zero value takes on the currency of the other operand.
+func (m Money) combine(o Money) (string, error) {
+	switch {
+	case m.Currency == o.Currency || o.Currency == "":
+		return m.Currency, nil
+	case m.Currency == "":
+		return o.Currency, nil
+	}
+	return "", fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+}
+
+// Add returns m + o
+func (m Money) Add(o Money) (Money, error) {
+	code, err := m.combine(o)
+	if err != nil {
+		return Money{}, err
+	}
+	sum := m.Minor + o.Minor
+	if (o.Minor > 0 && sum < m.Minor) || (o.Minor < 0 && sum > m.Minor) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Minor: sum, Currency: code}, nil
+}
+
+// Sub returns m - o
+func (m Money) Sub(o Money) (Money, error) {
+	negated, err := o.Neg()
+	if err != nil {
+		return Money{}, err
+	}
+	return m.Add(negated)
+}
+
+// Neg returns -m
+func (m Money) Neg() (Money, error) {
+	if m.Minor == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+	return Money{Minor: -m.Minor, Currency: m.Currency}, nil
+}
+
+// Abs returns the magnitude of m
+func (m Money) Abs() (Money, error) {
+	if m.Minor < 0 {
+		return m.Neg()
+	}
+	return m, nil
+}
+
+// Cmp compares m with o, which must be in the same currency, returning -1, 0 or +1
+func (m Money) Cmp(o Money) int {
+	switch {
+	case m.Minor < o.Minor:
+		return -1
+	case m.Minor > o.Minor:
+		return 1
+	}
+	return 0
+}
+
+// Sign returns -1, 0 or +1 depending on the sign of m
+func (m Money) Sign() int {
+	return m.Cmp(Money{})
+}
+
+// IsZero reports whether m is zero in any currency
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+// Decimal returns m in major units with every minor digit, e.g. "-12.30"
+func (m Money) Decimal() string {
+	scale, err := Scale(m.Currency)
+	if err != nil {
+		scale = 2
+	}
+
+	magnitude := strconv.FormatUint(absMinor(m.Minor), 10)
+	if len(magnitude) <= scale {
+		magnitude = strings.Repeat("0", scale-len(magnitude)+1) + magnitude
+	}
+
+	sign := ""
+	if m.Minor < 0 {
+		sign = "-"
+	}
+	if scale == 0 {
+		return sign + magnitude
+	}
+	point := len(magnitude) - scale
+	return sign + magnitude[:point] + "." + magnitude[point:]
+}
+
+// absMinor returns |minor| without overflowing on math.MinInt64
+func absMinor(minor int64) uint64 {
+	if minor < 0 {
+		return uint64(-(minor + 1)) + 1
+	}
+	return uint64(minor)
+}
+
+// String returns m as "12.34 USD"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// Format returns m as written in the given locale, e.g. "-$1,234.50" in
+// English or "-$1.234,50" in German
+func (m Money) Format(tag language.Tag) string {
+	unit, err := currency.ParseISO(m.Currency)
+	if err != nil {
+		return m.String()
+	}
+	p := message.NewPrinter(tag)
+
+	// Print the digits ourselves, number.Decimal goes through float64
+	whole, fraction, _ := strings.Cut(strings.TrimPrefix(m.Decimal(), "-"), ".")
+	wholeUnits, _ := strconv.ParseUint(whole, 10, 64)
+	formatted := p.Sprint(number.Decimal(wholeUnits))
+	if fraction != "" {
+		formatted += decimalSeparator(p) + fraction
+	}
+
+	sign := ""
+	if m.Minor < 0 {
+		sign = "-"
+	}
+	return sign + p.Sprint(currency.Symbol(unit)) + formatted
+}
+
+// decimalSeparator returns the decimal separator of the printer's locale
+func decimalSeparator(p *message.Printer) string {
+	half := p.Sprint(number.Decimal(0.5, number.Scale(1)))
+	return strings.TrimSuffix(strings.TrimPrefix(half, "0"), "5")
+}
+
+// jsonMoney is the explicit object form of Money in JSON
+type jsonMoney struct {
+	Amount   json.Number `json:"amount"`
+	Currency string      `json:"currency"`
+}
+
+// MarshalJSON writes m as a number in major units
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.Decimal()), nil
+}
+
+// UnmarshalJSON reads a number in major units of DefaultCurrency or an
+// {"amount", "currency"} object. Strings, fractions of a minor unit and
+// amounts out of range are rejected.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		return nil
+	}
+
+	amount, code := string(data), DefaultCurrency
+	if bytes.HasPrefix(data, []byte("{")) {
+		var object jsonMoney
+		if err := json.Unmarshal(data, &object); err != nil {
+			return err
+		}
+		amount, code = object.Amount.String(), object.Currency
+	}
+
+	parsed, err := ParseMoney(amount, code)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidMoney, data)
+	}
+	*m = parsed
+	return nil
+}
+
+// bsonMoney is the stored form of Money
+type bsonMoney struct {
+	Minor    int64  `bson:"minor_units"`
+	Currency string `bson:"currency"`
+}
+
+// MarshalBSONValue stores m as a {minor_units, currency} document
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(bsonMoney{Minor: m.Minor, Currency: m.Currency})
+}
+
+// UnmarshalBSONValue reads a {minor_units, currency} document, or a legacy
+// number of DefaultCurrency units
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	value := bson.RawValue{Type: t, Value: data}
+
+	switch t {
+	case bson.TypeEmbeddedDocument:
+		var stored bsonMoney
+		if err := value.Unmarshal(&stored); err != nil {
+			return err
+		}
+		*m = Money{Minor: stored.Minor, Currency: stored.Currency}
+		return nil
+	case bson.TypeNull:
+		*m = Money{}
+		return nil
+	case bson.TypeInt32, bson.TypeInt64:
+		legacy, err := FromMajor(value.AsInt64(), DefaultCurrency)
+		*m = legacy
+		return err
+	case bson.TypeDouble:
+		// Legacy doubles are rounded to the nearest cent
+		minor := math.Round(value.Double() * 100)
+		if math.IsNaN(minor) || minor >= math.MaxInt64 || minor < math.MinInt64 {
+			return ErrOverflow
+		}
+		*m = Money{Minor: int64(minor), Currency: DefaultCurrency}
+		return nil
+	}
+	return fmt.Errorf("%w: cannot decode %s into Money", ErrInvalidMoney, t)
+}
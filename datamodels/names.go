@@ -0,0 +1,108 @@
+package datamodels
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Results of comparing a name entered by a sender with the account holder's
+const (
+	NameMatch      = "match"       // Same name, ignoring case, spacing and punctuation
+	NameCloseMatch = "close-match" // Likely the holder: a typo, swapped or missing names, or an initial
+	NameNoMatch    = "no-match"
+)
+
+// FullName returns the name of the user as shown to others
+func (u User) FullName() string {
+	return strings.TrimSpace(u.FirstName + " " + u.LastName)
+}
+
+// MaskedName returns the first name and last initial of the user, e.g.
+// "Humberto B.", revealing enough to confirm a payee without disclosing the
+// full name
+func (u User) MaskedName() string {
+	first := strings.TrimSpace(u.FirstName)
+	last := []rune(strings.TrimSpace(u.LastName))
+	if len(last) == 0 {
+		return first
+	}
+	return strings.TrimSpace(first + " " + string(unicode.ToUpper(last[0])) + ".")
+}
+
+// nameWords returns the lower case words of a name with punctuation removed
+func nameWords(name string) []string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			return unicode.ToLower(r)
+		case unicode.IsSpace(r) || r == '-':
+			return ' '
+		}
+		return -1
+	}, name)
+	return strings.Fields(name)
+}
+
+// MatchName compares a name entered by a sender with the name of the account
+// holder and returns one of NameMatch, NameCloseMatch or NameNoMatch
+func MatchName(entered, holder string) string {
+	words, holderWords := nameWords(entered), nameWords(holder)
+	if len(words) == 0 || len(holderWords) == 0 {
+		return NameNoMatch
+	}
+
+	joined, holderJoined := strings.Join(words, " "), strings.Join(holderWords, " ")
+	if joined == holderJoined {
+		return NameMatch
+	}
+
+	// Names in another order, or only some of them
+	if containsAll(holderWords, words) {
+		return NameCloseMatch
+	}
+
+	// The first name with the initial of the last, e.g. "Humberto B"
+	last, holderLast := words[len(words)-1], holderWords[len(holderWords)-1]
+	if len(words) > 1 && len([]rune(last)) == 1 && words[0] == holderWords[0] && []rune(last)[0] == []rune(holderLast)[0] {
+		return NameCloseMatch
+	}
+
+	// A typo or two
+	if editDistance(joined, holderJoined) <= max(1, len([]rune(holderJoined))/8) {
+		return NameCloseMatch
+	}
+	return NameNoMatch
+}
+
+// containsAll reports whether every word of subset is one of words
+func containsAll(words, subset []string) bool {
+	for _, word := range subset {
+		if !slices.Contains(words, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
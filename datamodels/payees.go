@@ -0,0 +1,13 @@
+package datamodels
+
+// Payee is a recipient saved by a user so they can be paid without entering
+// their account number again
+type Payee struct {
+	PayeeID       int64  `json:"payee_id" bson:"payee_id"`             // Unique ID of the payee
+	UserID        int    `json:"user_id" bson:"user_id"`               // ID of the user who saved the payee
+	Name          string `json:"name" bson:"name"`                     // Name of the account holder as entered by the user
+	Nickname      string `json:"nickname,omitempty" bson:"nickname"`   // Optional label chosen by the user
+	AccountNumber int64  `json:"account_number" bson:"account_number"` // Account the payee is paid into
+	Verified      bool   `json:"verified" bson:"verified"`             // Whether Name matched the account holder when last checked
+	CreatedAt     int64  `json:"created_at" bson:"created_at"`         // Unix time the payee was saved
+}
@@ -0,0 +1,214 @@
+package datamodels
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// System accounts are the other side of money entering or leaving the bank
+const (
+	CashAccount       = "system:cash"        // Deposits and withdrawals
+	AdjustmentAccount = "system:adjustments" // Corrections written by reconciliation
+	FXAccount         = "system:fx"          // Currency exchange, one balance per currency
+	FeeAccount        = "system:fees"        // Fees charged to users
+)
+
+// Posting is one leg of a transaction against a single account. Amount is the
+// change to the account's balance: negative debits, positive credits.
+type Posting struct {
+	Account       string `json:"account" bson:"account"`                                   // LedgerAccount(number), UserAccount(id) or a system account
+	UserID        int    `json:"user_id,omitempty" bson:"user_id,omitempty"`               // Owner of the account, 0 for system accounts
+	AccountNumber int64  `json:"account_number,omitempty" bson:"account_number,omitempty"` // Customer account, 0 for system accounts
+	Amount        Money  `json:"amount" bson:"amount"`                                     // Signed change to the account's balance
+}
+
+// ErrUnbalanced is returned when a transaction's postings do not sum to zero
+var ErrUnbalanced = errors.New("postings do not sum to zero")
+
+// UserAccount returns the ledger account of a user, as used before users could
+// hold several accounts
+func UserAccount(userID int) string {
+	return "user:" + strconv.Itoa(userID)
+}
+
+// accountPosting posts amount to a customer account. Postings derived for
+// transactions that predate accounts only know the user.
+func accountPosting(account Account, amount Money) Posting {
+	name := LedgerAccount(account.AccountNumber)
+	if account.AccountNumber == 0 {
+		name = UserAccount(account.UserID)
+	}
+	return Posting{Account: name, UserID: account.UserID, AccountNumber: account.AccountNumber, Amount: amount}
+}
+
+// negated returns -amount. The only amount without a negation, math.MinInt64
+// minor units, negates to itself and is caught by CheckBalanced.
+func negated(amount Money) Money {
+	return Money{Minor: -amount.Minor, Currency: amount.Currency}
+}
+
+// TransferPostings moves a positive amount between two accounts, of the same
+// or of different users
+func TransferPostings(from, to Account, amount Money) []Posting {
+	return []Posting{
+		accountPosting(from, negated(amount)),
+		accountPosting(to, amount),
+	}
+}
+
+// CashPostings deposits a positive amount into, or withdraws a negative amount
+// from, the account against the cash account
+func CashPostings(account Account, amount Money) []Posting {
+	return []Posting{
+		{Account: CashAccount, Amount: negated(amount)},
+		accountPosting(account, amount),
+	}
+}
+
+// ConversionPostings moves a positive amount to an account holding another
+// currency. The fee is taken out of amount and the rest exchanged through the
+// FX account, so the postings of each currency balance.
+func ConversionPostings(from, to Account, amount, fee, converted Money) []Posting {
+	exchanged := Money{Minor: amount.Minor - fee.Minor, Currency: amount.Currency}
+
+	postings := []Posting{accountPosting(from, negated(amount))}
+	if !fee.IsZero() {
+		postings = append(postings, Posting{Account: FeeAccount, Amount: fee})
+	}
+	return append(postings,
+		Posting{Account: FXAccount, Amount: exchanged},
+		Posting{Account: FXAccount, Amount: negated(converted)},
+		accountPosting(to, converted),
+	)
+}
+
+// AdjustmentPostings corrects the account's ledger by amount against the adjustments account
+func AdjustmentPostings(account Account, amount Money) []Posting {
+	return []Posting{
+		{Account: AdjustmentAccount, Amount: negated(amount)},
+		accountPosting(account, amount),
+	}
+}
+
+// LedgerPostings returns the transaction's postings. Transactions written
+// before postings existed are interpreted from their sender, receiver and
+// amount: deposits and withdrawals move cash in or out of the receiving
+// account, anything else moves money from the sender's account.
+func (t Transaction) LedgerPostings() []Posting {
+	if len(t.Postings) > 0 {
+		return t.Postings
+	}
+	sender := Account{UserID: t.SenderID, AccountNumber: t.SenderAccount}
+	receiver := Account{UserID: t.ReceiverID, AccountNumber: t.ReceiverAccount}
+	switch t.EffectiveType() {
+	case TypeDeposit, TypeWithdrawal:
+		return CashPostings(receiver, t.Amount)
+	}
+	return TransferPostings(sender, receiver, t.Amount)
+}
+
+// CheckBalanced verifies the double-entry invariant: at least two non-zero
+// postings, whose amounts sum to zero in every currency
+func (t Transaction) CheckBalanced() error {
+	if len(t.Postings) < 2 {
+		return fmt.Errorf("transaction needs at least two postings, has %d", len(t.Postings))
+	}
+
+	sums := make(map[string]Money)
+	var currencies []string
+	for _, posting := range t.Postings {
+		if posting.Amount.IsZero() {
+			return fmt.Errorf("posting to %s has a zero amount", posting.Account)
+		}
+		currency := posting.Amount.Currency
+		if currency == "" {
+			return fmt.Errorf("posting to %s has no currency", posting.Account)
+		}
+		if _, seen := sums[currency]; !seen {
+			currencies = append(currencies, currency)
+		}
+
+		sum, err := sums[currency].Add(posting.Amount)
+		if err != nil {
+			return fmt.Errorf("posting to %s: %w", posting.Account, err)
+		}
+		sums[currency] = sum
+	}
+	for _, currency := range currencies {
+		if !sums[currency].IsZero() {
+			return fmt.Errorf("%w: off by %s", ErrUnbalanced, sums[currency])
+		}
+	}
+	return nil
+}
+
+// EffectOn returns how much the transaction changes the balances of userID if
+// it is posted. A transfer between the user's own accounts in two currencies
+// changes each balance in its own currency; the change in the currency of the
+// amount sent is returned.
+func (t Transaction) EffectOn(userID int) (Money, error) {
+	totals := make(map[string]Money)
+	var currencies []string
+	for _, posting := range t.LedgerPostings() {
+		if posting.UserID != userID {
+			continue
+		}
+		currency := posting.Amount.Currency
+		total, seen := totals[currency]
+		if !seen {
+			currencies = append(currencies, currency)
+		}
+		total, err := total.Add(posting.Amount)
+		if err != nil {
+			return Money{}, err
+		}
+		totals[currency] = total
+	}
+	switch len(currencies) {
+	case 0:
+		return Money{}, nil
+	case 1:
+		return totals[currencies[0]], nil
+	}
+	if effect, ok := totals[t.Amount.Currency]; ok {
+		return effect, nil
+	}
+	return Money{}, fmt.Errorf("%w: %s", ErrCurrencyMismatch, strings.Join(currencies, " and "))
+}
+
+// EffectOnAccount returns how much the transaction changes the balance of an
+// account if it is posted
+func (t Transaction) EffectOnAccount(accountNumber int64) (Money, error) {
+	var effect Money
+	for _, posting := range t.LedgerPostings() {
+		if posting.UserID != 0 && posting.AccountNumber == accountNumber {
+			var err error
+			if effect, err = effect.Add(posting.Amount); err != nil {
+				return Money{}, err
+			}
+		}
+	}
+	return effect, nil
+}
+
+// Involves reports whether any posting of the transaction touches userID
+func (t Transaction) Involves(userID int) bool {
+	for _, posting := range t.LedgerPostings() {
+		if posting.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// InvolvesAccount reports whether any posting of the transaction touches the account
+func (t Transaction) InvolvesAccount(accountNumber int64) bool {
+	for _, posting := range t.LedgerPostings() {
+		if posting.UserID != 0 && posting.AccountNumber == accountNumber {
+			return true
+		}
+	}
+	return false
+}
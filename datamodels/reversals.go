@@ -0,0 +1,55 @@
+package datamodels
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Reasons a transaction cannot be reversed
+var (
+	ErrNotReversible     = errors.New("transaction: only settled transfers can be reversed")
+	ErrReversalTooLarge  = errors.New("transaction: reversals would exceed the amount of the transfer")
+	ErrPartialConversion = errors.New("transaction: transfers between currencies can only be reversed in full")
+)
+
+// Reversible returns how much of the transaction has not been reversed yet
+func (t Transaction) Reversible() Money {
+	remaining, err := t.Amount.Sub(t.ReversedAmount)
+	if err != nil {
+		return Money{Currency: t.Amount.Currency}
+	}
+	return remaining
+}
+
+// ReversalPostings returns the postings that give amount of a settled
+// transfer back to its sender. A full reversal undoes every posting of the
+// transfer, fees and conversions included. A partial one moves amount from
+// the receiver's account to the sender's, so is only possible when both hold
+// the currency of the transfer.
+func (t Transaction) ReversalPostings(amount Money) ([]Posting, error) {
+	if !t.CanTransition(StatusReversed) || t.EffectiveType() != TypeTransfer {
+		return nil, ErrNotReversible
+	}
+	if amount.Sign() <= 0 || amount.Currency != t.Amount.Currency {
+		return nil, fmt.Errorf("%w: reversing %s of %s", ErrInvalidMoney, amount, t.Amount)
+	}
+	if t.Reversible().Cmp(amount) < 0 {
+		return nil, fmt.Errorf("%w: %s of %s remains", ErrReversalTooLarge, t.Reversible(), t.Amount)
+	}
+
+	if t.ReversedAmount.IsZero() && amount == t.Amount {
+		var postings []Posting
+		for _, posting := range t.LedgerPostings() {
+			posting.Amount = negated(posting.Amount)
+			postings = append(postings, posting)
+		}
+		return postings, nil
+	}
+
+	if t.FX != nil {
+		return nil, ErrPartialConversion
+	}
+	sender := Account{UserID: t.SenderID, AccountNumber: t.SenderAccount}
+	receiver := Account{UserID: t.ReceiverID, AccountNumber: t.ReceiverAccount}
+	return TransferPostings(receiver, sender, amount), nil
+}
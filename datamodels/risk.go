@@ -0,0 +1,32 @@
+package datamodels
+
+// Risk decisions, from weakest to strongest
+const (
+	RiskAllow  = "allow"  // The transfer goes ahead
+	RiskReview = "review" // The transfer is held as pending until an admin decides
+	RiskDeny   = "deny"   // The transfer is refused
+)
+
+// riskStrength orders the risk decisions
+var riskStrength = map[string]int{RiskAllow: 0, RiskReview: 1, RiskDeny: 2}
+
+// RiskAssessment records why a transfer was allowed, held for review or denied
+type RiskAssessment struct {
+	Decision string       `json:"decision" bson:"decision"`                   // The strongest decision of any rule
+	Reasons  []RiskReason `json:"reasons,omitempty" bson:"reasons,omitempty"` // The rules that did not simply allow the transfer
+}
+
+// RiskReason is the decision of a single rule on a transfer
+type RiskReason struct {
+	Rule     string `json:"rule" bson:"rule"`
+	Decision string `json:"decision" bson:"decision"`
+	Detail   string `json:"detail" bson:"detail"`
+}
+
+// Add records reason and makes its decision the assessment's if it is stronger
+func (a *RiskAssessment) Add(reason RiskReason) {
+	a.Reasons = append(a.Reasons, reason)
+	if a.Decision == "" || riskStrength[reason.Decision] > riskStrength[a.Decision] {
+		a.Decision = reason.Decision
+	}
+}
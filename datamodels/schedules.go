@@ -0,0 +1,83 @@
+package datamodels
+
+import "time"
+
+// Scheduled transfer frequencies
+const (
+	FrequencyOnce    = "once"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+)
+
+// Frequencies lists the frequencies a transfer can be scheduled with
+var Frequencies = []string{FrequencyOnce, FrequencyWeekly, FrequencyMonthly}
+
+// Scheduled transfer statuses
+const (
+	ScheduleActive    = "active"    // Has occurrences left to run
+	ScheduleCompleted = "completed" // Ran its last occurrence
+	ScheduleCancelled = "cancelled" // Cancelled by the user
+)
+
+// ScheduledTransfer is a transfer to be made at a later time, once or
+// repeatedly. Occurrence n falls n weeks or months after StartAt, on the same
+// day of the month or the last day of shorter months.
+type ScheduledTransfer struct {
+	ScheduleID    int64  `json:"schedule_id" bson:"schedule_id"`       // Unique ID of the schedule
+	UserID        int    `json:"user_id" bson:"user_id"`               // ID of the sender
+	FromAccount   int64  `json:"from_account" bson:"from_account"`     // Account the money is taken from
+	AccountNumber int64  `json:"account_number" bson:"account_number"` // Account the money is paid into
+	Amount        Money  `json:"amount" bson:"amount"`                 // Amount of every occurrence, in the currency of FromAccount
+	Remarks       string `json:"remarks" bson:"remarks"`               // Remarks of the transactions made
+	Frequency     string `json:"frequency" bson:"frequency"`           // One of the Frequency constants
+	StartAt       int64  `json:"start_at" bson:"start_at"`             // Unix time of the first occurrence
+	EndAt         int64  `json:"end_at,omitempty" bson:"end_at"`       // Unix time after which no occurrence runs, 0 for none
+	Status        string `json:"status" bson:"status"`                 // One of the Schedule status constants
+	CreatedAt     int64  `json:"created_at" bson:"created_at"`         // Unix time the schedule was created
+
+	Occurrence int   `json:"occurrence" bson:"occurrence"`   // Index of the next occurrence to run
+	NextRunAt  int64 `json:"next_run_at" bson:"next_run_at"` // Unix time of that occurrence, 0 once the schedule has ended
+	Runs       int   `json:"runs" bson:"runs"`               // Number of occurrences run
+
+	LastRunAt   int64  `json:"last_run_at,omitempty" bson:"last_run_at,omitempty"`   // Unix time the last occurrence ran
+	LastStatus  string `json:"last_status,omitempty" bson:"last_status,omitempty"`   // Status of the transaction it made
+	LastMessage string `json:"last_message,omitempty" bson:"last_message,omitempty"` // Why it failed, or that it succeeded
+
+	LeaseOwner string `json:"-" bson:"lease_owner"` // Scheduler instance running an occurrence
+	LeaseUntil int64  `json:"-" bson:"lease_until"` // Unix time the lease expires, 0 if not leased
+}
+
+// OccurrenceAt returns the time of occurrence n
+func (s ScheduledTransfer) OccurrenceAt(n int) time.Time {
+	start := time.Unix(s.StartAt, 0).UTC()
+	switch s.Frequency {
+	case FrequencyWeekly:
+		return start.AddDate(0, 0, 7*n)
+	case FrequencyMonthly:
+		// Move to the first of the month first so that AddDate does not
+		// overflow into the month after, then clamp the day
+		first := time.Date(start.Year(), start.Month(), 1, start.Hour(), start.Minute(), start.Second(), 0, time.UTC).AddDate(0, n, 0)
+		last := first.AddDate(0, 1, -1).Day()
+		return first.AddDate(0, 0, min(start.Day(), last)-1)
+	}
+	return start
+}
+
+// Advance moves the schedule past occurrence Occurrence, skipping any
+// occurrences already due at now so that missed ones are not all made at
+// once. The schedule is completed when no occurrence is left.
+func (s *ScheduledTransfer) Advance(now time.Time) {
+	next := s.Occurrence + 1
+	for s.Frequency != FrequencyOnce && !s.OccurrenceAt(next).After(now) {
+		next++
+	}
+
+	at := s.OccurrenceAt(next)
+	if s.Frequency == FrequencyOnce || (s.EndAt != 0 && at.Unix() > s.EndAt) {
+		s.Status = ScheduleCompleted
+		s.NextRunAt = 0
+		return
+	}
+	s.Occurrence = next
+	s.NextRunAt = at.Unix()
+}
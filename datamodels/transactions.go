@@ -1,11 +1,134 @@
 package datamodels
 
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Transaction statuses. A transaction starts pending and moves through the
+// states allowed by CanTransition.
+const (
+	StatusPending    = "pending"    // Received, not yet authorized or settled, or held for review
+	StatusAuthorized = "authorized" // Its amount is held on the sender's account
+	StatusSettled    = "settled"    // Posted, the balances were changed
+	StatusReversed   = "reversed"   // Posted, then undone by a later transaction
+	StatusFailed     = "failed"     // Rejected, voided or expired, no balance was changed
+	StatusSuccess    = "success"    // Posted by the API before transactions settled
+	StatusCompleted  = "completed"  // Posted, as written by the mock data generators
+)
+
+// Transaction types
+const (
+	TypeTransfer   = "transfer"   // Between two users
+	TypeDeposit    = "deposit"    // Cash into a user's account
+	TypeWithdrawal = "withdrawal" // Cash out of a user's account
+	TypeAdjustment = "adjustment" // Ledger correction written by reconciliation
+	TypeReversal   = "reversal"   // Returns all or part of a transfer to its sender
+)
+
+// PostedStatuses are the statuses of transactions that moved money
+var PostedStatuses = []string{StatusSettled, StatusReversed, StatusSuccess, StatusCompleted}
+
+// transitions lists the statuses each status may move to. Failed and
+// reversed transactions are final.
+var transitions = map[string][]string{
+	StatusPending:    {StatusAuthorized, StatusSettled, StatusFailed},
+	StatusAuthorized: {StatusSettled, StatusFailed},
+	StatusSettled:    {StatusReversed},
+	StatusSuccess:    {StatusReversed},
+	StatusCompleted:  {StatusReversed},
+}
+
+// ErrInvalidTransition is returned when a transaction cannot move to a status
+var ErrInvalidTransition = errors.New("transaction: invalid status transition")
+
+// Reasons a hold was released
+const (
+	HoldCaptured = "captured" // The authorization settled
+	HoldVoided   = "voided"   // The authorization was cancelled
+	HoldExpired  = "expired"  // Nobody captured it before it expired
+	HoldApproved = "approved" // An admin let the transfer held for review settle
+	HoldRejected = "rejected" // An admin refused the transfer held for review
+)
+
 type Transaction struct {
-	TransactionID int    `json:"transaction_id" bson:"transaction_id"` // Unique ID for the transaction
-	SenderID      int    `json:"sender_id" bson:"sender_id"`           // ID of the sender
-	Amount        int    `json:"amount" bson:"amount"`                 // Transaction amount, can be negative for withdrawal
-	ReceiverID    int    `json:"receiver_id" bson:"receiver_id"`       // ID of the receiver
-	Remarks       string `json:"remarks" bson:"remarks"`               // Description or notes about the transaction
-	DateTimeStamp int64  `json:"dateTimeStamp" bson:"dateTimeStamp"`   // Timestamp for the transaction
-	Status        string `json:"status" bson:"status"`                 // Status of the transaction, e.g., completed
+	TransactionID   int             `json:"transaction_id" bson:"transaction_id"`                         // Unique ID for the transaction
+	SenderID        int             `json:"sender_id" bson:"sender_id"`                                   // ID of the sender
+	SenderAccount   int64           `json:"sender_account,omitempty" bson:"sender_account,omitempty"`     // Account the money is taken from
+	Amount          Money           `json:"amount" bson:"amount"`                                         // Transaction amount, can be negative for withdrawal
+	ReceiverID      int             `json:"receiver_id" bson:"receiver_id"`                               // ID of the receiver
+	ReceiverAccount int64           `json:"receiver_account,omitempty" bson:"receiver_account,omitempty"` // Account the money is paid into
+	Remarks         string          `json:"remarks" bson:"remarks"`                                       // Description or notes about the transaction
+	DateTimeStamp   int64           `json:"dateTimeStamp" bson:"dateTimeStamp"`                           // When the server received the transaction
+	RequestedAt     int64           `json:"requested_at,omitempty" bson:"requested_at,omitempty"`         // The client's time when it was sent, for display only
+	Status          string          `json:"status" bson:"status"`                                         // Status of the transaction, e.g., completed
+	Type            string          `json:"type" bson:"type,omitempty"`                                   // One of the Type constants, see EffectiveType
+	Postings        []Posting       `json:"postings,omitempty" bson:"postings,omitempty"`                 // Balanced debits and credits, see LedgerPostings
+	FX              *Conversion     `json:"fx,omitempty" bson:"fx,omitempty"`                             // Set when the receiver's account is in another currency
+	Schedule        *ScheduleRun    `json:"schedule,omitempty" bson:"schedule,omitempty"`                 // Set when made by a scheduled transfer
+	Hold            *Hold           `json:"hold,omitempty" bson:"hold,omitempty"`                         // Set on authorizations
+	ReversalOf      int             `json:"reversal_of,omitempty" bson:"reversal_of,omitempty"`           // Transaction ID of the transfer a reversal returns
+	Reversals       []int           `json:"reversals,omitempty" bson:"reversals,omitempty"`               // Transaction IDs of the reversals of a transfer
+	ReversedAmount  Money           `json:"reversed_amount" bson:"reversed_amount,omitempty"`             // Sum of the reversals, in the currency of Amount
+	Risk            *RiskAssessment `json:"risk,omitempty" bson:"risk,omitempty"`                         // Set when the transfer was screened for fraud
+}
+
+// Hold is the part of the sender's available balance an authorization
+// reserves until it is captured, voided or expires
+type Hold struct {
+	AccountNumber int64  `json:"account_number" bson:"account_number"`
+	Amount        Money  `json:"amount" bson:"amount"`
+	ExpiresAt     int64  `json:"expires_at" bson:"expires_at"`                 // Released by the expiry worker after this
+	Released      string `json:"released,omitempty" bson:"released,omitempty"` // One of the Hold constants once released
+}
+
+// ScheduleRun identifies the occurrence of a scheduled transfer that made a
+// transaction. Each occurrence makes at most one transaction.
+type ScheduleRun struct {
+	ScheduleID int64 `json:"schedule_id" bson:"schedule_id"`
+	Occurrence int   `json:"occurrence" bson:"occurrence"`
+}
+
+// Conversion records how a transfer between accounts in different currencies
+// was converted. Amount is debited from the sender, Fee is kept by the bank
+// and the rest is converted at Rate into Converted for the receiver.
+type Conversion struct {
+	Rate      string `json:"rate" bson:"rate"`                  // Units of the receiver's currency per unit of the sender's
+	Fee       Money  `json:"fee" bson:"fee"`                    // In the sender's currency
+	Converted Money  `json:"converted_amount" bson:"converted"` // Credited to the receiver
+}
+
+// IsPosted reports whether the transaction moved money
+func (t Transaction) IsPosted() bool {
+	return slices.Contains(PostedStatuses, t.Status)
+}
+
+// CanTransition reports whether the transaction may move to status
+func (t Transaction) CanTransition(status string) bool {
+	return slices.Contains(transitions[t.Status], status)
+}
+
+// Transition moves the transaction to status, or returns ErrInvalidTransition
+func (t *Transaction) Transition(status string) error {
+	if !t.CanTransition(status) {
+		return fmt.Errorf("%w from %s to %s", ErrInvalidTransition, t.Status, status)
+	}
+	t.Status = status
+	return nil
+}
+
+// EffectiveType returns the transaction's type. Transactions written before
+// types existed are deposits or withdrawals if sender and receiver are the
+// same, depending on the sign of the amount, and transfers otherwise.
+func (t Transaction) EffectiveType() string {
+	switch {
+	case t.Type != "":
+		return t.Type
+	case t.SenderID != t.ReceiverID || t.SenderAccount != t.ReceiverAccount:
+		return TypeTransfer
+	case t.Amount.Sign() < 0:
+		return TypeWithdrawal
+	}
+	return TypeDeposit
 }
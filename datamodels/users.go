@@ -1,11 +1,30 @@
 package datamodels
 
+// User roles
+const (
+	RoleCustomer = "customer" // Uses the bank through its own accounts
+	RoleSupport  = "support"  // Helps customers, can read their statements
+	RoleAuditor  = "auditor"  // Reviews the bank, can read statements and the audit log
+	RoleAdmin    = "admin"    // Manages users and accounts through the /admin API
+)
+
+// Roles lists every role
+var Roles = []string{RoleCustomer, RoleSupport, RoleAuditor, RoleAdmin}
+
 type User struct {
-	UserID        int    `json:"user_id" bson:"user_id"`                 // Unique ID for the user
-	FirstName     string `json:"first_name" bson:"first_name"`           // First name of the user
-	LastName      string `json:"last_name" bson:"last_name"`             // Last name of the user
-	Email         string `json:"email" bson:"email"`                     // Email of the user
-	Balance       int    `json:"current_balance" bson:"current_balance"` // Current balance of the user
-	PassHash      string `json:"password" bson:"password"`               // Hash of the user's password
-	AccountNumber int64  `json:"account_number" bson:"account_number"`   // Account number of the user
+	UserID        int    `json:"user_id" bson:"user_id"`               // Unique ID for the user
+	FirstName     string `json:"first_name" bson:"first_name"`         // First name of the user
+	LastName      string `json:"last_name" bson:"last_name"`           // Last name of the user
+	Email         string `json:"email" bson:"email"`                   // Email of the user
+	PassHash      string `json:"password" bson:"password"`             // Hash of the user's password
+	AccountNumber int64  `json:"account_number" bson:"account_number"` // Primary account, used when a request names no other
+	Role          string `json:"role,omitempty" bson:"role,omitempty"` // One of the Role constants, see EffectiveRole
+}
+
+// EffectiveRole returns the user's role. Users stored without one are customers.
+func (u User) EffectiveRole() string {
+	if u.Role == "" {
+		return RoleCustomer
+	}
+	return u.Role
 }
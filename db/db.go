@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"log"
+	"os"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
@@ -11,11 +12,23 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
+// DatabaseName is the database holding the bank's collections
+const DatabaseName = "bank"
+
+// defaultURI points at the three routers started by scripts/main.sh
+const defaultURI = "mongodb://localhost:27151,localhost:27152,localhost:27153"
+
 var client *mongo.Client
 
 func connect() {
+	// The MONGODB_URI environment variable overrides the local cluster
+	uri := os.Getenv("MONGODB_URI")
+	if uri == "" {
+		uri = defaultURI
+	}
+
 	// Configure connection pool settings
-	clientOptions := options.Client().ApplyURI("mongodb://localhost:27151,localhost:27152,localhost:27153").
+	clientOptions := options.Client().ApplyURI(uri).
 		SetMaxPoolSize(30000).
 		SetMinPoolSize(10).
 		SetMaxConnIdleTime(5 * time.Minute).
@@ -42,3 +55,8 @@ func GetClient() *mongo.Client {
 	}
 	return client
 }
+
+// GetDatabase returns the bank database
+func GetDatabase() *mongo.Database {
+	return GetClient().Database(DatabaseName)
+}
@@ -0,0 +1,1097 @@
+package db
+
+import (
+	"context"
+	"cse512/datamodels"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// migrationsCollection records which migrations have been applied
+const migrationsCollection = "schema_migrations"
+
+// Migration is a versioned, idempotent change to the database schema
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, database *mongo.Database) error
+}
+
+// MigrationRecord is stored in schema_migrations once a migration has been applied
+type MigrationRecord struct {
+	Version     int       `bson:"version"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+// migrations lists every migration in version order. Never edit or reorder an
+// applied migration, append a new one instead.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create users and transactions collections with validators",
+		Up:          createCollections,
+	},
+	{
+		Version:     2,
+		Description: "create users and transactions indexes",
+		Up:          createIndexes,
+	},
+	{
+		Version:     3,
+		Description: "create unique transaction_id index for bulk loads",
+		Up:          createTransactionIDIndex,
+	},
+	{
+		Version:     4,
+		Description: "backfill double-entry postings on transactions",
+		Up:          BackfillPostings,
+	},
+	{
+		Version:     5,
+		Description: "backfill transaction types",
+		Up:          BackfillTypes,
+	},
+	{
+		Version:     6,
+		Description: "store balances and amounts as money documents",
+		Up:          migrateMoney,
+	},
+	{
+		Version:     7,
+		Description: "move balances into an accounts collection",
+		Up:          migrateAccounts,
+	},
+	{
+		Version:     8,
+		Description: "create the payees collection",
+		Up:          createPayees,
+	},
+	{
+		Version:     9,
+		Description: "create the scheduled_transfers collection",
+		Up:          createScheduledTransfers,
+	},
+	{
+		Version:     10,
+		Description: "index authorizations by when their hold expires",
+		Up:          createHoldExpiryIndex,
+	},
+	{
+		Version:     11,
+		Description: "create the transfer_limits collection",
+		Up:          createTransferLimits,
+	},
+	{
+		Version:     12,
+		Description: "index transfers by receiving account and those held for review",
+		Up:          createRiskIndexes,
+	},
+	{
+		Version:     13,
+		Description: "create the audit_events collection",
+		Up:          createAuditEvents,
+	},
+	{
+		Version:     14,
+		Description: "chain the audit events by hash",
+		Up:          chainAuditEvents,
+	},
+	{
+		Version:     15,
+		Description: "move failed attempts out of the transactions into transaction_attempts",
+		Up:          migrateAttempts,
+	},
+	{
+		Version:     16,
+		Description: "create the audit_outbox collection of events waiting to be chained",
+		Up:          createAuditOutbox,
+	},
+}
+
+// Migrate applies every pending migration to database in version order and
+// returns the ones it applied. It is safe to run from several server instances
+// at once since every migration is idempotent.
+func Migrate(ctx context.Context, database *mongo.Database) ([]Migration, error) {
+	applied, err := appliedVersions(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, migration := range migrations {
+		if applied[migration.Version] {
+			continue
+		}
+
+		if err := migration.Up(ctx, database); err != nil {
+			return ran, fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Description, err)
+		}
+
+		record := MigrationRecord{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now().UTC(),
+		}
+		_, err := database.Collection(migrationsCollection).InsertOne(ctx, record)
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return ran, fmt.Errorf("recording migration %d: %w", migration.Version, err)
+		}
+		ran = append(ran, migration)
+	}
+
+	return ran, nil
+}
+
+// MigrationStatus returns every known migration and the record of when it was
+// applied, or nil if it is pending
+func MigrationStatus(ctx context.Context, database *mongo.Database) ([]Migration, []*MigrationRecord, error) {
+	cursor, err := database.Collection(migrationsCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, nil, err
+	}
+	var records []MigrationRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, nil, err
+	}
+
+	byVersion := make(map[int]*MigrationRecord, len(records))
+	for i := range records {
+		byVersion[records[i].Version] = &records[i]
+	}
+
+	status := make([]*MigrationRecord, len(migrations))
+	for i, migration := range migrations {
+		status[i] = byVersion[migration.Version]
+	}
+	return migrations, status, nil
+}
+
+func appliedVersions(ctx context.Context, database *mongo.Database) (map[int]bool, error) {
+	collection := database.Collection(migrationsCollection)
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []MigrationRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]bool, len(records))
+	for _, record := range records {
+		applied[record.Version] = true
+	}
+	return applied, nil
+}
+
+// ensureCollection creates the collection with validator, or replaces the
+// validator if the collection already exists. Existing documents that do not
+// match are left alone (moderate validation) so legacy data keeps working.
+func ensureCollection(ctx context.Context, database *mongo.Database, name string, validator bson.M) error {
+	err := database.CreateCollection(ctx, name, options.CreateCollection().
+		SetValidator(validator).
+		SetValidationLevel("moderate"))
+
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && commandErr.Name == "NamespaceExists" {
+		return database.RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: name},
+			{Key: "validator", Value: validator},
+			{Key: "validationLevel", Value: "moderate"},
+		}).Err()
+	}
+	return err
+}
+
+// ensureUniqueIndex creates a unique index, falling back to a plain index when
+// the server refuses because the collection is sharded on another key
+func ensureUniqueIndex(ctx context.Context, collection *mongo.Collection, keys bson.D) error {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    keys,
+		Options: options.Index().SetUnique(true),
+	})
+
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && commandErr.Code == 67 { // CannotCreateIndex
+		log.Printf("Cannot create unique index %v on sharded collection %s, creating a non-unique index instead: %v\n", keys, collection.Name(), err)
+		_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: keys})
+	}
+	return err
+}
+
+func createCollections(ctx context.Context, database *mongo.Database) error {
+	integer := bson.M{"bsonType": bson.A{"int", "long"}}
+	number := bson.M{"bsonType": bson.A{"int", "long", "double", "decimal"}}
+	str := bson.M{"bsonType": "string"}
+
+	users := bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"user_id", "email", "password", "current_balance", "account_number"},
+		"properties": bson.M{
+			"user_id":         integer,
+			"first_name":      str,
+			"last_name":       str,
+			"email":           str,
+			"password":        str,
+			"current_balance": number,
+			"account_number":  integer,
+		},
+	}}
+	if err := ensureCollection(ctx, database, "users", users); err != nil {
+		return err
+	}
+
+	transactions := bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"sender_id", "receiver_id", "amount", "dateTimeStamp", "status"},
+		"properties": bson.M{
+			"transaction_id": integer,
+			"sender_id":      integer,
+			"receiver_id":    integer,
+			"amount":         number,
+			"remarks":        str,
+			"dateTimeStamp":  number,
+			"status":         str,
+		},
+	}}
+	return ensureCollection(ctx, database, "transactions", transactions)
+}
+
+func createIndexes(ctx context.Context, database *mongo.Database) error {
+	users := database.Collection("users")
+	for _, key := range []string{"user_id", "account_number", "email"} {
+		if err := ensureUniqueIndex(ctx, users, bson.D{{Key: key, Value: 1}}); err != nil {
+			return err
+		}
+	}
+
+	// Serve the $or over sender and receiver combined with the dateTimeStamp
+	// range and sort used by /transactions and /monthdata
+	_, err := database.Collection("transactions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "sender_id", Value: 1}, {Key: "dateTimeStamp", Value: 1}}},
+		{Keys: bson.D{{Key: "receiver_id", Value: 1}, {Key: "dateTimeStamp", Value: 1}}},
+	})
+	return err
+}
+
+// createTransactionIDIndex lets a resumed bulk load skip transactions it already
+// inserted. Transactions created through the API have no transaction_id.
+func createTransactionIDIndex(ctx context.Context, database *mongo.Database) error {
+	collection := database.Collection("transactions")
+	keys := bson.D{{Key: "transaction_id", Value: 1}}
+	partial := bson.M{"transaction_id": bson.M{"$gt": 0}}
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    keys,
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(partial),
+	})
+
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && commandErr.Code == 67 { // CannotCreateIndex
+		log.Printf("Cannot create unique index %v on sharded collection %s, creating a non-unique index instead: %v\n", keys, collection.Name(), err)
+		_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    keys,
+			Options: options.Index().SetPartialFilterExpression(partial),
+		})
+	}
+	return err
+}
+
+// BackfillPostings gives every transaction without postings, such as those
+// written before postings existed or imported through Compass, the postings
+// datamodels.Transaction.LedgerPostings derives for it, then indexes them for
+// the per-user views
+func BackfillPostings(ctx context.Context, database *mongo.Database) error {
+	collection := database.Collection("transactions")
+
+	userAccount := func(field string) bson.M {
+		return bson.M{"$concat": bson.A{"user:", bson.M{"$toString": field}}}
+	}
+	negated := bson.M{"$multiply": bson.A{"$amount", -1}}
+
+	postings := bson.M{"$cond": bson.A{
+		bson.M{"$eq": bson.A{"$sender_id", "$receiver_id"}},
+		// Deposit or withdrawal against the cash account
+		bson.A{
+			bson.M{"account": datamodels.CashAccount, "amount": negated},
+			bson.M{"account": userAccount("$sender_id"), "user_id": "$sender_id", "amount": "$amount"},
+		},
+		// Transfer from sender to receiver
+		bson.A{
+			bson.M{"account": userAccount("$sender_id"), "user_id": "$sender_id", "amount": negated},
+			bson.M{"account": userAccount("$receiver_id"), "user_id": "$receiver_id", "amount": "$amount"},
+		},
+	}}
+
+	_, err := collection.UpdateMany(ctx,
+		bson.M{"postings": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"postings": postings}}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "postings.user_id", Value: 1}, {Key: "dateTimeStamp", Value: 1}},
+	})
+	return err
+}
+
+// BackfillTypes sets the type datamodels.Transaction.EffectiveType derives on
+// every transaction without one
+func BackfillTypes(ctx context.Context, database *mongo.Database) error {
+	transactionType := bson.M{"$switch": bson.M{
+		"branches": bson.A{
+			bson.M{"case": bson.M{"$ne": bson.A{"$sender_id", "$receiver_id"}}, "then": datamodels.TypeTransfer},
+			bson.M{"case": bson.M{"$lt": bson.A{"$amount", 0}}, "then": datamodels.TypeWithdrawal},
+		},
+		"default": datamodels.TypeDeposit,
+	}}
+
+	_, err := database.Collection("transactions").UpdateMany(ctx,
+		bson.M{"type": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"type": transactionType}}}},
+	)
+	return err
+}
+
+// moneyFromNumber converts a legacy number of whole dollars at field into a
+// datamodels.Money document, leaving money documents as they are
+func moneyFromNumber(field string) bson.M {
+	return bson.M{"$cond": bson.A{
+		bson.M{"$isNumber": field},
+		bson.M{
+			"minor_units": bson.M{"$toLong": bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{field, 100}}, 0}}},
+			"currency":    datamodels.DefaultCurrency,
+		},
+		field,
+	}}
+}
+
+// BackfillMoney converts the numeric balances and amounts of documents written
+// before datamodels.Money, or imported through Compass, into money documents.
+// It must run after BackfillPostings and BackfillTypes, which read numeric amounts.
+func BackfillMoney(ctx context.Context, database *mongo.Database) error {
+	_, err := database.Collection("users").UpdateMany(ctx,
+		bson.M{"current_balance": bson.M{"$type": "number"}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"current_balance": moneyFromNumber("$current_balance")}}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	postings := bson.M{"$cond": bson.A{
+		bson.M{"$isArray": "$postings"},
+		bson.M{"$map": bson.M{
+			"input": "$postings",
+			"as":    "posting",
+			"in": bson.M{"$mergeObjects": bson.A{
+				"$$posting",
+				bson.M{"amount": moneyFromNumber("$$posting.amount")},
+			}},
+		}},
+		"$$REMOVE",
+	}}
+
+	_, err = database.Collection("transactions").UpdateMany(ctx,
+		bson.M{"$or": bson.A{
+			bson.M{"amount": bson.M{"$type": "number"}},
+			bson.M{"postings.amount": bson.M{"$type": "number"}},
+		}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"amount":   moneyFromNumber("$amount"),
+			"postings": postings,
+		}}}},
+	)
+	return err
+}
+
+// migrateMoney converts existing documents to money and requires it of new ones
+func migrateMoney(ctx context.Context, database *mongo.Database) error {
+	if err := BackfillMoney(ctx, database); err != nil {
+		return err
+	}
+
+	integer := bson.M{"bsonType": bson.A{"int", "long"}}
+	number := bson.M{"bsonType": bson.A{"int", "long", "double", "decimal"}}
+	str := bson.M{"bsonType": "string"}
+	// Legacy numbers are still accepted so Compass imports work, see BackfillMoney
+	money := bson.M{"anyOf": bson.A{
+		number,
+		bson.M{
+			"bsonType": "object",
+			"required": bson.A{"minor_units", "currency"},
+			"properties": bson.M{
+				"minor_units": bson.M{"bsonType": "long"},
+				"currency":    bson.M{"bsonType": "string", "pattern": "^[A-Z]{3}$"},
+			},
+		},
+	}}
+
+	users := bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"user_id", "email", "password", "current_balance", "account_number"},
+		"properties": bson.M{
+			"user_id":         integer,
+			"first_name":      str,
+			"last_name":       str,
+			"email":           str,
+			"password":        str,
+			"current_balance": money,
+			"account_number":  integer,
+		},
+	}}
+	if err := ensureCollection(ctx, database, "users", users); err != nil {
+		return err
+	}
+
+	transactions := bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"sender_id", "receiver_id", "amount", "dateTimeStamp", "status"},
+		"properties": bson.M{
+			"transaction_id": integer,
+			"sender_id":      integer,
+			"receiver_id":    integer,
+			"amount":         money,
+			"remarks":        str,
+			"dateTimeStamp":  number,
+			"status":         str,
+		},
+	}}
+	return ensureCollection(ctx, database, "transactions", transactions)
+}
+
+// accountsBatchSize is the number of users handled per bulk write by BackfillAccounts
+const accountsBatchSize = 500
+
+// BackfillAccounts opens a checking account for every user that still has a
+// current_balance, numbered with the user's account_number and holding the
+// balance, then removes the balance from the user. The postings, and sender
+// and receiver accounts, of transactions that only name users are pointed at
+// those accounts. It must run after BackfillMoney.
+func BackfillAccounts(ctx context.Context, database *mongo.Database) error {
+	users := database.Collection("users")
+	accounts := database.Collection("accounts")
+	transactions := database.Collection("transactions")
+
+	var legacy struct {
+		UserID        int              `bson:"user_id"`
+		AccountNumber int64            `bson:"account_number"`
+		Balance       datamodels.Money `bson:"current_balance"`
+	}
+
+	// Open the accounts, skipping those opened by an interrupted earlier run
+	cursor, err := users.Find(ctx, bson.M{"current_balance": bson.M{"$exists": true}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var writes []mongo.WriteModel
+	flush := func(collection *mongo.Collection) error {
+		if len(writes) == 0 {
+			return nil
+		}
+		_, err := collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		writes = writes[:0]
+		return err
+	}
+
+	for cursor.Next(ctx) {
+		if err := cursor.Decode(&legacy); err != nil {
+			return err
+		}
+		account := datamodels.Account{
+			AccountNumber: legacy.AccountNumber,
+			UserID:        legacy.UserID,
+			Type:          datamodels.AccountChecking,
+			Balance:       legacy.Balance,
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"account_number": account.AccountNumber}).
+			SetUpdate(bson.M{"$setOnInsert": account}).
+			SetUpsert(true))
+		if len(writes) == accountsBatchSize {
+			if err := flush(accounts); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if err := flush(accounts); err != nil {
+		return err
+	}
+
+	_, err = users.UpdateMany(ctx,
+		bson.M{"current_balance": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"current_balance": ""}},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Every user has a single account so far, their primary one
+	cursor, err = users.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"user_id": 1, "account_number": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		if err := cursor.Decode(&legacy); err != nil {
+			return err
+		}
+		id, number := legacy.UserID, legacy.AccountNumber
+
+		writes = append(writes,
+			mongo.NewUpdateManyModel().
+				SetFilter(bson.M{"sender_id": id, "sender_account": bson.M{"$exists": false}}).
+				SetUpdate(bson.M{"$set": bson.M{"sender_account": number}}),
+			mongo.NewUpdateManyModel().
+				SetFilter(bson.M{"receiver_id": id, "receiver_account": bson.M{"$exists": false}}).
+				SetUpdate(bson.M{"$set": bson.M{"receiver_account": number}}),
+			mongo.NewUpdateManyModel().
+				SetFilter(bson.M{"postings": bson.M{"$elemMatch": bson.M{"user_id": id, "account_number": bson.M{"$exists": false}}}}).
+				SetUpdate(bson.M{"$set": bson.M{
+					"postings.$[posting].account_number": number,
+					"postings.$[posting].account":        datamodels.LedgerAccount(number),
+				}}).
+				SetArrayFilters(options.ArrayFilters{Filters: []any{
+					bson.M{"posting.user_id": id, "posting.account_number": bson.M{"$exists": false}},
+				}}),
+		)
+		if len(writes) >= accountsBatchSize {
+			if err := flush(transactions); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	return flush(transactions)
+}
+
+// migrateAccounts creates the accounts collection, moves the balances of
+// existing users into it and indexes transactions by account
+func migrateAccounts(ctx context.Context, database *mongo.Database) error {
+	integer := bson.M{"bsonType": bson.A{"int", "long"}}
+	number := bson.M{"bsonType": bson.A{"int", "long", "double", "decimal"}}
+	str := bson.M{"bsonType": "string"}
+	money := bson.M{
+		"bsonType": "object",
+		"required": bson.A{"minor_units", "currency"},
+		"properties": bson.M{
+			"minor_units": bson.M{"bsonType": "long"},
+			"currency":    bson.M{"bsonType": "string", "pattern": "^[A-Z]{3}$"},
+		},
+	}
+
+	accounts := bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"account_number", "user_id", "type", "balance"},
+		"properties": bson.M{
+			"account_number": integer,
+			"user_id":        integer,
+			"type":           bson.M{"enum": bson.A{datamodels.AccountChecking, datamodels.AccountSavings}},
+			"balance":        money,
+		},
+	}}
+	if err := ensureCollection(ctx, database, "accounts", accounts); err != nil {
+		return err
+	}
+	collection := database.Collection("accounts")
+	if err := ensureUniqueIndex(ctx, collection, bson.D{{Key: "account_number", Value: 1}}); err != nil {
+		return err
+	}
+	if _, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}}}); err != nil {
+		return err
+	}
+
+	if err := BackfillAccounts(ctx, database); err != nil {
+		return err
+	}
+
+	// Users no longer carry a balance
+	users := bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"user_id", "email", "password", "account_number"},
+		"properties": bson.M{
+			"user_id":        integer,
+			"first_name":     str,
+			"last_name":      str,
+			"email":          str,
+			"password":       str,
+			"account_number": integer,
+		},
+	}}
+	if err := ensureCollection(ctx, database, "users", users); err != nil {
+		return err
+	}
+
+	transactions := bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"sender_id", "receiver_id", "amount", "dateTimeStamp", "status"},
+		"properties": bson.M{
+			"transaction_id":   integer,
+			"sender_id":        integer,
+			"sender_account":   integer,
+			"receiver_id":      integer,
+			"receiver_account": integer,
+			"amount":           bson.M{"anyOf": bson.A{number, money}},
+			"remarks":          str,
+			"dateTimeStamp":    number,
+			"status":           str,
+		},
+	}}
+	if err := ensureCollection(ctx, database, "transactions", transactions); err != nil {
+		return err
+	}
+
+	// Serve the per-account views and ledger totals
+	_, err := database.Collection("transactions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "postings.account_number", Value: 1}, {Key: "dateTimeStamp", Value: 1}},
+	})
+	return err
+}
+
+// createPayees creates the payees collection, with one payee per user and account
+func createPayees(ctx context.Context, database *mongo.Database) error {
+	integer := bson.M{"bsonType": bson.A{"int", "long"}}
+	str := bson.M{"bsonType": "string"}
+
+	payees := bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"payee_id", "user_id", "name", "account_number", "verified", "created_at"},
+		"properties": bson.M{
+			"payee_id":       integer,
+			"user_id":        integer,
+			"name":           str,
+			"nickname":       str,
+			"account_number": integer,
+			"verified":       bson.M{"bsonType": "bool"},
+			"created_at":     integer,
+		},
+	}}
+	if err := ensureCollection(ctx, database, "payees", payees); err != nil {
+		return err
+	}
+
+	collection := database.Collection("payees")
+	if err := ensureUniqueIndex(ctx, collection, bson.D{{Key: "payee_id", Value: 1}}); err != nil {
+		return err
+	}
+	return ensureUniqueIndex(ctx, collection, bson.D{{Key: "user_id", Value: 1}, {Key: "account_number", Value: 1}})
+}
+
+// createScheduledTransfers creates the scheduled_transfers collection, indexed
+// for the scheduler's claims, and makes sure each occurrence of a scheduled
+// transfer makes at most one transaction
+func createScheduledTransfers(ctx context.Context, database *mongo.Database) error {
+	integer := bson.M{"bsonType": bson.A{"int", "long"}}
+	str := bson.M{"bsonType": "string"}
+	money := bson.M{
+		"bsonType": "object",
+		"required": bson.A{"minor_units", "currency"},
+		"properties": bson.M{
+			"minor_units": bson.M{"bsonType": "long"},
+			"currency":    bson.M{"bsonType": "string", "pattern": "^[A-Z]{3}$"},
+		},
+	}
+
+	schedules := bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"schedule_id", "user_id", "from_account", "account_number", "amount", "frequency", "start_at", "status", "next_run_at", "lease_until"},
+		"properties": bson.M{
+			"schedule_id":    integer,
+			"user_id":        integer,
+			"from_account":   integer,
+			"account_number": integer,
+			"amount":         money,
+			"remarks":        str,
+			"frequency":      bson.M{"enum": bson.A{datamodels.FrequencyOnce, datamodels.FrequencyWeekly, datamodels.FrequencyMonthly}},
+			"start_at":       integer,
+			"end_at":         integer,
+			"status":         bson.M{"enum": bson.A{datamodels.ScheduleActive, datamodels.ScheduleCompleted, datamodels.ScheduleCancelled}},
+			"next_run_at":    integer,
+			"lease_owner":    str,
+			"lease_until":    integer,
+		},
+	}}
+	if err := ensureCollection(ctx, database, "scheduled_transfers", schedules); err != nil {
+		return err
+	}
+
+	collection := database.Collection("scheduled_transfers")
+	if err := ensureUniqueIndex(ctx, collection, bson.D{{Key: "schedule_id", Value: 1}}); err != nil {
+		return err
+	}
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_run_at", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Collection("transactions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "schedule.schedule_id", Value: 1}, {Key: "schedule.occurrence", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"schedule": bson.M{"$exists": true}}),
+	})
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && commandErr.Code == 67 { // CannotCreateIndex on a sharded collection
+		log.Printf("Cannot create unique index on schedule runs of sharded transactions, creating a non-unique index instead: %v\n", err)
+		_, err = database.Collection("transactions").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "schedule.schedule_id", Value: 1}, {Key: "schedule.occurrence", Value: 1}},
+		})
+	}
+	return err
+}
+
+// createHoldExpiryIndex lets the expiry worker find the authorizations whose
+// hold has expired without scanning settled transactions
+func createHoldExpiryIndex(ctx context.Context, database *mongo.Database) error {
+	_, err := database.Collection("transactions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "hold.expires_at", Value: 1}},
+		Options: options.Index().SetPartialFilterExpression(bson.M{"status": datamodels.StatusAuthorized}),
+	})
+	return err
+}
+
+// createTransferLimits creates the transfer_limits collection, with at most
+// one document of limits per user
+func createTransferLimits(ctx context.Context, database *mongo.Database) error {
+	integer := bson.M{"bsonType": bson.A{"int", "long"}}
+	limit := bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0}
+
+	limits := bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"user_id"},
+		"properties": bson.M{
+			"user_id":  integer,
+			"single":   limit,
+			"daily":    limit,
+			"monthly":  limit,
+			"velocity": limit,
+			"lock":     integer,
+		},
+	}}
+	if err := ensureCollection(ctx, database, "transfer_limits", limits); err != nil {
+		return err
+	}
+	return ensureUniqueIndex(ctx, database.Collection("transfer_limits"), bson.D{{Key: "user_id", Value: 1}})
+}
+
+// createRiskIndexes serves the fraud rules counting the transfers paid into an
+// account, and the list of transfers held for review
+func createRiskIndexes(ctx context.Context, database *mongo.Database) error {
+	_, err := database.Collection("transactions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "receiver_account", Value: 1}, {Key: "dateTimeStamp", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "dateTimeStamp", Value: 1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"status": datamodels.StatusPending}),
+		},
+	})
+	return err
+}
+
+// createAuditEvents creates the audit_events collection of admin actions,
+// indexed by time for exports
+func createAuditEvents(ctx context.Context, database *mongo.Database) error {
+	integer := bson.M{"bsonType": bson.A{"int", "long"}}
+	str := bson.M{"bsonType": "string"}
+
+	events := bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"at", "actor_id", "action"},
+		"properties": bson.M{
+			"at":             integer,
+			"actor_id":       integer,
+			"action":         str,
+			"user_id":        integer,
+			"account_number": integer,
+			"transaction_id": integer,
+			"reason":         str,
+			"detail":         str,
+		},
+	}}
+	if err := ensureCollection(ctx, database, "audit_events", events); err != nil {
+		return err
+	}
+
+	_, err := database.Collection("audit_events").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "at", Value: 1}},
+	})
+	return err
+}
+
+// chainAuditEvents chains the audit events recorded before the log was
+// hash-chained, oldest first, then requires every event to be chained. The
+// head of the chain is kept in the audit_chain collection.
+func chainAuditEvents(ctx context.Context, database *mongo.Database) error {
+	integer := bson.M{"bsonType": bson.A{"int", "long"}}
+	str := bson.M{"bsonType": "string"}
+
+	if err := ensureCollection(ctx, database, "audit_chain", bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"seq", "hash"},
+		"properties": bson.M{
+			"seq":  integer,
+			"hash": str,
+		},
+	}}); err != nil {
+		return err
+	}
+
+	for {
+		chained, err := chainAuditEvent(ctx, database)
+		if err != nil {
+			return err
+		}
+		if !chained {
+			break
+		}
+	}
+
+	events := bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"seq", "at", "actor_id", "action", "hash"},
+		"properties": bson.M{
+			"seq":            integer,
+			"at":             integer,
+			"actor_id":       integer,
+			"action":         str,
+			"ip":             str,
+			"request_id":     str,
+			"user_id":        integer,
+			"account_number": integer,
+			"transaction_id": integer,
+			"reason":         str,
+			"detail":         str,
+			"before":         str,
+			"after":          str,
+			"prev_hash":      str,
+			"hash":           str,
+		},
+	}}
+	if err := ensureCollection(ctx, database, "audit_events", events); err != nil {
+		return err
+	}
+	return ensureUniqueIndex(ctx, database.Collection("audit_events"), bson.D{{Key: "seq", Value: 1}})
+}
+
+// chainAuditEvent chains the oldest unchained audit event after the head, in
+// a transaction that moves the head so instances migrating at once take turns.
+// It returns false once every event is chained.
+func chainAuditEvent(ctx context.Context, database *mongo.Database) (bool, error) {
+	session, err := database.Client().StartSession()
+	if err != nil {
+		return false, err
+	}
+	defer session.EndSession(ctx)
+
+	opts := options.Transaction().SetReadPreference(readpref.Primary())
+	chained, err := session.WithTransaction(ctx, func(ctx mongo.SessionContext) (any, error) {
+		var event struct {
+			ID                    primitive.ObjectID `bson:"_id"`
+			datamodels.AuditEvent `bson:",inline"`
+		}
+		err := database.Collection("audit_events").FindOne(ctx,
+			bson.M{"hash": bson.M{"$exists": false}},
+			options.FindOne().SetSort(bson.D{{Key: "at", Value: 1}, {Key: "_id", Value: 1}}),
+		).Decode(&event)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		var head datamodels.AuditEvent
+		err = database.Collection("audit_chain").FindOne(ctx, bson.M{"_id": "head"}).Decode(&head)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return false, err
+		}
+
+		event.Chain(head)
+		_, err = database.Collection("audit_events").UpdateOne(ctx,
+			bson.M{"_id": event.ID},
+			bson.M{"$set": bson.M{"seq": event.Seq, "prev_hash": event.PrevHash, "hash": event.Hash}},
+		)
+		if err != nil {
+			return false, err
+		}
+		_, err = database.Collection("audit_chain").UpdateOne(ctx,
+			bson.M{"_id": "head"},
+			bson.M{"$set": bson.M{"seq": event.Seq, "hash": event.Hash}},
+			options.Update().SetUpsert(true),
+		)
+		return true, err
+	}, opts)
+	if err != nil {
+		return false, err
+	}
+	return chained.(bool), nil
+}
+
+// attemptsBatchSize is the number of failed transactions moved per batch by
+// MoveFailedAttempts
+const attemptsBatchSize = 500
+
+// migrateAttempts creates the transaction_attempts collection and moves the
+// failed attempts out of the transactions into it
+func migrateAttempts(ctx context.Context, database *mongo.Database) error {
+	integer := bson.M{"bsonType": bson.A{"int", "long"}}
+	number := bson.M{"bsonType": bson.A{"int", "long", "double", "decimal"}}
+	str := bson.M{"bsonType": "string"}
+	money := bson.M{
+		"bsonType": "object",
+		"required": bson.A{"minor_units", "currency"},
+		"properties": bson.M{
+			"minor_units": bson.M{"bsonType": "long"},
+			"currency":    bson.M{"bsonType": "string", "pattern": "^[A-Z]{3}$"},
+		},
+	}
+
+	attempts := bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"sender_id", "receiver_id", "amount", "dateTimeStamp", "code"},
+		"properties": bson.M{
+			"sender_id":        integer,
+			"sender_account":   integer,
+			"receiver_id":      integer,
+			"receiver_account": integer,
+			"amount":           money,
+			"remarks":          str,
+			"dateTimeStamp":    number,
+			"type":             str,
+			"code":             str,
+			"message":          str,
+		},
+	}}
+	if err := ensureCollection(ctx, database, "transaction_attempts", attempts); err != nil {
+		return err
+	}
+
+	// Serve the statements listing attempts and the scheduler's check for an
+	// occurrence that was already refused
+	_, err := database.Collection("transaction_attempts").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "postings.user_id", Value: 1}, {Key: "dateTimeStamp", Value: 1}}},
+		{Keys: bson.D{{Key: "postings.account_number", Value: 1}, {Key: "dateTimeStamp", Value: 1}}},
+		{Keys: bson.D{{Key: "schedule.schedule_id", Value: 1}, {Key: "schedule.occurrence", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	return MoveFailedAttempts(ctx, database)
+}
+
+// MoveFailedAttempts moves the failed transactions that never held money, as
+// logged before attempts were kept apart, into transaction_attempts, so the
+// transactions collection only keeps what moved or held money. Voided,
+// expired and rejected authorizations stay, as their hold was on the ledger.
+func MoveFailedAttempts(ctx context.Context, database *mongo.Database) error {
+	for {
+		moved, err := moveFailedBatch(ctx, database)
+		if err != nil {
+			return err
+		}
+		if moved == 0 {
+			return nil
+		}
+	}
+}
+
+// moveFailedBatch copies up to attemptsBatchSize failed transactions into
+// transaction_attempts under the same _id, then deletes them. A batch
+// interrupted between the two is copied again, skipping the duplicates, and
+// deleted by the next run. It returns the number moved.
+func moveFailedBatch(ctx context.Context, database *mongo.Database) (int, error) {
+	transactions := database.Collection("transactions")
+
+	cursor, err := transactions.Find(ctx,
+		bson.M{"status": datamodels.StatusFailed, "hold": bson.M{"$exists": false}},
+		options.Find().SetLimit(attemptsBatchSize),
+	)
+	if err != nil {
+		return 0, err
+	}
+	var failed []struct {
+		ID                     primitive.ObjectID `bson:"_id"`
+		datamodels.Transaction `bson:",inline"`
+	}
+	if err := cursor.All(ctx, &failed); err != nil {
+		return 0, err
+	}
+	if len(failed) == 0 {
+		return 0, nil
+	}
+
+	documents := make([]any, len(failed))
+	ids := make(bson.A, len(failed))
+	for i, t := range failed {
+		documents[i] = struct {
+			ID                 primitive.ObjectID `bson:"_id"`
+			datamodels.Attempt `bson:",inline"`
+		}{t.ID, datamodels.AttemptOf(t.Transaction, datamodels.AttemptCodeUnknown, "")}
+		ids[i] = t.ID
+	}
+
+	_, err = database.Collection("transaction_attempts").InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, writeErr := range bulkErr.WriteErrors {
+			if !mongo.IsDuplicateKeyError(writeErr) {
+				return 0, err
+			}
+		}
+	} else if err != nil {
+		return 0, err
+	}
+
+	if _, err := transactions.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		return 0, err
+	}
+	return len(failed), nil
+}
+
+// createAuditOutbox creates the audit_outbox collection, where units of work
+// queue their audit events for the chainer to move onto the log. It exists
+// before any transaction writes to it, since a transaction may not be able to
+// create it.
+func createAuditOutbox(ctx context.Context, database *mongo.Database) error {
+	integer := bson.M{"bsonType": bson.A{"int", "long"}}
+	str := bson.M{"bsonType": "string"}
+
+	return ensureCollection(ctx, database, "audit_outbox", bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"at", "actor_id", "action"},
+		"properties": bson.M{
+			"at":       integer,
+			"actor_id": integer,
+			"action":   str,
+		},
+	}})
+}
@@ -0,0 +1,102 @@
+// Package fx converts money between currencies at rates supplied by a Provider.
+package fx
+
+import (
+	"context"
+	"cse512/datamodels"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// ErrNoRate is returned when a provider has no rate for a currency pair
+var ErrNoRate = errors.New("fx: no exchange rate")
+
+// Provider supplies exchange rates
+type Provider interface {
+	// Rate returns the rate at which from is converted into to
+	Rate(ctx context.Context, from, to string) (Rate, error)
+}
+
+// Rate is an exact exchange rate: one unit of From buys Value units of To
+type Rate struct {
+	From  string
+	To    string
+	Value *big.Rat
+}
+
+// String returns the rate as a decimal with up to 10 places, e.g. "0.92"
+func (r Rate) String() string {
+	s := r.Value.FloatString(10)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// Convert returns amount, which must be in r.From, in r.To. The result is
+// rounded to the nearest minor unit, halves away from zero.
+func (r Rate) Convert(amount datamodels.Money) (datamodels.Money, error) {
+	if amount.Currency != r.From {
+		return datamodels.Money{}, fmt.Errorf("%w: converting %s at a %s rate", datamodels.ErrCurrencyMismatch, amount.Currency, r.From)
+	}
+	fromScale, err := datamodels.Scale(r.From)
+	if err != nil {
+		return datamodels.Money{}, err
+	}
+	toScale, err := datamodels.Scale(r.To)
+	if err != nil {
+		return datamodels.Money{}, err
+	}
+
+	// Minor units of To = minor units of From * rate * 10^(toScale - fromScale)
+	converted := new(big.Rat).Mul(new(big.Rat).SetInt64(amount.Minor), r.Value)
+	shift := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(toScale-fromScale))), nil))
+	if toScale >= fromScale {
+		converted.Mul(converted, shift)
+	} else {
+		converted.Quo(converted, shift)
+	}
+
+	minor, err := round(converted)
+	if err != nil {
+		return datamodels.Money{}, err
+	}
+	return datamodels.NewMoney(minor, r.To), nil
+}
+
+// Fee returns basisPoints hundredths of a percent of amount, rounded to the
+// nearest minor unit
+func Fee(amount datamodels.Money, basisPoints int64) (datamodels.Money, error) {
+	fee := new(big.Rat).SetFrac(big.NewInt(basisPoints), big.NewInt(10000))
+	fee.Mul(fee, new(big.Rat).SetInt64(amount.Minor))
+
+	minor, err := round(fee)
+	if err != nil {
+		return datamodels.Money{}, err
+	}
+	return datamodels.NewMoney(minor, amount.Currency), nil
+}
+
+// round rounds x to the nearest integer, halves away from zero
+func round(x *big.Rat) (int64, error) {
+	half := big.NewRat(1, 2)
+	if x.Sign() < 0 {
+		half.Neg(half)
+	}
+	shifted := new(big.Rat).Add(x, half)
+
+	// Quo truncates towards zero
+	rounded := new(big.Int).Quo(shifted.Num(), shifted.Denom())
+	if !rounded.IsInt64() || rounded.Int64() == math.MinInt64 {
+		return 0, datamodels.ErrOverflow
+	}
+	return rounded.Int64(), nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,81 @@
+package fx
+
+import (
+	"context"
+	"cse512/datamodels"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// StaticProvider serves fixed rates quoted against a base currency, for local
+// development and tests. Rates between two quoted currencies are crossed
+// through the base.
+type StaticProvider struct {
+	base  string
+	rates map[string]*big.Rat // Units of the currency per unit of base
+}
+
+// RatesFile is the format read by LoadStaticProvider, e.g.
+//
+//	{"base": "USD", "rates": {"EUR": "0.92", "JPY": "151.2"}}
+type RatesFile struct {
+	Base  string                 `json:"base"`
+	Rates map[string]json.Number `json:"rates"`
+}
+
+// NewStaticProvider returns a provider for rates, in units of each currency
+// per unit of base, given as decimals
+func NewStaticProvider(base string, rates map[string]string) (*StaticProvider, error) {
+	if _, err := datamodels.Scale(base); err != nil {
+		return nil, fmt.Errorf("fx: base: %w", err)
+	}
+
+	p := &StaticProvider{
+		base:  base,
+		rates: map[string]*big.Rat{base: big.NewRat(1, 1)},
+	}
+	for code, rate := range rates {
+		if _, err := datamodels.Scale(code); err != nil {
+			return nil, fmt.Errorf("fx: %w", err)
+		}
+		value, ok := new(big.Rat).SetString(rate)
+		if !ok || value.Sign() <= 0 {
+			return nil, fmt.Errorf("fx: invalid rate %q for %s", rate, code)
+		}
+		p.rates[code] = value
+	}
+	return p, nil
+}
+
+// LoadStaticProvider reads a RatesFile
+func LoadStaticProvider(path string) (*StaticProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file RatesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("fx: reading %s: %w", path, err)
+	}
+
+	rates := make(map[string]string, len(file.Rates))
+	for code, rate := range file.Rates {
+		rates[code] = rate.String()
+	}
+	return NewStaticProvider(file.Base, rates)
+}
+
+func (p *StaticProvider) Rate(ctx context.Context, from, to string) (Rate, error) {
+	fromRate, ok := p.rates[from]
+	if !ok {
+		return Rate{}, fmt.Errorf("%w from %s", ErrNoRate, from)
+	}
+	toRate, ok := p.rates[to]
+	if !ok {
+		return Rate{}, fmt.Errorf("%w to %s", ErrNoRate, to)
+	}
+	return Rate{From: from, To: to, Value: new(big.Rat).Quo(toRate, fromRate)}, nil
+}
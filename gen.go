@@ -0,0 +1,94 @@
+package main
+
+import (
+	"cse512/generator"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// runGen writes deterministic mock users, accounts and transactions for the
+// seed command. Only the password hashes differ between runs with a seed.
+func runGen(args []string) error {
+	flags := flag.NewFlagSet("gen", flag.ExitOnError)
+	seed := flags.Uint64("seed", 1, "Seed of the generator, the same seed always produces the same data except for the randomly salted password hashes")
+	users := flags.Int("users", 3000, "Number of users")
+	transactions := flags.Int("transactions", 25000, "Number of transactions, not counting each user's opening deposit")
+	firstUserID := flags.Int("first-user-id", 100, "User ID of the first user")
+	start := flags.String("start", "2022-01-01", "First day of the transaction date range (YYYY-MM-DD)")
+	end := flags.String("end", "2024-12-01", "Day after the transaction date range (YYYY-MM-DD)")
+	distribution := flags.String("distribution", generator.Uniform, "How senders and receivers are picked: uniform or zipf")
+	zipfS := flags.Float64("zipf-s", 1.1, "Skew of the zipf distribution, greater values make hot accounts hotter")
+	cost := flags.Int("bcrypt-cost", bcrypt.MinCost, "bcrypt cost of the password hashes")
+	format := flags.String("format", generator.JSON, "Output format: json or ndjson")
+	usersOut := flags.String("users-out", "mock_data_userInfo.json", "Users output file")
+	accountsOut := flags.String("accounts-out", "mock_accounts.json", "Accounts output file")
+	transactionsOut := flags.String("transactions-out", "mock_transactions.json", "Transactions output file")
+	credentialsOut := flags.String("credentials-out", "mock_credentials.csv", "Plain text logins output file, empty to skip")
+	flags.Parse(args)
+
+	startDate, err := time.Parse(time.DateOnly, *start)
+	if err != nil {
+		return fmt.Errorf("invalid -start: %w", err)
+	}
+	endDate, err := time.Parse(time.DateOnly, *end)
+	if err != nil {
+		return fmt.Errorf("invalid -end: %w", err)
+	}
+
+	dataset, err := generator.Generate(generator.Options{
+		Seed:         *seed,
+		Users:        *users,
+		Transactions: *transactions,
+		FirstUserID:  *firstUserID,
+		Start:        startDate,
+		End:          endDate,
+		Distribution: *distribution,
+		ZipfS:        *zipfS,
+		BcryptCost:   *cost,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := writeFile(*usersOut, func(f *os.File) error {
+		return generator.Write(f, dataset.Users, *format)
+	}); err != nil {
+		return err
+	}
+	if err := writeFile(*accountsOut, func(f *os.File) error {
+		return generator.Write(f, dataset.Accounts, *format)
+	}); err != nil {
+		return err
+	}
+	if err := writeFile(*transactionsOut, func(f *os.File) error {
+		return generator.Write(f, dataset.Transactions, *format)
+	}); err != nil {
+		return err
+	}
+	if *credentialsOut != "" {
+		if err := writeFile(*credentialsOut, func(f *os.File) error {
+			return generator.WriteCredentials(f, dataset.Credentials)
+		}); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Generated %d users, %d accounts and %d transactions.\n", len(dataset.Users), len(dataset.Accounts), len(dataset.Transactions))
+	return nil
+}
+
+func writeFile(path string, write func(f *os.File) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,299 @@
+// Package generator produces deterministic mock users, accounts and
+// transactions. The same seed and options always produce the same data,
+// except for the randomly salted password hashes, and every account's
+// balance equals the sum of its completed transactions.
+package generator
+
+import (
+	"cse512/datamodels"
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/text/language"
+)
+
+// Options configures the generated data
+type Options struct {
+	Seed         uint64
+	Users        int
+	Transactions int // Excludes the opening deposit every user receives
+	FirstUserID  int
+	Start        time.Time
+	End          time.Time
+	Distribution string  // "uniform" or "zipf", how senders and receivers are picked
+	ZipfS        float64 // Skew of the zipf distribution, must be > 1
+	BcryptCost   int
+}
+
+// Distributions supported by Options.Distribution
+const (
+	Uniform = "uniform"
+	Zipf    = "zipf"
+)
+
+// Amount bounds match generate_mock_transactions.js
+const (
+	minAmount         = 500
+	maxAmount         = 15000
+	minOpeningBalance = 10000
+	maxOpeningBalance = 999999
+	failureRate       = 0.02
+)
+
+// Credential is the plain text password a generated user logs in with
+type Credential struct {
+	UserID   int
+	Email    string
+	Password string
+}
+
+// Dataset is the generated data. Every user has a single checking account,
+// Accounts[i] belongs to Users[i].
+type Dataset struct {
+	Users        []datamodels.User
+	Accounts     []datamodels.Account
+	Credentials  []Credential
+	Transactions []datamodels.Transaction
+}
+
+// Validate reports invalid options
+func (o Options) Validate() error {
+	switch {
+	case o.Users <= 0:
+		return fmt.Errorf("generator: users must be positive")
+	case o.Transactions < 0:
+		return fmt.Errorf("generator: transactions must not be negative")
+	case !o.End.After(o.Start):
+		return fmt.Errorf("generator: end must be after start")
+	case o.Distribution != Uniform && o.Distribution != Zipf:
+		return fmt.Errorf("generator: unknown distribution %q", o.Distribution)
+	case o.Distribution == Zipf && o.ZipfS <= 1:
+		return fmt.Errorf("generator: zipf skew must be greater than 1")
+	case o.BcryptCost < bcrypt.MinCost || o.BcryptCost > bcrypt.MaxCost:
+		return fmt.Errorf("generator: bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return nil
+}
+
+// Generate builds the dataset described by opts. Password hashes use random
+// salts so they differ between runs, but the passwords themselves do not.
+func Generate(opts Options) (*Dataset, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewPCG(opts.Seed, opts.Seed^0x9e3779b97f4a7c15))
+	dataset := &Dataset{}
+
+	generateUsers(rng, opts, dataset)
+	generateTransactions(rng, opts, dataset)
+
+	if err := hashPasswords(opts.BcryptCost, dataset); err != nil {
+		return nil, err
+	}
+	return dataset, nil
+}
+
+func generateUsers(rng *rand.Rand, opts Options, dataset *Dataset) {
+	accountNumbers := make(map[int64]bool, opts.Users)
+
+	for i := 0; i < opts.Users; i++ {
+		userID := opts.FirstUserID + i
+
+		// Generate a unique account number
+		var accountNumber int64
+		for {
+			accountNumber = rng.Int64N(900000000) + 100000000
+			if !accountNumbers[accountNumber] {
+				break
+			}
+		}
+		accountNumbers[accountNumber] = true
+
+		firstName := firstNames[rng.IntN(len(firstNames))]
+		lastName := lastNames[rng.IntN(len(lastNames))]
+		// The user ID keeps emails unique
+		email := fmt.Sprintf("%s.%s%d@%s", firstName, lastName, userID, emailDomains[rng.IntN(len(emailDomains))])
+
+		password := make([]byte, 15)
+		for j := range password {
+			password[j] = passwordAlphabet[rng.IntN(len(passwordAlphabet))]
+		}
+
+		dataset.Users = append(dataset.Users, datamodels.User{
+			UserID:        userID,
+			FirstName:     firstName,
+			LastName:      lastName,
+			Email:         email,
+			AccountNumber: accountNumber,
+		})
+		dataset.Accounts = append(dataset.Accounts, datamodels.Account{
+			AccountNumber: accountNumber,
+			UserID:        userID,
+			Type:          datamodels.AccountChecking,
+			Balance:       datamodels.NewMoney(0, datamodels.DefaultCurrency),
+		})
+		dataset.Credentials = append(dataset.Credentials, Credential{
+			UserID:   userID,
+			Email:    email,
+			Password: string(password),
+		})
+	}
+}
+
+// picker returns a function choosing user indexes according to the distribution
+func picker(rng *rand.Rand, opts Options) func() int {
+	if opts.Distribution == Uniform {
+		return func() int { return rng.IntN(opts.Users) }
+	}
+
+	// Shuffle ranks so the hot accounts are not simply the lowest user IDs
+	ranks := rng.Perm(opts.Users)
+	zipf := rand.NewZipf(rng, opts.ZipfS, 1, uint64(opts.Users-1))
+	return func() int { return ranks[zipf.Uint64()] }
+}
+
+func generateTransactions(rng *rand.Rand, opts Options, dataset *Dataset) {
+	users := dataset.Users
+	accounts := dataset.Accounts
+	name := func(i int) string { return users[i].FirstName + " " + users[i].LastName }
+
+	transactionID := 0
+	nextID := func() int {
+		transactionID++
+		return transactionID
+	}
+
+	// Amounts are whole dollars, like those of the JavaScript generators
+	dollars := func(low, high int) datamodels.Money {
+		return datamodels.NewMoney(int64(rng.IntN(high-low+1)+low)*100, datamodels.DefaultCurrency)
+	}
+	format := func(amount datamodels.Money) string {
+		return amount.Format(language.English)
+	}
+
+	// Every user opens their account with a deposit at the start of the range
+	for i := range users {
+		amount := dollars(minOpeningBalance, maxOpeningBalance)
+		accounts[i].Balance = amount
+		dataset.Transactions = append(dataset.Transactions, datamodels.Transaction{
+			TransactionID:   nextID(),
+			SenderID:        users[i].UserID,
+			SenderAccount:   accounts[i].AccountNumber,
+			ReceiverID:      users[i].UserID,
+			ReceiverAccount: accounts[i].AccountNumber,
+			Amount:          amount,
+			Remarks:         fmt.Sprintf("Opening deposit of %s by %s", format(amount), name(i)),
+			DateTimeStamp:   opts.Start.Unix(),
+			Status:          datamodels.StatusCompleted,
+			Type:            datamodels.TypeDeposit,
+			Postings:        datamodels.CashPostings(accounts[i], amount),
+		})
+	}
+
+	// Spread the remaining transactions over the range in chronological order
+	span := opts.End.Unix() - opts.Start.Unix()
+	timestamps := make([]int64, opts.Transactions)
+	for i := range timestamps {
+		timestamps[i] = opts.Start.Unix() + 1 + rng.Int64N(span)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	pick := picker(rng, opts)
+	for _, timestamp := range timestamps {
+		sender := pick()
+		amount := dollars(minAmount, maxAmount)
+		transaction := datamodels.Transaction{
+			TransactionID: nextID(),
+			SenderID:      users[sender].UserID,
+			SenderAccount: accounts[sender].AccountNumber,
+			DateTimeStamp: timestamp,
+			Status:        datamodels.StatusCompleted,
+		}
+
+		switch rng.IntN(3) {
+		case 0: // Deposit
+			transaction.Type = datamodels.TypeDeposit
+			transaction.ReceiverID = users[sender].UserID
+			transaction.ReceiverAccount = accounts[sender].AccountNumber
+			transaction.Amount = amount
+			transaction.Remarks = fmt.Sprintf("Deposit of %s by %s", format(amount), name(sender))
+			accounts[sender].Balance.Minor += amount.Minor
+
+		case 1: // Withdrawal, failed if it would overdraw the account
+			transaction.Type = datamodels.TypeWithdrawal
+			transaction.ReceiverID = users[sender].UserID
+			transaction.ReceiverAccount = accounts[sender].AccountNumber
+			transaction.Amount = datamodels.NewMoney(-amount.Minor, amount.Currency)
+			transaction.Remarks = fmt.Sprintf("Withdrawal of %s by %s", format(amount), name(sender))
+			if accounts[sender].Balance.Cmp(amount) < 0 {
+				transaction.Status = datamodels.StatusFailed
+			} else {
+				accounts[sender].Balance.Minor -= amount.Minor
+			}
+
+		default: // Transfer
+			transaction.Type = datamodels.TypeTransfer
+			receiver := pick()
+			for opts.Users > 1 && receiver == sender {
+				receiver = pick()
+			}
+			transaction.ReceiverID = users[receiver].UserID
+			transaction.ReceiverAccount = accounts[receiver].AccountNumber
+			transaction.Amount = amount
+			transaction.Remarks = fmt.Sprintf("Transfer of %s from %s to %s", format(amount), name(sender), name(receiver))
+			if accounts[sender].Balance.Cmp(amount) < 0 || rng.Float64() < failureRate {
+				transaction.Status = datamodels.StatusFailed
+			} else {
+				accounts[sender].Balance.Minor -= amount.Minor
+				accounts[receiver].Balance.Minor += amount.Minor
+			}
+		}
+
+		transaction.Postings = transaction.LedgerPostings()
+		dataset.Transactions = append(dataset.Transactions, transaction)
+	}
+}
+
+// hashPasswords bcrypts every credential in parallel
+func hashPasswords(cost int, dataset *Dataset) error {
+	jobs := make(chan int)
+	errs := make(chan error, 1)
+	var wg sync.WaitGroup
+
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				hash, err := bcrypt.GenerateFromPassword([]byte(dataset.Credentials[i].Password), cost)
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					continue
+				}
+				dataset.Users[i].PassHash = string(hash)
+			}
+		}()
+	}
+
+	for i := range dataset.Users {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,20 @@
+package generator
+
+var firstNames = []string{
+	"Patrick", "Humberto", "Joe", "Thomas", "Abelardo", "Maria", "Aisha", "Wei",
+	"Priya", "Carlos", "Fatima", "Olivia", "Liam", "Noah", "Emma", "Ava",
+	"Sophia", "Mateo", "Yuki", "Hana", "Omar", "Lucia", "Elena", "Ivan",
+	"Chloe", "Ethan", "Mia", "Arjun", "Zara", "Diego", "Nina", "Samuel",
+	"Grace", "Henry", "Isla", "Jack", "Kofi", "Leila", "Marco", "Nora",
+}
+
+var lastNames = []string{
+	"Hackett", "Bernhard", "Wilderman", "Rodriguez", "Smith", "Johnson", "Nguyen", "Patel",
+	"Garcia", "Kim", "Okafor", "Schmidt", "Rossi", "Tanaka", "Kowalski", "Haddad",
+	"Silva", "Chen", "Murphy", "Novak", "Larsen", "Dubois", "Ivanova", "Mensah",
+	"Lopez", "Walker", "Singh", "Ali", "Brown", "Fischer", "Moreau", "Sato",
+}
+
+var emailDomains = []string{"gmail.com", "yahoo.com", "hotmail.com", "outlook.com"}
+
+const passwordAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
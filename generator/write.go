@@ -0,0 +1,56 @@
+package generator
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Output formats accepted by Write, both readable by the seed command
+const (
+	JSON   = "json"   // A JSON array, one record per line, like the mock data files
+	NDJSON = "ndjson" // Newline-delimited JSON
+)
+
+// Write encodes records to w in the given format
+func Write[T any](w io.Writer, records []T, format string) error {
+	if format != JSON && format != NDJSON {
+		return fmt.Errorf("generator: unknown format %q", format)
+	}
+
+	buffered := bufio.NewWriter(w)
+	if format == JSON {
+		buffered.WriteString("[\n")
+	}
+
+	for i, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		buffered.Write(data)
+		if format == JSON && i < len(records)-1 {
+			buffered.WriteByte(',')
+		}
+		buffered.WriteByte('\n')
+	}
+
+	if format == JSON {
+		buffered.WriteString("]\n")
+	}
+	return buffered.Flush()
+}
+
+// WriteCredentials writes the plain text login of every user as CSV
+func WriteCredentials(w io.Writer, credentials []Credential) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"user_id", "email", "password"})
+	for _, credential := range credentials {
+		writer.Write([]string{strconv.Itoa(credential.UserID), credential.Email, credential.Password})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/repository"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// errNotOwner is returned when an account exists but belongs to another user
+var errNotOwner = errors.New("account belongs to another user")
+
+// ownAccount returns the account of user with the given number, or the user's
+// primary account if accountNumber is 0
+func (h *Handler) ownAccount(ctx context.Context, user datamodels.User, accountNumber int64) (datamodels.Account, error) {
+	if accountNumber == 0 {
+		accountNumber = user.AccountNumber
+	}
+	account, err := h.accounts.FindByNumber(ctx, accountNumber)
+	if err != nil {
+		return account, err
+	}
+	if account.UserID != user.UserID {
+		return datamodels.Account{}, errNotOwner
+	}
+	return account, nil
+}
+
+// errInvalidAccountNumber is returned for an account_number parameter that is not a number
+var errInvalidAccountNumber = errors.New("invalid account_number")
+
+// accountParam returns the account_number query parameter of r, which must
+// name one of the user's accounts, or 0 if it is absent
+func (h *Handler) accountParam(r *http.Request, userID int) (int64, error) {
+	value := r.URL.Query().Get("account_number")
+	if value == "" {
+		return 0, nil
+	}
+	accountNumber, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || accountNumber <= 0 {
+		return 0, errInvalidAccountNumber
+	}
+
+	account, err := h.accounts.FindByNumber(r.Context(), accountNumber)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && account.UserID != userID) {
+		return 0, errNotOwner
+	}
+	return accountNumber, err
+}
+
+// AccountResponse describes an account to its owner
+type AccountResponse struct {
+	AccountNumber int64            `json:"account_number"`
+	Type          string           `json:"type"`
+	Balance       datamodels.Money `json:"balance"`           // Ledger balance, including held amounts
+	Available     datamodels.Money `json:"available_balance"` // Balance less the amounts held by authorizations
+	Currency      string           `json:"currency"`
+	Primary       bool             `json:"primary"` // Used when a request names no account
+	Frozen        bool             `json:"frozen"`  // No money can move in or out
+}
+
+func accountResponses(user datamodels.User, accounts []datamodels.Account) []AccountResponse {
+	responses := make([]AccountResponse, len(accounts))
+	for i, account := range accounts {
+		responses[i] = AccountResponse{
+			AccountNumber: account.AccountNumber,
+			Type:          account.Type,
+			Balance:       account.Balance,
+			Available:     account.Available(),
+			Currency:      account.Balance.Currency,
+			Primary:       account.AccountNumber == user.AccountNumber,
+			Frozen:        account.Frozen,
+		}
+	}
+	return responses
+}
+
+// ListAccounts returns the accounts of a user
+func (h *Handler) ListAccounts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Invalid or missing user_id.",
+		})
+		return
+	}
+
+	user, err := h.users.FindByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "User not found.",
+			})
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "Failed to fetch user's data.",
+			})
+		}
+		return
+	}
+
+	accounts, err := h.accounts.FindByUser(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to fetch accounts.",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Status:  "success",
+		Message: "Accounts fetched successfully.",
+		Data:    accountResponses(user, accounts),
+	})
+}
+
+// maxAccountNumberAttempts bounds the retries when a random account number is taken
+const maxAccountNumberAttempts = 10
+
+// OpenAccount opens a new, empty account for a user
+func (h *Handler) OpenAccount(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	var request struct {
+		UserID   int    `json:"user_id"`
+		Type     string `json:"type"`
+		Currency string `json:"currency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to parse JSON.",
+		})
+		return
+	}
+
+	// Validate fields, accounts are opened in USD unless told otherwise
+	if !slices.Contains(datamodels.AccountTypes, request.Type) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "type must be checking or savings.",
+		})
+		return
+	}
+	if request.Currency == "" {
+		request.Currency = datamodels.DefaultCurrency
+	}
+	if _, err := datamodels.Scale(request.Currency); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Unknown currency.",
+		})
+		return
+	}
+
+	user, err := h.users.FindByID(r.Context(), request.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "User not found.",
+			})
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "Failed to fetch user's data.",
+			})
+		}
+		return
+	}
+
+	// Pick an unused 9 digit account number
+	account := datamodels.Account{
+		UserID:  user.UserID,
+		Type:    request.Type,
+		Balance: datamodels.NewMoney(0, request.Currency),
+	}
+	for attempt := 0; ; attempt++ {
+		account.AccountNumber = rand.Int64N(900000000) + 100000000
+		err = h.accounts.Insert(r.Context(), account)
+		if !errors.Is(err, repository.ErrDuplicate) || attempt == maxAccountNumberAttempts {
+			break
+		}
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to open account.",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(Response{
+		Status:  "success",
+		Message: "Account opened successfully.",
+		Data:    accountResponses(user, []datamodels.Account{account})[0],
+	})
+}
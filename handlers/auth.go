@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"cse512/audit"
+	"cse512/auth"
+	"cse512/datamodels"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// DefaultTokenTTL is how long the tokens issued at login are valid
+const DefaultTokenTTL = 12 * time.Hour
+
+// SetTokenSecret signs and verifies login tokens with secret, so tokens issued
+// by one instance are accepted by every instance sharing it. Without one,
+// tokens are signed with a random secret and only valid on this instance.
+func (h *Handler) SetTokenSecret(secret []byte) {
+	h.tokens = auth.NewSigner(secret, DefaultTokenTTL)
+}
+
+type actorKey struct{}
+
+// actorFrom returns the claims of the token a request was authorized with,
+// or zero claims for requests made without one
+func actorFrom(ctx context.Context) auth.Claims {
+	claims, _ := ctx.Value(actorKey{}).(auth.Claims)
+	return claims
+}
+
+// SetRequireTokens makes the routes customers use for themselves refuse
+// requests without a login token. Otherwise such requests act for whichever
+// user they name, as before tokens existed. A token that is sent is always
+// checked, and staff routes always need one.
+func (h *Handler) SetRequireTokens(require bool) {
+	h.requireTokens = require
+}
+
+// maxAuthorizedBody caps the request body read to find the users it names
+const maxAuthorizedBody = 1 << 20
+
+// authorize lets a request through if Permissions allows the caller the
+// matched route. Callers are identified by their bearer token, and their role
+// is read again from the user so a change of role takes effect at once. Use
+// of a route through the caller's role, rather than as themselves, is
+// recorded in the audit log before the request is served.
+func (h *Handler) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Preflight requests carry no credentials
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var name string
+		if route := mux.CurrentRoute(r); route != nil {
+			name = route.GetName()
+		}
+		access, ok := Permissions[name]
+		if access.Public {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := r.Header.Get("Authorization")
+		if header == "" && access.Self && !h.requireTokens {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, found := strings.CutPrefix(header, "Bearer ")
+		if !found {
+			writeUnauthorized(w, "Missing bearer token.")
+			return
+		}
+		claims, err := h.tokens.Verify(token, h.now())
+		if err != nil {
+			message := "Invalid token."
+			if errors.Is(err, auth.ErrExpiredToken) {
+				message = "Token has expired, please log in again."
+			}
+			writeUnauthorized(w, message)
+			return
+		}
+
+		user, err := h.users.FindByID(r.Context(), claims.UserID)
+		if err != nil || !ok {
+			writeForbidden(w)
+			return
+		}
+		claims.Role = user.EffectiveRole()
+
+		subjects, err := subjectsOf(r)
+		if err != nil {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "Invalid request body.",
+			})
+			return
+		}
+		// A request for oneself names oneself and no one else
+		self := len(subjects) > 0 && !slices.ContainsFunc(subjects, func(userID int) bool { return userID != claims.UserID })
+
+		ctx := context.WithValue(r.Context(), actorKey{}, claims)
+		origin := audit.OriginFrom(ctx)
+		origin.ActorID = claims.UserID
+		ctx = audit.WithOrigin(ctx, origin)
+		switch {
+		case access.Self && self:
+		case slices.Contains(access.Roles, claims.Role):
+			event := datamodels.AuditEvent{
+				At:     h.now().Unix(),
+				Action: datamodels.AuditAccess,
+				Detail: r.Method + " " + r.URL.RequestURI(),
+			}
+			for _, userID := range subjects {
+				if userID != claims.UserID {
+					event.UserID = userID
+					break
+				}
+			}
+			if err := audit.Record(ctx, h.store.Audit(), event); err != nil {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(Response{
+					Status:  "error",
+					Message: "Failed to record access.",
+				})
+				return
+			}
+		default:
+			writeForbidden(w)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// subjectsOf returns the user IDs a request names in its route, its user_id
+// and sender_id query parameters and the same fields of its JSON body. The
+// body is read and put back for the handler. It fails if the body is not JSON.
+func subjectsOf(r *http.Request) ([]int, error) {
+	var subjects []int
+	add := func(value string) {
+		if userID, err := strconv.Atoi(value); err == nil {
+			subjects = append(subjects, userID)
+		}
+	}
+
+	add(mux.Vars(r)["user_id"])
+	query := r.URL.Query()
+	for _, value := range append(query["user_id"], query["sender_id"]...) {
+		add(value)
+	}
+
+	if r.Body == nil || r.Body == http.NoBody {
+		return subjects, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxAuthorizedBody))
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		return subjects, nil
+	}
+
+	// Decoded the way the handlers decode it, so both see the same users. A
+	// body that cannot be decoded is refused rather than let through.
+	var named struct {
+		UserID   *int `json:"user_id"`
+		SenderID *int `json:"sender_id"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&named); err != nil {
+		return nil, err
+	}
+	for _, userID := range []*int{named.UserID, named.SenderID} {
+		if userID != nil {
+			subjects = append(subjects, *userID)
+		}
+	}
+	return subjects, nil
+}
+
+// writeForbidden responds to a caller who may not use the route
+func writeForbidden(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(Response{
+		Status:  "error",
+		Message: "You are not allowed to use this endpoint.",
+	})
+}
+
+// writeUnauthorized responds to a request without valid credentials
+func writeUnauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(Response{
+		Status:  "error",
+		Message: message,
+	})
+}
+
+// audited runs action and records event as taken by the staff member who
+// made the request, in one unit of work so no action goes unrecorded. action
+// may fill in the event, such as the ID of a transaction it made or the
+// values it changed.
+func (h *Handler) audited(ctx context.Context, event datamodels.AuditEvent, action func(ctx context.Context, event *datamodels.AuditEvent) error) error {
+	event.At = h.now().Unix()
+	event.ActorID = actorFrom(ctx).UserID
+	return h.store.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := action(ctx, &event); err != nil {
+			return err
+		}
+		return audit.Record(ctx, h.store.Audit(), event)
+	})
+}
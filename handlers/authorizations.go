@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/ledger"
+	"cse512/repository"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// DefaultHoldExpiry is how long an authorization holds its amount before the
+// expiry worker releases it
+const DefaultHoldExpiry = 7 * 24 * time.Hour
+
+// SetHoldExpiry sets how long authorizations hold their amount
+func (h *Handler) SetHoldExpiry(expiry time.Duration) {
+	h.holdExpiry = expiry
+}
+
+// transactionIDParam returns the transaction ID in the route
+func transactionIDParam(r *http.Request) (int, error) {
+	return strconv.Atoi(mux.Vars(r)["transaction_id"])
+}
+
+// ownTransaction returns the transaction with transactionID if userID sent
+// it, and repository.ErrNotFound otherwise
+func (h *Handler) ownTransaction(ctx context.Context, userID int, transactionID int) (datamodels.Transaction, error) {
+	transaction, err := h.transactions.FindByID(ctx, transactionID)
+	if err != nil {
+		return transaction, err
+	}
+	if transaction.SenderID != userID {
+		return datamodels.Transaction{}, repository.ErrNotFound
+	}
+	return transaction, nil
+}
+
+// CaptureTransaction settles an authorized transfer, moving the held amount
+// to the receiver
+func (h *Handler) CaptureTransaction(w http.ResponseWriter, r *http.Request) {
+	h.releaseAuthorization(w, r, func(ctx context.Context, transaction datamodels.Transaction) (datamodels.Transaction, error) {
+		return ledger.Capture(ctx, h.store, transaction)
+	}, "Transaction captured successfully.")
+}
+
+// VoidTransaction cancels an authorized transfer, releasing the held amount
+func (h *Handler) VoidTransaction(w http.ResponseWriter, r *http.Request) {
+	h.releaseAuthorization(w, r, func(ctx context.Context, transaction datamodels.Transaction) (datamodels.Transaction, error) {
+		return ledger.Void(ctx, h.store, transaction, datamodels.HoldVoided)
+	}, "Transaction voided successfully.")
+}
+
+// releaseAuthorization serves the capture and void endpoints. release settles
+// or voids the authorization named in the route if the user in the body sent it.
+func (h *Handler) releaseAuthorization(w http.ResponseWriter, r *http.Request, release func(context.Context, datamodels.Transaction) (datamodels.Transaction, error), message string) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	transactionID, err := transactionIDParam(r)
+	if err != nil {
+		writeTransactionNotFound(w)
+		return
+	}
+
+	var request struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Transaction{
+			Status:  "error",
+			Message: decodeErrorMessage(err),
+			Code:    CodeRejected,
+		})
+		return
+	}
+
+	// Only the sender can settle or cancel their authorization
+	ctx := r.Context()
+	transaction, err := h.ownTransaction(ctx, request.UserID, transactionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			writeTransactionNotFound(w)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:  "error",
+				Message: "Failed to fetch transaction.",
+				Code:    CodeInternal,
+			})
+		}
+		return
+	}
+
+	// Captured, voided or expired meanwhile if the status changed since it was read
+	if transaction.Status == datamodels.StatusAuthorized {
+		transaction, err = release(ctx, transaction)
+	} else {
+		err = repository.ErrConflict
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:        "error",
+				Message:       "Only authorized transactions can be captured or voided.",
+				Code:          CodeInvalidState,
+				TransactionID: transactionID,
+			})
+		} else if errors.Is(err, repository.ErrInsufficientFunds) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:        "error",
+				Message:       "Insufficient balance.",
+				Code:          CodeInsufficientFunds,
+				TransactionID: transactionID,
+			})
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:        "error",
+				Message:       "Failed to update transaction.",
+				Code:          CodeInternal,
+				TransactionID: transactionID,
+			})
+		}
+		return
+	}
+
+	var balance datamodels.Money
+	if account, err := h.accounts.FindByNumber(ctx, transaction.Hold.AccountNumber); err == nil {
+		balance = account.Balance
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Transaction{
+		Status:         "success",
+		Message:        message,
+		UpdatedBalance: balance,
+		TransactionID:  transactionID,
+	})
+}
+
+// writeTransactionNotFound writes the response for a transaction that does
+// not exist or belongs to another user
+func writeTransactionNotFound(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(Transaction{
+		Status:  "error",
+		Message: "Transaction not found.",
+		Code:    CodeNotFound,
+	})
+}
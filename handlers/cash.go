@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"cse512/datamodels"
+	"cse512/ledger"
+	"cse512/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/text/language"
+)
+
+// MaxWithdrawal caps the amount of a single withdrawal, in whole units of the
+// account's currency
+var MaxWithdrawal int64 = 10000
+
+// withinWithdrawalLimit reports whether a positive amount may be withdrawn at once
+func withinWithdrawalLimit(amount datamodels.Money) bool {
+	limit, err := datamodels.FromMajor(MaxWithdrawal, amount.Currency)
+	return err == nil && ledger.ValidateAmount(amount) == nil && amount.Cmp(limit) <= 0
+}
+
+// HandleDeposit adds cash to a user's account
+func (h *Handler) HandleDeposit(w http.ResponseWriter, r *http.Request) {
+	h.handleCash(w, r, datamodels.TypeDeposit)
+}
+
+// HandleWithdraw takes cash out of a user's account
+func (h *Handler) HandleWithdraw(w http.ResponseWriter, r *http.Request) {
+	h.handleCash(w, r, datamodels.TypeWithdrawal)
+}
+
+// handleCash performs a deposit or withdrawal. Amounts in the request are
+// always positive, the sign is given by the transaction type.
+func (h *Handler) handleCash(w http.ResponseWriter, r *http.Request, transactionType string) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(Transaction{
+			Status:  "error",
+			Message: "Invalid request method. Only POST is allowed.",
+			Code:    CodeRejected,
+		})
+		return
+	}
+
+	var request struct {
+		UserID        int              `json:"user_id"`
+		AccountNumber int64            `json:"account_number"` // Defaults to the user's primary account
+		Amount        datamodels.Money `json:"amount"`
+		Remarks       string           `json:"remarks"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Transaction{
+			Status:  "error",
+			Message: decodeErrorMessage(err),
+			Code:    CodeRejected,
+		})
+		return
+	}
+
+	// Validate fields
+	if request.UserID <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Transaction{
+			Status:  "error",
+			Message: "user_id is required.",
+			Code:    CodeRejected,
+		})
+		return
+	}
+
+	if request.Amount.Sign() <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Transaction{
+			Status:  "error",
+			Message: "Amount must be positive.",
+			Code:    CodeRejected,
+		})
+		return
+	}
+
+	if transactionType == datamodels.TypeWithdrawal && !withinWithdrawalLimit(request.Amount) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Transaction{
+			Status:  "error",
+			Message: fmt.Sprintf("Withdrawals are limited to %d.", MaxWithdrawal),
+			Code:    CodeRejected,
+		})
+		return
+	}
+
+	if transactionType == datamodels.TypeDeposit && ledger.ValidateAmount(request.Amount) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Transaction{
+			Status:  "error",
+			Message: fmt.Sprintf("Deposits are limited to %d.", ledger.MaxAmount),
+			Code:    CodeRejected,
+		})
+		return
+	}
+
+	ctx := r.Context()
+
+	user, err := h.users.FindByID(ctx, request.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:  "error",
+				Message: "User not found.",
+				Code:    CodeNotFound,
+			})
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:  "error",
+				Message: "Failed to fetch user's data.",
+				Code:    CodeInternal,
+			})
+		}
+		return
+	}
+
+	account, err := h.ownAccount(ctx, user, request.AccountNumber)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) || errors.Is(err, errNotOwner) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:  "error",
+				Message: "Account number does not match.",
+				Code:    CodeAccountMismatch,
+			})
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:  "error",
+				Message: "Failed to fetch user's account.",
+				Code:    CodeInternal,
+			})
+		}
+		return
+	}
+
+	if account.Frozen {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(Transaction{
+			Status:         "error",
+			Message:        "Account is frozen. Please contact support.",
+			Code:           CodeFrozen,
+			UpdatedBalance: account.Balance,
+		})
+		return
+	}
+
+	if request.Amount.Currency != account.Balance.Currency {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Transaction{
+			Status:         "error",
+			Message:        fmt.Sprintf("Amount must be in %s.", account.Balance.Currency),
+			Code:           CodeRejected,
+			UpdatedBalance: account.Balance,
+		})
+		return
+	}
+
+	// Withdrawals are stored with a negative amount. Validated amounts can
+	// always be negated.
+	amount := request.Amount
+	if transactionType == datamodels.TypeWithdrawal {
+		amount, _ = amount.Neg()
+	}
+
+	remarks := request.Remarks
+	if remarks == "" {
+		remarks = fmt.Sprintf("%s of %s by %s %s", titles[transactionType], request.Amount.Format(language.English), user.FirstName, user.LastName)
+	}
+
+	attempt := datamodels.Transaction{
+		SenderID:        user.UserID,
+		SenderAccount:   account.AccountNumber,
+		ReceiverID:      user.UserID,
+		ReceiverAccount: account.AccountNumber,
+		Amount:          amount,
+		Remarks:         remarks,
+		DateTimeStamp:   h.now().Unix(),
+		Type:            transactionType,
+	}
+
+	completedTransaction := attempt
+	completedTransaction.Status = datamodels.StatusSettled
+	completedTransaction.Postings = datamodels.CashPostings(account, amount)
+
+	posted, err := ledger.Post(ctx, h.store, completedTransaction)
+	if err != nil {
+		if errors.Is(err, repository.ErrInsufficientFunds) {
+			h.refuse(ctx, w, http.StatusBadRequest, attempt, Transaction{
+				Status:         "error",
+				Message:        "Insufficient balance.",
+				Code:           CodeInsufficientFunds,
+				UpdatedBalance: account.Balance,
+			})
+		} else {
+			h.refuse(ctx, w, http.StatusInternalServerError, attempt, Transaction{
+				Status:         "error",
+				Message:        "Failed to commit transaction.",
+				Code:           CodeInternal,
+				UpdatedBalance: account.Balance,
+			})
+		}
+		return
+	}
+
+	if updated, err := h.accounts.FindByNumber(ctx, account.AccountNumber); err == nil {
+		account = updated
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Transaction{
+		Status:         "success",
+		Message:        fmt.Sprintf("%s completed successfully.", titles[transactionType]),
+		UpdatedBalance: account.Balance,
+		TransactionID:  posted.TransactionID,
+	})
+}
+
+// titles are the transaction types as used at the start of a sentence
+var titles = map[string]string{
+	datamodels.TypeDeposit:    "Deposit",
+	datamodels.TypeWithdrawal: "Withdrawal",
+}
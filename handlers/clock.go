@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"time"
+)
+
+// DefaultMaxClockSkew is how far the requested_at of a transfer may be from
+// the server's clock before the transfer is rejected
+const DefaultMaxClockSkew = 5 * time.Minute
+
+// SetClock makes the handler take the time from now instead of time.Now. All
+// timestamps it stores come from this clock.
+func (h *Handler) SetClock(now func() time.Time) {
+	h.clock = now
+	h.lookups.Now = now
+}
+
+// SetMaxClockSkew rejects transfers whose requested_at is more than skew from
+// the server's clock. A skew of 0 accepts any requested_at.
+func (h *Handler) SetMaxClockSkew(skew time.Duration) {
+	h.maxClockSkew = skew
+}
+
+// now returns the current time of the handler's clock
+func (h *Handler) now() time.Time {
+	if h.clock != nil {
+		return h.clock()
+	}
+	return time.Now()
+}
+
+// skewed reports whether requestedAt, in Unix seconds, is too far from now
+// to be shown alongside the server's timestamp. An unset requestedAt never is.
+func (h *Handler) skewed(requestedAt int64, now time.Time) bool {
+	if requestedAt == 0 || h.maxClockSkew <= 0 {
+		return false
+	}
+	return now.Sub(time.Unix(requestedAt, 0)).Abs() > h.maxClockSkew
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"cse512/datamodels"
+	"cse512/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Confirmation-of-payee lookups are limited per user and per client address,
+// so that account numbers cannot be enumerated to harvest names
+var (
+	ConfirmPayeeBurst    = 10          // Lookups allowed at once
+	ConfirmPayeeInterval = time.Minute // Time to regain one lookup
+)
+
+// ConfirmPayeeResponse tells a sender who holds an account and whether that is
+// who they expect
+type ConfirmPayeeResponse struct {
+	AccountNumber int64  `json:"account_number"`
+	MaskedName    string `json:"masked_name"` // First name and last initial of the holder
+	Result        string `json:"result"`      // One of datamodels.NameMatch, NameCloseMatch or NameNoMatch
+}
+
+// ConfirmPayee checks a name typed by a sender against the holder of an
+// account before money is sent to it
+func (h *Handler) ConfirmPayee(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var request struct {
+		UserID        int    `json:"user_id"`
+		AccountNumber int64  `json:"account_number"`
+		Name          string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to parse JSON.",
+		})
+		return
+	}
+
+	// Validate fields
+	if strings.TrimSpace(request.Name) == "" || request.AccountNumber <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "name and account_number are required.",
+		})
+		return
+	}
+
+	// Every lookup counts against both limits, whether or not the account exists
+	for _, key := range []string{"user:" + strconv.Itoa(request.UserID), "ip:" + h.callerIP(r)} {
+		if ok, retryAfter := h.lookups.Allow(key); !ok {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: fmt.Sprintf("Too many lookups, try again in %d seconds.", seconds),
+			})
+			return
+		}
+	}
+
+	ctx := r.Context()
+
+	if _, err := h.users.FindByID(ctx, request.UserID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "User not found.",
+			})
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "Failed to fetch user's data.",
+			})
+		}
+		return
+	}
+
+	// Find the holder of the account
+	account, err := h.accounts.FindByNumber(ctx, request.AccountNumber)
+	var holder datamodels.User
+	if err == nil {
+		holder, err = h.users.FindByID(ctx, account.UserID)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "Account not found.",
+			})
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "Failed to fetch account.",
+			})
+		}
+		return
+	}
+
+	result := datamodels.MatchName(request.Name, holder.FullName())
+	messages := map[string]string{
+		datamodels.NameMatch:      "The name matches the account holder.",
+		datamodels.NameCloseMatch: fmt.Sprintf("The name is close to the account holder's, %s.", holder.MaskedName()),
+		datamodels.NameNoMatch:    "The name does not match the account holder.",
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Status:  "success",
+		Message: messages[result],
+		Data: ConfirmPayeeResponse{
+			AccountNumber: account.AccountNumber,
+			MaskedName:    holder.MaskedName(),
+			Result:        result,
+		},
+	})
+}
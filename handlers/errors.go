@@ -0,0 +1,16 @@
+package handlers
+
+// Error codes returned in the code field of failed money requests, so clients
+// do not have to match on messages
+const (
+	CodeRejected          = "REQUEST_REJECTED"   // Malformed body or invalid field, nothing was attempted
+	CodeNotFound          = "NOT_FOUND"          // Sender, receiver, user or account does not exist
+	CodeAccountMismatch   = "ACCOUNT_MISMATCH"   // Account number does not belong to the sender or receiver
+	CodeInsufficientFunds = "INSUFFICIENT_FUNDS" // Balance does not cover the debit
+	CodeCoolingOff        = "PAYEE_COOLING_OFF"  // Amount is over NewPayeeLimit for a recently saved payee
+	CodeInvalidState      = "INVALID_STATE"      // The transaction's status does not allow the change
+	CodeLimitExceeded     = "LIMIT_EXCEEDED"     // The transfer would go over one of the sender's transfer limits
+	CodeDeclined          = "TRANSFER_DECLINED"  // Fraud screening refused the transfer
+	CodeFrozen            = "ACCOUNT_FROZEN"     // An admin froze the account money would move from or to
+	CodeInternal          = "INTERNAL_ERROR"     // Database failure
+)
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/fx"
+	"cse512/ledger"
+	"errors"
+	"fmt"
+)
+
+// FXFeeBasisPoints is the fee on transfers between currencies, in hundredths
+// of a percent of the amount sent
+var FXFeeBasisPoints int64 = 50
+
+// errConversionUnavailable is returned when no rate provider is configured
+var errConversionUnavailable = errors.New("currency conversion is not available")
+
+// errAmountTooSmall is returned when nothing would be left to credit after the
+// fee and conversion
+var errAmountTooSmall = errors.New("amount is too small to convert")
+
+// errConvertedTooLarge is returned when the converted amount exceeds ledger.MaxAmount
+var errConvertedTooLarge = errors.New("converted amount is too large")
+
+// convert quotes the exchange of amount into currency: the fee is taken in
+// amount's currency and the rest converted at the provider's rate
+func (h *Handler) convert(ctx context.Context, amount datamodels.Money, currency string) (datamodels.Conversion, error) {
+	if h.rates == nil {
+		return datamodels.Conversion{}, errConversionUnavailable
+	}
+
+	rate, err := h.rates.Rate(ctx, amount.Currency, currency)
+	if err != nil {
+		return datamodels.Conversion{}, err
+	}
+
+	fee, err := fx.Fee(amount, FXFeeBasisPoints)
+	if err != nil {
+		return datamodels.Conversion{}, err
+	}
+	exchanged, err := amount.Sub(fee)
+	if err != nil {
+		return datamodels.Conversion{}, err
+	}
+	converted, err := rate.Convert(exchanged)
+	if err != nil {
+		return datamodels.Conversion{}, err
+	}
+	if converted.Sign() <= 0 {
+		return datamodels.Conversion{}, errAmountTooSmall
+	}
+	if ledger.ValidateAmount(converted) != nil {
+		return datamodels.Conversion{}, errConvertedTooLarge
+	}
+
+	return datamodels.Conversion{Rate: rate.String(), Fee: fee, Converted: converted}, nil
+}
+
+// conversionErrorMessage explains why a transfer from one currency to another
+// could not be converted
+func conversionErrorMessage(err error, from, to string) string {
+	switch {
+	case errors.Is(err, errConversionUnavailable):
+		return fmt.Sprintf("Transfers from %s to %s accounts are not available.", from, to)
+	case errors.Is(err, fx.ErrNoRate):
+		return fmt.Sprintf("No exchange rate from %s to %s.", from, to)
+	case errors.Is(err, errAmountTooSmall):
+		return "Amount is too small to convert."
+	case errors.Is(err, errConvertedTooLarge):
+		return fmt.Sprintf("Converted amount must be at most %d %s.", ledger.MaxAmount, to)
+	}
+	return "Failed to convert amount."
+}
+
+// ConversionDetails shows both sides of a transfer between currencies in
+// statements. Amounts are positive, currencies are given alongside since
+// amounts are encoded as plain numbers.
+type ConversionDetails struct {
+	OriginalAmount    datamodels.Money `json:"original_amount"`
+	OriginalCurrency  string           `json:"original_currency"`
+	ConvertedAmount   datamodels.Money `json:"converted_amount"`
+	ConvertedCurrency string           `json:"converted_currency"`
+	Rate              string           `json:"rate"`
+	Fee               datamodels.Money `json:"fee"`
+}
+
+// conversionDetails returns the conversion applied to t, or nil if t was not
+// converted
+func conversionDetails(t datamodels.Transaction) *ConversionDetails {
+	if t.FX == nil {
+		return nil
+	}
+	return &ConversionDetails{
+		OriginalAmount:    t.Amount,
+		OriginalCurrency:  t.Amount.Currency,
+		ConvertedAmount:   t.FX.Converted,
+		ConvertedCurrency: t.FX.Converted.Currency,
+		Rate:              t.FX.Rate,
+		Fee:               t.FX.Fee,
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"cse512/auth"
+	"cse512/datamodels"
+	"cse512/fx"
+	"cse512/ratelimit"
+	"cse512/repository"
+	"cse512/risk"
+	"time"
+)
+
+// Handler serves the bank API on top of the repositories of a store
+type Handler struct {
+	users           repository.UserRepository
+	accounts        repository.AccountRepository
+	payees          repository.PayeeRepository
+	schedules       repository.ScheduleRepository
+	transactions    repository.TransactionRepository
+	attempts        repository.AttemptRepository
+	store           repository.Store
+	rates           fx.Provider               // nil if transfers between currencies are disabled
+	payeeCoolingOff time.Duration             // 0 if new payees can receive any amount
+	lookups         *ratelimit.Limiter        // Confirmation-of-payee lookups per user and address
+	clock           func() time.Time          // Current time, time.Now if nil
+	maxClockSkew    time.Duration             // 0 if any requested_at is accepted
+	holdExpiry      time.Duration             // How long authorizations hold their amount
+	transferLimits  datamodels.TransferLimits // Limits of users who have none of their own
+	risk            *risk.Engine              // nil if transfers are not screened for fraud
+	tokens          *auth.Signer              // Signs the tokens issued at login
+	requireTokens   bool                      // false if customers may call their routes without a token
+	behindProxy     bool                      // true if callers' addresses are taken from X-Forwarded-For
+}
+
+// New returns a Handler backed by store
+func New(store repository.Store) *Handler {
+	return &Handler{
+		users:          store.Users(),
+		accounts:       store.Accounts(),
+		payees:         store.Payees(),
+		schedules:      store.Schedules(),
+		transactions:   store.Transactions(),
+		attempts:       store.Attempts(),
+		store:          store,
+		lookups:        ratelimit.New(ConfirmPayeeBurst, ConfirmPayeeInterval),
+		maxClockSkew:   DefaultMaxClockSkew,
+		holdExpiry:     DefaultHoldExpiry,
+		transferLimits: DefaultTransferLimits,
+		tokens:         auth.NewSigner(auth.RandomSecret(), DefaultTokenTTL),
+	}
+}
+
+// SetRates enables transfers between accounts in different currencies at the
+// rates of provider
+func (h *Handler) SetRates(provider fx.Provider) {
+	h.rates = provider
+}
+
+// SetRiskEngine screens transfers to other users with engine before they are
+// committed. A nil engine disables screening.
+func (h *Handler) SetRiskEngine(engine *risk.Engine) {
+	h.risk = engine
+}
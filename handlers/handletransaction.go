@@ -3,45 +3,50 @@ package handlers
 import (
 	"context"
 	"cse512/datamodels"
-	"cse512/db"
+	"cse512/ledger"
+	"cse512/limits"
+	"cse512/repository"
+	"cse512/risk"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
+	"time"
 )
 
 // Response structure for sending API responses
 type Transaction struct {
-	Status         string `json:"status"`
-	Message        string `json:"message"`
-	UpdatedBalance int    `json:"updated_balance"`
+	Status         string           `json:"status"`
+	Message        string           `json:"message"`
+	Code           string           `json:"code,omitempty"` // One of the Code constants when Status is "error"
+	UpdatedBalance datamodels.Money `json:"updated_balance"`
+	TransactionID  int              `json:"transaction_id,omitempty"` // Set once the transaction is recorded
 }
 
-// insertErrorTransaction inserts a failed transaction record into the database
-func insertErrorTransaction(senderID, receiverID, amount int, remarks string, timestamp int64, status string) {
-	client := db.GetClient()
-	transactionsCollection := client.Database("bank").Collection("transactions")
+// refuse writes the error response for a transaction that could not be
+// completed and records the attempt with the code and message the client was
+// given, so the user still sees it in their statements
+func (h *Handler) refuse(ctx context.Context, w http.ResponseWriter, status int, attempt datamodels.Transaction, response Transaction) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+	h.recordAttempt(ctx, attempt, response.Code, response.Message)
+}
 
-	failedTransaction := datamodels.Transaction{
-		SenderID:      senderID,
-		ReceiverID:    receiverID,
-		Amount:        amount,
-		Remarks:       remarks,
-		DateTimeStamp: timestamp,
-		Status:        status,
+// recordAttempt records a transaction that could not be completed. Nothing
+// was posted, so it is kept apart from the ledger.
+func (h *Handler) recordAttempt(ctx context.Context, attempt datamodels.Transaction, code, message string) {
+	if err := ledger.RecordAttempt(ctx, h.store, datamodels.AttemptOf(attempt, code, message)); err != nil {
+		fmt.Println("Error logging failed transaction:", err)
+		return
 	}
-
-	transactionsCollection.InsertOne(context.Background(), failedTransaction)
 	fmt.Println("Failed transaction logged.")
 }
 
 // PerformTransaction handles a transaction between sender and receiver (withdraw, deposit, or transfer)
-func PerformTransaction(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) PerformTransaction(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method == http.MethodOptions {
@@ -54,25 +59,33 @@ func PerformTransaction(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(Transaction{
 			Status:  "error",
 			Message: "Invalid request method. Only POST is allowed.",
+			Code:    CodeRejected,
 		})
 		return
 	}
 
-	// Parse request body to get transaction details
+	// Parse request body to get transaction details. The receiver is given
+	// by account_number, receiver_id may be left out, or by a saved payee.
 	var transaction struct {
-		SenderID      int    `json:"sender_id"`
-		ReceiverID    int    `json:"receiver_id"`
-		AccountNumber int    `json:"account_number"`
-		Amount        int    `json:"amount"`
-		Remarks       string `json:"remarks"`
-		Timestamp     int64  `json:"dateTimeStamp"`
+		SenderID      int              `json:"sender_id"`
+		PayeeID       int64            `json:"payee_id"`
+		ReceiverID    int              `json:"receiver_id"`
+		FromAccount   int64            `json:"from_account"` // Defaults to the sender's primary account
+		AccountNumber int64            `json:"account_number"`
+		Amount        datamodels.Money `json:"amount"`
+		Remarks       string           `json:"remarks"`
+		RequestedAt   int64            `json:"requested_at"`  // The client's time, shown but never used for the ledger
+		Authorize     bool             `json:"authorize"`     // Only hold the amount until the transfer is captured
+		Timestamp     int64            `json:"dateTimeStamp"` // Older name of requested_at
 	}
 
 	err := json.NewDecoder(r.Body).Decode(&transaction)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{
-			"message": "Failed to parse JSON.",
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Transaction{
+			Status:  "error",
+			Message: decodeErrorMessage(err),
+			Code:    CodeRejected,
 		})
 		return
 	}
@@ -81,233 +94,479 @@ func PerformTransaction(w http.ResponseWriter, r *http.Request) {
 	receiverID := transaction.ReceiverID
 	amount := transaction.Amount
 	remarks := transaction.Remarks
-	timestamp := transaction.Timestamp
+	requestedAt := transaction.RequestedAt
+	if requestedAt == 0 {
+		requestedAt = transaction.Timestamp
+	}
 	accountNumber := transaction.AccountNumber
+	fromAccount := transaction.FromAccount
+
+	ctx := r.Context()
+
+	// A verified payee saved by the sender stands in for the receiver
+	var payee *datamodels.Payee
+	if transaction.PayeeID != 0 {
+		saved, err := h.ownPayee(ctx, senderID, transaction.PayeeID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(Transaction{
+					Status:  "error",
+					Message: "Payee not found.",
+					Code:    CodeNotFound,
+				})
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(Transaction{
+					Status:  "error",
+					Message: "Failed to fetch payee.",
+					Code:    CodeInternal,
+				})
+			}
+			return
+		}
+		if accountNumber != 0 && accountNumber != saved.AccountNumber {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:  "error",
+				Message: "payee_id cannot be combined with another account_number.",
+				Code:    CodeRejected,
+			})
+			return
+		}
+		if !saved.Verified {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:  "error",
+				Message: "Payee is not verified.",
+				Code:    CodeAccountMismatch,
+			})
+			return
+		}
+		payee = &saved
+		accountNumber = saved.AccountNumber
+	}
 
 	// Validate fields
-	if amount == 0 {
+	if amount.IsZero() {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(Transaction{
 			Status:  "error",
 			Message: "Amount is required.",
+			Code:    CodeRejected,
 		})
 		return
 	}
 
-	// Get MongoDB client and database
-	client := db.GetClient()
-	database := client.Database("bank")
-	usersCollection := database.Collection("users")
-	transactionsCollection := database.Collection("transactions")
+	if senderID <= 0 || receiverID < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Transaction{
+			Status:  "error",
+			Message: "sender_id and receiver_id must be positive.",
+			Code:    CodeRejected,
+		})
+		return
+	}
 
-	// Find sender's data including account number and balance
-	var sender struct {
-		Balance int `bson:"current_balance"`
+	if accountNumber <= 0 || fromAccount < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Transaction{
+			Status:  "error",
+			Message: "account_number is required and account numbers must be positive.",
+			Code:    CodeRejected,
+		})
+		return
 	}
 
-	err = usersCollection.FindOne(context.Background(), bson.M{"user_id": senderID}).Decode(&sender)
-	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		if err == mongo.ErrNoDocuments {
-			json.NewEncoder(w).Encode(Transaction{
-				Status:         "error",
-				Message:        "Sender not found.",
-				UpdatedBalance: sender.Balance,
-			})
-			insertErrorTransaction(senderID, receiverID, amount, remarks, timestamp, "failed")
-		} else {
-			json.NewEncoder(w).Encode(Transaction{
-				Status:         "error",
-				Message:        "Failed to fetch sender's data.",
-				UpdatedBalance: sender.Balance,
-			})
-			insertErrorTransaction(senderID, receiverID, amount, remarks, timestamp, "failed")
-		}
+	// A sender naming themselves as receiver deposits into (positive amount)
+	// or withdraws from (negative amount) the account against the cash
+	// account, unless money moves from another of their accounts
+	cash := senderID == receiverID && (fromAccount == 0 || fromAccount == accountNumber)
+
+	// Transfers move a positive amount from sender to receiver. A self
+	// transaction carries its direction in the sign, so check the magnitude.
+	if message := validateTransferAmount(cash, amount); message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Transaction{
+			Status:  "error",
+			Message: message,
+			Code:    CodeRejected,
+		})
 		return
 	}
 
-	// Check if sender has enough balance for withdrawal
-	if sender.Balance < amount && senderID != receiverID {
+	// Only transfers can be held, cash moves at once
+	if transaction.Authorize && cash {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(Transaction{
-			Status:         "error",
-			Message:        "Insufficient balance.",
-			UpdatedBalance: sender.Balance,
+			Status:  "error",
+			Message: "Only transfers can be authorized.",
+			Code:    CodeRejected,
+		})
+		return
+	}
+
+	// The server's clock dates the transaction, so a client cannot backdate it
+	// into another statement. The client's time is only kept for display and
+	// rejected if it is too far off to be believable.
+	now := h.now()
+	if h.skewed(requestedAt, now) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Transaction{
+			Status:  "error",
+			Message: fmt.Sprintf("requested_at must be within %s of the server's time.", h.maxClockSkew),
+			Code:    CodeRejected,
 		})
-		insertErrorTransaction(senderID, receiverID, amount, remarks, timestamp, "failed")
 		return
 	}
 
-	// Find receiver's data including account number and balance
-	var receiver struct {
-		AccountNumber int `bson:"account_number"`
-		Balance       int `bson:"current_balance"`
+	// The transaction as requested, recorded as an attempt if it cannot complete
+	attempt := datamodels.Transaction{
+		SenderID:        senderID,
+		SenderAccount:   fromAccount,
+		ReceiverID:      receiverID,
+		ReceiverAccount: accountNumber,
+		Amount:          amount,
+		Remarks:         remarks,
+		DateTimeStamp:   now.Unix(),
+		RequestedAt:     requestedAt,
+		Schedule:        scheduleRunFrom(ctx),
 	}
-	err = usersCollection.FindOne(context.Background(), bson.M{"user_id": receiverID}).Decode(&receiver)
+	if cash {
+		attempt.SenderAccount = accountNumber
+	}
+	attempt.Type = attempt.EffectiveType()
+
+	// Find sender's data including their primary account number
+	sender, err := h.users.FindByID(ctx, senderID)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		if err == mongo.ErrNoDocuments {
-			json.NewEncoder(w).Encode(Transaction{
-				Status:         "error",
-				Message:        "Receiver not found.",
-				UpdatedBalance: sender.Balance,
+		if errors.Is(err, repository.ErrNotFound) {
+			h.refuse(ctx, w, http.StatusNotFound, attempt, Transaction{
+				Status:  "error",
+				Message: "Sender not found.",
+				Code:    CodeNotFound,
 			})
-			insertErrorTransaction(senderID, receiverID, amount, remarks, timestamp, "failed")
 		} else {
-			json.NewEncoder(w).Encode(Transaction{
-				Status:         "error",
-				Message:        "Failed to fetch receiver's data.",
-				UpdatedBalance: sender.Balance,
+			h.refuse(ctx, w, http.StatusNotFound, attempt, Transaction{
+				Status:  "error",
+				Message: "Failed to fetch sender's data.",
+				Code:    CodeInternal,
 			})
-			insertErrorTransaction(senderID, receiverID, amount, remarks, timestamp, "failed")
 		}
 		return
 	}
 
-	// Check if receiver's account number matches
-	if receiver.AccountNumber != accountNumber {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(Transaction{
-			Status:  "error",
-			Message: "Receiver's account number does not match.",
-		})
-		insertErrorTransaction(senderID, receiverID, amount, remarks, timestamp, "failed")
+	// Find the account the money comes from
+	from, err := h.ownAccount(ctx, sender, attempt.SenderAccount)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) || errors.Is(err, errNotOwner) {
+			message := "Sender's account number does not match."
+			if cash {
+				message = "Receiver's account number does not match."
+			}
+			h.refuse(ctx, w, http.StatusBadRequest, attempt, Transaction{
+				Status:  "error",
+				Message: message,
+				Code:    CodeAccountMismatch,
+			})
+		} else {
+			h.refuse(ctx, w, http.StatusInternalServerError, attempt, Transaction{
+				Status:  "error",
+				Message: "Failed to fetch sender's account.",
+				Code:    CodeInternal,
+			})
+		}
 		return
 	}
+	attempt.SenderAccount = from.AccountNumber
 
-	// Start MongoDB session to ensure atomicity
-	session, err := client.StartSession()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(Transaction{
+	// Amounts are taken from the sender's balance, so must be in its currency
+	if amount.Currency != from.Balance.Currency {
+		h.refuse(ctx, w, http.StatusBadRequest, attempt, Transaction{
 			Status:         "error",
-			Message:        "Failed to start session.",
-			UpdatedBalance: sender.Balance,
+			Message:        fmt.Sprintf("Amount must be in %s.", from.Balance.Currency),
+			Code:           CodeRejected,
+			UpdatedBalance: from.Balance,
 		})
 		return
 	}
-	defer session.EndSession(context.Background())
 
-	// Start transaction
-	err = session.StartTransaction()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(Transaction{
+	// Check if sender has enough balance for withdrawal, less what is held
+	if from.Available().Cmp(amount) < 0 && !cash {
+		h.refuse(ctx, w, http.StatusBadRequest, attempt, Transaction{
 			Status:         "error",
-			Message:        "Failed to start transaction.",
-			UpdatedBalance: sender.Balance,
+			Message:        "Insufficient balance.",
+			Code:           CodeInsufficientFunds,
+			UpdatedBalance: from.Balance,
 		})
 		return
 	}
 
-	// Handle self transaction (withdrawal or deposit)
-	if senderID == receiverID {
-		if amount > 0 {
-			// Deposit: Increase balance
-			_, err := usersCollection.UpdateOne(
-				context.Background(),
-				bson.M{"user_id": receiverID},
-				bson.M{"$inc": bson.M{"current_balance": amount}},
-			)
-			if err != nil {
-				session.AbortTransaction(context.Background())
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(Transaction{
+	// Find receiver's data, if the request names them
+	if receiverID != 0 && receiverID != senderID {
+		if _, err := h.users.FindByID(ctx, receiverID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				h.refuse(ctx, w, http.StatusNotFound, attempt, Transaction{
 					Status:         "error",
-					Message:        "Failed to update balance (deposit).",
-					UpdatedBalance: sender.Balance,
+					Message:        "Receiver not found.",
+					Code:           CodeNotFound,
+					UpdatedBalance: from.Balance,
 				})
-				insertErrorTransaction(senderID, receiverID, amount, remarks, timestamp, "failed")
-				return
-			}
-		} else {
-			// Withdrawal: Decrease balance
-			_, err := usersCollection.UpdateOne(
-				context.Background(),
-				bson.M{"user_id": senderID},
-				bson.M{"$inc": bson.M{"current_balance": amount}},
-			)
-			if err != nil {
-				session.AbortTransaction(context.Background())
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(Transaction{
+			} else {
+				h.refuse(ctx, w, http.StatusNotFound, attempt, Transaction{
 					Status:         "error",
-					Message:        "Failed to update balance (withdrawal).",
-					UpdatedBalance: sender.Balance,
+					Message:        "Failed to fetch receiver's data.",
+					Code:           CodeInternal,
+					UpdatedBalance: from.Balance,
 				})
-				insertErrorTransaction(senderID, receiverID, amount, remarks, timestamp, "failed")
-				return
 			}
+			return
 		}
+	}
+
+	// Find the account the money goes to, which must be the receiver's
+	to, err := h.accounts.FindByNumber(ctx, accountNumber)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		h.refuse(ctx, w, http.StatusInternalServerError, attempt, Transaction{
+			Status:         "error",
+			Message:        "Failed to fetch receiver's account.",
+			Code:           CodeInternal,
+			UpdatedBalance: from.Balance,
+		})
+		return
+	}
+	if errors.Is(err, repository.ErrNotFound) && receiverID == 0 {
+		h.refuse(ctx, w, http.StatusNotFound, attempt, Transaction{
+			Status:         "error",
+			Message:        "Receiver's account not found.",
+			Code:           CodeNotFound,
+			UpdatedBalance: from.Balance,
+		})
+		return
+	}
+	if err != nil || (receiverID != 0 && to.UserID != receiverID) {
+		h.refuse(ctx, w, http.StatusBadRequest, attempt, Transaction{
+			Status:  "error",
+			Message: "Receiver's account number does not match.",
+			Code:    CodeAccountMismatch,
+		})
+		return
+	}
+	attempt.ReceiverID = to.UserID
+
+	// Frozen accounts can neither send nor receive
+	if from.Frozen || to.Frozen {
+		h.refuse(ctx, w, http.StatusForbidden, attempt, Transaction{
+			Status:         "error",
+			Message:        "Account is frozen. Please contact support.",
+			Code:           CodeFrozen,
+			UpdatedBalance: from.Balance,
+		})
+		return
+	}
+
+	if !cash && to.AccountNumber == from.AccountNumber {
+		h.refuse(ctx, w, http.StatusBadRequest, attempt, Transaction{
+			Status:         "error",
+			Message:        "Cannot transfer to the account the money comes from.",
+			Code:           CodeRejected,
+			UpdatedBalance: from.Balance,
+		})
+		return
+	}
+
+	// New payees can only receive small amounts until the cooling-off period ends
+	if payee != nil {
+		if ends := h.coolingOffEnds(*payee); !ends.IsZero() && !withinNewPayeeLimit(amount) {
+			h.refuse(ctx, w, http.StatusForbidden, attempt, Transaction{
+				Status:         "error",
+				Message:        fmt.Sprintf("New payees can receive at most %d until %s.", NewPayeeLimit, ends.UTC().Format(time.RFC3339)),
+				Code:           CodeCoolingOff,
+				UpdatedBalance: from.Balance,
+			})
+			return
+		}
+	}
+
+	completedTransaction := attempt
+	completedTransaction.Status = datamodels.StatusSettled
+	if cash {
+		completedTransaction.Postings = datamodels.CashPostings(to, amount)
 	} else {
-		// Standard transfer: sender != receiver
-		_, err := usersCollection.UpdateOne(context.Background(), bson.M{"user_id": senderID}, bson.M{"$inc": bson.M{"current_balance": -amount}})
+		completedTransaction.Postings = datamodels.TransferPostings(from, to, amount)
+	}
+
+	// Convert transfers to accounts in another currency
+	if !cash && to.Balance.Currency != amount.Currency {
+		conversion, err := h.convert(ctx, amount, to.Balance.Currency)
 		if err != nil {
-			session.AbortTransaction(context.Background())
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(Transaction{
+			h.refuse(ctx, w, http.StatusBadRequest, attempt, Transaction{
 				Status:         "error",
-				Message:        "Failed to update sender's balance.",
-				UpdatedBalance: sender.Balance,
+				Message:        conversionErrorMessage(err, amount.Currency, to.Balance.Currency),
+				Code:           CodeRejected,
+				UpdatedBalance: from.Balance,
 			})
-			insertErrorTransaction(senderID, receiverID, amount, remarks, timestamp, "failed")
 			return
 		}
+		completedTransaction.FX = &conversion
+		completedTransaction.Postings = datamodels.ConversionPostings(from, to, amount, conversion.Fee, conversion.Converted)
+	}
 
-		_, err = usersCollection.UpdateOne(context.Background(), bson.M{"user_id": receiverID}, bson.M{"$inc": bson.M{"current_balance": amount}})
+	// Screen transfers to other users for fraud. Denied transfers are
+	// refused, those held for review wait as pending for an admin's decision.
+	if h.risk != nil && !cash && to.UserID != senderID {
+		assessment, err := h.risk.Assess(ctx, h.store, risk.Transfer{Transaction: completedTransaction, Payee: payee, Now: now})
 		if err != nil {
-			session.AbortTransaction(context.Background())
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(Transaction{
+			h.refuse(ctx, w, http.StatusInternalServerError, attempt, Transaction{
 				Status:         "error",
-				Message:        "Failed to update receiver's balance.",
-				UpdatedBalance: sender.Balance,
+				Message:        "Failed to screen transfer.",
+				Code:           CodeInternal,
+				UpdatedBalance: from.Balance,
+			})
+			return
+		}
+		attempt.Risk = &assessment
+		completedTransaction.Risk = &assessment
+
+		if assessment.Decision == datamodels.RiskDeny {
+			h.refuse(ctx, w, http.StatusForbidden, attempt, Transaction{
+				Status:         "error",
+				Message:        "Transfer was declined.",
+				Code:           CodeDeclined,
+				UpdatedBalance: from.Balance,
 			})
-			insertErrorTransaction(senderID, receiverID, amount, remarks, timestamp, "failed")
 			return
 		}
 	}
+	review := completedTransaction.Risk != nil && completedTransaction.Risk.Decision == datamodels.RiskReview
 
-	// Commit the transaction
-	err = session.CommitTransaction(context.Background())
+	// The sender's own limits, or the defaults
+	transferLimits, err := limits.For(ctx, h.store, h.transferLimits, senderID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(Transaction{
+		h.refuse(ctx, w, http.StatusInternalServerError, attempt, Transaction{
 			Status:         "error",
-			Message:        "Failed to commit transaction.",
-			UpdatedBalance: sender.Balance,
+			Message:        "Failed to fetch transfer limits.",
+			Code:           CodeInternal,
+			UpdatedBalance: from.Balance,
 		})
-		insertErrorTransaction(senderID, receiverID, amount, remarks, timestamp, "failed")
 		return
 	}
 
-	// Log transaction in the transactions collection
-	completedTransaction := datamodels.Transaction{
-		SenderID:      senderID,
-		ReceiverID:    receiverID,
-		Amount:        amount,
-		Remarks:       remarks,
-		DateTimeStamp: timestamp,
-		Status:        "success",
+	// Update the balances and log the transaction atomically, or only hold
+	// the amount for an authorization or review. The balance is checked again
+	// here since it may have changed since it was read above, and so are the
+	// limits, against the transfers sent up to this one.
+	enforceLimits := limits.Enforce(h.store, transferLimits, completedTransaction, now)
+	message := "Transaction completed successfully."
+	var recorded datamodels.Transaction
+	if review {
+		message = "Transaction is held for review."
+		recorded, err = ledger.Review(ctx, h.store, completedTransaction, enforceLimits)
+	} else if transaction.Authorize {
+		message = "Transaction authorized successfully."
+		recorded, err = ledger.Authorize(ctx, h.store, completedTransaction, now.Add(h.holdExpiry).Unix(), enforceLimits)
+	} else {
+		recorded, err = ledger.Post(ctx, h.store, completedTransaction, enforceLimits)
 	}
-
-	_, err = transactionsCollection.InsertOne(context.Background(), completedTransaction)
+	var exceeded *limits.ExceededError
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		if errors.As(err, &exceeded) {
+			h.refuse(ctx, w, http.StatusForbidden, attempt, Transaction{
+				Status:         "error",
+				Message:        limitMessage(exceeded),
+				Code:           CodeLimitExceeded,
+				UpdatedBalance: from.Balance,
+			})
+		} else if errors.Is(err, repository.ErrInsufficientFunds) {
+			h.refuse(ctx, w, http.StatusBadRequest, attempt, Transaction{
+				Status:         "error",
+				Message:        "Insufficient balance.",
+				Code:           CodeInsufficientFunds,
+				UpdatedBalance: from.Balance,
+			})
+		} else if errors.Is(err, repository.ErrDuplicateRun) {
+			// Another scheduler instance made this occurrence meanwhile,
+			// which is no refusal of the transfer to record
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:         "error",
+				Message:        "The occurrence was already made.",
+				Code:           CodeInvalidState,
+				UpdatedBalance: from.Balance,
+			})
+		} else if errors.Is(err, datamodels.ErrCurrencyMismatch) {
+			h.refuse(ctx, w, http.StatusBadRequest, attempt, Transaction{
+				Status:         "error",
+				Message:        "Receiver's account is in another currency.",
+				Code:           CodeRejected,
+				UpdatedBalance: from.Balance,
+			})
+		} else {
+			h.refuse(ctx, w, http.StatusInternalServerError, attempt, Transaction{
+				Status:         "error",
+				Message:        "Failed to commit transaction.",
+				Code:           CodeInternal,
+				UpdatedBalance: from.Balance,
+			})
+		}
+		return
+	}
+
+	if updated, err := h.accounts.FindByNumber(ctx, from.AccountNumber); err == nil {
+		from = updated
+	}
+	// Transfers held for review are accepted but have not moved money yet
+	if review {
+		w.WriteHeader(http.StatusAccepted)
 		json.NewEncoder(w).Encode(Transaction{
-			Status:         "error",
-			Message:        "Failed to log transaction.",
-			UpdatedBalance: sender.Balance,
+			Status:         datamodels.StatusPending,
+			Message:        message,
+			UpdatedBalance: from.Balance,
+			TransactionID:  recorded.TransactionID,
 		})
 		return
 	}
 
-	err = usersCollection.FindOne(context.Background(), bson.M{"user_id": senderID}).Decode(&sender)
 	// Success response
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(Transaction{
 		Status:         "success",
-		Message:        "Transaction completed successfully.",
-		UpdatedBalance: sender.Balance,
+		Message:        message,
+		UpdatedBalance: from.Balance,
+		TransactionID:  recorded.TransactionID,
 	})
 }
+
+// validateTransferAmount returns why amount is not acceptable, or "" if it is
+func validateTransferAmount(cash bool, amount datamodels.Money) string {
+	switch {
+	case !cash:
+		if ledger.ValidateAmount(amount) != nil {
+			return fmt.Sprintf("Transfer amount must be positive and at most %d.", ledger.MaxAmount)
+		}
+	case amount.Sign() > 0:
+		if ledger.ValidateAmount(amount) != nil {
+			return fmt.Sprintf("Deposits are limited to %d.", ledger.MaxAmount)
+		}
+	default:
+		withdrawal, err := amount.Neg()
+		if err != nil || !withinWithdrawalLimit(withdrawal) {
+			return fmt.Sprintf("Withdrawals are limited to %d.", MaxWithdrawal)
+		}
+	}
+	return ""
+}
+
+// decodeErrorMessage explains a request body that could not be decoded.
+// Fractions of a cent, out of range or quoted amounts all fail to decode
+// into datamodels.Money, the only money field of a request.
+func decodeErrorMessage(err error) string {
+	if errors.Is(err, datamodels.ErrInvalidMoney) {
+		return "Invalid value for amount."
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return fmt.Sprintf("Invalid value for %s.", typeErr.Field)
+	}
+	return "Failed to parse JSON."
+}
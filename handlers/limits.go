@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"cse512/audit"
+	"cse512/datamodels"
+	"cse512/limits"
+	"cse512/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// DefaultTransferLimits are the limits of users who have none of their own,
+// in whole units of the sender's currency
+var DefaultTransferLimits = datamodels.TransferLimits{
+	Single:   25000,
+	Daily:    50000,
+	Monthly:  200000,
+	Velocity: 20,
+}
+
+// SetTransferLimits sets the limits of users who have none of their own. A
+// limit of 0 is no limit.
+func (h *Handler) SetTransferLimits(defaults datamodels.TransferLimits) {
+	h.transferLimits = defaults
+}
+
+// limitMessage explains which limit a transfer went over
+func limitMessage(exceeded *limits.ExceededError) string {
+	allowance := exceeded.Allowance
+	switch exceeded.Limit {
+	case limits.Single:
+		return fmt.Sprintf("Transfers are limited to %s each.", allowance.Single)
+	case limits.Daily:
+		return fmt.Sprintf("Transfer exceeds the daily limit, %s can still be sent today.", allowance.Daily)
+	case limits.Monthly:
+		return fmt.Sprintf("Transfer exceeds the monthly limit, %s can still be sent this month.", allowance.Monthly)
+	}
+	return "Too many transfers, try again later."
+}
+
+// LimitsResponse describes a user's transfer limits and what is left of them
+type LimitsResponse struct {
+	Limits     datamodels.TransferLimits `json:"limits"`
+	Allowances []limits.Allowance        `json:"allowances"` // One for each currency of the user's accounts
+}
+
+// GetLimits returns the transfer limits of a user and what they can still send
+func (h *Handler) GetLimits(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Invalid or missing user_id.",
+		})
+		return
+	}
+
+	// The allowances are in the currencies of the user's accounts
+	accounts, err := h.accounts.FindByUser(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to fetch accounts.",
+		})
+		return
+	}
+	if len(accounts) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "User not found.",
+		})
+		return
+	}
+	var currencies []string
+	for _, account := range accounts {
+		currencies = append(currencies, account.Balance.Currency)
+	}
+	slices.Sort(currencies)
+	currencies = slices.Compact(currencies)
+
+	var response LimitsResponse
+	response.Limits, err = limits.For(r.Context(), h.store, h.transferLimits, userID)
+	now := h.now()
+	for i := 0; err == nil && i < len(currencies); i++ {
+		var allowance limits.Allowance
+		allowance, err = limits.Remaining(r.Context(), h.store, response.Limits, userID, currencies[i], now)
+		response.Allowances = append(response.Allowances, allowance)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to fetch limits.",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Status:  "success",
+		Message: "Limits fetched successfully.",
+		Data:    response,
+	})
+}
+
+// SetUserLimits stores transfer limits for a single user. Limits left at 0
+// are the default ones.
+func (h *Handler) SetUserLimits(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "PUT, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Invalid user_id.",
+		})
+		return
+	}
+
+	var request datamodels.TransferLimits
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to parse JSON.",
+		})
+		return
+	}
+	if request.Single < 0 || request.Daily < 0 || request.Monthly < 0 || request.Velocity < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Limits cannot be negative.",
+		})
+		return
+	}
+	request.UserID = userID
+
+	if _, err := h.users.FindByID(r.Context(), userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "User not found.",
+			})
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "Failed to fetch user's data.",
+			})
+		}
+		return
+	}
+
+	event := datamodels.AuditEvent{
+		Action: datamodels.AuditSetLimits,
+		UserID: userID,
+		Detail: fmt.Sprintf("single %d, daily %d, monthly %d, velocity %d", request.Single, request.Daily, request.Monthly, request.Velocity),
+	}
+	err = h.audited(r.Context(), event, func(ctx context.Context, event *datamodels.AuditEvent) error {
+		stored, err := h.store.Limits().FindByUser(ctx, userID)
+		switch {
+		case err == nil:
+			event.Before = audit.Snapshot(stored)
+		case !errors.Is(err, repository.ErrNotFound):
+			return err
+		}
+		event.After = audit.Snapshot(request)
+		return h.store.Limits().Set(ctx, request)
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to store limits.",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Status:  "success",
+		Message: "Limits updated successfully.",
+		Data:    h.transferLimits.Override(request),
+	})
+}
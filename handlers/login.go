@@ -2,12 +2,13 @@ package handlers
 
 import (
 	"context"
-	"cse512/db"
+	"cse512/audit"
+	"cse512/datamodels"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -19,10 +20,10 @@ type Response struct {
 }
 
 // HandleLogin processes user login requests
-func HandleLogin(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method == http.MethodOptions {
@@ -68,16 +69,12 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Continue with database lookup and validation...
-	client := db.GetClient()
-	collection := client.Database("bank").Collection("users")
-
-	// Fetch the user's hashed password from MongoDB
-	var result bson.M
+	// Fetch the user's hashed password from the user repository
 	user_id, _ := strconv.Atoi(userID)
 
-	err = collection.FindOne(context.Background(), bson.M{"user_id": user_id}).Decode(&result)
+	user, err := h.users.FindByID(r.Context(), user_id)
 	if err != nil {
+		h.recordFailedLogin(r.Context(), user_id, "unknown user")
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(Response{
 			Status:  "error",
@@ -87,9 +84,9 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate email and hashed password
-	storedPassword, _ := result["password"].(string)
-	err = bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(password))
+	err = bcrypt.CompareHashAndPassword([]byte(user.PassHash), []byte(password))
 	if err != nil {
+		h.recordFailedLogin(r.Context(), user_id, "wrong password")
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(Response{
 			Status:  "error",
@@ -98,9 +95,8 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	storedEmail, _ := result["email"].(string)
-
-	if storedEmail != email {
+	if user.Email != email {
+		h.recordFailedLogin(r.Context(), user_id, "wrong email")
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(Response{
 			Status:  "error",
@@ -109,17 +105,88 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	accounts, err := h.accounts.FindByUser(r.Context(), user.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Error fetching details. Please try again.",
+		})
+		return
+	}
+
+	// The balances shown are the primary account's, every account is listed.
+	// The available balance leaves out what authorizations hold.
+	var primary datamodels.Account
+	for _, account := range accounts {
+		if account.AccountNumber == user.AccountNumber {
+			primary = account
+		}
+	}
+
+	// A frozen primary account locks the user out until an admin unfreezes it
+	if primary.Frozen {
+		h.recordFailedLogin(r.Context(), user_id, "account frozen")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Account is frozen. Please contact support.",
+		})
+		return
+	}
+
+	// The token identifies the user to endpoints that need a role
+	token, err := h.tokens.Issue(user.UserID, user.EffectiveRole(), h.now())
+	if err == nil {
+		// Tokens are only handed out once the login is on record
+		err = audit.Record(r.Context(), h.store.Audit(), datamodels.AuditEvent{
+			At:      h.now().Unix(),
+			ActorID: user.UserID,
+			Action:  datamodels.AuditLogin,
+			UserID:  user.UserID,
+		})
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Error fetching details. Please try again.",
+		})
+		return
+	}
+
 	// Successful login response
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(Response{
 		Status:  "success",
 		Message: "Login successful.",
 		Data: map[string]any{
-			"user_id":        userID,
-			"email":          email,
-			"name":           result["first_name"].(string) + " " + result["last_name"].(string),
-			"balance":        result["current_balance"],
-			"account_number": result["account_number"],
+			"user_id":           userID,
+			"email":             email,
+			"name":              user.FirstName + " " + user.LastName,
+			"balance":           primary.Balance,
+			"ledger_balance":    primary.Balance,
+			"available_balance": primary.Available(),
+			"currency":          primary.Balance.Currency,
+			"account_number":    user.AccountNumber,
+			"accounts":          accountResponses(user, accounts),
+			"role":              user.EffectiveRole(),
+			"token":             token,
 		},
 	})
 }
+
+// recordFailedLogin adds a refused login as userID to the audit log. Failing
+// to record it does not change the response.
+func (h *Handler) recordFailedLogin(ctx context.Context, userID int, reason string) {
+	err := audit.Record(ctx, h.store.Audit(), datamodels.AuditEvent{
+		At:      h.now().Unix(),
+		ActorID: userID,
+		Action:  datamodels.AuditLoginFailed,
+		UserID:  userID,
+		Reason:  reason,
+	})
+	if err != nil {
+		fmt.Println("Failed to record failed login:", err)
+	}
+}
@@ -1,33 +1,38 @@
 package handlers
 
 import (
-	"context"
-	"cse512/db"
+	"cse512/datamodels"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"golang.org/x/text/language"
-	"golang.org/x/text/message"
 )
 
 type MonthlyTransaction struct {
-	SenderID      int    `json:"sender_id"`
-	ReceiverID    int    `json:"receiver_id"`
-	Amount        int    `json:"amount"`
-	Remarks       string `json:"remarks"`
-	DateTimeStamp string `json:"dateTimeStamp"`
-	Status        string `json:"status"`
+	TransactionID int                `json:"transaction_id,omitempty"`
+	SenderID      int                `json:"sender_id"`
+	ReceiverID    int                `json:"receiver_id"`
+	Amount        datamodels.Money   `json:"amount"`
+	Remarks       string             `json:"remarks"`
+	DateTimeStamp string             `json:"dateTimeStamp"`
+	Status        string             `json:"status"`
+	Type          string             `json:"type"`
+	FX            *ConversionDetails `json:"fx,omitempty"`
+	ReversalOf    int                `json:"reversal_of,omitempty"`
+	Reversals     []int              `json:"reversals,omitempty"`
+	Code          string             `json:"code,omitempty"` // Why an attempt was refused, listed with include_failed
 }
 
-func GetMonthData(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetMonthData(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method == http.MethodOptions {
@@ -39,7 +44,6 @@ func GetMonthData(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		json.NewEncoder(w).Encode(TransactionResponse{
 			Status: "error",
-			Amount: 0,
 		})
 		return
 	}
@@ -85,63 +89,68 @@ func GetMonthData(w http.ResponseWriter, r *http.Request) {
 	startTimestamp := startDate.Unix()
 	endTimestamp := endDate.Unix()
 
-	// Query the MongoDB collection
-	client := db.GetClient()
-	db := client.Database("bank")
-	collection := db.Collection("transactions") // Replace with actual DB and collection names
-
 	user_id, err := strconv.Atoi(userID)
 	if err != nil {
 		http.Error(w, "invalid user_id provided", http.StatusBadRequest)
 		return
 	}
 
-	filter := bson.M{
-		"$or": []bson.M{
-			{"sender_id": user_id},
-			{"receiver_id": user_id},
-		},
-		"dateTimeStamp": bson.M{
-			"$gte": startTimestamp,
-			"$lte": endTimestamp,
-		},
+	// Optionally restrict the statement to one of the user's accounts
+	accountNumber, err := h.accountParam(r, user_id)
+	if errors.Is(err, errInvalidAccountNumber) || errors.Is(err, errNotOwner) {
+		http.Error(w, "account_number must be one of the user's accounts", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error querying database: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Failed transactions and refused attempts are only listed if asked for
+	withFailed, err := includeFailed(r)
+	if err != nil {
+		http.Error(w, "include_failed must be true or false", http.StatusBadRequest)
+		return
 	}
 
-	cursor, err := collection.Find(context.Background(), filter)
+	// Query the transactions of the user, or the account, within the month
+	found, err := h.transactions.FindInRange(r.Context(), user_id, accountNumber, statementStatuses(withFailed), startTimestamp, endTimestamp)
+	var attempts []datamodels.Attempt
+	if err == nil && withFailed {
+		attempts, err = h.attempts.FindInRange(r.Context(), user_id, accountNumber, startTimestamp, endTimestamp)
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("error querying database: %v", err), http.StatusInternalServerError)
 		return
 	}
-	defer cursor.Close(context.Background())
+	transactions := statementEntries(found, attempts, false)
 
 	// Parse the results into a slice
 	var responses []MonthlyTransaction
-	for cursor.Next(context.Background()) {
-		var transaction struct {
-			SenderID      int    `bson:"sender_id"`
-			ReceiverID    int    `bson:"receiver_id"`
-			Amount        int    `bson:"amount"`
-			Remarks       string `bson:"remarks"`
-			DateTimeStamp int    `bson:"dateTimeStamp"`
-			Status        string `bson:"status"`
-		}
-
-		if err := cursor.Decode(&transaction); err != nil {
-			http.Error(w, fmt.Sprintf("error decoding transaction: %v", err), http.StatusInternalServerError)
+	for _, transaction := range transactions {
+		effect, err := effectOn(transaction.Transaction, user_id, accountNumber)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("error reading transaction %d: %v", transaction.TransactionID, err), http.StatusInternalServerError)
 			return
 		}
 
 		// Convert timestamp to string format
-		formattedDate := time.Unix(int64(transaction.DateTimeStamp), 0).Format("02 Jan 2006")
+		formattedDate := time.Unix(transaction.DateTimeStamp, 0).Format("02 Jan 2006")
 
-		// Create the response object
+		// Create the response object, amounts are the change to the user's balance
 		responses = append(responses, MonthlyTransaction{
+			TransactionID: transaction.TransactionID,
 			SenderID:      transaction.SenderID,
 			ReceiverID:    transaction.ReceiverID,
-			Amount:        transaction.Amount,
+			Amount:        effect,
 			Remarks:       transaction.Remarks,
 			DateTimeStamp: formattedDate,
 			Status:        transaction.Status,
+			Type:          transaction.EffectiveType(),
+			FX:            conversionDetails(transaction.Transaction),
+			ReversalOf:    transaction.ReversalOf,
+			Reversals:     transaction.Reversals,
+			Code:          transaction.Code,
 		})
 	}
 
@@ -160,17 +169,37 @@ func GetMonthData(w http.ResponseWriter, r *http.Request) {
 	writer := csv.NewWriter(w)
 
 	// Write the header row
-	err = writer.Write([]string{"Sender ID", "Receiver ID", "Amount", "Remarks", "Date", "Status"})
+	err = writer.Write([]string{"Sender ID", "Receiver ID", "Amount", "Remarks", "Date", "Status", "Type", "Original Amount", "Converted Amount", "Exchange Rate", "Fee", "Transaction ID", "Reversal Of", "Reversed By", "Failure Code"})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("error writing CSV header: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	p := message.NewPrinter(language.English)
-
 	// Write the data rows
 	for _, transaction := range responses {
-		formattedAmount := p.Sprintf("$%.2f", float64(transaction.Amount))
+		formattedAmount := transaction.Amount.Format(language.English)
+
+		// Transfers between currencies also show both sides of the conversion
+		var original, converted, rate, fee string
+		if transaction.FX != nil {
+			original = transaction.FX.OriginalAmount.Format(language.English)
+			converted = transaction.FX.ConvertedAmount.Format(language.English)
+			rate = transaction.FX.Rate
+			fee = transaction.FX.Fee.Format(language.English)
+		}
+
+		// Reversals and the transfers they give back name each other
+		var transactionID, reversalOf string
+		if transaction.TransactionID != 0 {
+			transactionID = strconv.Itoa(transaction.TransactionID)
+		}
+		if transaction.ReversalOf != 0 {
+			reversalOf = strconv.Itoa(transaction.ReversalOf)
+		}
+		reversedBy := make([]string, len(transaction.Reversals))
+		for i, reversal := range transaction.Reversals {
+			reversedBy[i] = strconv.Itoa(reversal)
+		}
 
 		err := writer.Write([]string{
 			strconv.Itoa(transaction.SenderID),
@@ -179,6 +208,15 @@ func GetMonthData(w http.ResponseWriter, r *http.Request) {
 			transaction.Remarks,
 			transaction.DateTimeStamp,
 			transaction.Status,
+			transaction.Type,
+			original,
+			converted,
+			rate,
+			fee,
+			transactionID,
+			reversalOf,
+			strings.Join(reversedBy, " "),
+			transaction.Code,
 		})
 		if err != nil {
 			http.Error(w, fmt.Sprintf("error writing CSV row: %v", err), http.StatusInternalServerError)
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"cse512/audit"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// SetBehindProxy takes the address of callers from the last entry of the
+// X-Forwarded-For header, added by the proxy the server is behind, rather
+// than from the connection. Only enable it behind a proxy that sets the
+// header, or callers can give any address.
+func (h *Handler) SetBehindProxy(behind bool) {
+	h.behindProxy = behind
+}
+
+// requestIDPattern is what a request ID sent by a client must look like to be kept
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// traceRequest gives every request an ID, the one in its X-Request-ID header
+// if it sends a usable one, and returns it in the same header of the
+// response. The ID and the caller's address go into the request's context so
+// the events it leads to in the audit log can be told apart and traced back.
+func (h *Handler) traceRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		ctx := audit.WithOrigin(r.Context(), audit.Origin{IP: h.callerIP(r), RequestID: requestID})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// callerIP returns the address a request came from
+func (h *Handler) callerIP(r *http.Request) string {
+	if h.behindProxy {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			return strings.TrimSpace(hops[len(hops)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// newRequestID returns a random 16 byte ID in hex
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
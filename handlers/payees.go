@@ -0,0 +1,499 @@
+package handlers
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/repository"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// NewPayeeLimit caps the amount a payee can receive in a single transfer
+// during the cooling-off period after it was saved, in whole units of the
+// sender's currency
+var NewPayeeLimit int64 = 1000
+
+// SetPayeeCoolingOff limits transfers to payees saved less than period ago to
+// NewPayeeLimit. A period of 0 disables the limit.
+func (h *Handler) SetPayeeCoolingOff(period time.Duration) {
+	h.payeeCoolingOff = period
+}
+
+// coolingOffEnds returns when payee may first receive more than
+// NewPayeeLimit, or the zero time if it already can
+func (h *Handler) coolingOffEnds(payee datamodels.Payee) time.Time {
+	ends := time.Unix(payee.CreatedAt, 0).Add(h.payeeCoolingOff)
+	if h.payeeCoolingOff <= 0 || !h.now().Before(ends) {
+		return time.Time{}
+	}
+	return ends
+}
+
+// withinNewPayeeLimit reports whether amount may be sent to a payee in its cooling-off period
+func withinNewPayeeLimit(amount datamodels.Money) bool {
+	limit, err := datamodels.FromMajor(NewPayeeLimit, amount.Currency)
+	return err == nil && amount.Cmp(limit) <= 0
+}
+
+// PayeeResponse describes a saved payee to the user who saved it
+type PayeeResponse struct {
+	datamodels.Payee
+	CoolingOffUntil int64 `json:"cooling_off_until,omitempty"` // Unix time until which transfers are capped at NewPayeeLimit
+}
+
+func (h *Handler) payeeResponse(payee datamodels.Payee) PayeeResponse {
+	response := PayeeResponse{Payee: payee}
+	if ends := h.coolingOffEnds(payee); !ends.IsZero() {
+		response.CoolingOffUntil = ends.Unix()
+	}
+	return response
+}
+
+// ownPayee returns the payee with the given ID if userID saved it. Other
+// users' payees are reported as not found.
+func (h *Handler) ownPayee(ctx context.Context, userID int, payeeID int64) (datamodels.Payee, error) {
+	payee, err := h.payees.FindByID(ctx, payeeID)
+	if err == nil && payee.UserID != userID {
+		return datamodels.Payee{}, repository.ErrNotFound
+	}
+	return payee, err
+}
+
+// verifyPayee checks that the payee's name is that of the holder of its
+// account, as the account is now
+func (h *Handler) verifyPayee(ctx context.Context, payee *datamodels.Payee) error {
+	payee.Verified = false
+
+	account, err := h.accounts.FindByNumber(ctx, payee.AccountNumber)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	holder, err := h.users.FindByID(ctx, account.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	payee.Verified = datamodels.MatchName(payee.Name, holder.FullName()) == datamodels.NameMatch
+	return nil
+}
+
+// payeeIDParam returns the payee_id path parameter of r
+func payeeIDParam(r *http.Request) (int64, error) {
+	return strconv.ParseInt(mux.Vars(r)["payee_id"], 10, 64)
+}
+
+// writePayeeError writes the response for a payee that could not be fetched
+func writePayeeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Payee not found.",
+		})
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(Response{
+		Status:  "error",
+		Message: "Failed to fetch payee.",
+	})
+}
+
+// ListPayees returns the payees saved by a user
+func (h *Handler) ListPayees(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Invalid or missing user_id.",
+		})
+		return
+	}
+
+	payees, err := h.payees.FindByUser(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to fetch payees.",
+		})
+		return
+	}
+
+	responses := make([]PayeeResponse, len(payees))
+	for i, payee := range payees {
+		responses[i] = h.payeeResponse(payee)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Status:  "success",
+		Message: "Payees fetched successfully.",
+		Data:    responses,
+	})
+}
+
+// maxPayeeIDAttempts bounds the retries when a random payee ID is taken
+const maxPayeeIDAttempts = 10
+
+// AddPayee saves a recipient for a user and verifies their name against the
+// holder of the account
+func (h *Handler) AddPayee(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	var request struct {
+		UserID        int    `json:"user_id"`
+		Name          string `json:"name"`
+		Nickname      string `json:"nickname"`
+		AccountNumber int64  `json:"account_number"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to parse JSON.",
+		})
+		return
+	}
+
+	// Validate fields
+	if strings.TrimSpace(request.Name) == "" || request.AccountNumber <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "name and account_number are required.",
+		})
+		return
+	}
+
+	ctx := r.Context()
+
+	if _, err := h.users.FindByID(ctx, request.UserID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "User not found.",
+			})
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "Failed to fetch user's data.",
+			})
+		}
+		return
+	}
+
+	// Payees are other people, the user's own accounts are paid directly
+	account, err := h.accounts.FindByNumber(ctx, request.AccountNumber)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "Account not found.",
+			})
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "Failed to fetch account.",
+			})
+		}
+		return
+	}
+	if account.UserID == request.UserID {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Cannot save your own account as a payee.",
+		})
+		return
+	}
+
+	payee := datamodels.Payee{
+		UserID:        request.UserID,
+		Name:          strings.TrimSpace(request.Name),
+		Nickname:      strings.TrimSpace(request.Nickname),
+		AccountNumber: request.AccountNumber,
+		CreatedAt:     h.now().Unix(),
+	}
+	if err := h.verifyPayee(ctx, &payee); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to verify payee.",
+		})
+		return
+	}
+
+	// Each account is saved once per user
+	saved, err := h.payees.FindByUser(ctx, request.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to fetch payees.",
+		})
+		return
+	}
+	if slices.ContainsFunc(saved, func(p datamodels.Payee) bool { return p.AccountNumber == payee.AccountNumber }) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Payee already saved.",
+		})
+		return
+	}
+
+	// Pick an unused 9 digit payee ID. The account may also have been saved
+	// by a concurrent request since it was checked.
+	for attempt := 0; ; attempt++ {
+		payee.PayeeID = rand.Int64N(900000000) + 100000000
+		err = h.payees.Insert(ctx, payee)
+		if !errors.Is(err, repository.ErrDuplicate) || attempt == maxPayeeIDAttempts {
+			break
+		}
+	}
+	if errors.Is(err, repository.ErrDuplicate) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Payee already saved.",
+		})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to save payee.",
+		})
+		return
+	}
+
+	message := "Payee saved and verified."
+	if !payee.Verified {
+		message = "Payee saved, but the name does not match the account holder."
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(Response{
+		Status:  "success",
+		Message: message,
+		Data:    h.payeeResponse(payee),
+	})
+}
+
+// UpdatePayee changes the nickname or name of a payee. A new name is verified again.
+func (h *Handler) UpdatePayee(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	payeeID, err := payeeIDParam(r)
+	if err != nil {
+		writePayeeError(w, repository.ErrNotFound)
+		return
+	}
+
+	var request struct {
+		UserID   int     `json:"user_id"`
+		Name     *string `json:"name"`
+		Nickname *string `json:"nickname"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to parse JSON.",
+		})
+		return
+	}
+	if request.Name != nil && strings.TrimSpace(*request.Name) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "name cannot be empty.",
+		})
+		return
+	}
+
+	ctx := r.Context()
+	payee, err := h.ownPayee(ctx, request.UserID, payeeID)
+	if err != nil {
+		writePayeeError(w, err)
+		return
+	}
+
+	if request.Nickname != nil {
+		payee.Nickname = strings.TrimSpace(*request.Nickname)
+	}
+	if request.Name != nil {
+		payee.Name = strings.TrimSpace(*request.Name)
+		if err := h.verifyPayee(ctx, &payee); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "Failed to verify payee.",
+			})
+			return
+		}
+	}
+
+	if err := h.payees.Update(ctx, payee); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to update payee.",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Status:  "success",
+		Message: "Payee updated successfully.",
+		Data:    h.payeeResponse(payee),
+	})
+}
+
+// DeletePayee removes a saved payee
+func (h *Handler) DeletePayee(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	payeeID, err := payeeIDParam(r)
+	if err != nil {
+		writePayeeError(w, repository.ErrNotFound)
+		return
+	}
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Invalid or missing user_id.",
+		})
+		return
+	}
+
+	ctx := r.Context()
+	if _, err := h.ownPayee(ctx, userID, payeeID); err != nil {
+		writePayeeError(w, err)
+		return
+	}
+	if err := h.payees.Delete(ctx, payeeID); err != nil {
+		writePayeeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Status:  "success",
+		Message: "Payee deleted successfully.",
+	})
+}
+
+// VerifyPayee checks the name of a payee against the account holder again,
+// for instance after the holder changed their name
+func (h *Handler) VerifyPayee(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	payeeID, err := payeeIDParam(r)
+	if err != nil {
+		writePayeeError(w, repository.ErrNotFound)
+		return
+	}
+
+	var request struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to parse JSON.",
+		})
+		return
+	}
+
+	ctx := r.Context()
+	payee, err := h.ownPayee(ctx, request.UserID, payeeID)
+	if err != nil {
+		writePayeeError(w, err)
+		return
+	}
+
+	if err := h.verifyPayee(ctx, &payee); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to verify payee.",
+		})
+		return
+	}
+	if err := h.payees.Update(ctx, payee); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to update payee.",
+		})
+		return
+	}
+
+	message := "Payee verified."
+	if !payee.Verified {
+		message = "The name does not match the account holder."
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Status:  "success",
+		Message: message,
+		Data:    h.payeeResponse(payee),
+	})
+}
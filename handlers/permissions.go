@@ -0,0 +1,59 @@
+package handlers
+
+import "cse512/datamodels"
+
+// Access says who may use a route
+type Access struct {
+	Public bool     // Anyone, without a token
+	Self   bool     // Any logged in user, for their own user ID
+	Roles  []string // Users with these roles, for any user
+}
+
+// staff are the roles of the bank's own employees, who can read any user's
+// statements but never move their money
+var staff = []string{datamodels.RoleSupport, datamodels.RoleAuditor, datamodels.RoleAdmin}
+
+// Permissions is the permission matrix, the access to each named route of
+// NewRouter. Routes missing from it are refused to everyone.
+var Permissions = map[string]Access{
+	"login": {Public: true},
+
+	// Statements, readable by staff for any user
+	"transactions":  {Self: true, Roles: staff},
+	"monthdata":     {Self: true, Roles: staff},
+	"accounts.list": {Self: true, Roles: staff},
+	"limits":        {Self: true, Roles: staff},
+
+	// Money and settings, only ever for the user's own accounts
+	"transaction":                {Self: true},
+	"transaction.capture":        {Self: true},
+	"transaction.void":           {Self: true},
+	"transaction.reverse":        {Self: true},
+	"deposit":                    {Self: true},
+	"withdraw":                   {Self: true},
+	"accounts.open":              {Self: true},
+	"payees.list":                {Self: true},
+	"payees.add":                 {Self: true},
+	"payees.confirm":             {Self: true},
+	"payees.update":              {Self: true},
+	"payees.delete":              {Self: true},
+	"payees.verify":              {Self: true},
+	"scheduled-transfers.list":   {Self: true},
+	"scheduled-transfers.create": {Self: true},
+	"scheduled-transfers.cancel": {Self: true},
+
+	// Operator endpoints
+	"admin.users.search":      {Roles: staff},
+	"admin.users.get":         {Roles: staff},
+	"admin.users.role":        {Roles: []string{datamodels.RoleAdmin}},
+	"admin.accounts.freeze":   {Roles: []string{datamodels.RoleAdmin}},
+	"admin.accounts.unfreeze": {Roles: []string{datamodels.RoleAdmin}},
+	"admin.accounts.adjust":   {Roles: []string{datamodels.RoleAdmin}},
+	"admin.audit":             {Roles: []string{datamodels.RoleAuditor, datamodels.RoleAdmin}},
+	"admin.audit.events":      {Roles: []string{datamodels.RoleAuditor, datamodels.RoleAdmin}},
+	"admin.reconcile":         {Roles: []string{datamodels.RoleAuditor, datamodels.RoleAdmin}},
+	"admin.limits":            {Roles: []string{datamodels.RoleAdmin}},
+	"admin.reviews.list":      {Roles: staff},
+	"admin.reviews.approve":   {Roles: []string{datamodels.RoleAdmin}},
+	"admin.reviews.reject":    {Roles: []string{datamodels.RoleAdmin}},
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"cse512/reconcile"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Reconcile reports accounts whose balance disagrees with their ledger. It never
+// writes adjustments, use the reconcile command with -fix for that.
+func (h *Handler) Reconcile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	shards := 4
+	if value := r.URL.Query().Get("shards"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 64 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "shards must be a number between 1 and 64.",
+			})
+			return
+		}
+		shards = parsed
+	}
+
+	report, err := reconcile.Run(r.Context(), h.store, reconcile.Options{Shards: shards})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to reconcile balances.",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Status:  "success",
+		Message: fmt.Sprintf("Checked %d accounts, found %d discrepancies.", report.AccountsChecked, len(report.Discrepancies)),
+		Data:    report,
+	})
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"cse512/datamodels"
+	"cse512/ledger"
+	"cse512/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ReverseTransaction gives all or part of a settled transfer back to its
+// sender. Only the receiver can send the money back. The amount defaults to
+// what has not been reversed yet.
+func (h *Handler) ReverseTransaction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	transactionID, err := transactionIDParam(r)
+	if err != nil {
+		writeTransactionNotFound(w)
+		return
+	}
+
+	var request struct {
+		UserID  int              `json:"user_id"`
+		Amount  datamodels.Money `json:"amount"` // Everything not yet reversed if left out
+		Remarks string           `json:"remarks"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Transaction{
+			Status:  "error",
+			Message: decodeErrorMessage(err),
+			Code:    CodeRejected,
+		})
+		return
+	}
+
+	// Only the receiver of the transfer can reverse it
+	ctx := r.Context()
+	original, err := h.transactions.FindByID(ctx, transactionID)
+	if err == nil && original.ReceiverID != request.UserID {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			writeTransactionNotFound(w)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:  "error",
+				Message: "Failed to fetch transaction.",
+				Code:    CodeInternal,
+			})
+		}
+		return
+	}
+
+	amount := request.Amount
+	if amount.IsZero() {
+		amount = original.Reversible()
+	}
+	remarks := request.Remarks
+	if remarks == "" {
+		remarks = fmt.Sprintf("Reversal of transaction %d", original.TransactionID)
+	}
+
+	// Post the reversal and update the transfer atomically. The transfer is
+	// checked again there since another reversal may have run meanwhile.
+	reversal, err := ledger.Reverse(ctx, h.store, transactionID, amount, datamodels.Transaction{
+		Remarks:       remarks,
+		DateTimeStamp: h.now().Unix(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, datamodels.ErrNotReversible):
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:        "error",
+				Message:       "Only settled transfers can be reversed.",
+				Code:          CodeInvalidState,
+				TransactionID: transactionID,
+			})
+		case errors.Is(err, datamodels.ErrReversalTooLarge), errors.Is(err, datamodels.ErrInvalidMoney):
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:        "error",
+				Message:       fmt.Sprintf("Amount must be positive and at most the %s not yet reversed.", original.Reversible()),
+				Code:          CodeRejected,
+				TransactionID: transactionID,
+			})
+		case errors.Is(err, datamodels.ErrPartialConversion):
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:        "error",
+				Message:       "Transfers between currencies can only be reversed in full.",
+				Code:          CodeRejected,
+				TransactionID: transactionID,
+			})
+		case errors.Is(err, repository.ErrInsufficientFunds):
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:        "error",
+				Message:       "Insufficient balance.",
+				Code:          CodeInsufficientFunds,
+				TransactionID: transactionID,
+			})
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:        "error",
+				Message:       "Failed to reverse transaction.",
+				Code:          CodeInternal,
+				TransactionID: transactionID,
+			})
+		}
+		return
+	}
+
+	var balance datamodels.Money
+	if account, err := h.accounts.FindByNumber(ctx, reversal.SenderAccount); err == nil {
+		balance = account.Balance
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Transaction{
+		Status:         "success",
+		Message:        "Transaction reversed successfully.",
+		UpdatedBalance: balance,
+		TransactionID:  reversal.TransactionID,
+	})
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/ledger"
+	"cse512/repository"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// maxReviews caps the transfers listed for review at once
+const maxReviews = 100
+
+// ListReviews returns the transfers held for review, oldest first, with the
+// reasons they were held
+func (h *Handler) ListReviews(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	reviews, err := h.transactions.FindInReview(r.Context(), maxReviews)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to fetch transfers held for review.",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Status:  "success",
+		Message: "Transfers held for review fetched successfully.",
+		Data:    reviews,
+	})
+}
+
+// ApproveReview settles a transfer held for review
+func (h *Handler) ApproveReview(w http.ResponseWriter, r *http.Request) {
+	h.decideReview(w, r, func(ctx context.Context, transaction datamodels.Transaction) (datamodels.Transaction, error) {
+		return ledger.Approve(ctx, h.store, transaction)
+	}, datamodels.AuditApproveReview, "Transaction approved successfully.")
+}
+
+// RejectReview fails a transfer held for review, releasing the held amount
+func (h *Handler) RejectReview(w http.ResponseWriter, r *http.Request) {
+	h.decideReview(w, r, func(ctx context.Context, transaction datamodels.Transaction) (datamodels.Transaction, error) {
+		return ledger.Void(ctx, h.store, transaction, datamodels.HoldRejected)
+	}, datamodels.AuditRejectReview, "Transaction rejected successfully.")
+}
+
+// decideReview serves the approve and reject endpoints. decide settles or
+// fails the transfer named in the route if it is held for review, and the
+// decision is audited as action.
+func (h *Handler) decideReview(w http.ResponseWriter, r *http.Request, decide func(context.Context, datamodels.Transaction) (datamodels.Transaction, error), action, message string) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	transactionID, err := transactionIDParam(r)
+	if err != nil {
+		writeTransactionNotFound(w)
+		return
+	}
+
+	ctx := r.Context()
+	transaction, err := h.transactions.FindByID(ctx, transactionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			writeTransactionNotFound(w)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:  "error",
+				Message: "Failed to fetch transaction.",
+				Code:    CodeInternal,
+			})
+		}
+		return
+	}
+
+	// Decided by another admin meanwhile if the status changed since it was read
+	if transaction.Status == datamodels.StatusPending && transaction.Hold != nil {
+		event := datamodels.AuditEvent{
+			Action:        action,
+			UserID:        transaction.SenderID,
+			AccountNumber: transaction.SenderAccount,
+			TransactionID: transactionID,
+		}
+		err = h.audited(ctx, event, func(ctx context.Context, _ *datamodels.AuditEvent) error {
+			var err error
+			transaction, err = decide(ctx, transaction)
+			return err
+		})
+	} else {
+		err = repository.ErrConflict
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:        "error",
+				Message:       "Only transfers held for review can be approved or rejected.",
+				Code:          CodeInvalidState,
+				TransactionID: transactionID,
+			})
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Transaction{
+				Status:        "error",
+				Message:       "Failed to update transaction.",
+				Code:          CodeInternal,
+				TransactionID: transactionID,
+			})
+		}
+		return
+	}
+
+	var balance datamodels.Money
+	if account, err := h.accounts.FindByNumber(ctx, transaction.Hold.AccountNumber); err == nil {
+		balance = account.Balance
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Transaction{
+		Status:         "success",
+		Message:        message,
+		UpdatedBalance: balance,
+		TransactionID:  transactionID,
+	})
+}
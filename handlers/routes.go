@@ -0,0 +1,51 @@
+package handlers
+
+import "github.com/gorilla/mux"
+
+// NewRouter registers the API routes of h on a new router. Every route is
+// named after its entry in Permissions, which decides who may use it.
+// Requests are traced before they are authorized, so refused ones carry an ID.
+func NewRouter(h *Handler) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(h.traceRequest, h.authorize)
+
+	router.HandleFunc("/login", h.HandleLogin).Methods("POST", "OPTIONS").Name("login")
+	router.HandleFunc("/transactions", h.HandleTransaction).Methods("GET", "OPTIONS").Name("transactions")
+	router.HandleFunc("/transaction", h.PerformTransaction).Methods("POST", "OPTIONS").Name("transaction")
+	router.HandleFunc("/transaction/{transaction_id}/capture", h.CaptureTransaction).Methods("POST", "OPTIONS").Name("transaction.capture")
+	router.HandleFunc("/transaction/{transaction_id}/void", h.VoidTransaction).Methods("POST", "OPTIONS").Name("transaction.void")
+	router.HandleFunc("/transaction/{transaction_id}/reverse", h.ReverseTransaction).Methods("POST", "OPTIONS").Name("transaction.reverse")
+	router.HandleFunc("/deposit", h.HandleDeposit).Methods("POST", "OPTIONS").Name("deposit")
+	router.HandleFunc("/withdraw", h.HandleWithdraw).Methods("POST", "OPTIONS").Name("withdraw")
+	router.HandleFunc("/monthdata", h.GetMonthData).Methods("GET", "OPTIONS").Name("monthdata")
+	router.HandleFunc("/accounts", h.ListAccounts).Methods("GET", "OPTIONS").Name("accounts.list")
+	router.HandleFunc("/accounts", h.OpenAccount).Methods("POST").Name("accounts.open")
+	router.HandleFunc("/payees", h.ListPayees).Methods("GET", "OPTIONS").Name("payees.list")
+	router.HandleFunc("/payees", h.AddPayee).Methods("POST").Name("payees.add")
+	router.HandleFunc("/payees/confirm", h.ConfirmPayee).Methods("POST", "OPTIONS").Name("payees.confirm")
+	router.HandleFunc("/payees/{payee_id}", h.UpdatePayee).Methods("PUT", "OPTIONS").Name("payees.update")
+	router.HandleFunc("/payees/{payee_id}", h.DeletePayee).Methods("DELETE").Name("payees.delete")
+	router.HandleFunc("/payees/{payee_id}/verify", h.VerifyPayee).Methods("POST", "OPTIONS").Name("payees.verify")
+	router.HandleFunc("/limits", h.GetLimits).Methods("GET", "OPTIONS").Name("limits")
+	router.HandleFunc("/scheduled-transfers", h.ListScheduledTransfers).Methods("GET", "OPTIONS").Name("scheduled-transfers.list")
+	router.HandleFunc("/scheduled-transfers", h.CreateScheduledTransfer).Methods("POST").Name("scheduled-transfers.create")
+	router.HandleFunc("/scheduled-transfers/{schedule_id}", h.CancelScheduledTransfer).Methods("DELETE", "OPTIONS").Name("scheduled-transfers.cancel")
+
+	// Operator endpoints, for staff roles
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.HandleFunc("/users", h.SearchUsers).Methods("GET", "OPTIONS").Name("admin.users.search")
+	admin.HandleFunc("/users/{user_id}", h.GetUserDetails).Methods("GET", "OPTIONS").Name("admin.users.get")
+	admin.HandleFunc("/users/{user_id}/role", h.SetUserRole).Methods("PUT", "OPTIONS").Name("admin.users.role")
+	admin.HandleFunc("/accounts/{account_number}/freeze", h.FreezeAccount).Methods("POST", "OPTIONS").Name("admin.accounts.freeze")
+	admin.HandleFunc("/accounts/{account_number}/unfreeze", h.UnfreezeAccount).Methods("POST", "OPTIONS").Name("admin.accounts.unfreeze")
+	admin.HandleFunc("/accounts/{account_number}/adjust", h.AdjustBalance).Methods("POST", "OPTIONS").Name("admin.accounts.adjust")
+	admin.HandleFunc("/audit", h.ExportAudit).Methods("GET", "OPTIONS").Name("admin.audit")
+	admin.HandleFunc("/audit/events", h.QueryAudit).Methods("GET", "OPTIONS").Name("admin.audit.events")
+	admin.HandleFunc("/reconcile", h.Reconcile).Methods("GET", "OPTIONS").Name("admin.reconcile")
+	admin.HandleFunc("/limits/{user_id}", h.SetUserLimits).Methods("PUT", "OPTIONS").Name("admin.limits")
+	admin.HandleFunc("/reviews", h.ListReviews).Methods("GET", "OPTIONS").Name("admin.reviews.list")
+	admin.HandleFunc("/reviews/{transaction_id}/approve", h.ApproveReview).Methods("POST", "OPTIONS").Name("admin.reviews.approve")
+	admin.HandleFunc("/reviews/{transaction_id}/reject", h.RejectReview).Methods("POST", "OPTIONS").Name("admin.reviews.reject")
+
+	return router
+}
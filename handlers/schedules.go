@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"cse512/datamodels"
+	"cse512/ledger"
+	"cse512/repository"
+	"cse512/scheduler"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type scheduleRunKey struct{}
+
+// scheduleRunFrom returns the occurrence of a scheduled transfer a request to
+// PerformTransaction is made for, or nil for requests from clients
+func scheduleRunFrom(ctx context.Context) *datamodels.ScheduleRun {
+	run, _ := ctx.Value(scheduleRunKey{}).(*datamodels.ScheduleRun)
+	return run
+}
+
+// ExecuteScheduledTransfer makes the transaction of an occurrence of a
+// scheduled transfer. It goes through PerformTransaction, so it is checked and
+// recorded like a transfer requested by the user at the time it runs.
+func (h *Handler) ExecuteScheduledTransfer(ctx context.Context, schedule datamodels.ScheduledTransfer, run datamodels.ScheduleRun) scheduler.Outcome {
+	body, err := json.Marshal(map[string]any{
+		"sender_id":      schedule.UserID,
+		"from_account":   schedule.FromAccount,
+		"account_number": schedule.AccountNumber,
+		"amount": map[string]any{
+			"amount":   json.RawMessage(schedule.Amount.Decimal()),
+			"currency": schedule.Amount.Currency,
+		},
+		"remarks": schedule.Remarks,
+	})
+	if err != nil {
+		return scheduler.Outcome{Status: datamodels.StatusFailed, Message: err.Error()}
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/transaction", bytes.NewReader(body))
+	request = request.WithContext(context.WithValue(ctx, scheduleRunKey{}, &run))
+	recorder := httptest.NewRecorder()
+	h.PerformTransaction(recorder, request)
+
+	var response Transaction
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		return scheduler.Outcome{Status: datamodels.StatusFailed, Message: "Failed to read the transfer's response."}
+	}
+	if response.Status == datamodels.StatusPending {
+		return scheduler.Outcome{Status: datamodels.StatusPending, Message: response.Message}
+	}
+	if response.Status != "success" {
+		// Another instance running the occurrence after the lease expired
+		// may have made it meanwhile, which is the outcome of this run too
+		if made, err := h.transactions.FindScheduleRun(ctx, run); err == nil {
+			return scheduler.Outcome{Status: made.Status, Message: "Made by another run of the occurrence."}
+		}
+		h.recordFailedRun(ctx, schedule, run, response)
+		return scheduler.Outcome{Status: datamodels.StatusFailed, Message: response.Message}
+	}
+	return scheduler.Outcome{Status: datamodels.StatusSettled, Message: response.Message}
+}
+
+// recordFailedRun records the attempt of an occurrence that
+// PerformTransaction rejected without recording one, so that every occurrence
+// shows in the user's statements
+func (h *Handler) recordFailedRun(ctx context.Context, schedule datamodels.ScheduledTransfer, run datamodels.ScheduleRun, response Transaction) {
+	if _, err := h.transactions.FindScheduleRun(ctx, run); !errors.Is(err, repository.ErrNotFound) {
+		return
+	}
+	if _, err := h.attempts.FindScheduleRun(ctx, run); !errors.Is(err, repository.ErrNotFound) {
+		return
+	}
+
+	attempt := datamodels.Transaction{
+		SenderID:        schedule.UserID,
+		SenderAccount:   schedule.FromAccount,
+		ReceiverAccount: schedule.AccountNumber,
+		Amount:          schedule.Amount,
+		Remarks:         schedule.Remarks,
+		DateTimeStamp:   h.now().Unix(),
+		Type:            datamodels.TypeTransfer,
+		Schedule:        &run,
+	}
+	if to, err := h.accounts.FindByNumber(ctx, schedule.AccountNumber); err == nil {
+		attempt.ReceiverID = to.UserID
+	}
+	code := response.Code
+	if code == "" {
+		code = datamodels.AttemptCodeUnknown
+	}
+	h.recordAttempt(ctx, attempt, code, response.Message)
+}
+
+// maxScheduleIDAttempts bounds the retries when a random schedule ID is taken
+const maxScheduleIDAttempts = 10
+
+// CreateScheduledTransfer schedules a transfer for a future time, once or
+// weekly or monthly until an optional end date
+func (h *Handler) CreateScheduledTransfer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	var request struct {
+		UserID        int              `json:"user_id"`
+		FromAccount   int64            `json:"from_account"` // Defaults to the user's primary account
+		AccountNumber int64            `json:"account_number"`
+		Amount        datamodels.Money `json:"amount"`
+		Remarks       string           `json:"remarks"`
+		Frequency     string           `json:"frequency"` // Defaults to once
+		StartAt       int64            `json:"start_at"`
+		EndAt         int64            `json:"end_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: decodeErrorMessage(err),
+		})
+		return
+	}
+
+	// Validate fields
+	if request.Frequency == "" {
+		request.Frequency = datamodels.FrequencyOnce
+	}
+	now := h.now().Unix()
+	var message string
+	switch {
+	case !slices.Contains(datamodels.Frequencies, request.Frequency):
+		message = "frequency must be once, weekly or monthly."
+	case request.StartAt <= now:
+		message = "start_at must be in the future."
+	case request.EndAt != 0 && request.EndAt < request.StartAt:
+		message = "end_at must not be before start_at."
+	case request.AccountNumber <= 0 || request.FromAccount < 0:
+		message = "account_number is required and account numbers must be positive."
+	case ledger.ValidateAmount(request.Amount) != nil:
+		message = fmt.Sprintf("Transfer amount must be positive and at most %d.", ledger.MaxAmount)
+	}
+	if message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: message,
+		})
+		return
+	}
+
+	ctx := r.Context()
+
+	user, err := h.users.FindByID(ctx, request.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "User not found.",
+			})
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "Failed to fetch user's data.",
+			})
+		}
+		return
+	}
+
+	from, err := h.ownAccount(ctx, user, request.FromAccount)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) || errors.Is(err, errNotOwner) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "Sender's account number does not match.",
+			})
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "Failed to fetch sender's account.",
+			})
+		}
+		return
+	}
+	if request.Amount.Currency != from.Balance.Currency {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: fmt.Sprintf("Amount must be in %s.", from.Balance.Currency),
+		})
+		return
+	}
+
+	// The balance is only checked when the transfer runs, but the receiving
+	// account must exist now
+	to, err := h.accounts.FindByNumber(ctx, request.AccountNumber)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "Receiver's account not found.",
+			})
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "Failed to fetch receiver's account.",
+			})
+		}
+		return
+	}
+	if to.AccountNumber == from.AccountNumber {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Cannot transfer to the account the money comes from.",
+		})
+		return
+	}
+
+	schedule := datamodels.ScheduledTransfer{
+		UserID:        user.UserID,
+		FromAccount:   from.AccountNumber,
+		AccountNumber: to.AccountNumber,
+		Amount:        request.Amount,
+		Remarks:       request.Remarks,
+		Frequency:     request.Frequency,
+		StartAt:       request.StartAt,
+		EndAt:         request.EndAt,
+		Status:        datamodels.ScheduleActive,
+		CreatedAt:     now,
+		NextRunAt:     request.StartAt,
+	}
+
+	// Pick an unused 9 digit schedule ID
+	for attempt := 0; ; attempt++ {
+		schedule.ScheduleID = rand.Int64N(900000000) + 100000000
+		err = h.schedules.Insert(ctx, schedule)
+		if !errors.Is(err, repository.ErrDuplicate) || attempt == maxScheduleIDAttempts {
+			break
+		}
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to schedule transfer.",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(Response{
+		Status:  "success",
+		Message: "Transfer scheduled successfully.",
+		Data:    schedule,
+	})
+}
+
+// ListScheduledTransfers returns the scheduled transfers of a user, including
+// those that ended, with the outcome of their last run
+func (h *Handler) ListScheduledTransfers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Invalid or missing user_id.",
+		})
+		return
+	}
+
+	schedules, err := h.schedules.FindByUser(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Failed to fetch scheduled transfers.",
+		})
+		return
+	}
+	if schedules == nil {
+		schedules = []datamodels.ScheduledTransfer{}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Status:  "success",
+		Message: "Scheduled transfers fetched successfully.",
+		Data:    schedules,
+	})
+}
+
+// CancelScheduledTransfer stops a scheduled transfer from running again. An
+// occurrence that is already running completes.
+func (h *Handler) CancelScheduledTransfer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	scheduleID, idErr := strconv.ParseInt(mux.Vars(r)["schedule_id"], 10, 64)
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if idErr != nil || err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Invalid schedule_id or missing user_id.",
+		})
+		return
+	}
+
+	ctx := r.Context()
+
+	// Other users' transfers are reported as not found
+	schedule, err := h.schedules.FindByID(ctx, scheduleID)
+	if err == nil && schedule.UserID != userID {
+		err = repository.ErrNotFound
+	}
+	if err == nil && schedule.Status != datamodels.ScheduleActive {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(Response{
+			Status:  "error",
+			Message: "Scheduled transfer has already ended.",
+		})
+		return
+	}
+	if err == nil {
+		err = h.schedules.Cancel(ctx, scheduleID)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "Scheduled transfer not found.",
+			})
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{
+				Status:  "error",
+				Message: "Failed to cancel scheduled transfer.",
+			})
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Response{
+		Status:  "success",
+		Message: "Scheduled transfer cancelled.",
+	})
+}
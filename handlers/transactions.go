@@ -1,29 +1,37 @@
 package handlers
 
 import (
-	"context"
-	"cse512/db"
+	"cse512/datamodels"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"sort"
 	"strconv"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // TransactionResponse represents the response structure for the transaction handler
 type TransactionResponse struct {
-	Status    string `json:"status"`
-	Amount    int    `json:"amount"`
-	TimeStamp int    `json:"dateTimeStamp"`
-	Remarks   string `json:"remarks"`
+	TransactionID   int                `json:"transaction_id,omitempty"` // Set on transactions made through the API
+	Status          string             `json:"status"`
+	Type            string             `json:"type"`
+	Amount          datamodels.Money   `json:"amount"`
+	Currency        string             `json:"currency,omitempty"`
+	SenderAccount   int64              `json:"sender_account,omitempty"`
+	ReceiverAccount int64              `json:"receiver_account,omitempty"`
+	TimeStamp       int                `json:"dateTimeStamp"`
+	RequestedAt     int64              `json:"requested_at,omitempty"` // The client's time, if it sent one
+	Remarks         string             `json:"remarks"`
+	FX              *ConversionDetails `json:"fx,omitempty"`          // Set for transfers between currencies
+	ReversalOf      int                `json:"reversal_of,omitempty"` // The transfer a reversal gives back
+	Reversals       []int              `json:"reversals,omitempty"`   // Reversals of a transfer
+	Code            string             `json:"code,omitempty"`        // Why an attempt was refused, listed with include_failed
 }
 
 // HandleTransaction handles requests for retrieving user transactions
-func HandleTransaction(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleTransaction(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method == http.MethodOptions {
@@ -35,7 +43,6 @@ func HandleTransaction(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		json.NewEncoder(w).Encode(TransactionResponse{
 			Status: "error",
-			Amount: 0,
 		})
 		return
 	}
@@ -46,7 +53,6 @@ func HandleTransaction(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(TransactionResponse{
 			Status:  "error",
-			Amount:  0,
 			Remarks: "Missing sender_id in query parameters.",
 		})
 		return
@@ -58,30 +64,47 @@ func HandleTransaction(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(TransactionResponse{
 			Status:  "error",
-			Amount:  0,
 			Remarks: "Invalid sender_id format.",
 		})
 		return
 	}
 
-	// Database query setup
-	client := db.GetClient()
-	database := client.Database("bank")
-	transactionCollection := database.Collection("transactions")
+	// Optionally restrict the view to one of the user's accounts
+	accountNumber, err := h.accountParam(r, userID)
+	if err != nil {
+		if errors.Is(err, errInvalidAccountNumber) || errors.Is(err, errNotOwner) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(TransactionResponse{
+				Status:  "error",
+				Remarks: "account_number must be one of the user's accounts.",
+			})
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(TransactionResponse{
+				Status:  "error",
+				Remarks: "Failed to fetch transactions.",
+			})
+		}
+		return
+	}
 
-	// Find transactions where the user is either the sender or the receiver
-	filter := bson.M{
-		"$or": []bson.M{
-			{"sender_id": userID},
-			{"receiver_id": userID},
-		},
+	// Failed transactions and refused attempts are only listed if asked for
+	withFailed, err := includeFailed(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(TransactionResponse{
+			Status:  "error",
+			Remarks: "include_failed must be true or false.",
+		})
+		return
 	}
-	opts := options.Find().
-		SetSort(bson.D{{"dateTimeStamp", -1}}). // Sort by dateTimeStamp descending
-		SetLimit(10)                            // Limit to 10 results
 
-	// Execute the query
-	cursor, err := transactionCollection.Find(context.Background(), filter, opts)
+	// Find the 10 most recent transactions where the user, or the account, is either the sender or the receiver
+	found, err := h.transactions.FindRecent(r.Context(), userID, accountNumber, statementStatuses(withFailed), 10)
+	var attempts []datamodels.Attempt
+	if err == nil && withFailed {
+		attempts, err = h.attempts.FindRecent(r.Context(), userID, accountNumber, 10)
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(TransactionResponse{
@@ -90,30 +113,43 @@ func HandleTransaction(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	defer cursor.Close(context.Background())
+	results := statementEntries(found, attempts, true)
+	if len(results) > 10 {
+		results = results[:10]
+	}
 
-	// Decode results
+	// Amounts are the change to the balance of the user, or of the account,
+	// so money sent is negative and in the currency of the account
 	var transactions []TransactionResponse
-	for cursor.Next(context.Background()) {
-		var transaction struct {
-			Status    string `bson:"status" json:"status"`
-			Amount    int    `bson:"amount" json:"amount"`
-			TimeStamp int    `bson:"dateTimeStamp" json:"dateTimeStamp"`
-			Remarks   string `bson:"remarks" json:"remarks"`
-		}
-		if err := cursor.Decode(&transaction); err != nil {
+	for _, transaction := range results {
+		effect, err := effectOn(transaction.Transaction, userID, accountNumber)
+		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(TransactionResponse{
 				Status:  "error",
-				Remarks: "Failed to decode transactions.",
+				Remarks: "Failed to fetch transactions.",
 			})
 			return
 		}
+		currency := effect.Currency
+		if currency == "" {
+			currency = transaction.Amount.Currency
+		}
 		transactions = append(transactions, TransactionResponse{
-			Status:    transaction.Status,
-			Amount:    transaction.Amount,
-			TimeStamp: transaction.TimeStamp,
-			Remarks:   transaction.Remarks,
+			TransactionID:   transaction.TransactionID,
+			Status:          transaction.Status,
+			Type:            transaction.EffectiveType(),
+			Amount:          effect,
+			Currency:        currency,
+			SenderAccount:   transaction.SenderAccount,
+			ReceiverAccount: transaction.ReceiverAccount,
+			TimeStamp:       int(transaction.DateTimeStamp),
+			RequestedAt:     transaction.RequestedAt,
+			Remarks:         transaction.Remarks,
+			FX:              conversionDetails(transaction.Transaction),
+			ReversalOf:      transaction.ReversalOf,
+			Reversals:       transaction.Reversals,
+			Code:            transaction.Code,
 		})
 	}
 
@@ -121,3 +157,62 @@ func HandleTransaction(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(transactions)
 }
+
+// effectOn returns the change t makes to the balance of the account, or of all
+// of the user's accounts if accountNumber is 0
+func effectOn(t datamodels.Transaction, userID int, accountNumber int64) (datamodels.Money, error) {
+	if accountNumber != 0 {
+		return t.EffectOnAccount(accountNumber)
+	}
+	return t.EffectOn(userID)
+}
+
+// includeFailed reports whether the request asks with include_failed for the
+// failed transactions and refused attempts to be listed beside the
+// transactions that moved or hold money
+func includeFailed(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("include_failed")
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// statementStatuses returns the statuses of the transactions a statement
+// lists: those that moved or hold money, or all of them with include_failed
+func statementStatuses(withFailed bool) []string {
+	if withFailed {
+		return nil
+	}
+	return datamodels.CommittedStatuses
+}
+
+// statementEntry is a line of a statement: a transaction, or an attempt shown
+// as a failed transaction with the code it was refused with
+type statementEntry struct {
+	datamodels.Transaction
+	Code string
+}
+
+// statementEntries lists the transactions in their order, followed by the
+// attempts if there are any, all sorted by time, newest first if newestFirst.
+// Of those in the same second, transactions come before attempts.
+func statementEntries(transactions []datamodels.Transaction, attempts []datamodels.Attempt, newestFirst bool) []statementEntry {
+	entries := make([]statementEntry, 0, len(transactions)+len(attempts))
+	for _, transaction := range transactions {
+		entries = append(entries, statementEntry{Transaction: transaction})
+	}
+	if len(attempts) == 0 {
+		return entries
+	}
+	for _, attempt := range attempts {
+		entries = append(entries, statementEntry{Transaction: attempt.Transaction(), Code: attempt.Code})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if newestFirst {
+			return entries[i].DateTimeStamp > entries[j].DateTimeStamp
+		}
+		return entries[i].DateTimeStamp < entries[j].DateTimeStamp
+	})
+	return entries
+}
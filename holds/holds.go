@@ -0,0 +1,86 @@
+// Package holds releases the holds of authorizations that were neither
+// captured nor voided before they expired. Every server instance may run the
+// worker: an authorization only expires if it is still authorized, so
+// instances racing on the same hold release it once.
+package holds
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/ledger"
+	"cse512/repository"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Options configures the expiry worker
+type Options struct {
+	Interval time.Duration // How often expired holds are looked for, defaults to a minute
+	Batch    int           // Authorizations read at a time, defaults to 100
+	// Now decides which holds have expired, defaults to time.Now
+	Now func() time.Time
+}
+
+func (opts *Options) setDefaults() {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+	if opts.Batch <= 0 {
+		opts.Batch = 100
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+}
+
+// Run expires holds every opts.Interval until ctx is cancelled
+func Run(ctx context.Context, store repository.Store, opts Options) {
+	opts.setDefaults()
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := ExpireDue(ctx, store, opts); err != nil && ctx.Err() == nil {
+			log.Printf("Hold expiry: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExpireDue fails every authorization whose hold has expired, releasing the
+// held amount, and returns the number expired
+func ExpireDue(ctx context.Context, store repository.Store, opts Options) (int, error) {
+	opts.setDefaults()
+
+	expired := 0
+	for ctx.Err() == nil {
+		due, err := store.Transactions().FindExpiredHolds(ctx, opts.Now().Unix(), opts.Batch)
+		if err != nil {
+			return expired, fmt.Errorf("finding expired holds: %w", err)
+		}
+
+		for _, authorization := range due {
+			_, err := ledger.Void(ctx, store, authorization, datamodels.HoldExpired)
+			if errors.Is(err, repository.ErrConflict) {
+				// Captured, voided or expired by another instance meanwhile
+				continue
+			}
+			if err != nil {
+				return expired, fmt.Errorf("expiring transaction %d: %w", authorization.TransactionID, err)
+			}
+			expired++
+		}
+
+		if len(due) < opts.Batch {
+			break
+		}
+	}
+	return expired, ctx.Err()
+}
@@ -0,0 +1,420 @@
+// Package ledger records transactions as balanced double-entry postings and
+// keeps user balances in step with them. Every transaction it records, and
+// every change of status, is added to the audit log in the same unit of work.
+package ledger
+
+import (
+	"context"
+	"cse512/audit"
+	"cse512/datamodels"
+	"cse512/repository"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sort"
+)
+
+// Check decides whether a transaction may go ahead. It runs inside the unit of
+// work that records the transaction, with the context of that unit of work,
+// so what it reads cannot change before the transaction is recorded.
+type Check func(ctx context.Context) error
+
+// runChecks returns the first error of checks
+func runChecks(ctx context.Context, checks []Check) error {
+	for _, check := range checks {
+		if err := check(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Post checks that the postings of t balance, applies them to the balances of
+// the customer accounts they touch and records t, all atomically and only if
+// every check passes. Debits fail with repository.ErrInsufficientFunds rather
+// than overdraw an account. System accounts have no stored balance. It
+// returns t as recorded, with a transaction ID if it had none.
+func Post(ctx context.Context, store repository.Store, t datamodels.Transaction, checks ...Check) (datamodels.Transaction, error) {
+	if err := validate(t); err != nil {
+		return t, err
+	}
+
+	return WithTransactionID(t, func(t datamodels.Transaction) error {
+		return store.WithTransaction(ctx, func(ctx context.Context) error {
+			if err := runChecks(ctx, checks); err != nil {
+				return err
+			}
+			if err := apply(ctx, store, t.Postings); err != nil {
+				return err
+			}
+			if err := store.Transactions().Insert(ctx, t); err != nil {
+				return err
+			}
+			return recordChange(ctx, store, datamodels.AuditTransaction, nil, t)
+		})
+	})
+}
+
+// ErrNoTransactionID is returned by Correct for a correction without a transaction ID
+var ErrNoTransactionID = errors.New("ledger: corrections need a transaction ID")
+
+// Correct records t, an adjustment whose effect is already in the balances of
+// the accounts it touches, so that their ledger agrees with them again. Its
+// postings are checked like those of any other transaction but not applied.
+// It is recorded within the unit of work of ctx, where a taken ID cannot be
+// retried, so t must be given its ID by WithTransactionID around that unit.
+func Correct(ctx context.Context, store repository.Store, t datamodels.Transaction) error {
+	if t.TransactionID == 0 {
+		return ErrNoTransactionID
+	}
+	if err := validate(t); err != nil {
+		return err
+	}
+	return store.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := store.Transactions().Insert(ctx, t); err != nil {
+			return err
+		}
+		return recordChange(ctx, store, datamodels.AuditTransaction, nil, t)
+	})
+}
+
+// RecordAttempt stores a refused attempt to move money without changing any
+// balance, and records its failure in the audit log
+func RecordAttempt(ctx context.Context, store repository.Store, attempt datamodels.Attempt) error {
+	return store.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := store.Attempts().Insert(ctx, attempt); err != nil {
+			return err
+		}
+		return audit.Record(ctx, store.Audit(), datamodels.AuditEvent{
+			Action:        datamodels.AuditTransactionFailed,
+			UserID:        attempt.SenderID,
+			AccountNumber: attempt.SenderAccount,
+			Reason:        attempt.Code,
+			Detail:        attempt.Type,
+			After:         snapshot(attempt.Transaction()),
+		})
+	})
+}
+
+// Authorize records t as an authorization that holds its amount on the
+// sender's account until expiresAt, without posting it, if every check
+// passes. The hold fails with repository.ErrInsufficientFunds if the
+// available balance does not cover it.
+func Authorize(ctx context.Context, store repository.Store, t datamodels.Transaction, expiresAt int64, checks ...Check) (datamodels.Transaction, error) {
+	if err := validate(t); err != nil {
+		return t, err
+	}
+	t.Status = datamodels.StatusPending
+	if err := t.Transition(datamodels.StatusAuthorized); err != nil {
+		return t, err
+	}
+	t.Hold = &datamodels.Hold{AccountNumber: t.SenderAccount, Amount: t.Amount, ExpiresAt: expiresAt}
+
+	return WithTransactionID(t, func(t datamodels.Transaction) error {
+		return store.WithTransaction(ctx, func(ctx context.Context) error {
+			if err := runChecks(ctx, checks); err != nil {
+				return err
+			}
+			if err := store.Accounts().Hold(ctx, t.Hold.AccountNumber, t.Hold.Amount); err != nil {
+				return err
+			}
+			if err := store.Transactions().Insert(ctx, t); err != nil {
+				return err
+			}
+			return recordChange(ctx, store, datamodels.AuditTransaction, nil, t)
+		})
+	})
+}
+
+// Review records t as pending, holding its amount on the sender's account
+// until an admin approves or rejects it, if every check passes. The hold
+// fails with repository.ErrInsufficientFunds if the available balance does
+// not cover it. Holds for review do not expire.
+func Review(ctx context.Context, store repository.Store, t datamodels.Transaction, checks ...Check) (datamodels.Transaction, error) {
+	if err := validate(t); err != nil {
+		return t, err
+	}
+	t.Status = datamodels.StatusPending
+	t.Hold = &datamodels.Hold{AccountNumber: t.SenderAccount, Amount: t.Amount}
+
+	return WithTransactionID(t, func(t datamodels.Transaction) error {
+		return store.WithTransaction(ctx, func(ctx context.Context) error {
+			if err := runChecks(ctx, checks); err != nil {
+				return err
+			}
+			if err := store.Accounts().Hold(ctx, t.Hold.AccountNumber, t.Hold.Amount); err != nil {
+				return err
+			}
+			if err := store.Transactions().Insert(ctx, t); err != nil {
+				return err
+			}
+			return recordChange(ctx, store, datamodels.AuditTransaction, nil, t)
+		})
+	})
+}
+
+// Capture settles the authorization t: its hold is released and its postings
+// are applied, atomically. It returns repository.ErrConflict if t was
+// captured, voided or expired meanwhile.
+func Capture(ctx context.Context, store repository.Store, t datamodels.Transaction) (datamodels.Transaction, error) {
+	return settle(ctx, store, t, datamodels.HoldCaptured)
+}
+
+// Approve settles the transfer t held for review like Capture does an
+// authorization. It returns repository.ErrConflict if t was approved or
+// rejected meanwhile.
+func Approve(ctx context.Context, store repository.Store, t datamodels.Transaction) (datamodels.Transaction, error) {
+	return settle(ctx, store, t, datamodels.HoldApproved)
+}
+
+// settle releases the hold of t for reason and applies its postings, atomically
+func settle(ctx context.Context, store repository.Store, t datamodels.Transaction, reason string) (datamodels.Transaction, error) {
+	if err := validate(t); err != nil {
+		return t, err
+	}
+	settled, err := release(t, datamodels.StatusSettled, reason)
+	if err != nil {
+		return t, err
+	}
+
+	// The status is updated first so an authorization released meanwhile
+	// fails with repository.ErrConflict before its hold is touched
+	err = store.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := store.Transactions().Update(ctx, settled, t.Status); err != nil {
+			return err
+		}
+		if err := store.Accounts().ReleaseHold(ctx, t.Hold.AccountNumber, t.Hold.Amount); err != nil {
+			return err
+		}
+		if err := apply(ctx, store, settled.Postings); err != nil {
+			return err
+		}
+		return recordChange(ctx, store, datamodels.AuditTransaction, &t, settled)
+	})
+	if err != nil {
+		return t, err
+	}
+	return settled, nil
+}
+
+// Void fails the authorization, or transfer held for review, t and releases
+// its hold, atomically. reason is one of datamodels.HoldVoided, HoldExpired or
+// HoldRejected. It returns repository.ErrConflict if t was released meanwhile.
+func Void(ctx context.Context, store repository.Store, t datamodels.Transaction, reason string) (datamodels.Transaction, error) {
+	voided, err := release(t, datamodels.StatusFailed, reason)
+	if err != nil {
+		return t, err
+	}
+
+	err = store.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := store.Transactions().Update(ctx, voided, t.Status); err != nil {
+			return err
+		}
+		if err := store.Accounts().ReleaseHold(ctx, t.Hold.AccountNumber, t.Hold.Amount); err != nil {
+			return err
+		}
+		return recordChange(ctx, store, datamodels.AuditTransaction, &t, voided)
+	})
+	if err != nil {
+		return t, err
+	}
+	return voided, nil
+}
+
+// Reverse posts reversal, which gives amount of the settled transfer with
+// transactionID back to its sender, and records it against the transfer, all
+// atomically. The transfer is read inside the unit of work, so concurrent
+// reversals never give back more than it moved. The transfer becomes reversed
+// once all of it is. reversal only needs its remarks and timestamp; the rest
+// is filled in from the transfer.
+func Reverse(ctx context.Context, store repository.Store, transactionID int, amount datamodels.Money, reversal datamodels.Transaction) (datamodels.Transaction, error) {
+	var posted datamodels.Transaction
+	_, err := WithTransactionID(reversal, func(reversal datamodels.Transaction) error {
+		return store.WithTransaction(ctx, func(ctx context.Context) error {
+			original, err := store.Transactions().FindByID(ctx, transactionID)
+			if err != nil {
+				return err
+			}
+			postings, err := original.ReversalPostings(amount)
+			if err != nil {
+				return err
+			}
+
+			reversal.SenderID = original.ReceiverID
+			reversal.SenderAccount = original.ReceiverAccount
+			reversal.ReceiverID = original.SenderID
+			reversal.ReceiverAccount = original.SenderAccount
+			reversal.Amount = amount
+			reversal.Type = datamodels.TypeReversal
+			reversal.Status = datamodels.StatusSettled
+			reversal.ReversalOf = original.TransactionID
+			reversal.Postings = postings
+			if err := validate(reversal); err != nil {
+				return err
+			}
+
+			updated := original
+			updated.Reversals = append(slices.Clone(original.Reversals), reversal.TransactionID)
+			if updated.ReversedAmount, err = original.ReversedAmount.Add(amount); err != nil {
+				return err
+			}
+			if updated.Reversible().IsZero() {
+				if err := updated.Transition(datamodels.StatusReversed); err != nil {
+					return err
+				}
+			}
+
+			if err := store.Transactions().Update(ctx, updated, original.Status); err != nil {
+				return err
+			}
+			if err := apply(ctx, store, postings); err != nil {
+				return err
+			}
+			if err := store.Transactions().Insert(ctx, reversal); err != nil {
+				return err
+			}
+			if err := recordChange(ctx, store, datamodels.AuditTransaction, &original, updated); err != nil {
+				return err
+			}
+			posted = reversal
+			return recordChange(ctx, store, datamodels.AuditTransaction, nil, reversal)
+		})
+	})
+	return posted, err
+}
+
+// release returns the authorization, or transfer held for review, t moved to
+// status with its hold released for reason
+func release(t datamodels.Transaction, status, reason string) (datamodels.Transaction, error) {
+	if (t.Status != datamodels.StatusAuthorized && t.Status != datamodels.StatusPending) || t.Hold == nil {
+		return t, fmt.Errorf("ledger: transaction %d holds no amount: %w", t.TransactionID, datamodels.ErrInvalidTransition)
+	}
+	if err := t.Transition(status); err != nil {
+		return t, err
+	}
+	hold := *t.Hold
+	hold.Released = reason
+	t.Hold = &hold
+	return t, nil
+}
+
+// recordChange adds t to the audit log as action, changed from before or
+// newly recorded if before is nil
+func recordChange(ctx context.Context, store repository.Store, action string, before *datamodels.Transaction, t datamodels.Transaction) error {
+	event := datamodels.AuditEvent{
+		Action:        action,
+		UserID:        t.SenderID,
+		AccountNumber: t.SenderAccount,
+		TransactionID: t.TransactionID,
+		Detail:        t.EffectiveType(),
+		After:         snapshot(t),
+	}
+	if before != nil {
+		event.Before = snapshot(*before)
+	}
+	return audit.Record(ctx, store.Audit(), event)
+}
+
+// snapshot returns what the audit log shows of t: its status and amount, and
+// how much of it was reversed or why its hold was released once they apply
+func snapshot(t datamodels.Transaction) string {
+	state := map[string]string{"status": t.Status, "amount": t.Amount.String()}
+	if !t.ReversedAmount.IsZero() {
+		state["reversed_amount"] = t.ReversedAmount.String()
+	}
+	if t.Hold != nil && t.Hold.Released != "" {
+		state["hold_released"] = t.Hold.Released
+	}
+	return audit.Snapshot(state)
+}
+
+// validate checks that the postings of t balance and move valid amounts
+func validate(t datamodels.Transaction) error {
+	if err := t.CheckBalanced(); err != nil {
+		return fmt.Errorf("ledger: %w", err)
+	}
+	for _, posting := range t.Postings {
+		magnitude, err := posting.Amount.Abs()
+		if err == nil {
+			err = ValidateAmount(magnitude)
+		}
+		if err != nil {
+			return fmt.Errorf("posting to %s: %w", posting.Account, ErrInvalidAmount)
+		}
+		if posting.UserID != 0 && posting.AccountNumber == 0 {
+			return fmt.Errorf("ledger: posting to %s has no account number", posting.Account)
+		}
+	}
+	return nil
+}
+
+// apply changes the balances of the customer accounts postings touch. Debits
+// go first so an insufficient balance fails before any write.
+func apply(ctx context.Context, store repository.Store, postings []datamodels.Posting) error {
+	postings = append([]datamodels.Posting(nil), postings...)
+	sort.SliceStable(postings, func(i, j int) bool {
+		return postings[i].Amount.Cmp(postings[j].Amount) < 0
+	})
+
+	for _, posting := range postings {
+		if posting.UserID == 0 {
+			continue
+		}
+
+		var err error
+		if posting.Amount.Sign() < 0 {
+			debit, _ := posting.Amount.Neg() // Validated by validate
+			err = store.Accounts().Debit(ctx, posting.AccountNumber, debit)
+		} else {
+			err = store.Accounts().IncrementBalance(ctx, posting.AccountNumber, posting.Amount)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxTransactionIDAttempts bounds the retries when a random transaction ID is taken
+const maxTransactionIDAttempts = 10
+
+// WithTransactionID calls insert with t, giving it a random 9 digit
+// transaction ID unless it has one and picking another if the ID is taken.
+// insert may therefore run more than once, so anything it does besides the
+// insert must be rolled back when it returns ErrDuplicate; AdjustBalance
+// relies on this by wrapping its audited unit of work
+func WithTransactionID(t datamodels.Transaction, insert func(datamodels.Transaction) error) (datamodels.Transaction, error) {
+	if t.TransactionID != 0 {
+		return t, insert(t)
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		t.TransactionID = rand.IntN(900000000) + 100000000
+		err = insert(t)
+		if !errors.Is(err, repository.ErrDuplicate) || attempt == maxTransactionIDAttempts {
+			return t, err
+		}
+	}
+}
+
+// MaxAmount caps the amount of any single movement of money, in whole units
+// of its currency. It keeps balances far from overflowing int64 minor units.
+const MaxAmount = 1_000_000_000
+
+// ErrInvalidAmount is returned for amounts that are not positive or exceed MaxAmount
+var ErrInvalidAmount = errors.New("ledger: amount must be positive and at most 1,000,000,000")
+
+// ValidateAmount checks an amount to be moved, which must always be positive
+// and in a known currency
+func ValidateAmount(amount datamodels.Money) error {
+	limit, err := datamodels.FromMajor(MaxAmount, amount.Currency)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidAmount, err)
+	}
+	if amount.Sign() <= 0 || amount.Cmp(limit) > 0 {
+		return ErrInvalidAmount
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+// Package limits caps what users can send to other users: in a single
+// transfer, in total over a rolling day and month, and in number of transfers
+// over an hour. Totals are summed from the transactions collection inside the
+// unit of work that records a transfer, after locking the sender's limits, so
+// concurrent transfers cannot together go over a limit.
+package limits
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/ledger"
+	"cse512/repository"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Names of the limits, as reported by ExceededError
+const (
+	Single   = "single"
+	Daily    = "daily"
+	Monthly  = "monthly"
+	Velocity = "velocity"
+)
+
+// ErrLimitExceeded is returned, wrapped in an ExceededError, for a transfer
+// that would go over one of the sender's limits
+var ErrLimitExceeded = errors.New("limits: transfer limit exceeded")
+
+// ExceededError reports the first limit a transfer would go over
+type ExceededError struct {
+	Limit     string    // One of the limit names
+	Allowance Allowance // What the sender could still send
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("limits: transfer exceeds the %s limit", e.Limit)
+}
+
+func (e *ExceededError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// Allowance is what a user can still send to other users from accounts in
+// Currency. Nil fields are not limited.
+type Allowance struct {
+	Currency  string            `json:"currency"`
+	Single    *datamodels.Money `json:"single,omitempty"`    // Largest transfer allowed
+	Daily     *datamodels.Money `json:"daily,omitempty"`     // Left of the daily limit
+	Monthly   *datamodels.Money `json:"monthly,omitempty"`   // Left of the monthly limit
+	Transfers *int              `json:"transfers,omitempty"` // Transfers left over datamodels.VelocityWindow
+}
+
+// For returns the limits of the user: defaults, overridden by the limits
+// stored for them
+func For(ctx context.Context, store repository.Store, defaults datamodels.TransferLimits, userID int) (datamodels.TransferLimits, error) {
+	stored, err := store.Limits().FindByUser(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return defaults, nil
+	}
+	if err != nil {
+		return defaults, err
+	}
+	return defaults.Override(stored), nil
+}
+
+// Remaining returns what the user can still send in currency at now under limits
+func Remaining(ctx context.Context, store repository.Store, limits datamodels.TransferLimits, userID int, currency string, now time.Time) (Allowance, error) {
+	allowance := Allowance{Currency: currency}
+
+	var err error
+	if limits.Single > 0 {
+		if allowance.Single, err = left(limits.Single, datamodels.NewMoney(0, currency)); err != nil {
+			return allowance, err
+		}
+	}
+	if limits.Daily > 0 {
+		sent, _, err := store.Transactions().SentSince(ctx, userID, currency, now.Add(-datamodels.DailyWindow).Unix())
+		if err != nil {
+			return allowance, err
+		}
+		if allowance.Daily, err = left(limits.Daily, sent); err != nil {
+			return allowance, err
+		}
+	}
+	if limits.Monthly > 0 {
+		sent, _, err := store.Transactions().SentSince(ctx, userID, currency, now.Add(-datamodels.MonthlyWindow).Unix())
+		if err != nil {
+			return allowance, err
+		}
+		if allowance.Monthly, err = left(limits.Monthly, sent); err != nil {
+			return allowance, err
+		}
+	}
+	if limits.Velocity > 0 {
+		_, count, err := store.Transactions().SentSince(ctx, userID, currency, now.Add(-datamodels.VelocityWindow).Unix())
+		if err != nil {
+			return allowance, err
+		}
+		transfers := max(limits.Velocity-count, 0)
+		allowance.Transfers = &transfers
+	}
+	return allowance, nil
+}
+
+// left returns what is left of limit, in whole units of the currency of sent,
+// once sent has been sent, or zero if nothing is
+func left(limit int64, sent datamodels.Money) (*datamodels.Money, error) {
+	total, err := datamodels.FromMajor(limit, sent.Currency)
+	if err != nil {
+		return nil, err
+	}
+	remaining, err := total.Sub(sent)
+	if err != nil {
+		return nil, err
+	}
+	if remaining.Sign() < 0 {
+		remaining = datamodels.NewMoney(0, sent.Currency)
+	}
+	return &remaining, nil
+}
+
+// Allows returns an ExceededError naming the first limit sending amount
+// would go over, or nil if it can be sent
+func (a Allowance) Allows(amount datamodels.Money) error {
+	switch {
+	case a.Single != nil && amount.Cmp(*a.Single) > 0:
+		return &ExceededError{Limit: Single, Allowance: a}
+	case a.Daily != nil && amount.Cmp(*a.Daily) > 0:
+		return &ExceededError{Limit: Daily, Allowance: a}
+	case a.Monthly != nil && amount.Cmp(*a.Monthly) > 0:
+		return &ExceededError{Limit: Monthly, Allowance: a}
+	case a.Transfers != nil && *a.Transfers < 1:
+		return &ExceededError{Limit: Velocity, Allowance: a}
+	}
+	return nil
+}
+
+// Enforce returns a ledger.Check that fails with an ExceededError if t would
+// take its sender over limits at now. Deposits, withdrawals and moves between
+// the sender's own accounts are not limited.
+func Enforce(store repository.Store, limits datamodels.TransferLimits, t datamodels.Transaction, now time.Time) ledger.Check {
+	return func(ctx context.Context) error {
+		if t.EffectiveType() != datamodels.TypeTransfer || t.SenderID == t.ReceiverID {
+			return nil
+		}
+		if err := store.Limits().Lock(ctx, t.SenderID); err != nil {
+			return err
+		}
+		allowance, err := Remaining(ctx, store, limits, t.SenderID, t.Amount.Currency, now)
+		if err != nil {
+			return err
+		}
+		return allowance.Allows(t.Amount)
+	}
+}
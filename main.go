@@ -1,22 +1,55 @@
 package main
 
 import (
+	"context"
+	"cse512/audit"
+	"cse512/datamodels"
 	"cse512/db"
+	"cse512/fx"
 	"cse512/handlers"
+	"cse512/holds"
+	"cse512/repository"
+	"cse512/risk"
+	"cse512/scheduler"
 	"flag"
 	"fmt"
 	"net/http"
-
-	"github.com/gorilla/mux"
+	"os"
+	"strings"
+	"time"
 )
 
 func main() {
+	// Subcommands such as "migrate" come before any flags
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	port := flag.Int("p", 0, "Port to run the server on")
+	skipMigrations := flag.Bool("skip-migrations", false, "Do not apply pending schema migrations at startup")
+	rates := flag.String("rates", "", "JSON file of exchange rates, enables transfers between currencies")
+	noScheduler := flag.Bool("no-scheduler", false, "Do not run scheduled transfers in this instance")
+	scheduleInterval := flag.Duration("schedule-interval", 30*time.Second, "How often to look for scheduled transfers that are due")
+	payeeCoolingOff := flag.Duration("payee-cooling-off", 0, "Period after a payee is saved during which transfers to it are limited to 1000, e.g. 24h")
+	holdExpiry := flag.Duration("hold-expiry", handlers.DefaultHoldExpiry, "How long authorized transfers hold their amount before the hold is released")
+	maxClockSkew := flag.Duration("max-clock-skew", handlers.DefaultMaxClockSkew, "Reject transfers whose requested_at is further than this from the server's clock, 0 accepts any")
+	limitSingle := flag.Int64("limit-single", handlers.DefaultTransferLimits.Single, "Largest transfer a user can send, unless limits are set for them, 0 is no limit")
+	limitDaily := flag.Int64("limit-daily", handlers.DefaultTransferLimits.Daily, "Total a user can send over 24 hours, unless limits are set for them, 0 is no limit")
+	limitMonthly := flag.Int64("limit-monthly", handlers.DefaultTransferLimits.Monthly, "Total a user can send over 30 days, unless limits are set for them, 0 is no limit")
+	limitVelocity := flag.Int("limit-velocity", handlers.DefaultTransferLimits.Velocity, "Number of transfers a user can send in an hour, unless limits are set for them, 0 is no limit")
+	noRiskRules := flag.Bool("no-risk-rules", false, "Do not screen transfers for fraud")
+	allowAnonymous := flag.Bool("allow-anonymous", false, "Let customers use their endpoints without a login token, for clients that do not send one yet")
+	behindProxy := flag.Bool("behind-proxy", false, "Take callers' addresses from the X-Forwarded-For header set by the proxy in front of the server")
 	help := flag.Bool("help", false, "Use p flag to specify port to run the server on")
 	flag.Parse()
 
 	if *help {
 		flag.PrintDefaults()
+		printCommands()
 		return
 	}
 
@@ -25,13 +58,82 @@ func main() {
 		return
 	}
 
-	_ = db.GetClient()
-	router := mux.NewRouter()
+	database := db.GetDatabase()
+
+	if !*skipMigrations {
+		ran, err := db.Migrate(context.Background(), database)
+		if err != nil {
+			fmt.Println("Failed to apply migrations:", err)
+			return
+		}
+		for _, migration := range ran {
+			fmt.Printf("Applied migration %d: %s\n", migration.Version, migration.Description)
+		}
+	}
+
+	store := repository.NewMongoStore(database)
+	handler := handlers.New(store)
+	if *rates != "" {
+		provider, err := fx.LoadStaticProvider(*rates)
+		if err != nil {
+			fmt.Println("Failed to load exchange rates:", err)
+			return
+		}
+		handler.SetRates(provider)
+	}
+	// Instances behind the same load balancer must share the secret, or tokens
+	// issued by one are refused by the others
+	if secret := os.Getenv("AUTH_SECRET"); secret != "" {
+		handler.SetTokenSecret([]byte(secret))
+	} else {
+		fmt.Println("AUTH_SECRET is not set, login tokens are only valid on this instance until it restarts")
+	}
+	handler.SetRequireTokens(!*allowAnonymous)
+	handler.SetBehindProxy(*behindProxy)
+	handler.SetPayeeCoolingOff(*payeeCoolingOff)
+	handler.SetMaxClockSkew(*maxClockSkew)
+	handler.SetHoldExpiry(*holdExpiry)
+	handler.SetTransferLimits(datamodels.TransferLimits{
+		Single:   *limitSingle,
+		Daily:    *limitDaily,
+		Monthly:  *limitMonthly,
+		Velocity: *limitVelocity,
+	})
+	if !*noRiskRules {
+		handler.SetRiskEngine(risk.NewEngine(risk.DefaultRules()...))
+	}
+	router := handlers.NewRouter(handler)
+
+	// Changes to the flags instances run with are on record. The port is left
+	// out as it differs between instances.
+	config := map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name != "p" && f.Name != "help" {
+			config[f.Name] = f.Value.String()
+		}
+	})
+	if err := audit.RecordConfig(context.Background(), store.Audit(), config); err != nil {
+		fmt.Println("Failed to record configuration:", err)
+		return
+	}
+
+	// Every instance can run scheduled transfers, leases keep them from
+	// running the same one
+	if !*noScheduler {
+		hostname, _ := os.Hostname()
+		go scheduler.Run(context.Background(), store, handler.ExecuteScheduledTransfer, scheduler.Options{
+			Owner:    fmt.Sprintf("%s:%d:%d", hostname, *port, os.Getpid()),
+			Interval: *scheduleInterval,
+		})
+	}
+
+	// Every instance releases expired holds, each is only released once
+	go holds.Run(context.Background(), store, holds.Options{})
 
-	router.HandleFunc("/login", handlers.HandleLogin).Methods("POST", "OPTIONS")
-	router.HandleFunc("/transactions", handlers.HandleTransaction).Methods("GET", "OPTIONS")
-	router.HandleFunc("/transaction", handlers.PerformTransaction).Methods("POST", "OPTIONS")
-	router.HandleFunc("/monthdata", handlers.GetMonthData).Methods("GET", "OPTIONS")
+	// Every instance chains the audit events queued by its requests and by
+	// the others. Chainers only take turns with each other on the head of
+	// the log, never with the money transactions that queue the events.
+	go audit.Run(context.Background(), store.Audit(), audit.Options{})
 
 	fmt.Printf("Starting server on port %d\n", *port)
 	if err := http.ListenAndServe(fmt.Sprintf(":%d", *port), router); err != nil {
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"cse512/db"
+	"flag"
+	"fmt"
+)
+
+// runMigrate applies pending migrations, or lists them with -status
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	status := flags.Bool("status", false, "List migrations and whether they have been applied")
+	backfill := flags.Bool("backfill", false, "Add postings, types, money amounts and accounts to documents imported without them, and move failed transactions to the attempts")
+	flags.Parse(args)
+
+	ctx := context.Background()
+	database := db.GetDatabase()
+
+	if *backfill {
+		if err := db.BackfillPostings(ctx, database); err != nil {
+			return err
+		}
+		if err := db.BackfillTypes(ctx, database); err != nil {
+			return err
+		}
+		if err := db.BackfillMoney(ctx, database); err != nil {
+			return err
+		}
+		if err := db.BackfillAccounts(ctx, database); err != nil {
+			return err
+		}
+		if err := db.MoveFailedAttempts(ctx, database); err != nil {
+			return err
+		}
+		fmt.Println("Postings, types, money and accounts backfilled, failed transactions moved to the attempts.")
+		return nil
+	}
+
+	if *status {
+		migrations, records, err := db.MigrationStatus(ctx, database)
+		if err != nil {
+			return err
+		}
+		for i, migration := range migrations {
+			applied := "pending"
+			if records[i] != nil {
+				applied = "applied " + records[i].AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%3d  %-28s %s\n", migration.Version, applied, migration.Description)
+		}
+		return nil
+	}
+
+	ran, err := db.Migrate(ctx, database)
+	for _, migration := range ran {
+		fmt.Printf("Applied migration %d: %s\n", migration.Version, migration.Description)
+	}
+	if err != nil {
+		return err
+	}
+	if len(ran) == 0 {
+		fmt.Println("Database is up to date.")
+	}
+	return nil
+}
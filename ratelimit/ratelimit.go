@@ -0,0 +1,84 @@
+// Package ratelimit limits how often a caller, identified by a key such as a
+// user ID or IP address, may do something. Limits are kept in memory, so
+// each server instance enforces them separately.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// maxIdleKeys is the number of keys kept before those that have fully
+// recovered are forgotten
+const maxIdleKeys = 10000
+
+// Limiter is a token bucket per key: a key may act burst times at once and
+// regains one action every interval
+type Limiter struct {
+	burst    int
+	interval time.Duration
+	Now      func() time.Time // Current time, time.Now if nil
+
+	mu      sync.Mutex
+	buckets map[string]bucket
+}
+
+type bucket struct {
+	tokens float64
+	at     time.Time // When tokens was last updated
+}
+
+// New returns a Limiter allowing burst actions per key at once and one more
+// every interval
+func New(burst int, interval time.Duration) *Limiter {
+	return &Limiter{burst: burst, interval: interval, buckets: make(map[string]bucket)}
+}
+
+func (l *Limiter) now() time.Time {
+	if l.Now != nil {
+		return l.Now()
+	}
+	return time.Now()
+}
+
+// refilled returns the bucket of key as it is at now
+func (l *Limiter) refilled(key string, now time.Time) bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		return bucket{tokens: float64(l.burst), at: now}
+	}
+	b.tokens = min(float64(l.burst), b.tokens+float64(now.Sub(b.at))/float64(l.interval))
+	b.at = now
+	return b
+}
+
+// Allow takes an action for key if it has one left. Otherwise it returns
+// false and how long until the next one is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if len(l.buckets) >= maxIdleKeys {
+		l.forgetIdle(now)
+	}
+
+	b := l.refilled(key, now)
+	if b.tokens < 1 {
+		l.buckets[key] = b
+		return false, time.Duration((1 - b.tokens) * float64(l.interval))
+	}
+	b.tokens--
+	l.buckets[key] = b
+	return true, 0
+}
+
+// forgetIdle removes the keys whose buckets are full again, which behave as
+// if they had never acted. Callers must hold the lock.
+func (l *Limiter) forgetIdle(now time.Time) {
+	for key := range l.buckets {
+		if l.refilled(key, now).tokens >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
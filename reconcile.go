@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"cse512/db"
+	"cse512/reconcile"
+	"cse512/repository"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runReconcile recomputes balances from the ledger and reports, or with -fix
+// corrects, every account whose balance disagrees
+func runReconcile(args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	shards := flags.Int("shards", 8, "Number of account shards checked concurrently")
+	fix := flags.Bool("fix", false, "Write an adjustment transaction for every discrepancy")
+	asJSON := flags.Bool("json", false, "Print the report as JSON")
+	flags.Parse(args)
+
+	store := repository.NewMongoStore(db.GetDatabase())
+	report, err := reconcile.Run(context.Background(), store, reconcile.Options{Shards: *shards, Fix: *fix})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	for _, d := range report.Discrepancies {
+		fmt.Printf("Account %d of user %d: balance %s, ledger %s, difference %s", d.AccountNumber, d.UserID, d.Balance, d.LedgerBalance, d.Difference)
+		if d.Adjusted {
+			fmt.Print(" (adjusted)")
+		}
+		fmt.Println()
+		for _, t := range d.Suspects {
+			fmt.Printf("    %s transaction %d: %d -> %d, amount %s at %d, %q\n", t.Status, t.TransactionID, t.SenderID, t.ReceiverID, t.Amount, t.DateTimeStamp, t.Remarks)
+		}
+	}
+	fmt.Printf("Checked %d accounts, found %d discrepancies.\n", report.AccountsChecked, len(report.Discrepancies))
+	return nil
+}
@@ -0,0 +1,247 @@
+// Package reconcile checks that the balance of every account agrees with the
+// sum of its posted transactions.
+package reconcile
+
+import (
+	"context"
+	"cse512/audit"
+	"cse512/datamodels"
+	"cse512/ledger"
+	"cse512/repository"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Options configures a reconciliation run
+type Options struct {
+	Shards int  // Accounts are split by account_number modulo Shards and checked concurrently
+	Fix    bool // Write an adjustment transaction for every discrepancy
+	// Now timestamps adjustment transactions, defaults to time.Now
+	Now func() time.Time
+}
+
+// Discrepancy is an account whose balance does not match its ledger
+type Discrepancy struct {
+	AccountNumber int64                    `json:"account_number"`
+	UserID        int                      `json:"user_id"` // Owner of the account
+	Balance       datamodels.Money         `json:"balance"`
+	LedgerBalance datamodels.Money         `json:"ledger_balance"`
+	Difference    datamodels.Money         `json:"difference"` // Balance - LedgerBalance
+	Suspects      []datamodels.Transaction `json:"suspects"`   // Unposted transactions and attempts whose amount explains the difference
+	Adjusted      bool                     `json:"adjusted"`
+}
+
+// Report is the outcome of a run
+type Report struct {
+	AccountsChecked int           `json:"accounts_checked"`
+	Discrepancies   []Discrepancy `json:"discrepancies"`
+}
+
+// Run compares every account's balance with its ledger. With opts.Fix each
+// discrepancy is re-checked inside a transaction, so transfers that ran while
+// the shard was scanned are not mistaken for errors, and then corrected by
+// posting an adjustment that brings the ledger in line with the balance.
+func Run(ctx context.Context, store repository.Store, opts Options) (Report, error) {
+	if opts.Shards <= 0 {
+		opts.Shards = 1
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	reports := make([]Report, opts.Shards)
+	errs := make([]error, opts.Shards)
+
+	var wg sync.WaitGroup
+	for shard := 0; shard < opts.Shards; shard++ {
+		wg.Add(1)
+		go func(shard int) {
+			defer wg.Done()
+			reports[shard], errs[shard] = runShard(ctx, store, opts, shard)
+		}(shard)
+	}
+	wg.Wait()
+
+	var report Report
+	for shard := range reports {
+		if errs[shard] != nil {
+			return report, fmt.Errorf("reconciling shard %d: %w", shard, errs[shard])
+		}
+		report.AccountsChecked += reports[shard].AccountsChecked
+		report.Discrepancies = append(report.Discrepancies, reports[shard].Discrepancies...)
+	}
+
+	sort.Slice(report.Discrepancies, func(i, j int) bool {
+		return report.Discrepancies[i].AccountNumber < report.Discrepancies[j].AccountNumber
+	})
+	return report, nil
+}
+
+func runShard(ctx context.Context, store repository.Store, opts Options, shard int) (Report, error) {
+	var report Report
+
+	// Aggregate the ledger of the shard's accounts, then stream the accounts against it
+	totals := make(map[int64]datamodels.Money)
+	err := store.Transactions().LedgerBalances(ctx, opts.Shards, shard, func(accountNumber int64, balance datamodels.Money) error {
+		totals[accountNumber] = balance
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	var mismatched []int64
+	err = store.Accounts().ForEach(ctx, opts.Shards, shard, func(account datamodels.Account) error {
+		report.AccountsChecked++
+		if !agree(account.Balance, totals[account.AccountNumber]) {
+			mismatched = append(mismatched, account.AccountNumber)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for _, accountNumber := range mismatched {
+		discrepancy, found, err := check(ctx, store, opts, accountNumber)
+		if err != nil {
+			return report, err
+		}
+		if found {
+			report.Discrepancies = append(report.Discrepancies, discrepancy)
+		}
+	}
+	return report, nil
+}
+
+// check compares a single account's balance and ledger from a consistent
+// snapshot. With opts.Fix the adjustment is inserted within that snapshot's
+// unit of work, so its ID is picked around the unit, which is retried whole
+// if the ID is taken.
+func check(ctx context.Context, store repository.Store, opts Options, accountNumber int64) (Discrepancy, bool, error) {
+	if !opts.Fix {
+		return checkWithID(ctx, store, opts, accountNumber, 0)
+	}
+
+	var discrepancy Discrepancy
+	found := false
+	_, err := ledger.WithTransactionID(datamodels.Transaction{}, func(picked datamodels.Transaction) error {
+		var err error
+		discrepancy, found, err = checkWithID(ctx, store, opts, accountNumber, picked.TransactionID)
+		return err
+	})
+	return discrepancy, found, err
+}
+
+// checkWithID is check, giving an adjustment the transaction ID transactionID
+func checkWithID(ctx context.Context, store repository.Store, opts Options, accountNumber int64, transactionID int) (Discrepancy, bool, error) {
+	var discrepancy Discrepancy
+	found := false
+
+	err := store.WithTransaction(ctx, func(ctx context.Context) error {
+		account, err := store.Accounts().FindByNumber(ctx, accountNumber)
+		if err != nil {
+			return err
+		}
+		ledgerBalance, err := store.Transactions().LedgerBalance(ctx, accountNumber)
+		if err != nil {
+			return err
+		}
+
+		found = !agree(account.Balance, ledgerBalance)
+		if !found {
+			return nil
+		}
+
+		difference, err := account.Balance.Sub(ledgerBalance)
+		if err != nil {
+			return fmt.Errorf("account %d: %w", accountNumber, err)
+		}
+		discrepancy = Discrepancy{
+			AccountNumber: accountNumber,
+			UserID:        account.UserID,
+			Balance:       account.Balance,
+			LedgerBalance: ledgerBalance,
+			Difference:    difference,
+		}
+
+		unposted, err := store.Transactions().FindUnposted(ctx, accountNumber)
+		if err != nil {
+			return err
+		}
+		// Refused attempts are kept apart from the ledger but are suspects too
+		attempts, err := store.Attempts().FindByAccount(ctx, accountNumber)
+		if err != nil {
+			return err
+		}
+		for _, attempt := range attempts {
+			unposted = append(unposted, attempt.Transaction())
+		}
+		discrepancy.Suspects = suspects(unposted, accountNumber, discrepancy.Difference)
+
+		if !opts.Fix {
+			return nil
+		}
+
+		// The balance is already right, so the adjustment is recorded without
+		// being applied to it
+		adjustment := datamodels.Transaction{
+			TransactionID:   transactionID,
+			SenderID:        account.UserID,
+			SenderAccount:   accountNumber,
+			ReceiverID:      account.UserID,
+			ReceiverAccount: accountNumber,
+			Amount:          discrepancy.Difference,
+			Remarks:         fmt.Sprintf("Reconciliation adjustment of %s (balance %s, ledger %s)", discrepancy.Difference, account.Balance, ledgerBalance),
+			DateTimeStamp:   opts.Now().Unix(),
+			Status:          datamodels.StatusSettled,
+			Type:            datamodels.TypeAdjustment,
+			Postings:        datamodels.AdjustmentPostings(account, discrepancy.Difference),
+		}
+		if err := ledger.Correct(ctx, store, adjustment); err != nil {
+			return err
+		}
+		err = audit.Record(ctx, store.Audit(), datamodels.AuditEvent{
+			Action:        datamodels.AuditAdjustBalance,
+			UserID:        account.UserID,
+			AccountNumber: accountNumber,
+			TransactionID: adjustment.TransactionID,
+			Reason:        "reconciliation",
+			Detail:        fmt.Sprintf("Ledger adjusted by %s to match the balance", discrepancy.Difference),
+			Before:        audit.Snapshot(map[string]string{"balance": account.Balance.String(), "ledger": ledgerBalance.String()}),
+			After:         audit.Snapshot(map[string]string{"balance": account.Balance.String(), "ledger": account.Balance.String()}),
+		})
+		if err != nil {
+			return err
+		}
+		discrepancy.Adjusted = true
+		return nil
+	})
+
+	return discrepancy, found, err
+}
+
+// suspects returns the unposted transactions whose effect, had they been
+// applied, would account for the difference on their own. If none does, every
+// unposted transaction is returned for manual review.
+func suspects(unposted []datamodels.Transaction, accountNumber int64, difference datamodels.Money) []datamodels.Transaction {
+	var exact []datamodels.Transaction
+	for _, t := range unposted {
+		if effect, err := t.EffectOnAccount(accountNumber); err == nil && agree(effect, difference) {
+			exact = append(exact, t)
+		}
+	}
+	if len(exact) > 0 {
+		return exact
+	}
+	return unposted
+}
+
+// agree reports whether a balance and a ledger total are the same amount. An
+// account without postings has a ledger total of no currency.
+func agree(balance, ledger datamodels.Money) bool {
+	difference, err := balance.Sub(ledger)
+	return err == nil && difference.IsZero()
+}
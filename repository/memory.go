@@ -0,0 +1,942 @@
+package repository
+
+import (
+	"context"
+	"cse512/datamodels"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MemoryStore is an in-memory Store intended for tests and local development.
+// Transactions are serialized: WithTransaction holds the store lock for the
+// duration of fn and restores a snapshot if fn fails.
+type MemoryStore struct {
+	mu           sync.Mutex
+	users        map[int]datamodels.User
+	accounts     map[int64]datamodels.Account
+	payees       map[int64]datamodels.Payee
+	schedules    map[int64]datamodels.ScheduledTransfer
+	limits       map[int]datamodels.TransferLimits
+	audit        []datamodels.AuditEvent
+	auditQueue   []datamodels.AuditEvent // Appended but not yet chained
+	transactions []datamodels.Transaction
+	attempts     []datamodels.Attempt
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:     make(map[int]datamodels.User),
+		accounts:  make(map[int64]datamodels.Account),
+		payees:    make(map[int64]datamodels.Payee),
+		schedules: make(map[int64]datamodels.ScheduledTransfer),
+		limits:    make(map[int]datamodels.TransferLimits),
+	}
+}
+
+type memoryTxKey struct{}
+
+// lock acquires the store lock unless ctx belongs to a transaction on this
+// store, which already holds it. The returned function releases the lock.
+func (s *MemoryStore) lock(ctx context.Context) func() {
+	if ctx.Value(memoryTxKey{}) == s {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+func (s *MemoryStore) Users() UserRepository {
+	return memoryUserRepository{s}
+}
+
+func (s *MemoryStore) Accounts() AccountRepository {
+	return memoryAccountRepository{s}
+}
+
+func (s *MemoryStore) Payees() PayeeRepository {
+	return memoryPayeeRepository{s}
+}
+
+func (s *MemoryStore) Schedules() ScheduleRepository {
+	return memoryScheduleRepository{s}
+}
+
+func (s *MemoryStore) Limits() LimitRepository {
+	return memoryLimitRepository{s}
+}
+
+func (s *MemoryStore) Audit() AuditRepository {
+	return memoryAuditRepository{s}
+}
+
+func (s *MemoryStore) Transactions() TransactionRepository {
+	return memoryTransactionRepository{s}
+}
+
+func (s *MemoryStore) Attempts() AttemptRepository {
+	return memoryAttemptRepository{s}
+}
+
+func (s *MemoryStore) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	unlock := s.lock(ctx)
+	defer unlock()
+
+	// Snapshot the state so it can be restored on failure
+	users := make(map[int]datamodels.User, len(s.users))
+	for id, user := range s.users {
+		users[id] = user
+	}
+	accounts := make(map[int64]datamodels.Account, len(s.accounts))
+	for number, account := range s.accounts {
+		accounts[number] = account
+	}
+	payees := make(map[int64]datamodels.Payee, len(s.payees))
+	for id, payee := range s.payees {
+		payees[id] = payee
+	}
+	schedules := make(map[int64]datamodels.ScheduledTransfer, len(s.schedules))
+	for id, schedule := range s.schedules {
+		schedules[id] = schedule
+	}
+	limits := make(map[int]datamodels.TransferLimits, len(s.limits))
+	for id, limit := range s.limits {
+		limits[id] = limit
+	}
+	audit := append([]datamodels.AuditEvent(nil), s.audit...)
+	auditQueue := append([]datamodels.AuditEvent(nil), s.auditQueue...)
+	transactions := append([]datamodels.Transaction(nil), s.transactions...)
+	attempts := append([]datamodels.Attempt(nil), s.attempts...)
+
+	if err := fn(context.WithValue(ctx, memoryTxKey{}, s)); err != nil {
+		s.users = users
+		s.accounts = accounts
+		s.payees = payees
+		s.schedules = schedules
+		s.limits = limits
+		s.audit = audit
+		s.auditQueue = auditQueue
+		s.transactions = transactions
+		s.attempts = attempts
+		return err
+	}
+	return nil
+}
+
+type memoryUserRepository struct {
+	s *MemoryStore
+}
+
+func (r memoryUserRepository) FindByID(ctx context.Context, userID int) (datamodels.User, error) {
+	defer r.s.lock(ctx)()
+
+	user, ok := r.s.users[userID]
+	if !ok {
+		return datamodels.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (r memoryUserRepository) Insert(ctx context.Context, user datamodels.User) error {
+	defer r.s.lock(ctx)()
+
+	r.s.users[user.UserID] = user
+	return nil
+}
+
+func (r memoryUserRepository) InsertMany(ctx context.Context, users []datamodels.User) (int, error) {
+	defer r.s.lock(ctx)()
+
+	inserted := 0
+	for _, user := range users {
+		if _, exists := r.s.users[user.UserID]; exists {
+			continue
+		}
+		r.s.users[user.UserID] = user
+		inserted++
+	}
+	return inserted, nil
+}
+
+func (r memoryUserRepository) Search(ctx context.Context, query string, limit int) ([]datamodels.User, error) {
+	defer r.s.lock(ctx)()
+
+	query = strings.ToLower(query)
+	var users []datamodels.User
+	for _, user := range r.s.users {
+		name := strings.ToLower(user.FirstName + " " + user.LastName)
+		if strconv.Itoa(user.UserID) == query || strconv.FormatInt(user.AccountNumber, 10) == query ||
+			strings.Contains(name, query) || strings.Contains(strings.ToLower(user.Email), query) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+func (r memoryUserRepository) SetRole(ctx context.Context, userID int, role string) error {
+	defer r.s.lock(ctx)()
+
+	user, ok := r.s.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Role = role
+	r.s.users[userID] = user
+	return nil
+}
+
+type memoryAccountRepository struct {
+	s *MemoryStore
+}
+
+func (r memoryAccountRepository) FindByNumber(ctx context.Context, accountNumber int64) (datamodels.Account, error) {
+	defer r.s.lock(ctx)()
+
+	account, ok := r.s.accounts[accountNumber]
+	if !ok {
+		return datamodels.Account{}, ErrNotFound
+	}
+	return account, nil
+}
+
+func (r memoryAccountRepository) FindByUser(ctx context.Context, userID int) ([]datamodels.Account, error) {
+	defer r.s.lock(ctx)()
+
+	var accounts []datamodels.Account
+	for _, account := range r.s.accounts {
+		if account.UserID == userID {
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].AccountNumber < accounts[j].AccountNumber })
+	return accounts, nil
+}
+
+func (r memoryAccountRepository) Insert(ctx context.Context, account datamodels.Account) error {
+	defer r.s.lock(ctx)()
+
+	if _, exists := r.s.accounts[account.AccountNumber]; exists {
+		return ErrDuplicate
+	}
+	r.s.accounts[account.AccountNumber] = account
+	return nil
+}
+
+func (r memoryAccountRepository) InsertMany(ctx context.Context, accounts []datamodels.Account) (int, error) {
+	defer r.s.lock(ctx)()
+
+	inserted := 0
+	for _, account := range accounts {
+		if _, exists := r.s.accounts[account.AccountNumber]; exists {
+			continue
+		}
+		r.s.accounts[account.AccountNumber] = account
+		inserted++
+	}
+	return inserted, nil
+}
+
+func (r memoryAccountRepository) IncrementBalance(ctx context.Context, accountNumber int64, delta datamodels.Money) error {
+	defer r.s.lock(ctx)()
+
+	account, ok := r.s.accounts[accountNumber]
+	if !ok {
+		return ErrNotFound
+	}
+	if account.Balance.Currency != delta.Currency {
+		return fmt.Errorf("account %d: %w", accountNumber, datamodels.ErrCurrencyMismatch)
+	}
+
+	balance, err := account.Balance.Add(delta)
+	if err != nil {
+		return err
+	}
+	account.Balance = balance
+	r.s.accounts[accountNumber] = account
+	return nil
+}
+
+func (r memoryAccountRepository) Debit(ctx context.Context, accountNumber int64, amount datamodels.Money) error {
+	defer r.s.lock(ctx)()
+
+	account, ok := r.s.accounts[accountNumber]
+	if !ok {
+		return ErrNotFound
+	}
+	if account.Balance.Currency != amount.Currency {
+		return fmt.Errorf("account %d: %w", accountNumber, datamodels.ErrCurrencyMismatch)
+	}
+	if account.Available().Cmp(amount) < 0 {
+		return ErrInsufficientFunds
+	}
+
+	balance, err := account.Balance.Sub(amount)
+	if err != nil {
+		return err
+	}
+	account.Balance = balance
+	r.s.accounts[accountNumber] = account
+	return nil
+}
+
+func (r memoryAccountRepository) Hold(ctx context.Context, accountNumber int64, amount datamodels.Money) error {
+	defer r.s.lock(ctx)()
+
+	account, ok := r.s.accounts[accountNumber]
+	if !ok {
+		return ErrNotFound
+	}
+	if account.Balance.Currency != amount.Currency {
+		return fmt.Errorf("account %d: %w", accountNumber, datamodels.ErrCurrencyMismatch)
+	}
+	if account.Available().Cmp(amount) < 0 {
+		return ErrInsufficientFunds
+	}
+
+	held, err := account.Held.Add(amount)
+	if err != nil {
+		return err
+	}
+	account.Held = held
+	r.s.accounts[accountNumber] = account
+	return nil
+}
+
+func (r memoryAccountRepository) ReleaseHold(ctx context.Context, accountNumber int64, amount datamodels.Money) error {
+	defer r.s.lock(ctx)()
+
+	account, ok := r.s.accounts[accountNumber]
+	if !ok {
+		return ErrNotFound
+	}
+	if account.Held.Currency != amount.Currency || account.Held.Cmp(amount) < 0 {
+		return fmt.Errorf("account %d: release of %s exceeds its holds", accountNumber, amount)
+	}
+
+	held, err := account.Held.Sub(amount)
+	if err != nil {
+		return err
+	}
+	account.Held = held
+	r.s.accounts[accountNumber] = account
+	return nil
+}
+
+func (r memoryAccountRepository) SetFrozen(ctx context.Context, accountNumber int64, frozen bool) error {
+	defer r.s.lock(ctx)()
+
+	account, ok := r.s.accounts[accountNumber]
+	if !ok {
+		return ErrNotFound
+	}
+	account.Frozen = frozen
+	r.s.accounts[accountNumber] = account
+	return nil
+}
+
+func (r memoryAccountRepository) ForEach(ctx context.Context, shards, shard int, fn func(datamodels.Account) error) error {
+	// Copy the matches first so fn may call back into the store
+	unlock := r.s.lock(ctx)
+	var accounts []datamodels.Account
+	for _, account := range r.s.accounts {
+		if account.AccountNumber%int64(shards) == int64(shard) {
+			accounts = append(accounts, account)
+		}
+	}
+	unlock()
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].AccountNumber < accounts[j].AccountNumber })
+	for _, account := range accounts {
+		if err := fn(account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type memoryPayeeRepository struct {
+	s *MemoryStore
+}
+
+func (r memoryPayeeRepository) FindByID(ctx context.Context, payeeID int64) (datamodels.Payee, error) {
+	defer r.s.lock(ctx)()
+
+	payee, ok := r.s.payees[payeeID]
+	if !ok {
+		return datamodels.Payee{}, ErrNotFound
+	}
+	return payee, nil
+}
+
+func (r memoryPayeeRepository) FindByUser(ctx context.Context, userID int) ([]datamodels.Payee, error) {
+	defer r.s.lock(ctx)()
+
+	var payees []datamodels.Payee
+	for _, payee := range r.s.payees {
+		if payee.UserID == userID {
+			payees = append(payees, payee)
+		}
+	}
+	sort.Slice(payees, func(i, j int) bool {
+		if payees[i].CreatedAt != payees[j].CreatedAt {
+			return payees[i].CreatedAt < payees[j].CreatedAt
+		}
+		return payees[i].PayeeID < payees[j].PayeeID
+	})
+	return payees, nil
+}
+
+func (r memoryPayeeRepository) Insert(ctx context.Context, payee datamodels.Payee) error {
+	defer r.s.lock(ctx)()
+
+	for id, saved := range r.s.payees {
+		if id == payee.PayeeID || (saved.UserID == payee.UserID && saved.AccountNumber == payee.AccountNumber) {
+			return ErrDuplicate
+		}
+	}
+	r.s.payees[payee.PayeeID] = payee
+	return nil
+}
+
+func (r memoryPayeeRepository) Update(ctx context.Context, payee datamodels.Payee) error {
+	defer r.s.lock(ctx)()
+
+	if _, ok := r.s.payees[payee.PayeeID]; !ok {
+		return ErrNotFound
+	}
+	r.s.payees[payee.PayeeID] = payee
+	return nil
+}
+
+func (r memoryPayeeRepository) Delete(ctx context.Context, payeeID int64) error {
+	defer r.s.lock(ctx)()
+
+	if _, ok := r.s.payees[payeeID]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.payees, payeeID)
+	return nil
+}
+
+type memoryScheduleRepository struct {
+	s *MemoryStore
+}
+
+func (r memoryScheduleRepository) FindByID(ctx context.Context, scheduleID int64) (datamodels.ScheduledTransfer, error) {
+	defer r.s.lock(ctx)()
+
+	schedule, ok := r.s.schedules[scheduleID]
+	if !ok {
+		return datamodels.ScheduledTransfer{}, ErrNotFound
+	}
+	return schedule, nil
+}
+
+func (r memoryScheduleRepository) FindByUser(ctx context.Context, userID int) ([]datamodels.ScheduledTransfer, error) {
+	defer r.s.lock(ctx)()
+
+	var schedules []datamodels.ScheduledTransfer
+	for _, schedule := range r.s.schedules {
+		if schedule.UserID == userID {
+			schedules = append(schedules, schedule)
+		}
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		if schedules[i].CreatedAt != schedules[j].CreatedAt {
+			return schedules[i].CreatedAt < schedules[j].CreatedAt
+		}
+		return schedules[i].ScheduleID < schedules[j].ScheduleID
+	})
+	return schedules, nil
+}
+
+func (r memoryScheduleRepository) Insert(ctx context.Context, schedule datamodels.ScheduledTransfer) error {
+	defer r.s.lock(ctx)()
+
+	if _, exists := r.s.schedules[schedule.ScheduleID]; exists {
+		return ErrDuplicate
+	}
+	r.s.schedules[schedule.ScheduleID] = schedule
+	return nil
+}
+
+func (r memoryScheduleRepository) Cancel(ctx context.Context, scheduleID int64) error {
+	defer r.s.lock(ctx)()
+
+	schedule, ok := r.s.schedules[scheduleID]
+	if !ok || schedule.Status != datamodels.ScheduleActive {
+		return ErrNotFound
+	}
+	schedule.Status = datamodels.ScheduleCancelled
+	r.s.schedules[scheduleID] = schedule
+	return nil
+}
+
+func (r memoryScheduleRepository) ClaimDue(ctx context.Context, now int64, owner string, leaseUntil int64) (datamodels.ScheduledTransfer, error) {
+	defer r.s.lock(ctx)()
+
+	var due *datamodels.ScheduledTransfer
+	for _, schedule := range r.s.schedules {
+		if schedule.Status != datamodels.ScheduleActive || schedule.NextRunAt > now || schedule.LeaseUntil >= now {
+			continue
+		}
+		if due == nil || schedule.NextRunAt < due.NextRunAt || (schedule.NextRunAt == due.NextRunAt && schedule.ScheduleID < due.ScheduleID) {
+			due = &schedule
+		}
+	}
+	if due == nil {
+		return datamodels.ScheduledTransfer{}, ErrNotFound
+	}
+
+	due.LeaseOwner = owner
+	due.LeaseUntil = leaseUntil
+	r.s.schedules[due.ScheduleID] = *due
+	return *due, nil
+}
+
+func (r memoryScheduleRepository) Complete(ctx context.Context, schedule datamodels.ScheduledTransfer, owner string) error {
+	defer r.s.lock(ctx)()
+
+	stored, ok := r.s.schedules[schedule.ScheduleID]
+	if !ok || stored.LeaseOwner != owner {
+		return ErrNotFound
+	}
+	if stored.Status == datamodels.ScheduleCancelled {
+		schedule.Status = datamodels.ScheduleCancelled
+	}
+	schedule.LeaseOwner = ""
+	schedule.LeaseUntil = 0
+	r.s.schedules[schedule.ScheduleID] = schedule
+	return nil
+}
+
+type memoryLimitRepository struct {
+	s *MemoryStore
+}
+
+func (r memoryLimitRepository) FindByUser(ctx context.Context, userID int) (datamodels.TransferLimits, error) {
+	defer r.s.lock(ctx)()
+
+	limits, ok := r.s.limits[userID]
+	if !ok {
+		return datamodels.TransferLimits{}, ErrNotFound
+	}
+	return limits, nil
+}
+
+func (r memoryLimitRepository) Set(ctx context.Context, limits datamodels.TransferLimits) error {
+	defer r.s.lock(ctx)()
+
+	r.s.limits[limits.UserID] = limits
+	return nil
+}
+
+// Lock has nothing to do since units of work on a MemoryStore are serialized
+func (r memoryLimitRepository) Lock(ctx context.Context, userID int) error {
+	return nil
+}
+
+type memoryAuditRepository struct {
+	s *MemoryStore
+}
+
+func (r memoryAuditRepository) Append(ctx context.Context, event datamodels.AuditEvent) error {
+	defer r.s.lock(ctx)()
+
+	r.s.auditQueue = append(r.s.auditQueue, event)
+	return nil
+}
+
+func (r memoryAuditRepository) ChainQueued(ctx context.Context, limit int) (int, error) {
+	defer r.s.lock(ctx)()
+
+	var head datamodels.AuditEvent
+	if len(r.s.audit) > 0 {
+		head = r.s.audit[len(r.s.audit)-1]
+	}
+	chained := min(limit, len(r.s.auditQueue))
+	for _, event := range r.s.auditQueue[:chained] {
+		event.Chain(head)
+		r.s.audit = append(r.s.audit, event)
+		head = event
+	}
+	r.s.auditQueue = slices.Delete(r.s.auditQueue, 0, chained)
+	return chained, nil
+}
+
+// Head returns the last event, as a MemoryStore cannot be tampered with
+func (r memoryAuditRepository) Head(ctx context.Context) (datamodels.AuditEvent, error) {
+	defer r.s.lock(ctx)()
+
+	if len(r.s.audit) == 0 {
+		return datamodels.AuditEvent{}, nil
+	}
+	return r.s.audit[len(r.s.audit)-1], nil
+}
+
+func (r memoryAuditRepository) Find(ctx context.Context, query AuditQuery) ([]datamodels.AuditEvent, error) {
+	defer r.s.lock(ctx)()
+
+	var events []datamodels.AuditEvent
+	for _, event := range r.s.audit {
+		switch {
+		case event.Seq <= query.AfterSeq,
+			(query.From != 0 || query.To != 0) && (event.At < query.From || event.At > query.To),
+			query.Action != "" && event.Action != query.Action,
+			query.ActorID != 0 && event.ActorID != query.ActorID,
+			query.UserID != 0 && event.UserID != query.UserID:
+			continue
+		}
+		events = append(events, event)
+		if len(events) == query.Limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+func (r memoryAuditRepository) ForEach(ctx context.Context, fn func(event datamodels.AuditEvent) error) error {
+	unlock := r.s.lock(ctx)
+	events := slices.Clone(r.s.audit)
+	unlock()
+
+	for _, event := range events {
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type memoryTransactionRepository struct {
+	s *MemoryStore
+}
+
+func (r memoryTransactionRepository) Insert(ctx context.Context, transaction datamodels.Transaction) error {
+	defer r.s.lock(ctx)()
+
+	if transaction.TransactionID != 0 && r.s.indexOf(transaction.TransactionID) >= 0 {
+		return ErrDuplicate
+	}
+	if run := transaction.Schedule; run != nil && slices.ContainsFunc(r.s.transactions, func(t datamodels.Transaction) bool {
+		return t.Schedule != nil && *t.Schedule == *run
+	}) {
+		return ErrDuplicateRun
+	}
+	r.s.transactions = append(r.s.transactions, transaction)
+	return nil
+}
+
+func (r memoryTransactionRepository) FindByID(ctx context.Context, transactionID int) (datamodels.Transaction, error) {
+	defer r.s.lock(ctx)()
+
+	i := r.s.indexOf(transactionID)
+	if transactionID == 0 || i < 0 {
+		return datamodels.Transaction{}, ErrNotFound
+	}
+	return r.s.transactions[i], nil
+}
+
+func (r memoryTransactionRepository) Update(ctx context.Context, transaction datamodels.Transaction, from string) error {
+	defer r.s.lock(ctx)()
+
+	i := r.s.indexOf(transaction.TransactionID)
+	if transaction.TransactionID == 0 || i < 0 || r.s.transactions[i].Status != from {
+		return ErrConflict
+	}
+	r.s.transactions[i] = transaction
+	return nil
+}
+
+func (r memoryTransactionRepository) FindExpiredHolds(ctx context.Context, now int64, limit int) ([]datamodels.Transaction, error) {
+	defer r.s.lock(ctx)()
+
+	expired := r.s.filter(func(t datamodels.Transaction) bool {
+		return t.Status == datamodels.StatusAuthorized && t.Hold != nil && t.Hold.ExpiresAt <= now
+	})
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].Hold.ExpiresAt < expired[j].Hold.ExpiresAt
+	})
+	if len(expired) > limit {
+		expired = expired[:limit]
+	}
+	return expired, nil
+}
+
+func (r memoryTransactionRepository) InsertMany(ctx context.Context, transactions []datamodels.Transaction) (int, error) {
+	defer r.s.lock(ctx)()
+
+	existing := make(map[int]bool)
+	for _, t := range r.s.transactions {
+		if t.TransactionID != 0 {
+			existing[t.TransactionID] = true
+		}
+	}
+
+	inserted := 0
+	for _, transaction := range transactions {
+		if transaction.TransactionID != 0 && existing[transaction.TransactionID] {
+			continue
+		}
+		existing[transaction.TransactionID] = true
+		r.s.transactions = append(r.s.transactions, transaction)
+		inserted++
+	}
+	return inserted, nil
+}
+
+func (r memoryTransactionRepository) FindRecent(ctx context.Context, userID int, accountNumber int64, statuses []string, limit int) ([]datamodels.Transaction, error) {
+	defer r.s.lock(ctx)()
+
+	// Transactions are timestamped to the second, so of those in the same
+	// second the one inserted last comes first
+	matches := r.s.filter(onStatement(userID, accountNumber, statuses))
+	slices.Reverse(matches)
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].DateTimeStamp > matches[j].DateTimeStamp
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+func (r memoryTransactionRepository) FindInRange(ctx context.Context, userID int, accountNumber int64, statuses []string, from, to int64) ([]datamodels.Transaction, error) {
+	defer r.s.lock(ctx)()
+
+	involves := onStatement(userID, accountNumber, statuses)
+	return r.s.filter(func(t datamodels.Transaction) bool {
+		return involves(t) && t.DateTimeStamp >= from && t.DateTimeStamp <= to
+	}), nil
+}
+
+func (r memoryTransactionRepository) FindScheduleRun(ctx context.Context, run datamodels.ScheduleRun) (datamodels.Transaction, error) {
+	defer r.s.lock(ctx)()
+
+	for _, t := range r.s.transactions {
+		if t.Schedule != nil && *t.Schedule == run {
+			return t, nil
+		}
+	}
+	return datamodels.Transaction{}, ErrNotFound
+}
+
+func (r memoryTransactionRepository) SentSince(ctx context.Context, userID int, currency string, since int64) (datamodels.Money, int, error) {
+	defer r.s.lock(ctx)()
+
+	total := datamodels.NewMoney(0, currency)
+	count := 0
+	for _, t := range r.s.transactions {
+		if t.SenderID != userID || t.ReceiverID == userID || t.EffectiveType() != datamodels.TypeTransfer ||
+			t.DateTimeStamp < since || !slices.Contains(datamodels.CommittedStatuses, t.Status) {
+			continue
+		}
+		count++
+		if t.Amount.Currency == currency {
+			total.Minor += t.Amount.Minor
+		}
+	}
+	return total, count, nil
+}
+
+func (r memoryTransactionRepository) FindSent(ctx context.Context, userID int, since int64) ([]datamodels.Transaction, error) {
+	defer r.s.lock(ctx)()
+
+	sent := r.s.filter(func(t datamodels.Transaction) bool {
+		return t.SenderID == userID && t.ReceiverID != userID && t.EffectiveType() == datamodels.TypeTransfer &&
+			t.DateTimeStamp >= since && slices.Contains(datamodels.CommittedStatuses, t.Status)
+	})
+	sort.SliceStable(sent, func(i, j int) bool { return sent[i].DateTimeStamp < sent[j].DateTimeStamp })
+	return sent, nil
+}
+
+func (r memoryTransactionRepository) ReceivedSince(ctx context.Context, accountNumber int64, since int64) (int, error) {
+	defer r.s.lock(ctx)()
+
+	received := r.s.filter(func(t datamodels.Transaction) bool {
+		return t.ReceiverAccount == accountNumber && t.SenderID != t.ReceiverID && t.EffectiveType() == datamodels.TypeTransfer &&
+			t.DateTimeStamp >= since && slices.Contains(datamodels.CommittedStatuses, t.Status)
+	})
+	return len(received), nil
+}
+
+func (r memoryTransactionRepository) FindInReview(ctx context.Context, limit int) ([]datamodels.Transaction, error) {
+	defer r.s.lock(ctx)()
+
+	pending := r.s.filter(func(t datamodels.Transaction) bool {
+		return t.Status == datamodels.StatusPending && t.Risk != nil
+	})
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].DateTimeStamp < pending[j].DateTimeStamp })
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return pending, nil
+}
+
+func (r memoryTransactionRepository) FindUnposted(ctx context.Context, accountNumber int64) ([]datamodels.Transaction, error) {
+	defer r.s.lock(ctx)()
+
+	return r.s.filter(func(t datamodels.Transaction) bool {
+		return t.InvolvesAccount(accountNumber) && !t.IsPosted()
+	}), nil
+}
+
+func (r memoryTransactionRepository) LedgerBalances(ctx context.Context, shards, shard int, fn func(accountNumber int64, balance datamodels.Money) error) error {
+	unlock := r.s.lock(ctx)
+	balances := make(map[int64]datamodels.Money)
+	for _, t := range r.s.transactions {
+		if !t.IsPosted() {
+			continue
+		}
+		for _, posting := range t.LedgerPostings() {
+			if posting.UserID != 0 && posting.AccountNumber%int64(shards) == int64(shard) {
+				balance := balances[posting.AccountNumber]
+				balance.Minor += posting.Amount.Minor
+				balance.Currency = posting.Amount.Currency
+				balances[posting.AccountNumber] = balance
+			}
+		}
+	}
+	unlock()
+
+	for accountNumber, balance := range balances {
+		if err := fn(accountNumber, balance); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r memoryTransactionRepository) LedgerBalance(ctx context.Context, accountNumber int64) (datamodels.Money, error) {
+	defer r.s.lock(ctx)()
+
+	var balance datamodels.Money
+	for _, t := range r.s.transactions {
+		if !t.IsPosted() || !t.InvolvesAccount(accountNumber) {
+			continue
+		}
+		effect, err := t.EffectOnAccount(accountNumber)
+		if err != nil {
+			return datamodels.Money{}, err
+		}
+		if balance, err = balance.Add(effect); err != nil {
+			return datamodels.Money{}, err
+		}
+	}
+	return balance, nil
+}
+
+type memoryAttemptRepository struct {
+	s *MemoryStore
+}
+
+func (r memoryAttemptRepository) Insert(ctx context.Context, attempt datamodels.Attempt) error {
+	defer r.s.lock(ctx)()
+
+	r.s.attempts = append(r.s.attempts, attempt)
+	return nil
+}
+
+func (r memoryAttemptRepository) FindRecent(ctx context.Context, userID int, accountNumber int64, limit int) ([]datamodels.Attempt, error) {
+	defer r.s.lock(ctx)()
+
+	// As with transactions, of those in the same second the one inserted
+	// last comes first
+	matches := r.s.filterAttempts(involving(userID, accountNumber))
+	slices.Reverse(matches)
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].DateTimeStamp > matches[j].DateTimeStamp
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+func (r memoryAttemptRepository) FindInRange(ctx context.Context, userID int, accountNumber int64, from, to int64) ([]datamodels.Attempt, error) {
+	defer r.s.lock(ctx)()
+
+	involves := involving(userID, accountNumber)
+	return r.s.filterAttempts(func(t datamodels.Transaction) bool {
+		return involves(t) && t.DateTimeStamp >= from && t.DateTimeStamp <= to
+	}), nil
+}
+
+func (r memoryAttemptRepository) FindScheduleRun(ctx context.Context, run datamodels.ScheduleRun) (datamodels.Attempt, error) {
+	defer r.s.lock(ctx)()
+
+	for _, a := range r.s.attempts {
+		if a.Schedule != nil && *a.Schedule == run {
+			return a, nil
+		}
+	}
+	return datamodels.Attempt{}, ErrNotFound
+}
+
+func (r memoryAttemptRepository) FindByAccount(ctx context.Context, accountNumber int64) ([]datamodels.Attempt, error) {
+	defer r.s.lock(ctx)()
+
+	return r.s.filterAttempts(func(t datamodels.Transaction) bool {
+		return t.InvolvesAccount(accountNumber)
+	}), nil
+}
+
+// involving matches the transactions touching one of the user's accounts, or
+// only accountNumber if it is not 0
+func involving(userID int, accountNumber int64) func(datamodels.Transaction) bool {
+	if accountNumber != 0 {
+		return func(t datamodels.Transaction) bool { return t.InvolvesAccount(accountNumber) }
+	}
+	return func(t datamodels.Transaction) bool { return t.Involves(userID) }
+}
+
+// onStatement is involving limited to transactions with one of statuses, or of
+// any status if statuses is nil
+func onStatement(userID int, accountNumber int64, statuses []string) func(datamodels.Transaction) bool {
+	involves := involving(userID, accountNumber)
+	if statuses == nil {
+		return involves
+	}
+	return func(t datamodels.Transaction) bool {
+		return involves(t) && slices.Contains(statuses, t.Status)
+	}
+}
+
+// indexOf returns the position of the transaction with the given transaction
+// ID, or -1 if there is none
+func (s *MemoryStore) indexOf(transactionID int) int {
+	return slices.IndexFunc(s.transactions, func(t datamodels.Transaction) bool {
+		return t.TransactionID == transactionID
+	})
+}
+
+// filter returns copies of the transactions matching keep. Callers must hold the lock.
+func (s *MemoryStore) filter(keep func(datamodels.Transaction) bool) []datamodels.Transaction {
+	var matches []datamodels.Transaction
+	for _, t := range s.transactions {
+		if keep(t) {
+			matches = append(matches, t)
+		}
+	}
+	return matches
+}
+
+// filterAttempts returns copies of the attempts whose failed transaction
+// matches keep. Callers must hold the lock.
+func (s *MemoryStore) filterAttempts(keep func(datamodels.Transaction) bool) []datamodels.Attempt {
+	var matches []datamodels.Attempt
+	for _, a := range s.attempts {
+		if keep(a.Transaction()) {
+			matches = append(matches, a)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,1038 @@
+package repository
+
+import (
+	"context"
+	"cse512/datamodels"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// MongoStore is a Store backed by a MongoDB database
+type MongoStore struct {
+	database     *mongo.Database
+	users        *mongoUserRepository
+	accounts     *mongoAccountRepository
+	payees       *mongoPayeeRepository
+	schedules    *mongoScheduleRepository
+	limits       *mongoLimitRepository
+	audit        *mongoAuditRepository
+	transactions *mongoTransactionRepository
+	attempts     *mongoAttemptRepository
+}
+
+// NewMongoStore returns a Store using the users, accounts, payees,
+// scheduled_transfers, transfer_limits, audit_events, audit_chain,
+// audit_outbox, transactions and transaction_attempts collections of database
+func NewMongoStore(database *mongo.Database) *MongoStore {
+	s := &MongoStore{
+		database:     database,
+		users:        &mongoUserRepository{collection: database.Collection("users")},
+		accounts:     &mongoAccountRepository{collection: database.Collection("accounts")},
+		payees:       &mongoPayeeRepository{collection: database.Collection("payees")},
+		schedules:    &mongoScheduleRepository{collection: database.Collection("scheduled_transfers")},
+		limits:       &mongoLimitRepository{collection: database.Collection("transfer_limits")},
+		transactions: &mongoTransactionRepository{collection: database.Collection("transactions")},
+		attempts:     &mongoAttemptRepository{collection: database.Collection("transaction_attempts")},
+	}
+	s.audit = &mongoAuditRepository{
+		collection: database.Collection("audit_events"),
+		chain:      database.Collection("audit_chain"),
+		outbox:     database.Collection("audit_outbox"),
+		store:      s,
+	}
+	return s
+}
+
+func (s *MongoStore) Users() UserRepository {
+	return s.users
+}
+
+func (s *MongoStore) Accounts() AccountRepository {
+	return s.accounts
+}
+
+func (s *MongoStore) Payees() PayeeRepository {
+	return s.payees
+}
+
+func (s *MongoStore) Schedules() ScheduleRepository {
+	return s.schedules
+}
+
+func (s *MongoStore) Limits() LimitRepository {
+	return s.limits
+}
+
+func (s *MongoStore) Audit() AuditRepository {
+	return s.audit
+}
+
+func (s *MongoStore) Transactions() TransactionRepository {
+	return s.transactions
+}
+
+func (s *MongoStore) Attempts() AttemptRepository {
+	return s.attempts
+}
+
+// WithTransaction runs fn inside a multi-document transaction, or as part of
+// the transaction ctx already belongs to. Transactions must read from the
+// primary, whatever the client's default read preference is.
+func (s *MongoStore) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	// Join the transaction ctx already belongs to
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	session, err := s.database.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	opts := options.Transaction().SetReadPreference(readpref.Primary())
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (any, error) {
+		return nil, fn(sessCtx)
+	}, opts)
+	return err
+}
+
+type mongoUserRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoUserRepository) FindByID(ctx context.Context, userID int) (datamodels.User, error) {
+	var user datamodels.User
+	err := r.collection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (r *mongoUserRepository) Insert(ctx context.Context, user datamodels.User) error {
+	_, err := r.collection.InsertOne(ctx, user)
+	return err
+}
+
+func (r *mongoUserRepository) InsertMany(ctx context.Context, users []datamodels.User) (int, error) {
+	documents := make([]any, len(users))
+	for i, user := range users {
+		documents[i] = user
+	}
+	return insertMany(ctx, r.collection, documents)
+}
+
+func (r *mongoUserRepository) Search(ctx context.Context, query string, limit int) ([]datamodels.User, error) {
+	pattern := primitive.Regex{Pattern: regexp.QuoteMeta(query), Options: "i"}
+	or := bson.A{
+		bson.M{"first_name": pattern},
+		bson.M{"last_name": pattern},
+		bson.M{"email": pattern},
+	}
+	// A name can only be matched in full across both fields with an expression
+	or = append(or, bson.M{"$expr": bson.M{"$regexMatch": bson.M{
+		"input":   bson.M{"$concat": bson.A{"$first_name", " ", "$last_name"}},
+		"regex":   regexp.QuoteMeta(query),
+		"options": "i",
+	}}})
+	if number, err := strconv.ParseInt(query, 10, 64); err == nil {
+		or = append(or, bson.M{"user_id": number}, bson.M{"account_number": number})
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "user_id", Value: 1}}).
+		SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, bson.M{"$or": or}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []datamodels.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *mongoUserRepository) SetRole(ctx context.Context, userID int, role string) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"user_id": userID}, bson.M{"$set": bson.M{"role": role}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoAccountRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoAccountRepository) FindByNumber(ctx context.Context, accountNumber int64) (datamodels.Account, error) {
+	var account datamodels.Account
+	err := r.collection.FindOne(ctx, bson.M{"account_number": accountNumber}).Decode(&account)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return account, ErrNotFound
+	}
+	return account, err
+}
+
+func (r *mongoAccountRepository) FindByUser(ctx context.Context, userID int) ([]datamodels.Account, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "account_number", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var accounts []datamodels.Account
+	if err := cursor.All(ctx, &accounts); err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+func (r *mongoAccountRepository) Insert(ctx context.Context, account datamodels.Account) error {
+	_, err := r.collection.InsertOne(ctx, account)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *mongoAccountRepository) InsertMany(ctx context.Context, accounts []datamodels.Account) (int, error) {
+	documents := make([]any, len(accounts))
+	for i, account := range accounts {
+		documents[i] = account
+	}
+	return insertMany(ctx, r.collection, documents)
+}
+
+func (r *mongoAccountRepository) IncrementBalance(ctx context.Context, accountNumber int64, delta datamodels.Money) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"account_number": accountNumber, "balance.currency": delta.Currency},
+		bson.M{"$inc": bson.M{"balance.minor_units": delta.Minor}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return r.unmatched(ctx, accountNumber, delta)
+	}
+	return nil
+}
+
+func (r *mongoAccountRepository) Debit(ctx context.Context, accountNumber int64, amount datamodels.Money) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{
+			"account_number":   accountNumber,
+			"balance.currency": amount.Currency,
+			"$expr":            bson.M{"$gte": bson.A{availableMinorUnits, amount.Minor}},
+		},
+		bson.M{"$inc": bson.M{"balance.minor_units": -amount.Minor}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if err := r.unmatched(ctx, accountNumber, amount); err != nil {
+			return err
+		}
+		return ErrInsufficientFunds
+	}
+	return nil
+}
+
+// availableMinorUnits computes an account's balance less its holds in a query
+var availableMinorUnits = bson.M{"$subtract": bson.A{
+	"$balance.minor_units",
+	bson.M{"$ifNull": bson.A{"$held.minor_units", 0}},
+}}
+
+func (r *mongoAccountRepository) Hold(ctx context.Context, accountNumber int64, amount datamodels.Money) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{
+			"account_number":   accountNumber,
+			"balance.currency": amount.Currency,
+			"$expr":            bson.M{"$gte": bson.A{availableMinorUnits, amount.Minor}},
+		},
+		bson.M{
+			"$inc": bson.M{"held.minor_units": amount.Minor},
+			"$set": bson.M{"held.currency": amount.Currency},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if err := r.unmatched(ctx, accountNumber, amount); err != nil {
+			return err
+		}
+		return ErrInsufficientFunds
+	}
+	return nil
+}
+
+func (r *mongoAccountRepository) ReleaseHold(ctx context.Context, accountNumber int64, amount datamodels.Money) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{
+			"account_number":   accountNumber,
+			"held.currency":    amount.Currency,
+			"held.minor_units": bson.M{"$gte": amount.Minor},
+		},
+		bson.M{"$inc": bson.M{"held.minor_units": -amount.Minor}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if _, err := r.FindByNumber(ctx, accountNumber); err != nil {
+			return err
+		}
+		return fmt.Errorf("account %d: release of %s exceeds its holds", accountNumber, amount)
+	}
+	return nil
+}
+
+// unmatched explains why a balance update for amount matched no account: the
+// account is missing or holds another currency. It returns nil otherwise.
+func (r *mongoAccountRepository) unmatched(ctx context.Context, accountNumber int64, amount datamodels.Money) error {
+	account, err := r.FindByNumber(ctx, accountNumber)
+	if err != nil {
+		return err
+	}
+	if account.Balance.Currency != amount.Currency {
+		return fmt.Errorf("account %d: %w", accountNumber, datamodels.ErrCurrencyMismatch)
+	}
+	return nil
+}
+
+func (r *mongoAccountRepository) SetFrozen(ctx context.Context, accountNumber int64, frozen bool) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"account_number": accountNumber}, bson.M{"$set": bson.M{"frozen": frozen}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoAccountRepository) ForEach(ctx context.Context, shards, shard int, fn func(datamodels.Account) error) error {
+	cursor, err := r.collection.Find(ctx, bson.M{"account_number": bson.M{"$mod": bson.A{shards, shard}}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var account datamodels.Account
+		if err := cursor.Decode(&account); err != nil {
+			return err
+		}
+		if err := fn(account); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+type mongoPayeeRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoPayeeRepository) FindByID(ctx context.Context, payeeID int64) (datamodels.Payee, error) {
+	var payee datamodels.Payee
+	err := r.collection.FindOne(ctx, bson.M{"payee_id": payeeID}).Decode(&payee)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return payee, ErrNotFound
+	}
+	return payee, err
+}
+
+func (r *mongoPayeeRepository) FindByUser(ctx context.Context, userID int) ([]datamodels.Payee, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "payee_id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var payees []datamodels.Payee
+	if err := cursor.All(ctx, &payees); err != nil {
+		return nil, err
+	}
+	return payees, nil
+}
+
+func (r *mongoPayeeRepository) Insert(ctx context.Context, payee datamodels.Payee) error {
+	_, err := r.collection.InsertOne(ctx, payee)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *mongoPayeeRepository) Update(ctx context.Context, payee datamodels.Payee) error {
+	result, err := r.collection.ReplaceOne(ctx, bson.M{"payee_id": payee.PayeeID}, payee)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoPayeeRepository) Delete(ctx context.Context, payeeID int64) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"payee_id": payeeID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoScheduleRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoScheduleRepository) FindByID(ctx context.Context, scheduleID int64) (datamodels.ScheduledTransfer, error) {
+	var schedule datamodels.ScheduledTransfer
+	err := r.collection.FindOne(ctx, bson.M{"schedule_id": scheduleID}).Decode(&schedule)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return schedule, ErrNotFound
+	}
+	return schedule, err
+}
+
+func (r *mongoScheduleRepository) FindByUser(ctx context.Context, userID int) ([]datamodels.ScheduledTransfer, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "schedule_id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var schedules []datamodels.ScheduledTransfer
+	if err := cursor.All(ctx, &schedules); err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func (r *mongoScheduleRepository) Insert(ctx context.Context, schedule datamodels.ScheduledTransfer) error {
+	_, err := r.collection.InsertOne(ctx, schedule)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *mongoScheduleRepository) Cancel(ctx context.Context, scheduleID int64) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"schedule_id": scheduleID, "status": datamodels.ScheduleActive},
+		bson.M{"$set": bson.M{"status": datamodels.ScheduleCancelled}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ClaimDue finds and leases in a single atomic update, so two instances
+// never claim the same scheduled transfer
+func (r *mongoScheduleRepository) ClaimDue(ctx context.Context, now int64, owner string, leaseUntil int64) (datamodels.ScheduledTransfer, error) {
+	filter := bson.M{
+		"status":      datamodels.ScheduleActive,
+		"next_run_at": bson.M{"$lte": now},
+		"lease_until": bson.M{"$lt": now},
+	}
+	update := bson.M{"$set": bson.M{"lease_owner": owner, "lease_until": leaseUntil}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_run_at", Value: 1}, {Key: "schedule_id", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var schedule datamodels.ScheduledTransfer
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&schedule)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return schedule, ErrNotFound
+	}
+	return schedule, err
+}
+
+func (r *mongoScheduleRepository) Complete(ctx context.Context, schedule datamodels.ScheduledTransfer, owner string) error {
+	// A cancellation made while the occurrence ran is kept
+	status := bson.M{"$cond": bson.A{
+		bson.M{"$eq": bson.A{"$status", datamodels.ScheduleCancelled}},
+		datamodels.ScheduleCancelled,
+		schedule.Status,
+	}}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"status":       status,
+		"occurrence":   schedule.Occurrence,
+		"next_run_at":  schedule.NextRunAt,
+		"runs":         schedule.Runs,
+		"last_run_at":  schedule.LastRunAt,
+		"last_status":  bson.M{"$literal": schedule.LastStatus},
+		"last_message": bson.M{"$literal": schedule.LastMessage},
+		"lease_owner":  "",
+		"lease_until":  int64(0),
+	}}}}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"schedule_id": schedule.ScheduleID, "lease_owner": owner}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoLimitRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoLimitRepository) FindByUser(ctx context.Context, userID int) (datamodels.TransferLimits, error) {
+	var limits datamodels.TransferLimits
+	err := r.collection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&limits)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return limits, ErrNotFound
+	}
+	return limits, err
+}
+
+func (r *mongoLimitRepository) Set(ctx context.Context, limits datamodels.TransferLimits) error {
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"user_id": limits.UserID}, limits, options.Replace().SetUpsert(true))
+	return err
+}
+
+// Lock writes the user's limits document, creating an empty one if needed.
+// Transactions writing the same document conflict, and WithTransaction
+// retries the one that loses.
+func (r *mongoLimitRepository) Lock(ctx context.Context, userID int) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$inc": bson.M{"lock": 1}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+type mongoAuditRepository struct {
+	collection *mongo.Collection
+	chain      *mongo.Collection // Holds the head of the log
+	outbox     *mongo.Collection // Events recorded but not yet chained
+	store      *MongoStore
+}
+
+// auditHeadID is the _id of the audit_chain document holding the head
+const auditHeadID = "head"
+
+// Append inserts the event into the outbox, in the unit of work of ctx if
+// there is one, so it is only queued if the work commits
+func (r *mongoAuditRepository) Append(ctx context.Context, event datamodels.AuditEvent) error {
+	_, err := r.outbox.InsertOne(ctx, event)
+	return err
+}
+
+// ChainQueued moves a batch from the outbox to the log and moves the head in
+// one transaction. Chainers racing each other conflict on the head document,
+// and WithTransaction retries the one that loses.
+func (r *mongoAuditRepository) ChainQueued(ctx context.Context, limit int) (int, error) {
+	chained := 0
+	err := r.store.WithTransaction(ctx, func(ctx context.Context) error {
+		chained = 0
+
+		// Outbox IDs are ObjectIDs, which sort in the order events were queued
+		opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit))
+		cursor, err := r.outbox.Find(ctx, bson.M{}, opts)
+		if err != nil {
+			return err
+		}
+		var queued []struct {
+			ID                    primitive.ObjectID `bson:"_id"`
+			datamodels.AuditEvent `bson:",inline"`
+		}
+		if err := cursor.All(ctx, &queued); err != nil {
+			return err
+		}
+		if len(queued) == 0 {
+			return nil
+		}
+
+		head, err := r.Head(ctx)
+		if err != nil {
+			return err
+		}
+		events := make([]any, len(queued))
+		ids := make([]primitive.ObjectID, len(queued))
+		for i, entry := range queued {
+			event := entry.AuditEvent
+			event.Chain(head)
+			head = event
+			events[i] = event
+			ids[i] = entry.ID
+		}
+		if _, err := r.collection.InsertMany(ctx, events); err != nil {
+			return err
+		}
+		if _, err := r.outbox.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+			return err
+		}
+		_, err = r.chain.UpdateOne(ctx,
+			bson.M{"_id": auditHeadID},
+			bson.M{"$set": bson.M{"seq": head.Seq, "hash": head.Hash}},
+			options.Update().SetUpsert(true),
+		)
+		chained = len(queued)
+		return err
+	})
+	return chained, err
+}
+
+func (r *mongoAuditRepository) Head(ctx context.Context) (datamodels.AuditEvent, error) {
+	var head datamodels.AuditEvent
+	err := r.chain.FindOne(ctx, bson.M{"_id": auditHeadID}).Decode(&head)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return datamodels.AuditEvent{}, nil
+	}
+	return head, err
+}
+
+func (r *mongoAuditRepository) Find(ctx context.Context, query AuditQuery) ([]datamodels.AuditEvent, error) {
+	filter := bson.M{}
+	if query.AfterSeq != 0 {
+		filter["seq"] = bson.M{"$gt": query.AfterSeq}
+	}
+	if query.From != 0 || query.To != 0 {
+		filter["at"] = bson.M{"$gte": query.From, "$lte": query.To}
+	}
+	if query.Action != "" {
+		filter["action"] = query.Action
+	}
+	if query.ActorID != 0 {
+		filter["actor_id"] = query.ActorID
+	}
+	if query.UserID != 0 {
+		filter["user_id"] = query.UserID
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}).SetLimit(int64(query.Limit))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var events []datamodels.AuditEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *mongoAuditRepository) ForEach(ctx context.Context, fn func(event datamodels.AuditEvent) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var event datamodels.AuditEvent
+		if err := cursor.Decode(&event); err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+type mongoTransactionRepository struct {
+	collection *mongo.Collection
+}
+
+// scheduleRunIndex is the name of the unique index on the occurrence of a
+// scheduled transfer a transaction was made for
+const scheduleRunIndex = "schedule.schedule_id_1_schedule.occurrence_1"
+
+// isDuplicateOn reports whether err is a duplicate key error on the named index
+func isDuplicateOn(err error, index string) bool {
+	return mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), "index: "+index+" ")
+}
+
+func (r *mongoTransactionRepository) Insert(ctx context.Context, transaction datamodels.Transaction) error {
+	_, err := r.collection.InsertOne(ctx, transaction)
+	switch {
+	case isDuplicateOn(err, scheduleRunIndex):
+		return ErrDuplicateRun
+	case mongo.IsDuplicateKeyError(err):
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (r *mongoTransactionRepository) FindByID(ctx context.Context, transactionID int) (datamodels.Transaction, error) {
+	var transaction datamodels.Transaction
+	if transactionID == 0 {
+		return transaction, ErrNotFound
+	}
+	err := r.collection.FindOne(ctx, bson.M{"transaction_id": transactionID}).Decode(&transaction)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return transaction, ErrNotFound
+	}
+	return transaction, err
+}
+
+func (r *mongoTransactionRepository) Update(ctx context.Context, transaction datamodels.Transaction, from string) error {
+	if transaction.TransactionID == 0 {
+		return ErrConflict
+	}
+	result, err := r.collection.ReplaceOne(ctx, bson.M{"transaction_id": transaction.TransactionID, "status": from}, transaction)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (r *mongoTransactionRepository) FindExpiredHolds(ctx context.Context, now int64, limit int) ([]datamodels.Transaction, error) {
+	filter := bson.M{
+		"status":          datamodels.StatusAuthorized,
+		"hold.expires_at": bson.M{"$lte": now},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "hold.expires_at", Value: 1}}).
+		SetLimit(int64(limit))
+
+	return r.find(ctx, filter, opts)
+}
+
+func (r *mongoTransactionRepository) InsertMany(ctx context.Context, transactions []datamodels.Transaction) (int, error) {
+	documents := make([]any, len(transactions))
+	for i, transaction := range transactions {
+		documents[i] = transaction
+	}
+	return insertMany(ctx, r.collection, documents)
+}
+
+// involvingFilter matches the transactions with a posting to one of the user's
+// accounts, or only to accountNumber if it is not 0
+func involvingFilter(userID int, accountNumber int64) bson.M {
+	if accountNumber != 0 {
+		return bson.M{"postings.account_number": accountNumber}
+	}
+	return bson.M{"postings.user_id": userID}
+}
+
+// statementFilter is involvingFilter limited to transactions with one of
+// statuses, or of any status if statuses is nil
+func statementFilter(userID int, accountNumber int64, statuses []string) bson.M {
+	filter := involvingFilter(userID, accountNumber)
+	if statuses != nil {
+		filter["status"] = bson.M{"$in": statuses}
+	}
+	return filter
+}
+
+func (r *mongoTransactionRepository) FindRecent(ctx context.Context, userID int, accountNumber int64, statuses []string, limit int) ([]datamodels.Transaction, error) {
+	filter := statementFilter(userID, accountNumber, statuses)
+	opts := options.Find().
+		SetSort(bson.D{{Key: "dateTimeStamp", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit))
+
+	return r.find(ctx, filter, opts)
+}
+
+func (r *mongoTransactionRepository) FindInRange(ctx context.Context, userID int, accountNumber int64, statuses []string, from, to int64) ([]datamodels.Transaction, error) {
+	filter := statementFilter(userID, accountNumber, statuses)
+	filter["dateTimeStamp"] = bson.M{
+		"$gte": from,
+		"$lte": to,
+	}
+
+	return r.find(ctx, filter)
+}
+
+func (r *mongoTransactionRepository) FindScheduleRun(ctx context.Context, run datamodels.ScheduleRun) (datamodels.Transaction, error) {
+	var transaction datamodels.Transaction
+	err := r.collection.FindOne(ctx, bson.M{
+		"schedule.schedule_id": run.ScheduleID,
+		"schedule.occurrence":  run.Occurrence,
+	}).Decode(&transaction)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return transaction, ErrNotFound
+	}
+	return transaction, err
+}
+
+func (r *mongoTransactionRepository) SentSince(ctx context.Context, userID int, currency string, since int64) (datamodels.Money, int, error) {
+	cursor, err := r.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"sender_id":     userID,
+			"receiver_id":   bson.M{"$ne": userID},
+			"type":          datamodels.TypeTransfer,
+			"dateTimeStamp": bson.M{"$gte": since},
+			"status":        bson.M{"$in": datamodels.CommittedStatuses},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   nil,
+			"count": bson.M{"$sum": 1},
+			"total": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$amount.currency", currency}},
+				"$amount.minor_units",
+				0,
+			}}},
+		}}},
+	})
+	if err != nil {
+		return datamodels.Money{}, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var totals []struct {
+		Count int   `bson:"count"`
+		Total int64 `bson:"total"`
+	}
+	if err := cursor.All(ctx, &totals); err != nil {
+		return datamodels.Money{}, 0, err
+	}
+	if len(totals) == 0 {
+		return datamodels.NewMoney(0, currency), 0, nil
+	}
+	return datamodels.NewMoney(totals[0].Total, currency), totals[0].Count, nil
+}
+
+func (r *mongoTransactionRepository) FindSent(ctx context.Context, userID int, since int64) ([]datamodels.Transaction, error) {
+	filter := bson.M{
+		"sender_id":     userID,
+		"receiver_id":   bson.M{"$ne": userID},
+		"type":          datamodels.TypeTransfer,
+		"dateTimeStamp": bson.M{"$gte": since},
+		"status":        bson.M{"$in": datamodels.CommittedStatuses},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "dateTimeStamp", Value: 1}})
+
+	return r.find(ctx, filter, opts)
+}
+
+func (r *mongoTransactionRepository) ReceivedSince(ctx context.Context, accountNumber int64, since int64) (int, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{
+		"receiver_account": accountNumber,
+		"type":             datamodels.TypeTransfer,
+		"dateTimeStamp":    bson.M{"$gte": since},
+		"status":           bson.M{"$in": datamodels.CommittedStatuses},
+		"$expr":            bson.M{"$ne": bson.A{"$sender_id", "$receiver_id"}},
+	})
+	return int(count), err
+}
+
+func (r *mongoTransactionRepository) FindInReview(ctx context.Context, limit int) ([]datamodels.Transaction, error) {
+	filter := bson.M{
+		"status": datamodels.StatusPending,
+		"risk":   bson.M{"$exists": true},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "dateTimeStamp", Value: 1}}).
+		SetLimit(int64(limit))
+
+	return r.find(ctx, filter, opts)
+}
+
+func (r *mongoTransactionRepository) FindUnposted(ctx context.Context, accountNumber int64) ([]datamodels.Transaction, error) {
+	filter := bson.M{
+		"postings.account_number": accountNumber,
+		"status":                  bson.M{"$nin": datamodels.PostedStatuses},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "dateTimeStamp", Value: 1}})
+
+	return r.find(ctx, filter, opts)
+}
+
+// ledgerPipeline sums the postings of posted transactions per account, keeping
+// the accounts matched by accountFilter
+func ledgerPipeline(accountFilter any) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"status":                  bson.M{"$in": datamodels.PostedStatuses},
+			"postings.account_number": accountFilter,
+		}}},
+		{{Key: "$unwind", Value: "$postings"}},
+		{{Key: "$match", Value: bson.M{"postings.account_number": accountFilter}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      "$postings.account_number",
+			"balance":  bson.M{"$sum": "$postings.amount.minor_units"},
+			"currency": bson.M{"$first": "$postings.amount.currency"},
+		}}},
+	}
+}
+
+type ledgerTotal struct {
+	AccountNumber int64  `bson:"_id"`
+	Balance       int64  `bson:"balance"`
+	Currency      string `bson:"currency"`
+}
+
+func (t ledgerTotal) money() datamodels.Money {
+	return datamodels.NewMoney(t.Balance, t.Currency)
+}
+
+func (r *mongoTransactionRepository) LedgerBalances(ctx context.Context, shards, shard int, fn func(accountNumber int64, balance datamodels.Money) error) error {
+	pipeline := ledgerPipeline(bson.M{"$mod": bson.A{shards, shard}})
+	cursor, err := r.collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var total ledgerTotal
+		if err := cursor.Decode(&total); err != nil {
+			return err
+		}
+		if err := fn(total.AccountNumber, total.money()); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (r *mongoTransactionRepository) LedgerBalance(ctx context.Context, accountNumber int64) (datamodels.Money, error) {
+	cursor, err := r.collection.Aggregate(ctx, ledgerPipeline(accountNumber))
+	if err != nil {
+		return datamodels.Money{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var totals []ledgerTotal
+	if err := cursor.All(ctx, &totals); err != nil {
+		return datamodels.Money{}, err
+	}
+	if len(totals) == 0 {
+		return datamodels.Money{}, nil
+	}
+	return totals[0].money(), nil
+}
+
+func (r *mongoTransactionRepository) find(ctx context.Context, filter bson.M, opts ...*options.FindOptions) ([]datamodels.Transaction, error) {
+	cursor, err := r.collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []datamodels.Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+type mongoAttemptRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoAttemptRepository) Insert(ctx context.Context, attempt datamodels.Attempt) error {
+	_, err := r.collection.InsertOne(ctx, attempt)
+	return err
+}
+
+func (r *mongoAttemptRepository) FindRecent(ctx context.Context, userID int, accountNumber int64, limit int) ([]datamodels.Attempt, error) {
+	filter := involvingFilter(userID, accountNumber)
+	opts := options.Find().
+		SetSort(bson.D{{Key: "dateTimeStamp", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit))
+
+	return r.find(ctx, filter, opts)
+}
+
+func (r *mongoAttemptRepository) FindInRange(ctx context.Context, userID int, accountNumber int64, from, to int64) ([]datamodels.Attempt, error) {
+	filter := involvingFilter(userID, accountNumber)
+	filter["dateTimeStamp"] = bson.M{
+		"$gte": from,
+		"$lte": to,
+	}
+
+	return r.find(ctx, filter)
+}
+
+func (r *mongoAttemptRepository) FindScheduleRun(ctx context.Context, run datamodels.ScheduleRun) (datamodels.Attempt, error) {
+	var attempt datamodels.Attempt
+	err := r.collection.FindOne(ctx, bson.M{
+		"schedule.schedule_id": run.ScheduleID,
+		"schedule.occurrence":  run.Occurrence,
+	}).Decode(&attempt)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return attempt, ErrNotFound
+	}
+	return attempt, err
+}
+
+func (r *mongoAttemptRepository) FindByAccount(ctx context.Context, accountNumber int64) ([]datamodels.Attempt, error) {
+	filter := bson.M{"postings.account_number": accountNumber}
+	opts := options.Find().SetSort(bson.D{{Key: "dateTimeStamp", Value: 1}})
+
+	return r.find(ctx, filter, opts)
+}
+
+func (r *mongoAttemptRepository) find(ctx context.Context, filter bson.M, opts ...*options.FindOptions) ([]datamodels.Attempt, error) {
+	cursor, err := r.collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var attempts []datamodels.Attempt
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+// insertMany performs an unordered bulk insert. Documents rejected by a unique
+// index are skipped rather than failing the batch, so loads can be re-run.
+func insertMany(ctx context.Context, collection *mongo.Collection, documents []any) (int, error) {
+	if len(documents) == 0 {
+		return 0, nil
+	}
+
+	_, err := collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, writeErr := range bulkErr.WriteErrors {
+			if !mongo.IsDuplicateKeyError(writeErr) {
+				return len(documents) - len(bulkErr.WriteErrors), err
+			}
+		}
+		return len(documents) - len(bulkErr.WriteErrors), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(documents), nil
+}
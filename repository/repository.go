@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"context"
+	"cse512/datamodels"
+	"errors"
+)
+
+// ErrNotFound is returned when the requested document does not exist
+var ErrNotFound = errors.New("repository: not found")
+
+// ErrInsufficientFunds is returned when a debit would take a balance below zero
+var ErrInsufficientFunds = errors.New("repository: insufficient funds")
+
+// ErrDuplicate is returned when inserting a document whose key already exists
+var ErrDuplicate = errors.New("repository: duplicate key")
+
+// ErrDuplicateRun is returned when inserting the transaction of an occurrence
+// of a scheduled transfer that already has one. Unlike ErrDuplicate, another
+// transaction ID does not help: the occurrence was made.
+var ErrDuplicateRun = errors.New("repository: occurrence of scheduled transfer already made")
+
+// ErrConflict is returned when a document changed since it was read
+var ErrConflict = errors.New("repository: document changed concurrently")
+
+// UserRepository provides access to the users collection
+type UserRepository interface {
+	// FindByID returns the user with the given user ID
+	FindByID(ctx context.Context, userID int) (datamodels.User, error)
+	// Insert stores a new user
+	Insert(ctx context.Context, user datamodels.User) error
+	// InsertMany stores users in bulk, skipping those that already exist, and
+	// returns the number inserted
+	InsertMany(ctx context.Context, users []datamodels.User) (int, error)
+	// Search returns up to limit users, by user ID, whose user ID or primary
+	// account number is query or whose name or email contains it, ignoring case
+	Search(ctx context.Context, query string, limit int) ([]datamodels.User, error)
+	// SetRole changes the role of the user, returning ErrNotFound if there is none
+	SetRole(ctx context.Context, userID int, role string) error
+}
+
+// AccountRepository provides access to the accounts collection
+type AccountRepository interface {
+	// FindByNumber returns the account with the given account number
+	FindByNumber(ctx context.Context, accountNumber int64) (datamodels.Account, error)
+	// FindByUser returns the accounts owned by the user, by account number
+	FindByUser(ctx context.Context, userID int) ([]datamodels.Account, error)
+	// Insert stores a new account, returning ErrDuplicate if its number is taken
+	Insert(ctx context.Context, account datamodels.Account) error
+	// InsertMany stores accounts in bulk, skipping those that already exist, and
+	// returns the number inserted
+	InsertMany(ctx context.Context, accounts []datamodels.Account) (int, error)
+	// IncrementBalance adds delta (which may be negative) to the account's
+	// balance, which must be in the same currency
+	IncrementBalance(ctx context.Context, accountNumber int64, delta datamodels.Money) error
+	// Debit subtracts amount from the account's balance only if the available
+	// balance covers it, returning ErrInsufficientFunds otherwise. The check
+	// and the update are a single atomic operation.
+	Debit(ctx context.Context, accountNumber int64, amount datamodels.Money) error
+	// Hold reserves amount of the account's available balance, the balance
+	// less what is already held, returning ErrInsufficientFunds if it does not
+	// cover it. The check and the update are a single atomic operation.
+	Hold(ctx context.Context, accountNumber int64, amount datamodels.Money) error
+	// ReleaseHold returns amount reserved by Hold to the available balance
+	ReleaseHold(ctx context.Context, accountNumber int64, amount datamodels.Money) error
+	// SetFrozen freezes or unfreezes the account, returning ErrNotFound if there is none
+	SetFrozen(ctx context.Context, accountNumber int64, frozen bool) error
+	// ForEach calls fn for every account whose account_number modulo shards
+	// equals shard, streaming rather than loading them all
+	ForEach(ctx context.Context, shards, shard int, fn func(datamodels.Account) error) error
+}
+
+// PayeeRepository provides access to the payees collection
+type PayeeRepository interface {
+	// FindByID returns the payee with the given payee ID
+	FindByID(ctx context.Context, payeeID int64) (datamodels.Payee, error)
+	// FindByUser returns the payees saved by the user, oldest first
+	FindByUser(ctx context.Context, userID int) ([]datamodels.Payee, error)
+	// Insert stores a new payee, returning ErrDuplicate if its ID is taken or
+	// the user already saved its account
+	Insert(ctx context.Context, payee datamodels.Payee) error
+	// Update replaces a stored payee
+	Update(ctx context.Context, payee datamodels.Payee) error
+	// Delete removes the payee with the given payee ID
+	Delete(ctx context.Context, payeeID int64) error
+}
+
+// ScheduleRepository provides access to the scheduled_transfers collection
+type ScheduleRepository interface {
+	// FindByID returns the scheduled transfer with the given schedule ID
+	FindByID(ctx context.Context, scheduleID int64) (datamodels.ScheduledTransfer, error)
+	// FindByUser returns the scheduled transfers of the user, oldest first
+	FindByUser(ctx context.Context, userID int) ([]datamodels.ScheduledTransfer, error)
+	// Insert stores a new scheduled transfer, returning ErrDuplicate if its ID is taken
+	Insert(ctx context.Context, schedule datamodels.ScheduledTransfer) error
+	// Cancel cancels an active scheduled transfer, returning ErrNotFound if
+	// there is none with the ID
+	Cancel(ctx context.Context, scheduleID int64) error
+	// ClaimDue leases the active scheduled transfer that has been due the
+	// longest at now and is not leased, to owner until leaseUntil. It returns
+	// ErrNotFound if none is due.
+	ClaimDue(ctx context.Context, now int64, owner string, leaseUntil int64) (datamodels.ScheduledTransfer, error)
+	// Complete records the run of a claimed scheduled transfer and releases
+	// its lease: the occurrence, next run, run count and last outcome are
+	// written, as is the status unless the transfer was cancelled meanwhile.
+	// It returns ErrNotFound if owner no longer holds the lease.
+	Complete(ctx context.Context, schedule datamodels.ScheduledTransfer, owner string) error
+}
+
+// LimitRepository provides access to the transfer_limits collection
+type LimitRepository interface {
+	// FindByUser returns the limits stored for the user, returning ErrNotFound
+	// if the user has the default limits
+	FindByUser(ctx context.Context, userID int) (datamodels.TransferLimits, error)
+	// Set stores limits for limits.UserID in place of any stored before
+	Set(ctx context.Context, limits datamodels.TransferLimits) error
+	// Lock makes the units of work that lock the same user's limits take
+	// effect one after another, so none decides on totals another is changing
+	Lock(ctx context.Context, userID int) error
+}
+
+// AuditQuery selects audit events. Zero fields select every event.
+type AuditQuery struct {
+	From     int64  // Earliest time
+	To       int64  // Latest time, any time if From and To are both 0
+	Action   string // One of the datamodels.Audit constants
+	ActorID  int    // User who acted
+	UserID   int    // User acted on
+	AfterSeq int64  // Only events after this position, to page through the log
+	Limit    int    // Most events returned, 0 for no limit
+}
+
+// AuditRepository provides access to the audit_events collection. The log is
+// append-only: events are never updated or removed.
+type AuditRepository interface {
+	// Append queues event to be chained onto the log. It does not touch the
+	// head, so units of work recording events do not wait on each other.
+	Append(ctx context.Context, event datamodels.AuditEvent) error
+	// ChainQueued chains up to limit queued events after the last event of
+	// the log, oldest first, and returns the number chained. Chaining takes
+	// effect one batch after another, so the chain never forks.
+	ChainQueued(ctx context.Context, limit int) (int, error)
+	// Head returns the last event appended, or the zero event if the log is
+	// empty. It is stored apart from the events, so removing events from the
+	// end of the log shows too.
+	Head(ctx context.Context) (datamodels.AuditEvent, error)
+	// Find returns the events query selects in log order
+	Find(ctx context.Context, query AuditQuery) ([]datamodels.AuditEvent, error)
+	// ForEach calls fn with every event in log order, stopping at the first error
+	ForEach(ctx context.Context, fn func(event datamodels.AuditEvent) error) error
+}
+
+// TransactionRepository provides access to the transactions collection
+type TransactionRepository interface {
+	// Insert stores a transaction record, returning ErrDuplicate if its
+	// transaction ID is taken and ErrDuplicateRun if the occurrence of a
+	// scheduled transfer it was made for already has a transaction
+	Insert(ctx context.Context, transaction datamodels.Transaction) error
+	// FindByID returns the transaction with the given transaction ID
+	FindByID(ctx context.Context, transactionID int) (datamodels.Transaction, error)
+	// Update replaces the stored transaction with the same transaction ID if
+	// its status is still from, returning ErrConflict otherwise
+	Update(ctx context.Context, transaction datamodels.Transaction, from string) error
+	// FindExpiredHolds returns up to limit authorizations whose hold expired
+	// at or before now, those that expired first first
+	FindExpiredHolds(ctx context.Context, now int64, limit int) ([]datamodels.Transaction, error)
+	// InsertMany stores transactions in bulk, skipping those whose transaction
+	// ID already exists, and returns the number inserted
+	InsertMany(ctx context.Context, transactions []datamodels.Transaction) (int, error)
+	// FindRecent returns up to limit transactions with a posting to one of the
+	// user's accounts, or only to accountNumber if it is not 0, newest first.
+	// Only those with one of statuses are returned, unless statuses is nil.
+	FindRecent(ctx context.Context, userID int, accountNumber int64, statuses []string, limit int) ([]datamodels.Transaction, error)
+	// FindInRange returns the transactions with a posting to one of the user's
+	// accounts, or only to accountNumber if it is not 0, with a timestamp in
+	// [from, to]. Only those with one of statuses are returned, unless statuses is nil.
+	FindInRange(ctx context.Context, userID int, accountNumber int64, statuses []string, from, to int64) ([]datamodels.Transaction, error)
+	// FindScheduleRun returns the transaction made by an occurrence of a scheduled transfer
+	FindScheduleRun(ctx context.Context, run datamodels.ScheduleRun) (datamodels.Transaction, error)
+	// SentSince totals the transfers the user sent to other users from since
+	// on that moved or hold money: the sum of those in currency and the
+	// number of all of them
+	SentSince(ctx context.Context, userID int, currency string, since int64) (datamodels.Money, int, error)
+	// FindSent returns the transfers the user sent to other users from since on
+	// that moved or hold money, oldest first
+	FindSent(ctx context.Context, userID int, since int64) ([]datamodels.Transaction, error)
+	// ReceivedSince counts the transfers from other users paid into the
+	// account from since on that moved or hold money
+	ReceivedSince(ctx context.Context, accountNumber int64, since int64) (int, error)
+	// FindInReview returns up to limit transfers held for review, oldest first
+	FindInReview(ctx context.Context, limit int) ([]datamodels.Transaction, error)
+	// FindUnposted returns the transactions involving the account that did not move money
+	FindUnposted(ctx context.Context, accountNumber int64) ([]datamodels.Transaction, error)
+	// LedgerBalances sums the posted transactions of every account whose
+	// account_number modulo shards equals shard and calls fn with each non-empty total
+	LedgerBalances(ctx context.Context, shards, shard int, fn func(accountNumber int64, balance datamodels.Money) error) error
+	// LedgerBalance sums the posted transactions of a single account
+	LedgerBalance(ctx context.Context, accountNumber int64) (datamodels.Money, error)
+}
+
+// AttemptRepository provides access to the transaction_attempts collection,
+// the requests to move money that were refused before anything was posted
+type AttemptRepository interface {
+	// Insert stores an attempt
+	Insert(ctx context.Context, attempt datamodels.Attempt) error
+	// FindRecent returns up to limit attempts with a posting to one of the
+	// user's accounts, or only to accountNumber if it is not 0, newest first
+	FindRecent(ctx context.Context, userID int, accountNumber int64, limit int) ([]datamodels.Attempt, error)
+	// FindInRange returns the attempts with a posting to one of the user's
+	// accounts, or only to accountNumber if it is not 0, with a timestamp in [from, to]
+	FindInRange(ctx context.Context, userID int, accountNumber int64, from, to int64) ([]datamodels.Attempt, error)
+	// FindScheduleRun returns the attempt made by an occurrence of a scheduled transfer
+	FindScheduleRun(ctx context.Context, run datamodels.ScheduleRun) (datamodels.Attempt, error)
+	// FindByAccount returns the attempts with a posting to the account
+	FindByAccount(ctx context.Context, accountNumber int64) ([]datamodels.Attempt, error)
+}
+
+// Store groups the repositories and runs units of work atomically
+type Store interface {
+	Users() UserRepository
+	Accounts() AccountRepository
+	Payees() PayeeRepository
+	Schedules() ScheduleRepository
+	Limits() LimitRepository
+	Audit() AuditRepository
+	Transactions() TransactionRepository
+	Attempts() AttemptRepository
+	// WithTransaction runs fn atomically. Repository calls made inside fn must use
+	// the context passed to fn. If fn returns an error every change is rolled back.
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
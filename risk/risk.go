@@ -0,0 +1,67 @@
+// Package risk screens transfers for fraud before they are committed. An
+// Engine runs every Rule on a transfer, each of which allows it, holds it for
+// review or denies it, and the strongest decision wins. The decisions other
+// than allow are kept as the reasons of the assessment, which is stored on
+// the transaction.
+package risk
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/repository"
+	"fmt"
+	"time"
+)
+
+// Transfer is what rules decide on
+type Transfer struct {
+	Transaction datamodels.Transaction // The transfer about to be committed, with its receiver found
+	Payee       *datamodels.Payee      // Set when the transfer is to a saved payee
+	Now         time.Time              // When the transfer was received
+}
+
+// Rule decides on a transfer. Rules read what else they need, such as the
+// sender's recent transfers, from the store.
+type Rule interface {
+	// Name identifies the rule in the reasons of an assessment
+	Name() string
+	// Evaluate returns one of the datamodels.Risk decisions and, unless it is
+	// datamodels.RiskAllow, why
+	Evaluate(ctx context.Context, store repository.Store, transfer Transfer) (decision string, detail string, err error)
+}
+
+// Engine runs a set of rules
+type Engine struct {
+	Rules []Rule
+}
+
+// NewEngine returns an Engine running rules
+func NewEngine(rules ...Rule) *Engine {
+	return &Engine{Rules: rules}
+}
+
+// Assess runs every rule on transfer and returns the strongest decision,
+// with the reasons of the rules that did not allow it
+func (e *Engine) Assess(ctx context.Context, store repository.Store, transfer Transfer) (datamodels.RiskAssessment, error) {
+	assessment := datamodels.RiskAssessment{Decision: datamodels.RiskAllow}
+	for _, rule := range e.Rules {
+		decision, detail, err := rule.Evaluate(ctx, store, transfer)
+		if err != nil {
+			return assessment, fmt.Errorf("risk rule %s: %w", rule.Name(), err)
+		}
+		if decision != datamodels.RiskAllow {
+			assessment.Add(datamodels.RiskReason{Rule: rule.Name(), Decision: decision, Detail: detail})
+		}
+	}
+	return assessment, nil
+}
+
+// DefaultRules returns the rules servers screen transfers with unless told otherwise
+func DefaultRules() []Rule {
+	return []Rule{
+		NewPayee{Amount: 5000, Age: 7 * 24 * time.Hour, Lookback: 90 * 24 * time.Hour},
+		VelocitySpike{Window: time.Hour, Baseline: 30 * 24 * time.Hour, MinCount: 5, Factor: 3},
+		RoundAmounts{Unit: 1000, Count: 3, Window: 24 * time.Hour},
+		InboundBurst{Window: time.Hour, Review: 10, Deny: 50},
+	}
+}
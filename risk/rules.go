@@ -0,0 +1,151 @@
+package risk
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/repository"
+	"fmt"
+	"time"
+)
+
+// NewPayee holds large transfers to accounts the sender has not paid before
+// Age ago, or to payees saved less than Age ago, for review
+type NewPayee struct {
+	Amount   int64         // Transfers of at least this many whole units of their currency are large
+	Age      time.Duration // How long ago an account must first have been paid to be known
+	Lookback time.Duration // How far back earlier transfers are looked for
+}
+
+func (r NewPayee) Name() string {
+	return "new_payee"
+}
+
+func (r NewPayee) Evaluate(ctx context.Context, store repository.Store, transfer Transfer) (string, string, error) {
+	t := transfer.Transaction
+	large, err := datamodels.FromMajor(r.Amount, t.Amount.Currency)
+	if err != nil || t.Amount.Cmp(large) < 0 {
+		return datamodels.RiskAllow, "", err
+	}
+
+	known := transfer.Now.Add(-r.Age).Unix()
+	if transfer.Payee != nil && transfer.Payee.CreatedAt > known {
+		return datamodels.RiskReview, fmt.Sprintf("%s to a payee saved less than %s ago", t.Amount, r.Age), nil
+	}
+
+	sent, err := store.Transactions().FindSent(ctx, t.SenderID, transfer.Now.Add(-r.Lookback).Unix())
+	if err != nil {
+		return datamodels.RiskAllow, "", err
+	}
+	for _, earlier := range sent {
+		if earlier.ReceiverAccount == t.ReceiverAccount && earlier.DateTimeStamp <= known {
+			return datamodels.RiskAllow, "", nil
+		}
+	}
+	return datamodels.RiskReview, fmt.Sprintf("%s to an account first paid less than %s ago", t.Amount, r.Age), nil
+}
+
+// VelocitySpike holds a transfer for review when the sender sends many more
+// transfers than usual: at least MinCount in the last Window, counting this
+// one, and more than Factor times their average per Window over Baseline
+type VelocitySpike struct {
+	Window   time.Duration
+	Baseline time.Duration
+	MinCount int
+	Factor   float64
+}
+
+func (r VelocitySpike) Name() string {
+	return "velocity_spike"
+}
+
+func (r VelocitySpike) Evaluate(ctx context.Context, store repository.Store, transfer Transfer) (string, string, error) {
+	t := transfer.Transaction
+	sent, err := store.Transactions().FindSent(ctx, t.SenderID, transfer.Now.Add(-r.Baseline).Unix())
+	if err != nil {
+		return datamodels.RiskAllow, "", err
+	}
+
+	recent := 1
+	windowStart := transfer.Now.Add(-r.Window).Unix()
+	for _, earlier := range sent {
+		if earlier.DateTimeStamp >= windowStart {
+			recent++
+		}
+	}
+	average := float64(len(sent)-recent+1) / max(float64(r.Baseline/r.Window)-1, 1)
+
+	if recent < r.MinCount || float64(recent) <= r.Factor*average {
+		return datamodels.RiskAllow, "", nil
+	}
+	return datamodels.RiskReview, fmt.Sprintf("%d transfers in the last %s, %.1f on average", recent, r.Window, average), nil
+}
+
+// RoundAmounts holds a transfer of a round amount for review when it makes
+// Count or more transfers of round amounts within Window
+type RoundAmounts struct {
+	Unit   int64 // Amounts that are a multiple of this many whole units are round
+	Count  int
+	Window time.Duration
+}
+
+func (r RoundAmounts) Name() string {
+	return "round_amounts"
+}
+
+// round reports whether amount is a multiple of the rule's unit
+func (r RoundAmounts) round(amount datamodels.Money) bool {
+	unit, err := datamodels.FromMajor(r.Unit, amount.Currency)
+	return err == nil && unit.Minor > 0 && amount.Minor%unit.Minor == 0
+}
+
+func (r RoundAmounts) Evaluate(ctx context.Context, store repository.Store, transfer Transfer) (string, string, error) {
+	t := transfer.Transaction
+	if !r.round(t.Amount) {
+		return datamodels.RiskAllow, "", nil
+	}
+
+	sent, err := store.Transactions().FindSent(ctx, t.SenderID, transfer.Now.Add(-r.Window).Unix())
+	if err != nil {
+		return datamodels.RiskAllow, "", err
+	}
+	count := 1
+	for _, earlier := range sent {
+		if r.round(earlier.Amount) {
+			count++
+		}
+	}
+
+	if count < r.Count {
+		return datamodels.RiskAllow, "", nil
+	}
+	return datamodels.RiskReview, fmt.Sprintf("%d transfers of round amounts in the last %s", count, r.Window), nil
+}
+
+// InboundBurst holds transfers to an account that was paid Review or more
+// times within Window for review, and denies them from Deny times on. Such
+// accounts are often used to collect and move on stolen money.
+type InboundBurst struct {
+	Window time.Duration
+	Review int
+	Deny   int
+}
+
+func (r InboundBurst) Name() string {
+	return "inbound_burst"
+}
+
+func (r InboundBurst) Evaluate(ctx context.Context, store repository.Store, transfer Transfer) (string, string, error) {
+	received, err := store.Transactions().ReceivedSince(ctx, transfer.Transaction.ReceiverAccount, transfer.Now.Add(-r.Window).Unix())
+	if err != nil {
+		return datamodels.RiskAllow, "", err
+	}
+
+	detail := fmt.Sprintf("receiving account was paid %d times in the last %s", received, r.Window)
+	switch {
+	case r.Deny > 0 && received >= r.Deny:
+		return datamodels.RiskDeny, detail, nil
+	case r.Review > 0 && received >= r.Review:
+		return datamodels.RiskReview, detail, nil
+	}
+	return datamodels.RiskAllow, "", nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"cse512/audit"
+	"cse512/datamodels"
+	"cse512/db"
+	"cse512/repository"
+	"flag"
+	"fmt"
+	"slices"
+)
+
+// runSetRole changes the role of a user, such as to make the first admin
+func runSetRole(args []string) error {
+	flags := flag.NewFlagSet("set-role", flag.ExitOnError)
+	userID := flags.Int("user", 0, "User ID of the user whose role changes")
+	role := flags.String("role", "", fmt.Sprintf("New role, one of %v", datamodels.Roles))
+	flags.Parse(args)
+
+	if *userID <= 0 || !slices.Contains(datamodels.Roles, *role) {
+		flags.PrintDefaults()
+		return fmt.Errorf("set-role needs a user ID and one of the roles %v", datamodels.Roles)
+	}
+
+	// The change is audited like one made through the admin API, as made by
+	// the server itself
+	store := repository.NewMongoStore(db.GetDatabase())
+	err := store.WithTransaction(context.Background(), func(ctx context.Context) error {
+		user, err := store.Users().FindByID(ctx, *userID)
+		if err != nil {
+			return err
+		}
+		if err := store.Users().SetRole(ctx, *userID, *role); err != nil {
+			return err
+		}
+		return audit.Record(ctx, store.Audit(), datamodels.AuditEvent{
+			Action: datamodels.AuditSetRole,
+			UserID: *userID,
+			Detail: fmt.Sprintf("%s to %s by the set-role command", user.EffectiveRole(), *role),
+			Before: audit.Snapshot(map[string]string{"role": user.EffectiveRole()}),
+			After:  audit.Snapshot(map[string]string{"role": *role}),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("User %d is now %s.\n", *userID, *role)
+	return nil
+}
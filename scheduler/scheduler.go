@@ -0,0 +1,133 @@
+// Package scheduler runs scheduled transfers when they fall due. Every server
+// instance may run a scheduler: an occurrence is only run by the instance
+// holding the lease on its transfer, and each occurrence makes at most one
+// transaction, so occurrences are not made twice when instances race or stop
+// halfway through a run.
+package scheduler
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/repository"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Outcome is the result of making the transaction of an occurrence
+type Outcome struct {
+	Status  string // Status of the transaction, datamodels.StatusSettled, StatusPending if held for review, or StatusFailed
+	Message string // Why it failed, or that it succeeded
+}
+
+// Executor makes the transaction of an occurrence of a scheduled transfer,
+// tagged with run so that it can be found again, and reports the outcome.
+// Failed transfers are recorded on the ledger as failed transactions.
+type Executor func(ctx context.Context, schedule datamodels.ScheduledTransfer, run datamodels.ScheduleRun) Outcome
+
+// Options configures a scheduler
+type Options struct {
+	Owner    string        // Identifies this instance in leases, must differ between instances
+	Interval time.Duration // How often due transfers are looked for, defaults to 30 seconds
+	Lease    time.Duration // How long a claimed transfer is reserved for this instance, defaults to a minute
+	// Now decides which transfers are due, defaults to time.Now
+	Now func() time.Time
+}
+
+func (opts *Options) setDefaults() {
+	if opts.Interval <= 0 {
+		opts.Interval = 30 * time.Second
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = time.Minute
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+}
+
+// Run runs due transfers every opts.Interval until ctx is cancelled
+func Run(ctx context.Context, store repository.Store, execute Executor, opts Options) {
+	opts.setDefaults()
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := RunDue(ctx, store, execute, opts); err != nil && ctx.Err() == nil {
+			log.Printf("Scheduler: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue claims and runs transfers until none is due, and returns the number run
+func RunDue(ctx context.Context, store repository.Store, execute Executor, opts Options) (int, error) {
+	opts.setDefaults()
+
+	ran := 0
+	for ctx.Err() == nil {
+		now := opts.Now()
+		schedule, err := store.Schedules().ClaimDue(ctx, now.Unix(), opts.Owner, now.Add(opts.Lease).Unix())
+		if errors.Is(err, repository.ErrNotFound) {
+			break
+		}
+		if err != nil {
+			return ran, fmt.Errorf("claiming due transfer: %w", err)
+		}
+
+		if err := runOccurrence(ctx, store, execute, opts, schedule); err != nil {
+			return ran, fmt.Errorf("running scheduled transfer %d: %w", schedule.ScheduleID, err)
+		}
+		ran++
+	}
+	return ran, ctx.Err()
+}
+
+// runOccurrence makes the transaction of the claimed transfer's next
+// occurrence, unless a previous run already did before it was interrupted,
+// and moves the transfer on to the following occurrence
+func runOccurrence(ctx context.Context, store repository.Store, execute Executor, opts Options, schedule datamodels.ScheduledTransfer) error {
+	run := datamodels.ScheduleRun{ScheduleID: schedule.ScheduleID, Occurrence: schedule.Occurrence}
+
+	var outcome Outcome
+	made, err := store.Transactions().FindScheduleRun(ctx, run)
+	if errors.Is(err, repository.ErrNotFound) {
+		// A refused occurrence is recorded as an attempt instead
+		var attempt datamodels.Attempt
+		attempt, err = store.Attempts().FindScheduleRun(ctx, run)
+		if err == nil {
+			made = attempt.Transaction()
+		}
+	}
+	switch {
+	case err == nil:
+		outcome = Outcome{Status: made.Status, Message: "Made by an earlier run that was interrupted."}
+	case errors.Is(err, repository.ErrNotFound):
+		outcome = execute(ctx, schedule, run)
+	default:
+		// The lease expires and the occurrence is retried
+		return err
+	}
+
+	now := opts.Now()
+	schedule.Runs++
+	schedule.LastRunAt = now.Unix()
+	schedule.LastStatus = outcome.Status
+	schedule.LastMessage = outcome.Message
+	schedule.Advance(now)
+
+	err = store.Schedules().Complete(ctx, schedule, opts.Owner)
+	if errors.Is(err, repository.ErrNotFound) {
+		// Another instance claimed the transfer after the lease expired. It
+		// finds the transaction made here and does not make it again.
+		log.Printf("Scheduler: lost the lease on scheduled transfer %d\n", schedule.ScheduleID)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"cse512/db"
+	"cse512/repository"
+	"cse512/seed"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runSeed bulk loads users, accounts and transactions from JSON or NDJSON files
+func runSeed(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	usersFile := flags.String("users", "", "Users file, e.g. update_userInfo.json")
+	accountsFile := flags.String("accounts", "", "Accounts file, e.g. mock_accounts.json, for users files without balances")
+	transactionsFile := flags.String("transactions", "", "Transactions file, e.g. mock_transactions.json")
+	workers := flags.Int("workers", 4, "Number of batches inserted concurrently")
+	batchSize := flags.Int("batch", 1000, "Number of records per insert")
+	resume := flags.Bool("resume", true, "Record progress in <file>.checkpoint and resume from it")
+	interval := flags.Duration("progress", 5*time.Second, "How often to report progress")
+	flags.Parse(args)
+
+	if *usersFile == "" && *accountsFile == "" && *transactionsFile == "" {
+		flags.PrintDefaults()
+		return fmt.Errorf("nothing to load, pass -users, -accounts and/or -transactions")
+	}
+
+	database := db.GetDatabase()
+	if _, err := db.Migrate(context.Background(), database); err != nil {
+		return err
+	}
+	store := repository.NewMongoStore(database)
+
+	options := func(file string) seed.Options {
+		opts := seed.Options{
+			BatchSize:        *batchSize,
+			Workers:          *workers,
+			Progress:         os.Stdout,
+			ProgressInterval: *interval,
+		}
+		if *resume {
+			opts.Checkpoint = file + ".checkpoint"
+		}
+		return opts
+	}
+
+	if *usersFile != "" {
+		file, err := os.Open(*usersFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		stats, err := seed.LoadUsers(context.Background(), file, store.Users(), store.Accounts(), options(*usersFile))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Loaded %d users (%d already present, %d invalid).\n", stats.Inserted, stats.Existing, stats.Invalid)
+	}
+
+	if *accountsFile != "" {
+		file, err := os.Open(*accountsFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		stats, err := seed.LoadAccounts(context.Background(), file, store.Accounts(), options(*accountsFile))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Loaded %d accounts (%d already present, %d invalid).\n", stats.Inserted, stats.Existing, stats.Invalid)
+	}
+
+	if *transactionsFile != "" {
+		file, err := os.Open(*transactionsFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		stats, err := seed.LoadTransactions(context.Background(), file, store.Transactions(), options(*transactionsFile))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Loaded %d transactions (%d already present, %d invalid).\n", stats.Inserted, stats.Existing, stats.Invalid)
+
+		// Postings of transactions from the mock data files only know the
+		// users, and their failed transactions are attempts
+		if err := db.BackfillAccounts(context.Background(), database); err != nil {
+			return err
+		}
+		if err := db.MoveFailedAttempts(context.Background(), database); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package seed
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Reader streams the records of a JSON array file (as exported by Compass or
+// written by the mock data generators) or of a newline-delimited JSON file.
+// Records are returned as raw extended JSON so types such as $numberLong survive.
+type Reader struct {
+	decoder *json.Decoder
+	array   bool
+	started bool
+	done    bool
+}
+
+// NewReader detects the format of r from its first non-space character
+func NewReader(r io.Reader) (*Reader, error) {
+	buffered := bufio.NewReaderSize(r, 1<<20)
+
+	for {
+		b, err := buffered.ReadByte()
+		if err == io.EOF {
+			return &Reader{decoder: json.NewDecoder(buffered), done: true}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+			continue
+		}
+		if b != '[' && b != '{' {
+			return nil, fmt.Errorf("seed: expected a JSON array or NDJSON, found %q", b)
+		}
+		buffered.UnreadByte()
+		return &Reader{decoder: json.NewDecoder(buffered), array: b == '['}, nil
+	}
+}
+
+// Next returns the next record, or io.EOF once every record has been read
+func (r *Reader) Next() (json.RawMessage, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+	if r.array && !r.started {
+		// Consume the opening bracket
+		if _, err := r.decoder.Token(); err != nil {
+			return nil, err
+		}
+	}
+	r.started = true
+
+	if !r.decoder.More() {
+		if r.array {
+			// Consume the closing bracket
+			if _, err := r.decoder.Token(); err != nil {
+				return nil, err
+			}
+		}
+		r.done = true
+		return nil, io.EOF
+	}
+
+	var record json.RawMessage
+	if err := r.decoder.Decode(&record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
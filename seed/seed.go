@@ -0,0 +1,378 @@
+// Package seed bulk loads users, accounts and transactions from the JSON files
+// used to populate the bank database.
+package seed
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Options configures a load
+type Options struct {
+	BatchSize        int           // Records per InsertMany call
+	Workers          int           // Number of batches inserted concurrently
+	Checkpoint       string        // File recording progress so a load can resume, empty to disable
+	Progress         io.Writer     // Where progress is reported, nil to disable
+	ProgressInterval time.Duration // How often progress is reported
+}
+
+func (o Options) withDefaults() Options {
+	if o.BatchSize <= 0 {
+		o.BatchSize = 1000
+	}
+	if o.Workers <= 0 {
+		o.Workers = 4
+	}
+	if o.ProgressInterval <= 0 {
+		o.ProgressInterval = 5 * time.Second
+	}
+	return o
+}
+
+// Stats summarises a load
+type Stats struct {
+	Read     int64 // Records read from the input, including resumed ones
+	Resumed  int64 // Records skipped because an earlier run already loaded them
+	Inserted int64 // Records inserted
+	Existing int64 // Records skipped because they were already in the database
+	Invalid  int64 // Records rejected by validation
+}
+
+// maxReportedErrors caps how many invalid records are described in the progress output
+const maxReportedErrors = 10
+
+// userRecord is a user as read from a users file. The mock data files predate
+// accounts and give every user a current_balance, which opens their primary
+// account.
+type userRecord struct {
+	User    datamodels.User   `bson:",inline"`
+	Balance *datamodels.Money `bson:"current_balance"`
+}
+
+// primaryAccount returns the checking account opened with the record's
+// current_balance, or nil if it has none
+func (r userRecord) primaryAccount() *datamodels.Account {
+	if r.Balance == nil {
+		return nil
+	}
+	return &datamodels.Account{
+		AccountNumber: r.User.AccountNumber,
+		UserID:        r.User.UserID,
+		Type:          datamodels.AccountChecking,
+		Balance:       *r.Balance,
+	}
+}
+
+// LoadUsers streams the users in r into users, and the primary accounts of
+// those with a current_balance into accounts
+func LoadUsers(ctx context.Context, r io.Reader, users repository.UserRepository, accounts repository.AccountRepository, opts Options) (Stats, error) {
+	return load(ctx, "users", r, func(raw json.RawMessage) (userRecord, error) {
+		var record userRecord
+		if err := bson.UnmarshalExtJSON(raw, false, &record); err != nil {
+			return record, err
+		}
+		if err := ValidateUser(record.User); err != nil {
+			return record, err
+		}
+		if account := record.primaryAccount(); account != nil {
+			return record, ValidateAccount(*account)
+		}
+		return record, nil
+	}, func(ctx context.Context, records []userRecord) (int, error) {
+		batch := make([]datamodels.User, len(records))
+		var opened []datamodels.Account
+		for i, record := range records {
+			batch[i] = record.User
+			if account := record.primaryAccount(); account != nil {
+				opened = append(opened, *account)
+			}
+		}
+
+		// Accounts go first so a user is never loaded without the balance
+		// that came with them
+		if _, err := accounts.InsertMany(ctx, opened); err != nil {
+			return 0, err
+		}
+		return users.InsertMany(ctx, batch)
+	}, opts)
+}
+
+// LoadAccounts streams the accounts in r into accounts
+func LoadAccounts(ctx context.Context, r io.Reader, accounts repository.AccountRepository, opts Options) (Stats, error) {
+	return load(ctx, "accounts", r, func(raw json.RawMessage) (datamodels.Account, error) {
+		var account datamodels.Account
+		if err := bson.UnmarshalExtJSON(raw, false, &account); err != nil {
+			return account, err
+		}
+		return account, ValidateAccount(account)
+	}, accounts.InsertMany, opts)
+}
+
+// LoadTransactions streams the transactions in r into transactions
+func LoadTransactions(ctx context.Context, r io.Reader, transactions repository.TransactionRepository, opts Options) (Stats, error) {
+	return load(ctx, "transactions", r, func(raw json.RawMessage) (datamodels.Transaction, error) {
+		var transaction datamodels.Transaction
+		if err := bson.UnmarshalExtJSON(raw, false, &transaction); err != nil {
+			return transaction, err
+		}
+		// The mock data files predate postings and types, and accounts, whose
+		// numbers db.BackfillAccounts adds to the postings afterwards
+		transaction.Postings = transaction.LedgerPostings()
+		transaction.Type = transaction.EffectiveType()
+		return transaction, ValidateTransaction(transaction)
+	}, transactions.InsertMany, opts)
+}
+
+// batch is a group of records inserted together. end is the number of input
+// records consumed once this batch is loaded, which is what the checkpoint stores.
+type batch[T any] struct {
+	seq     int
+	records []T
+	end     int64
+}
+
+func load[T any](
+	ctx context.Context,
+	name string,
+	r io.Reader,
+	decode func(json.RawMessage) (T, error),
+	insert func(context.Context, []T) (int, error),
+	opts Options,
+) (Stats, error) {
+	opts = opts.withDefaults()
+	var stats Stats
+
+	reader, err := NewReader(r)
+	if err != nil {
+		return stats, err
+	}
+
+	resumeFrom, err := readCheckpoint(opts.Checkpoint)
+	if err != nil {
+		return stats, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := make(chan batch[T], opts.Workers)
+	done := make(chan batch[T], opts.Workers)
+
+	// Insert batches concurrently, stopping everything at the first failure
+	var firstErr error
+	var errOnce sync.Once
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	var workers sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for b := range batches {
+				inserted, err := insert(ctx, b.records)
+				atomic.AddInt64(&stats.Inserted, int64(inserted))
+				if err != nil {
+					fail(fmt.Errorf("inserting %s batch ending at record %d: %w", name, b.end, err))
+					continue
+				}
+				atomic.AddInt64(&stats.Existing, int64(len(b.records)-inserted))
+				done <- b
+			}
+		}()
+	}
+
+	// Advance the checkpoint only past batches whose predecessors are all loaded
+	tracked := make(chan struct{})
+	go func() {
+		defer close(tracked)
+		pending := make(map[int]int64)
+		next := 0
+		committed := resumeFrom
+		for b := range done {
+			pending[b.seq] = b.end
+			advanced := false
+			for end, ok := pending[next]; ok; end, ok = pending[next] {
+				delete(pending, next)
+				next++
+				committed = end
+				advanced = true
+			}
+			if advanced {
+				if err := writeCheckpoint(opts.Checkpoint, committed); err != nil {
+					fail(err)
+				}
+			}
+		}
+	}()
+
+	stopProgress := reportProgress(name, opts, &stats)
+
+	// Read, validate and batch the input
+	readErr := func() error {
+		defer close(batches)
+
+		current := batch[T]{}
+		for {
+			raw, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("reading %s record %d: %w", name, stats.Read+1, err)
+			}
+			read := atomic.AddInt64(&stats.Read, 1)
+
+			if read <= resumeFrom {
+				atomic.AddInt64(&stats.Resumed, 1)
+				continue
+			}
+
+			record, err := decode(raw)
+			if err != nil {
+				if invalid := atomic.AddInt64(&stats.Invalid, 1); invalid <= maxReportedErrors && opts.Progress != nil {
+					fmt.Fprintf(opts.Progress, "%s: skipping invalid record %d: %v\n", name, read, err)
+				}
+			} else {
+				current.records = append(current.records, record)
+			}
+			current.end = read
+
+			if len(current.records) == opts.BatchSize {
+				select {
+				case batches <- current:
+				case <-ctx.Done():
+					return nil
+				}
+				current = batch[T]{seq: current.seq + 1}
+			}
+		}
+
+		if len(current.records) > 0 || current.end > 0 {
+			select {
+			case batches <- current:
+			case <-ctx.Done():
+			}
+		}
+		return nil
+	}()
+
+	workers.Wait()
+	close(done)
+	<-tracked
+	stopProgress()
+
+	if readErr != nil {
+		return stats, readErr
+	}
+	if firstErr != nil {
+		return stats, firstErr
+	}
+
+	// A complete load needs no checkpoint
+	if opts.Checkpoint != "" {
+		if err := os.Remove(opts.Checkpoint); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// reportProgress prints the load's statistics every interval until the returned function is called
+func reportProgress(name string, opts Options, stats *Stats) func() {
+	if opts.Progress == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+	print := func() {
+		inserted := atomic.LoadInt64(&stats.Inserted)
+		rate := float64(inserted) / time.Since(start).Seconds()
+		fmt.Fprintf(opts.Progress, "%s: read %d, inserted %d, already present %d, invalid %d, resumed %d (%.0f/s)\n",
+			name,
+			atomic.LoadInt64(&stats.Read),
+			inserted,
+			atomic.LoadInt64(&stats.Existing),
+			atomic.LoadInt64(&stats.Invalid),
+			atomic.LoadInt64(&stats.Resumed),
+			rate,
+		)
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(opts.ProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				print()
+			case <-stop:
+				print()
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+type checkpoint struct {
+	Records int64 `json:"records"`
+}
+
+// readCheckpoint returns how many input records an earlier run loaded
+func readCheckpoint(path string) (int64, error) {
+	if path == "" {
+		return 0, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var c checkpoint
+	if err := json.Unmarshal(data, &c); err != nil {
+		return 0, fmt.Errorf("reading checkpoint %s: %w", path, err)
+	}
+	return c.Records, nil
+}
+
+func writeCheckpoint(path string, records int64) error {
+	if path == "" {
+		return nil
+	}
+
+	data, _ := json.Marshal(checkpoint{Records: records})
+
+	// Write then rename so a crash never leaves a truncated checkpoint
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,60 @@
+package seed
+
+import (
+	"cse512/datamodels"
+	"errors"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ValidateUser reports why a user cannot be loaded, or nil if it can
+func ValidateUser(user datamodels.User) error {
+	switch {
+	case user.UserID <= 0:
+		return errors.New("user_id must be positive")
+	case user.AccountNumber <= 0:
+		return errors.New("account_number must be positive")
+	case !strings.Contains(user.Email, "@"):
+		return errors.New("email is not valid")
+	}
+
+	// Plain text passwords would never match at login
+	if _, err := bcrypt.Cost([]byte(user.PassHash)); err != nil {
+		return errors.New("password is not a bcrypt hash")
+	}
+	return nil
+}
+
+// ValidateAccount reports why an account cannot be loaded, or nil if it can
+func ValidateAccount(account datamodels.Account) error {
+	switch {
+	case account.AccountNumber <= 0:
+		return errors.New("account_number must be positive")
+	case account.UserID <= 0:
+		return errors.New("user_id must be positive")
+	case !slices.Contains(datamodels.AccountTypes, account.Type):
+		return errors.New("type must be checking or savings")
+	case account.Balance.Sign() < 0:
+		return errors.New("balance must not be negative")
+	}
+	return nil
+}
+
+// ValidateTransaction reports why a transaction cannot be loaded, or nil if it can
+func ValidateTransaction(transaction datamodels.Transaction) error {
+	switch {
+	case transaction.SenderID <= 0:
+		return errors.New("sender_id must be positive")
+	case transaction.ReceiverID <= 0:
+		return errors.New("receiver_id must be positive")
+	case transaction.Amount.IsZero():
+		return errors.New("amount must not be zero")
+	case transaction.DateTimeStamp <= 0:
+		return errors.New("dateTimeStamp must be positive")
+	case transaction.Status == "":
+		return errors.New("status is required")
+	}
+	return transaction.CheckBalanced()
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"cse512/handlers"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// openAccount opens an account of the given type for userID and returns its response
+func openAccount(t *testing.T, server *httptest.Server, userID int, accountType string) (int, handlers.AccountResponse) {
+	t.Helper()
+
+	data, _ := json.Marshal(map[string]any{"user_id": userID, "type": accountType})
+	res, err := http.Post(server.URL+"/accounts", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response struct {
+		Data handlers.AccountResponse `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	return res.StatusCode, response.Data
+}
+
+func TestOpenAndListAccounts(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	status, savings := openAccount(t, server, 106, "savings")
+	if status != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, status)
+	}
+	if savings.Type != "savings" || savings.Primary || !savings.Balance.IsZero() || savings.Currency != "USD" {
+		t.Errorf("Unexpected account %+v", savings)
+	}
+
+	if status, _ := openAccount(t, server, 106, "brokerage"); status != http.StatusBadRequest {
+		t.Errorf("Expected an unknown type to be rejected, got status %d", status)
+	}
+	if status, _ := openAccount(t, server, 9, "checking"); status != http.StatusNotFound {
+		t.Errorf("Expected an unknown user to be rejected, got status %d", status)
+	}
+
+	res, err := http.Get(server.URL + "/accounts?user_id=106")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response struct {
+		Status string                     `json:"status"`
+		Data   []handlers.AccountResponse `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if len(response.Data) != 2 {
+		t.Fatalf("Expected 2 accounts, got %+v", response.Data)
+	}
+	for _, account := range response.Data {
+		primary := account.AccountNumber == 482913374
+		if account.Primary != primary {
+			t.Errorf("Expected primary %t for account %d", primary, account.AccountNumber)
+		}
+	}
+}
+
+func TestTransferBetweenOwnAccounts(t *testing.T) {
+	server, store := newTestServer(t)
+	_, savings := openAccount(t, server, 106, "savings")
+
+	status, response := postTransaction(t, server, TransactionRequest{
+		SenderID:      106,
+		ReceiverID:    106,
+		FromAccount:   482913374,
+		AccountNumber: int(savings.AccountNumber),
+		Amount:        300,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, status, response.Message)
+	}
+	if response.UpdatedBalance != dollars(49700) {
+		t.Errorf("Expected updated balance 49700, got %s", response.UpdatedBalance)
+	}
+	if got := accountBalance(t, store, savings.AccountNumber); got != dollars(300) {
+		t.Errorf("Expected savings balance 300, got %s", got)
+	}
+
+	// Money cannot be moved out of an account into itself
+	status, response = postTransaction(t, server, TransactionRequest{
+		SenderID:      106,
+		FromAccount:   int(savings.AccountNumber),
+		AccountNumber: int(savings.AccountNumber),
+		Amount:        10,
+	})
+	if status != http.StatusBadRequest || response.Message != "Cannot transfer to the account the money comes from." {
+		t.Errorf("Expected a transfer into the same account to be rejected, got %d %q", status, response.Message)
+	}
+
+	// The savings statement only shows the transfer into it
+	res, err := http.Get(server.URL + "/transactions?sender_id=106&account_number=" + strconv.FormatInt(savings.AccountNumber, 10))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var transactions []handlers.TransactionResponse
+	if err := json.NewDecoder(res.Body).Decode(&transactions); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if len(transactions) != 1 || transactions[0].Amount != dollars(300) || transactions[0].SenderAccount != 482913374 {
+		t.Errorf("Unexpected savings statement %+v", transactions)
+	}
+}
+
+func TestTransferByAccountNumber(t *testing.T) {
+	server, store := newTestServer(t)
+
+	// The receiver is found from the account number alone
+	status, response := postTransaction(t, server, TransactionRequest{SenderID: 110, AccountNumber: 694332936, Amount: 25})
+	if status != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, status, response.Message)
+	}
+	if got := balanceOf(t, store, 50664); got != dollars(20025) {
+		t.Errorf("Expected receiver balance 20025, got %s", got)
+	}
+
+	status, response = postTransaction(t, server, TransactionRequest{SenderID: 110, AccountNumber: 999999999, Amount: 25})
+	if status != http.StatusNotFound || response.Code != handlers.CodeNotFound {
+		t.Errorf("Expected an unknown account to be not found, got %d %q", status, response.Code)
+	}
+
+	// Another user's account cannot be sent from
+	status, response = postTransaction(t, server, TransactionRequest{SenderID: 110, FromAccount: 482913374, AccountNumber: 694332936, Amount: 25})
+	if response.Code != handlers.CodeAccountMismatch {
+		t.Errorf("Expected code %q, got %d %q", handlers.CodeAccountMismatch, status, response.Code)
+	}
+}
+
+func TestTransactionsRejectForeignAccount(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	res, err := http.Get(server.URL + "/transactions?sender_id=106&account_number=694332936")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, res.StatusCode)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"cse512/audit"
+	"cse512/datamodels"
+	"cse512/handlers"
+	"cse512/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// auditEvents returns the events the audit query endpoint gives the admin
+// for the query string query
+func auditEvents(t *testing.T, server *httptest.Server, query string) []datamodels.AuditEvent {
+	t.Helper()
+
+	res := adminRequest(t, server, http.MethodGet, "/admin/audit/events?"+query, nil)
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d querying %q, got %d", http.StatusOK, query, res.StatusCode)
+	}
+	var response struct {
+		Data []datamodels.AuditEvent `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	return response.Data
+}
+
+func TestAuditRecordsLogins(t *testing.T) {
+	server, _ := newTestServer(t)
+	user := fixtureUsers[0].user
+
+	for _, password := range []string{"wrong", fixtureUsers[0].password} {
+		data, _ := json.Marshal(map[string]string{"user_id": "106", "email": user.Email, "password": password})
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/login", bytes.NewBuffer(data))
+		req.Header.Set("X-Request-ID", "login-"+password)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		res.Body.Close()
+		if res.Header.Get("X-Request-ID") != "login-"+password {
+			t.Errorf("Expected the request ID to be returned, got %q", res.Header.Get("X-Request-ID"))
+		}
+	}
+
+	failed := auditEvents(t, server, "action=login_failed")
+	if len(failed) != 1 || failed[0].UserID != 106 || failed[0].Reason != "wrong password" || failed[0].RequestID != "login-wrong" || failed[0].IP != "127.0.0.1" {
+		t.Errorf("Expected the failed login to be recorded, got %+v", failed)
+	}
+	logins := auditEvents(t, server, "action=login&user_id=106")
+	if len(logins) != 1 || logins[0].ActorID != 106 || logins[0].RequestID != "login-"+fixtureUsers[0].password {
+		t.Errorf("Expected the login to be recorded, got %+v", logins)
+	}
+}
+
+func TestAuditRecordsTransfers(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	status, response := postTransaction(t, server, TransactionRequest{SenderID: 106, ReceiverID: 110, AccountNumber: 310557821, Amount: 100})
+	if status != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, status)
+	}
+	status, _ = postTransaction(t, server, TransactionRequest{SenderID: 110, ReceiverID: 106, AccountNumber: 482913374, Amount: 5000})
+	if status != http.StatusBadRequest {
+		t.Fatalf("Expected status code %d, got %d", http.StatusBadRequest, status)
+	}
+
+	events := auditEvents(t, server, "action=transaction&user_id=106")
+	if len(events) != 1 || events[0].TransactionID != response.TransactionID || events[0].Before != "" || events[0].After != `{"amount":"100.00 USD","status":"settled"}` {
+		t.Errorf("Expected the transfer to be recorded, got %+v", events)
+	}
+	failed := auditEvents(t, server, "action=transaction_failed")
+	if len(failed) != 1 || failed[0].UserID != 110 || failed[0].Reason != handlers.CodeInsufficientFunds || failed[0].After != `{"amount":"5000.00 USD","status":"failed"}` {
+		t.Errorf("Expected the failed transfer to be recorded, got %+v", failed)
+	}
+}
+
+func TestAuditRecordsBeforeAndAfter(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	res := adminRequest(t, server, http.MethodPost, "/admin/accounts/310557821/freeze", nil)
+	res.Body.Close()
+	res = adminRequest(t, server, http.MethodPut, "/admin/limits/110", map[string]int{"daily": 100})
+	res.Body.Close()
+	res = adminRequest(t, server, http.MethodPut, "/admin/limits/110", map[string]int{"daily": 200})
+	res.Body.Close()
+
+	limits := func(daily int) string {
+		return fmt.Sprintf(`{"user_id":110,"single":0,"daily":%d,"monthly":0,"velocity":0}`, daily)
+	}
+	freezes := auditEvents(t, server, "action=freeze_account")
+	if len(freezes) != 1 || freezes[0].ActorID != fixtureAdmin.user.UserID || freezes[0].Before != `{"frozen":false}` || freezes[0].After != `{"frozen":true}` {
+		t.Errorf("Expected the freeze to be recorded, got %+v", freezes)
+	}
+
+	// Limits set for the first time had none before. The next page starts
+	// after the last event of the one before.
+	first := auditEvents(t, server, "action=set_limits&limit=1")
+	if len(first) != 1 || first[0].Before != "" || first[0].After != limits(100) {
+		t.Fatalf("Expected the first change of limits on the first page, got %+v", first)
+	}
+	next := auditEvents(t, server, fmt.Sprintf("action=set_limits&after=%d", first[0].Seq))
+	if len(next) != 1 || next[0].Before != limits(100) || next[0].After != limits(200) {
+		t.Errorf("Expected the second change of limits on the next page, got %+v", next)
+	}
+}
+
+func TestAuditQueryIsForAuditors(t *testing.T) {
+	server, _ := newSecuredServer(t)
+
+	res := authorizedRequest(t, server, fixtureToken(t, server, 106), http.MethodGet, "/admin/audit/events", nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status code %d for a customer, got %d", http.StatusForbidden, res.StatusCode)
+	}
+	res = adminRequest(t, server, http.MethodGet, "/admin/audit/events?limit=5000", nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for too large a limit, got %d", http.StatusBadRequest, res.StatusCode)
+	}
+}
+
+// tamperedLog hands out the events of a log after tamper changed them, as if
+// they were edited in the database
+type tamperedLog struct {
+	repository.AuditRepository
+	tamper func([]datamodels.AuditEvent) []datamodels.AuditEvent
+}
+
+func (l tamperedLog) ForEach(ctx context.Context, fn func(event datamodels.AuditEvent) error) error {
+	var events []datamodels.AuditEvent
+	l.AuditRepository.ForEach(ctx, func(event datamodels.AuditEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	for _, event := range l.tamper(events) {
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestVerifyAuditDetectsTampering(t *testing.T) {
+	ctx := context.Background()
+	log := repository.NewMemoryStore().Audit()
+	for userID := 1; userID <= 5; userID++ {
+		if err := audit.Record(ctx, log, datamodels.AuditEvent{ActorID: 900, Action: datamodels.AuditFreeze, UserID: userID}); err != nil {
+			t.Fatalf("Error recording event: %v", err)
+		}
+	}
+
+	// Nothing is on the log until the queued events are chained
+	if verified, err := audit.Verify(ctx, log); err != nil || verified != 0 {
+		t.Fatalf("Expected no events before chaining, got %d and %v", verified, err)
+	}
+	if chained, err := audit.Flush(ctx, log, audit.Options{Batch: 2}); err != nil || chained != 5 {
+		t.Fatalf("Expected 5 events to be chained, got %d and %v", chained, err)
+	}
+
+	verified, err := audit.Verify(ctx, log)
+	if err != nil || verified != 5 {
+		t.Fatalf("Expected 5 events to verify, got %d and %v", verified, err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func([]datamodels.AuditEvent) []datamodels.AuditEvent
+	}{
+		{"event changed", func(events []datamodels.AuditEvent) []datamodels.AuditEvent {
+			events[2].UserID = 42
+			return events
+		}},
+		{"event changed and rehashed", func(events []datamodels.AuditEvent) []datamodels.AuditEvent {
+			events[2].UserID = 42
+			events[2].Hash = events[2].ComputeHash()
+			return events
+		}},
+		{"event removed", func(events []datamodels.AuditEvent) []datamodels.AuditEvent {
+			return append(events[:2], events[3:]...)
+		}},
+		{"event removed and renumbered", func(events []datamodels.AuditEvent) []datamodels.AuditEvent {
+			events = append(events[:2], events[3:]...)
+			for i := 2; i < len(events); i++ {
+				events[i].Seq--
+			}
+			return events
+		}},
+		{"last event removed", func(events []datamodels.AuditEvent) []datamodels.AuditEvent {
+			return events[:4]
+		}},
+		{"events swapped", func(events []datamodels.AuditEvent) []datamodels.AuditEvent {
+			events[1], events[2] = events[2], events[1]
+			return events
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := audit.Verify(ctx, tamperedLog{log, test.tamper})
+			if !errors.Is(err, audit.ErrTampered) {
+				t.Errorf("Expected ErrTampered, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRecordConfigOnlyWhenChanged(t *testing.T) {
+	ctx := context.Background()
+	log := repository.NewMemoryStore().Audit()
+
+	for _, config := range []map[string]string{{"hold-expiry": "1h"}, {"hold-expiry": "1h"}, {"hold-expiry": "2h"}} {
+		if err := audit.RecordConfig(ctx, log, config); err != nil {
+			t.Fatalf("Error recording configuration: %v", err)
+		}
+	}
+
+	if _, err := audit.Flush(ctx, log, audit.Options{}); err != nil {
+		t.Fatalf("Error chaining events: %v", err)
+	}
+	events, err := log.Find(ctx, repository.AuditQuery{Action: datamodels.AuditConfig})
+	if err != nil {
+		t.Fatalf("Error fetching events: %v", err)
+	}
+	if len(events) != 2 || events[1].Before != `{"hold-expiry":"1h"}` || events[1].After != `{"hold-expiry":"2h"}` {
+		t.Errorf("Expected the change of configuration to be recorded once, got %+v", events)
+	}
+}
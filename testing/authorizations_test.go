@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"cse512/datamodels"
+	"cse512/handlers"
+	"cse512/holds"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTransactionTransitions(t *testing.T) {
+	tests := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{datamodels.StatusPending, datamodels.StatusAuthorized, true},
+		{datamodels.StatusPending, datamodels.StatusSettled, true},
+		{datamodels.StatusAuthorized, datamodels.StatusSettled, true},
+		{datamodels.StatusAuthorized, datamodels.StatusFailed, true},
+		{datamodels.StatusSettled, datamodels.StatusReversed, true},
+		{datamodels.StatusCompleted, datamodels.StatusReversed, true},
+		{datamodels.StatusAuthorized, datamodels.StatusReversed, false},
+		{datamodels.StatusSettled, datamodels.StatusFailed, false},
+		{datamodels.StatusFailed, datamodels.StatusSettled, false},
+		{datamodels.StatusReversed, datamodels.StatusSettled, false},
+	}
+	for _, test := range tests {
+		transaction := datamodels.Transaction{Status: test.from}
+		err := transaction.Transition(test.to)
+		if (err == nil) != test.allowed {
+			t.Errorf("%s to %s: expected allowed %v, got %v", test.from, test.to, test.allowed, err)
+		}
+	}
+}
+
+// releaseAuthorization posts to the capture or void endpoint of a transaction as userID
+func releaseAuthorization(t *testing.T, server *httptest.Server, action string, transactionID int, userID int) (int, handlers.Transaction) {
+	t.Helper()
+
+	data, _ := json.Marshal(map[string]int{"user_id": userID})
+	res, err := http.Post(server.URL+"/transaction/"+strconv.Itoa(transactionID)+"/"+action, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response handlers.Transaction
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	return res.StatusCode, response
+}
+
+// loginBalances logs user 110 in and returns its ledger and available balances
+func loginBalances(t *testing.T, server *httptest.Server) (datamodels.Money, datamodels.Money) {
+	t.Helper()
+
+	data, _ := json.Marshal(LoginRequest{UserID: "110", Email: "Thomas19@yahoo.com", Password: "qfKH89aXG9QFcOW"})
+	res, err := http.Post(server.URL+"/login", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response struct {
+		Data struct {
+			Ledger    datamodels.Money `json:"ledger_balance"`
+			Available datamodels.Money `json:"available_balance"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	return response.Data.Ledger, response.Data.Available
+}
+
+func TestAuthorizeAndCapture(t *testing.T) {
+	server, store := newTestServer(t)
+
+	status, authorized := postTransaction(t, server, TransactionRequest{SenderID: 110, ReceiverID: 50664, AccountNumber: 694332936, Amount: 600, Authorize: true})
+	if status != http.StatusOK || authorized.TransactionID == 0 || authorized.Message != "Transaction authorized successfully." {
+		t.Fatalf("Expected the transfer to be authorized, got %d %+v", status, authorized)
+	}
+
+	// The hold is only taken from the available balance
+	if ledger, available := loginBalances(t, server); ledger != dollars(1000) || available != dollars(400) {
+		t.Errorf("Expected ledger balance 1000 and available 400, got %s and %s", ledger, available)
+	}
+	if status, response := postTransaction(t, server, TransactionRequest{SenderID: 110, ReceiverID: 50664, AccountNumber: 694332936, Amount: 500}); status != http.StatusBadRequest || response.Code != handlers.CodeInsufficientFunds {
+		t.Errorf("Expected a transfer of held money to fail, got %d %+v", status, response)
+	}
+
+	if status, _ := releaseAuthorization(t, server, "capture", authorized.TransactionID, 106); status != http.StatusNotFound {
+		t.Errorf("Expected status code %d capturing another user's transfer, got %d", http.StatusNotFound, status)
+	}
+	status, captured := releaseAuthorization(t, server, "capture", authorized.TransactionID, 110)
+	if status != http.StatusOK || captured.UpdatedBalance != dollars(400) {
+		t.Fatalf("Expected the transfer to be captured, got %d %+v", status, captured)
+	}
+	if status, response := releaseAuthorization(t, server, "void", authorized.TransactionID, 110); status != http.StatusConflict || response.Code != handlers.CodeInvalidState {
+		t.Errorf("Expected voiding a captured transfer to fail, got %d %+v", status, response)
+	}
+
+	if ledger, available := loginBalances(t, server); ledger != dollars(400) || available != dollars(400) {
+		t.Errorf("Expected ledger and available balance 400, got %s and %s", ledger, available)
+	}
+	if got := balanceOf(t, store, 50664); got != dollars(20600) {
+		t.Errorf("Expected receiver balance 20600, got %s", got)
+	}
+
+	// The failed transfer of 500 is an attempt, not on the ledger
+	transactions := recentTransactions(t, server, 110)
+	if len(transactions) < 1 || transactions[0].TransactionID != authorized.TransactionID || transactions[0].Status != datamodels.StatusSettled {
+		t.Errorf("Expected the captured transfer to be settled, got %+v", transactions)
+	}
+}
+
+func TestVoidReleasesHold(t *testing.T) {
+	server, store := newTestServer(t)
+
+	_, authorized := postTransaction(t, server, TransactionRequest{SenderID: 110, ReceiverID: 50664, AccountNumber: 694332936, Amount: 600, Authorize: true})
+	if status, response := releaseAuthorization(t, server, "void", authorized.TransactionID, 110); status != http.StatusOK || response.UpdatedBalance != dollars(1000) {
+		t.Fatalf("Expected the transfer to be voided, got %d %+v", status, response)
+	}
+
+	if ledger, available := loginBalances(t, server); ledger != dollars(1000) || available != dollars(1000) {
+		t.Errorf("Expected ledger and available balance 1000, got %s and %s", ledger, available)
+	}
+	if got := balanceOf(t, store, 50664); got != dollars(20000) {
+		t.Errorf("Expected receiver balance to be unchanged, got %s", got)
+	}
+
+	transaction, err := store.Transactions().FindByID(context.Background(), authorized.TransactionID)
+	if err != nil || transaction.Status != datamodels.StatusFailed || transaction.Hold.Released != datamodels.HoldVoided {
+		t.Errorf("Expected a voided transaction, got %+v: %v", transaction, err)
+	}
+
+	// The voided transfer stays on the ledger but is only listed with include_failed
+	for _, transaction := range recentTransactions(t, server, 110) {
+		if transaction.TransactionID == authorized.TransactionID {
+			t.Errorf("Expected the voided transfer to be hidden, got %+v", transaction)
+		}
+	}
+	res, err := http.Get(server.URL + "/transactions?sender_id=110&include_failed=true")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+	var transactions []handlers.TransactionResponse
+	if err := json.NewDecoder(res.Body).Decode(&transactions); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if len(transactions) == 0 || transactions[0].TransactionID != authorized.TransactionID || transactions[0].Status != datamodels.StatusFailed {
+		t.Errorf("Expected the voided transfer with include_failed, got %+v", transactions)
+	}
+
+	// Cash moves at once and cannot be held
+	status, response := postTransaction(t, server, TransactionRequest{SenderID: 110, ReceiverID: 110, AccountNumber: 310557821, Amount: 10, Authorize: true})
+	if status != http.StatusBadRequest || response.Message != "Only transfers can be authorized." {
+		t.Errorf("Expected a held deposit to be rejected, got %d %+v", status, response)
+	}
+}
+
+func TestExpiredHoldsAreReleased(t *testing.T) {
+	now := time.Now()
+	server, store, handler := newClockedServer(t, &now)
+	handler.SetHoldExpiry(time.Hour)
+	ctx := context.Background()
+
+	_, authorized := postTransaction(t, server, TransactionRequest{SenderID: 110, ReceiverID: 50664, AccountNumber: 694332936, Amount: 600, Authorize: true})
+
+	// Nothing has expired yet
+	opts := holds.Options{Now: func() time.Time { return now }}
+	if expired, err := holds.ExpireDue(ctx, store, opts); err != nil || expired != 0 {
+		t.Fatalf("Expected no hold to expire, got %d: %v", expired, err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if expired, err := holds.ExpireDue(ctx, store, opts); err != nil || expired != 1 {
+		t.Fatalf("Expected one hold to expire, got %d: %v", expired, err)
+	}
+	if ledger, available := loginBalances(t, server); ledger != dollars(1000) || available != dollars(1000) {
+		t.Errorf("Expected ledger and available balance 1000, got %s and %s", ledger, available)
+	}
+	if status, _ := releaseAuthorization(t, server, "capture", authorized.TransactionID, 110); status != http.StatusConflict {
+		t.Errorf("Expected status code %d capturing an expired hold, got %d", http.StatusConflict, status)
+	}
+
+	transaction, _ := store.Transactions().FindByID(ctx, authorized.TransactionID)
+	if transaction.Status != datamodels.StatusFailed || transaction.Hold.Released != datamodels.HoldExpired {
+		t.Errorf("Expected an expired transaction, got %+v", transaction)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"cse512/datamodels"
+	"cse512/handlers"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type CashRequest struct {
+	UserID  int    `json:"user_id"`
+	Amount  int    `json:"amount"`
+	Remarks string `json:"remarks,omitempty"`
+}
+
+// postCash sends payload to a deposit or withdrawal route and decodes the response
+func postCash(t *testing.T, server *httptest.Server, route string, payload CashRequest) (int, handlers.Transaction) {
+	t.Helper()
+
+	data, _ := json.Marshal(payload)
+	res, err := http.Post(server.URL+route, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response handlers.Transaction
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	return res.StatusCode, response
+}
+
+func TestDepositAndWithdraw(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   string
+		payload CashRequest
+		status  int
+		message string
+		balance int
+	}{
+		{"deposit", "/deposit", CashRequest{UserID: 110, Amount: 250}, http.StatusOK, "Deposit completed successfully.", 1250},
+		{"withdrawal", "/withdraw", CashRequest{UserID: 110, Amount: 250}, http.StatusOK, "Withdrawal completed successfully.", 750},
+		{"negative deposit", "/deposit", CashRequest{UserID: 110, Amount: -250}, http.StatusBadRequest, "Amount must be positive.", 1000},
+		{"negative withdrawal", "/withdraw", CashRequest{UserID: 110, Amount: -250}, http.StatusBadRequest, "Amount must be positive.", 1000},
+		{"zero deposit", "/deposit", CashRequest{UserID: 110}, http.StatusBadRequest, "Amount must be positive.", 1000},
+		{"withdrawal over limit", "/withdraw", CashRequest{UserID: 106, Amount: int(handlers.MaxWithdrawal) + 1}, http.StatusBadRequest, "Withdrawals are limited to 10000.", 50000},
+		{"insufficient balance", "/withdraw", CashRequest{UserID: 110, Amount: 1001}, http.StatusBadRequest, "Insufficient balance.", 1000},
+		{"unknown user", "/deposit", CashRequest{UserID: 9, Amount: 10}, http.StatusNotFound, "User not found.", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, store := newTestServer(t)
+
+			status, response := postCash(t, server, test.route, test.payload)
+			if status != test.status {
+				t.Errorf("Expected status code %d, got %d", test.status, status)
+			}
+			if response.Message != test.message {
+				t.Errorf("Expected message %q, got %q", test.message, response.Message)
+			}
+			if status == http.StatusOK && response.UpdatedBalance != dollars(test.balance) {
+				t.Errorf("Expected updated balance %d, got %s", test.balance, response.UpdatedBalance)
+			}
+			if test.status != http.StatusNotFound {
+				if got := balanceOf(t, store, test.payload.UserID); got != dollars(test.balance) {
+					t.Errorf("Expected balance %d, got %s", test.balance, got)
+				}
+			}
+		})
+	}
+}
+
+func TestTransactionTypesAreListed(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	postCash(t, server, "/deposit", CashRequest{UserID: 110, Amount: 100})
+	postCash(t, server, "/withdraw", CashRequest{UserID: 110, Amount: 40})
+
+	res, err := http.Get(server.URL + "/transactions?sender_id=110")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var transactions []handlers.TransactionResponse
+	if err := json.NewDecoder(res.Body).Decode(&transactions); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	types := map[string]datamodels.Money{}
+	for _, transaction := range transactions {
+		types[transaction.Type] = transaction.Amount
+	}
+	if types["deposit"] != dollars(100) || types["withdrawal"] != dollars(-40) {
+		t.Errorf("Unexpected transactions %+v", transactions)
+	}
+
+	// Legacy fixtures without a type are classified from their amounts
+	res, err = http.Get(server.URL + "/transactions?sender_id=106")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	transactions = nil
+	json.NewDecoder(res.Body).Decode(&transactions)
+	if len(transactions) < 3 || transactions[0].Type != "deposit" || transactions[1].Type != "withdrawal" || transactions[2].Type != "transfer" {
+		t.Errorf("Unexpected legacy types %+v", transactions)
+	}
+}
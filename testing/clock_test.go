@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"cse512/handlers"
+	"cse512/repository"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newClockedServer serves the fixtures with a handler whose clock reads *now
+func newClockedServer(t *testing.T, now *time.Time) (*httptest.Server, *repository.MemoryStore, *handlers.Handler) {
+	t.Helper()
+
+	_, store := newTestServer(t)
+	handler := handlers.New(store)
+	handler.SetClock(func() time.Time { return *now })
+	server := httptest.NewServer(handlers.NewRouter(handler))
+	t.Cleanup(server.Close)
+
+	return server, store, handler
+}
+
+// recentTransactions returns the /transactions view of userID
+func recentTransactions(t *testing.T, server *httptest.Server, userID int) []handlers.TransactionResponse {
+	t.Helper()
+
+	res, err := http.Get(server.URL + "/transactions?sender_id=" + strconv.Itoa(userID))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var transactions []handlers.TransactionResponse
+	if err := json.NewDecoder(res.Body).Decode(&transactions); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	return transactions
+}
+
+func TestServerAssignsTimestamps(t *testing.T) {
+	now := time.Date(2030, time.March, 1, 12, 0, 0, 0, time.UTC)
+	server, _, _ := newClockedServer(t, &now)
+
+	// The client's time is kept for display next to the server's
+	requested := now.Add(-2 * time.Minute).Unix()
+	status, response := postTransaction(t, server, TransactionRequest{SenderID: 106, ReceiverID: 50664, AccountNumber: 694332936, Amount: 20, RequestedAt: requested})
+	if status != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, status, response.Message)
+	}
+
+	transactions := recentTransactions(t, server, 106)
+	if len(transactions) == 0 || int64(transactions[0].TimeStamp) != now.Unix() || transactions[0].RequestedAt != requested {
+		t.Errorf("Expected the transfer at %d requested at %d, got %+v", now.Unix(), requested, transactions)
+	}
+
+	// Without requested_at the transaction is still dated by the server
+	now = now.Add(time.Hour)
+	postTransaction(t, server, TransactionRequest{SenderID: 106, ReceiverID: 50664, AccountNumber: 694332936, Amount: 10})
+	transactions = recentTransactions(t, server, 106)
+	if len(transactions) == 0 || int64(transactions[0].TimeStamp) != now.Unix() || transactions[0].RequestedAt != 0 {
+		t.Errorf("Expected the transfer at %d without requested_at, got %+v", now.Unix(), transactions)
+	}
+}
+
+func TestClockSkewIsRejected(t *testing.T) {
+	now := time.Date(2030, time.March, 1, 12, 0, 0, 0, time.UTC)
+	server, store, handler := newClockedServer(t, &now)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"backdated", `{"sender_id": 106, "receiver_id": 50664, "account_number": 694332936, "amount": 20, "requested_at": 1700000000}`},
+		{"ahead", `{"sender_id": 106, "receiver_id": 50664, "account_number": 694332936, "amount": 20, "requested_at": ` + strconv.FormatInt(now.Add(time.Hour).Unix(), 10) + `}`},
+		{"older field name", `{"sender_id": 106, "receiver_id": 50664, "account_number": 694332936, "amount": 20, "dateTimeStamp": 1700000000}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := http.Post(server.URL+"/transaction", "application/json", bytes.NewBufferString(test.body))
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer res.Body.Close()
+
+			var response handlers.Transaction
+			json.NewDecoder(res.Body).Decode(&response)
+			if res.StatusCode != http.StatusBadRequest || response.Code != handlers.CodeRejected || response.Message != "requested_at must be within 5m0s of the server's time." {
+				t.Errorf("Expected the skewed request to be rejected, got %d %+v", res.StatusCode, response)
+			}
+		})
+	}
+	if got := balanceOf(t, store, 106); got != dollars(50000) {
+		t.Errorf("Expected sender balance to be unchanged, got %s", got)
+	}
+
+	// With the check disabled the transfer goes through, dated by the server
+	handler.SetMaxClockSkew(0)
+	status, response := postTransaction(t, server, TransactionRequest{SenderID: 106, ReceiverID: 50664, AccountNumber: 694332936, Amount: 20, RequestedAt: 1700000000})
+	if status != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, status, response.Message)
+	}
+	if transactions := recentTransactions(t, server, 106); int64(transactions[0].TimeStamp) != now.Unix() {
+		t.Errorf("Expected the transfer at %d, got %+v", now.Unix(), transactions[0])
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"cse512/datamodels"
+	"cse512/handlers"
+	"cse512/ratelimit"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMatchName(t *testing.T) {
+	tests := []struct {
+		entered string
+		result  string
+	}{
+		{"Humberto Bernhard", datamodels.NameMatch},
+		{"  humberto  BERNHARD ", datamodels.NameMatch},
+		{"Humberto Bernhard.", datamodels.NameMatch},
+		{"Bernhard Humberto", datamodels.NameCloseMatch},
+		{"Humberto", datamodels.NameCloseMatch},
+		{"Humberto B", datamodels.NameCloseMatch},
+		{"Humberto Bernhardt", datamodels.NameCloseMatch},
+		{"Humbrto Bernard", datamodels.NameCloseMatch},
+		{"Humberto C", datamodels.NameNoMatch},
+		{"Joe Wilderman", datamodels.NameNoMatch},
+		{"", datamodels.NameNoMatch},
+	}
+	for _, test := range tests {
+		if got := datamodels.MatchName(test.entered, "Humberto Bernhard"); got != test.result {
+			t.Errorf("MatchName(%q) = %q, expected %q", test.entered, got, test.result)
+		}
+	}
+}
+
+func TestMaskedName(t *testing.T) {
+	tests := []struct {
+		user   datamodels.User
+		masked string
+	}{
+		{datamodels.User{FirstName: "Humberto", LastName: "Bernhard"}, "Humberto B."},
+		{datamodels.User{FirstName: "Anke", LastName: "vogel"}, "Anke V."},
+		{datamodels.User{FirstName: "Cher"}, "Cher"},
+	}
+	for _, test := range tests {
+		if got := test.user.MaskedName(); got != test.masked {
+			t.Errorf("Expected %q, got %q", test.masked, got)
+		}
+	}
+}
+
+// confirmPayee looks up accountNumber for userID and decodes the response
+func confirmPayee(t *testing.T, server *httptest.Server, userID int, accountNumber int64, name string) (*http.Response, handlers.ConfirmPayeeResponse) {
+	t.Helper()
+
+	data, _ := json.Marshal(map[string]any{"user_id": userID, "account_number": accountNumber, "name": name})
+	res, err := http.Post(server.URL+"/payees/confirm", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response struct {
+		Data handlers.ConfirmPayeeResponse `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	return res, response.Data
+}
+
+func TestConfirmPayee(t *testing.T) {
+	tests := []struct {
+		name          string
+		accountNumber int64
+		entered       string
+		status        int
+		result        string
+	}{
+		{"match", 694332936, "Humberto Bernhard", http.StatusOK, datamodels.NameMatch},
+		{"close match", 694332936, "Humberto B", http.StatusOK, datamodels.NameCloseMatch},
+		{"no match", 694332936, "Thomas Kuhn", http.StatusOK, datamodels.NameNoMatch},
+		{"unknown account", 999999999, "Humberto Bernhard", http.StatusNotFound, ""},
+	}
+
+	server, _ := newTestServer(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, response := confirmPayee(t, server, 106, test.accountNumber, test.entered)
+			if res.StatusCode != test.status {
+				t.Fatalf("Expected status code %d, got %d", test.status, res.StatusCode)
+			}
+			if response.Result != test.result {
+				t.Errorf("Expected result %q, got %q", test.result, response.Result)
+			}
+			if test.status == http.StatusOK && response.MaskedName != "Humberto B." {
+				t.Errorf("Expected masked name %q, got %q", "Humberto B.", response.MaskedName)
+			}
+		})
+	}
+}
+
+func TestConfirmPayeeIsRateLimited(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	for i := 0; i < handlers.ConfirmPayeeBurst; i++ {
+		if res, _ := confirmPayee(t, server, 106, 999999999, "Humberto Bernhard"); res.StatusCode != http.StatusNotFound {
+			t.Fatalf("Expected lookup %d to be allowed, got status code %d", i+1, res.StatusCode)
+		}
+	}
+
+	res, _ := confirmPayee(t, server, 106, 694332936, "Humberto Bernhard")
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d, got %d", http.StatusTooManyRequests, res.StatusCode)
+	}
+	if res.Header.Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+
+	// The limit also applies to the client address, whichever user is named
+	if res, _ := confirmPayee(t, server, 110, 694332936, "Humberto Bernhard"); res.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d for another user from the same address, got %d", http.StatusTooManyRequests, res.StatusCode)
+	}
+}
+
+func TestConfirmPayeeLimitsForwardedAddresses(t *testing.T) {
+	_, store := newTestServer(t)
+	handler := handlers.New(store)
+	handler.SetBehindProxy(true)
+	server := httptest.NewServer(handlers.NewRouter(handler))
+	t.Cleanup(server.Close)
+
+	// lookup confirms an account for userID from the address the proxy saw
+	lookup := func(userID int, address string) int {
+		data, _ := json.Marshal(map[string]any{"user_id": userID, "account_number": 694332936, "name": "Humberto Bernhard"})
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/payees/confirm", bytes.NewBuffer(data))
+		req.Header.Set("X-Forwarded-For", address)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	for i := 0; i < handlers.ConfirmPayeeBurst; i++ {
+		if status := lookup(106, "203.0.113.7"); status != http.StatusOK {
+			t.Fatalf("Expected lookup %d to be allowed, got status code %d", i+1, status)
+		}
+	}
+
+	// Every caller reaches the server from the proxy, so only the forwarded
+	// address tells them apart
+	if status := lookup(110, "203.0.113.7"); status != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d from the same address, got %d", http.StatusTooManyRequests, status)
+	}
+	if status := lookup(110, "198.51.100.4"); status != http.StatusOK {
+		t.Errorf("Expected status code %d from another address, got %d", http.StatusOK, status)
+	}
+}
+
+func TestLimiterRefills(t *testing.T) {
+	now := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+	limiter := ratelimit.New(2, time.Minute)
+	limiter.Now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.Allow("user:1"); !ok {
+			t.Fatalf("Expected action %d to be allowed", i+1)
+		}
+	}
+	ok, retryAfter := limiter.Allow("user:1")
+	if ok || retryAfter != time.Minute {
+		t.Errorf("Expected to wait a minute, got %t %v", ok, retryAfter)
+	}
+	if ok, _ := limiter.Allow("user:2"); !ok {
+		t.Error("Expected another key to be allowed")
+	}
+
+	now = now.Add(30 * time.Second)
+	if ok, retryAfter := limiter.Allow("user:1"); ok || retryAfter != 30*time.Second {
+		t.Errorf("Expected to wait 30s, got %t %v", ok, retryAfter)
+	}
+	now = now.Add(30 * time.Second)
+	if ok, _ := limiter.Allow("user:1"); !ok {
+		t.Error("Expected an action to be allowed after a minute")
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"cse512/datamodels"
+	"cse512/handlers"
+	"cse512/repository"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type TestUser struct {
+	UserID   int    `json:"user_id"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// fixtureUsers are seeded into every test server together with the passwords
+// they log in with
+var fixtureUsers = []struct {
+	user     datamodels.User
+	password string
+	balance  datamodels.Money // Of the user's primary checking account
+}{
+	{
+		user: datamodels.User{
+			UserID:        106,
+			FirstName:     "Joe",
+			LastName:      "Wilderman",
+			Email:         "Joe.Wilderman@hotmail.com",
+			AccountNumber: 482913374,
+		},
+		password: "r3h5_o0Z8K5lsQI",
+		balance:  dollars(50000),
+	},
+	{
+		user: datamodels.User{
+			UserID:        110,
+			FirstName:     "Thomas",
+			LastName:      "Kuhn",
+			Email:         "Thomas19@yahoo.com",
+			AccountNumber: 310557821,
+		},
+		password: "qfKH89aXG9QFcOW",
+		balance:  dollars(1000),
+	},
+	{
+		user: datamodels.User{
+			UserID:        50664,
+			FirstName:     "Humberto",
+			LastName:      "Bernhard",
+			Email:         "Abelardo.Rodriguez-OConner59@gmail.com",
+			AccountNumber: 694332936,
+		},
+		password: "Hb50664_secret",
+		balance:  dollars(20000),
+	},
+}
+
+// fixtureAdmin is seeded into every test server to call the /admin endpoints.
+// Admins need no account of their own.
+var fixtureAdmin = struct {
+	user     datamodels.User
+	password string
+}{
+	user: datamodels.User{
+		UserID:    900,
+		FirstName: "Ada",
+		LastName:  "Operator",
+		Email:     "ada.operator@bank.example",
+		Role:      datamodels.RoleAdmin,
+	},
+	password: "Adm1n_secret",
+}
+
+// fixtureTransactions gives user 106 a history in August 2022 followed by the
+// two most recent entries checked by TestGetTransaction
+func fixtureTransactions() []datamodels.Transaction {
+	var transactions []datamodels.Transaction
+
+	start := time.Date(2022, time.August, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 12; i++ {
+		transactions = append(transactions, datamodels.Transaction{
+			TransactionID:   i + 1,
+			SenderID:        106,
+			SenderAccount:   482913374,
+			ReceiverID:      50664,
+			ReceiverAccount: 694332936,
+			Amount:          dollars(100 + i),
+			Remarks:         "Transfer of rent share",
+			DateTimeStamp:   start.AddDate(0, 0, i).Unix(),
+			Status:          "completed",
+		})
+	}
+
+	transactions = append(transactions,
+		datamodels.Transaction{
+			TransactionID:   13,
+			SenderID:        106,
+			SenderAccount:   482913374,
+			ReceiverID:      106,
+			ReceiverAccount: 482913374,
+			Amount:          dollars(-5969),
+			Remarks:         "Withdrawal of $5,969.00 by Joe Wilderman",
+			DateTimeStamp:   time.Date(2023, time.March, 2, 9, 0, 0, 0, time.UTC).Unix(),
+			Status:          "completed",
+		},
+		datamodels.Transaction{
+			TransactionID:   14,
+			SenderID:        106,
+			SenderAccount:   482913374,
+			ReceiverID:      106,
+			ReceiverAccount: 482913374,
+			Amount:          dollars(1452),
+			Remarks:         "Deposit of $1,452.00 by Joe Wilderman",
+			DateTimeStamp:   time.Date(2023, time.March, 9, 9, 0, 0, 0, time.UTC).Unix(),
+			Status:          "completed",
+		},
+	)
+
+	return transactions
+}
+
+// newTestServer starts the API on an in-memory store seeded with the fixtures
+func newTestServer(t *testing.T) (*httptest.Server, *repository.MemoryStore) {
+	t.Helper()
+
+	store := repository.NewMemoryStore()
+	ctx := context.Background()
+
+	for _, fixture := range fixtureUsers {
+		hash, err := bcrypt.GenerateFromPassword([]byte(fixture.password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatalf("Error hashing password: %v", err)
+		}
+		user := fixture.user
+		user.PassHash = string(hash)
+		if err := store.Users().Insert(ctx, user); err != nil {
+			t.Fatalf("Error seeding user %d: %v", user.UserID, err)
+		}
+		account := datamodels.Account{
+			AccountNumber: user.AccountNumber,
+			UserID:        user.UserID,
+			Type:          datamodels.AccountChecking,
+			Balance:       fixture.balance,
+		}
+		if err := store.Accounts().Insert(ctx, account); err != nil {
+			t.Fatalf("Error seeding account of user %d: %v", user.UserID, err)
+		}
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(fixtureAdmin.password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Error hashing password: %v", err)
+	}
+	admin := fixtureAdmin.user
+	admin.PassHash = string(hash)
+	if err := store.Users().Insert(ctx, admin); err != nil {
+		t.Fatalf("Error seeding admin: %v", err)
+	}
+
+	for _, transaction := range fixtureTransactions() {
+		if err := store.Transactions().Insert(ctx, transaction); err != nil {
+			t.Fatalf("Error seeding transaction %d: %v", transaction.TransactionID, err)
+		}
+	}
+
+	server := httptest.NewServer(handlers.NewRouter(handlers.New(store)))
+	t.Cleanup(server.Close)
+
+	return server, store
+}
+
+// loginToken logs the user in and returns the bearer token they are issued
+func loginToken(t *testing.T, server *httptest.Server, user datamodels.User, password string) string {
+	t.Helper()
+
+	data, _ := json.Marshal(map[string]string{
+		"user_id":  strconv.Itoa(user.UserID),
+		"email":    user.Email,
+		"password": password,
+	})
+	res, err := http.Post(server.URL+"/login", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if res.StatusCode != http.StatusOK || response.Data.Token == "" {
+		t.Fatalf("Expected user %d to log in, got status code %d", user.UserID, res.StatusCode)
+	}
+	return response.Data.Token
+}
+
+// adminRequest makes a request as fixtureAdmin, with payload as its JSON body
+// unless it is nil
+func adminRequest(t *testing.T, server *httptest.Server, method, path string, payload any) *http.Response {
+	t.Helper()
+
+	return authorizedRequest(t, server, loginToken(t, server, fixtureAdmin.user, fixtureAdmin.password), method, path, payload)
+}
+
+// authorizedRequest makes a request with token, and payload as its JSON body
+// unless it is nil
+func authorizedRequest(t *testing.T, server *httptest.Server, token, method, path string, payload any) *http.Response {
+	t.Helper()
+
+	var body io.Reader
+	if payload != nil {
+		data, _ := json.Marshal(payload)
+		body = bytes.NewBuffer(data)
+	}
+	req, _ := http.NewRequest(method, server.URL+path, body)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	return res
+}
+
+// dollars returns a whole number of US dollars
+func dollars(amount int) datamodels.Money {
+	return datamodels.NewMoney(int64(amount)*100, "USD")
+}
+
+// balanceOf returns the stored balance of a user's primary account
+func balanceOf(t *testing.T, store *repository.MemoryStore, userID int) datamodels.Money {
+	t.Helper()
+
+	ctx := context.Background()
+	user, err := store.Users().FindByID(ctx, userID)
+	if err != nil {
+		t.Fatalf("Error fetching user %d: %v", userID, err)
+	}
+	return accountBalance(t, store, user.AccountNumber)
+}
+
+// accountBalance returns the stored balance of an account
+func accountBalance(t *testing.T, store *repository.MemoryStore, accountNumber int64) datamodels.Money {
+	t.Helper()
+
+	account, err := store.Accounts().FindByNumber(context.Background(), accountNumber)
+	if err != nil {
+		t.Fatalf("Error fetching account %d: %v", accountNumber, err)
+	}
+	return account.Balance
+}
+
+// effectOf returns the change a transaction makes to the balances of a user
+func effectOf(t *testing.T, transaction datamodels.Transaction, userID int) datamodels.Money {
+	t.Helper()
+
+	effect, err := transaction.EffectOn(userID)
+	if err != nil {
+		t.Fatalf("Error reading the effect on %d: %v", userID, err)
+	}
+	return effect
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/fx"
+	"cse512/handlers"
+	"cse512/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// eurUser holds a euro account, added to the fixtures by tests of transfers
+// between currencies
+var eurUser = datamodels.User{
+	UserID:        7001,
+	FirstName:     "Anke",
+	LastName:      "Vogel",
+	Email:         "anke.vogel@example.de",
+	AccountNumber: 270011234,
+}
+
+// eurBalance is the opening balance of eurUser's account
+var eurBalance = datamodels.NewMoney(50000, "EUR")
+
+// testRates quotes a few currencies against USD
+func testRates(t *testing.T) *fx.StaticProvider {
+	return mustProvider(t, "USD", map[string]string{"EUR": "0.92", "GBP": "0.79", "JPY": "151.20"})
+}
+
+func TestStaticProviderRates(t *testing.T) {
+	provider := testRates(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		from, to string
+		amount   datamodels.Money
+		rate     string
+		expected datamodels.Money
+	}{
+		{"USD", "EUR", dollars(100), "0.92", datamodels.NewMoney(9200, "EUR")},
+		{"EUR", "USD", datamodels.NewMoney(9200, "EUR"), "1.0869565217", dollars(100)},
+		{"USD", "JPY", datamodels.NewMoney(1, "USD"), "151.2", datamodels.NewMoney(2, "JPY")},
+		{"JPY", "USD", datamodels.NewMoney(1000, "JPY"), "0.0066137566", datamodels.NewMoney(661, "USD")},
+		// Crossed through USD: 0.79 / 0.92
+		{"EUR", "GBP", datamodels.NewMoney(10000, "EUR"), "0.8586956522", datamodels.NewMoney(8587, "GBP")},
+		{"USD", "USD", dollars(5), "1", dollars(5)},
+	}
+
+	for _, test := range tests {
+		rate, err := provider.Rate(ctx, test.from, test.to)
+		if err != nil {
+			t.Errorf("Rate(%s, %s): %v", test.from, test.to, err)
+			continue
+		}
+		if rate.String() != test.rate {
+			t.Errorf("Rate(%s, %s) = %s, expected %s", test.from, test.to, rate, test.rate)
+		}
+		converted, err := rate.Convert(test.amount)
+		if err != nil || converted != test.expected {
+			t.Errorf("Converting %s to %s gave %s, %v, expected %s", test.amount, test.to, converted, err, test.expected)
+		}
+	}
+
+	if _, err := provider.Rate(ctx, "USD", "CHF"); !errors.Is(err, fx.ErrNoRate) {
+		t.Errorf("Expected ErrNoRate, got %v", err)
+	}
+
+	rate, _ := provider.Rate(ctx, "USD", "EUR")
+	if _, err := rate.Convert(datamodels.NewMoney(100, "GBP")); !errors.Is(err, datamodels.ErrCurrencyMismatch) {
+		t.Errorf("Expected ErrCurrencyMismatch, got %v", err)
+	}
+}
+
+func TestFee(t *testing.T) {
+	tests := []struct {
+		amount   datamodels.Money
+		points   int64
+		expected datamodels.Money
+	}{
+		{dollars(100), 50, datamodels.NewMoney(50, "USD")},
+		{datamodels.NewMoney(101, "USD"), 50, datamodels.NewMoney(1, "USD")},
+		{datamodels.NewMoney(99, "USD"), 50, datamodels.NewMoney(0, "USD")},
+		{dollars(100), 0, datamodels.NewMoney(0, "USD")},
+	}
+
+	for _, test := range tests {
+		if fee, err := fx.Fee(test.amount, test.points); err != nil || fee != test.expected {
+			t.Errorf("Fee(%s, %d) = %s, %v, expected %s", test.amount, test.points, fee, err, test.expected)
+		}
+	}
+}
+
+func TestLoadStaticProvider(t *testing.T) {
+	provider, err := fx.LoadStaticProvider("../rates.json")
+	if err != nil {
+		t.Fatalf("Error loading rates: %v", err)
+	}
+	if rate, err := provider.Rate(context.Background(), "USD", "EUR"); err != nil || rate.String() != "0.92" {
+		t.Errorf("Expected USD to EUR at 0.92, got %v, %v", rate, err)
+	}
+
+	if _, err := fx.NewStaticProvider("USD", map[string]string{"EUR": "-1"}); err == nil {
+		t.Error("Expected a negative rate to be rejected")
+	}
+	if _, err := fx.NewStaticProvider("USD", map[string]string{"XYZ": "2"}); err == nil {
+		t.Error("Expected an unknown currency to be rejected")
+	}
+}
+
+func TestConversionPostingsBalance(t *testing.T) {
+	postings := datamodels.ConversionPostings(datamodels.Account{AccountNumber: 482913374, UserID: 106}, datamodels.Account{AccountNumber: 270011234, UserID: 7001}, dollars(100), datamodels.NewMoney(50, "USD"), datamodels.NewMoney(9154, "EUR"))
+	if err := (datamodels.Transaction{Postings: postings}).CheckBalanced(); err != nil {
+		t.Errorf("Expected conversion postings to balance: %v", err)
+	}
+
+	// Each currency has to balance on its own
+	unbalanced := datamodels.Transaction{Postings: []datamodels.Posting{
+		{Account: datamodels.UserAccount(106), UserID: 106, Amount: dollars(-100)},
+		{Account: datamodels.UserAccount(7001), UserID: 7001, Amount: datamodels.NewMoney(10000, "EUR")},
+	}}
+	if err := unbalanced.CheckBalanced(); !errors.Is(err, datamodels.ErrUnbalanced) {
+		t.Errorf("Expected ErrUnbalanced, got %v", err)
+	}
+}
+
+// newFXTestServer starts the API with testRates and eurUser added to the fixtures
+func newFXTestServer(t *testing.T, rates fx.Provider) (*httptest.Server, *repository.MemoryStore) {
+	t.Helper()
+
+	_, store := newTestServer(t)
+	if err := store.Users().Insert(context.Background(), eurUser); err != nil {
+		t.Fatalf("Error seeding user %d: %v", eurUser.UserID, err)
+	}
+	account := datamodels.Account{
+		AccountNumber: eurUser.AccountNumber,
+		UserID:        eurUser.UserID,
+		Type:          datamodels.AccountChecking,
+		Balance:       eurBalance,
+	}
+	if err := store.Accounts().Insert(context.Background(), account); err != nil {
+		t.Fatalf("Error seeding account of user %d: %v", eurUser.UserID, err)
+	}
+
+	handler := handlers.New(store)
+	if rates != nil {
+		handler.SetRates(rates)
+	}
+	server := httptest.NewServer(handlers.NewRouter(handler))
+	t.Cleanup(server.Close)
+
+	return server, store
+}
+
+func TestTransferBetweenCurrencies(t *testing.T) {
+	server, store := newFXTestServer(t, testRates(t))
+
+	res, err := http.Post(server.URL+"/transaction", "application/json", strings.NewReader(`{"sender_id":106,"receiver_id":7001,"account_number":270011234,"amount":100}`))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+
+	// The 0.50 fee is taken before converting 99.50 at 0.92
+	if got := balanceOf(t, store, 106); got != dollars(49900) {
+		t.Errorf("Expected sender balance 49900.00 USD, got %s", got)
+	}
+	if got := balanceOf(t, store, 7001); got != datamodels.NewMoney(59154, "EUR") {
+		t.Errorf("Expected receiver balance 591.54 EUR, got %s", got)
+	}
+
+	// The receiver's statement shows the credit in euros and both amounts
+	res, err = http.Get(server.URL + "/transactions?sender_id=7001")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var transactions []handlers.TransactionResponse
+	if err := json.NewDecoder(res.Body).Decode(&transactions); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if len(transactions) != 1 {
+		t.Fatalf("Expected 1 transaction, got %d", len(transactions))
+	}
+	received := transactions[0]
+	if received.Amount.Minor != 9154 || received.Currency != "EUR" {
+		t.Errorf("Expected a credit of 91.54 EUR, got %s %s", received.Amount.Decimal(), received.Currency)
+	}
+	details := received.FX
+	if details == nil {
+		t.Fatal("Expected conversion details")
+	}
+	if details.OriginalAmount.Minor != 10000 || details.OriginalCurrency != "USD" ||
+		details.ConvertedAmount.Minor != 9154 || details.ConvertedCurrency != "EUR" ||
+		details.Rate != "0.92" || details.Fee.Minor != 50 {
+		t.Errorf("Unexpected conversion details %+v", details)
+	}
+}
+
+func TestTransferBetweenOwnAccountsInTwoCurrencies(t *testing.T) {
+	server, store := newFXTestServer(t, testRates(t))
+
+	res, err := http.Post(server.URL+"/accounts", "application/json", strings.NewReader(`{"user_id":106,"type":"savings","currency":"JPY"}`))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var opened struct {
+		Data handlers.AccountResponse `json:"data"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&opened)
+	res.Body.Close()
+	if err != nil || res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %v", http.StatusCreated, res.StatusCode, err)
+	}
+	yen := opened.Data.AccountNumber
+
+	body := fmt.Sprintf(`{"sender_id":106,"receiver_id":106,"from_account":482913374,"account_number":%d,"amount":100}`, yen)
+	res, err = http.Post(server.URL+"/transaction", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+
+	// The 0.50 fee is taken before converting 99.50 at 151.20
+	if got := accountBalance(t, store, yen); got != datamodels.NewMoney(15044, "JPY") {
+		t.Errorf("Expected savings balance 15044 JPY, got %s", got)
+	}
+
+	// Across all of the user's accounts the change is shown in the currency
+	// sent, not a sum of dollars and yen
+	transactions := recentTransactions(t, server, 106)
+	if len(transactions) == 0 {
+		t.Fatal("Expected the transfer to be listed")
+	}
+	if sent := transactions[0]; sent.Amount != dollars(-100) || sent.Currency != "USD" {
+		t.Errorf("Expected a debit of 100.00 USD, got %s %s", sent.Amount.Decimal(), sent.Currency)
+	}
+
+	// Each account shows its own side. Amounts are decoded as numbers, since
+	// the response does not say that they are yen.
+	res, err = http.Get(fmt.Sprintf("%s/transactions?sender_id=106&account_number=%d", server.URL, yen))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+	var received []struct {
+		Amount   json.Number `json:"amount"`
+		Currency string      `json:"currency"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&received); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if len(received) != 1 || received[0].Amount != "15044" || received[0].Currency != "JPY" {
+		t.Errorf("Expected a credit of 15044 JPY, got %+v", received)
+	}
+}
+
+func TestRejectedTransfersBetweenCurrencies(t *testing.T) {
+	tests := []struct {
+		name    string
+		rates   fx.Provider
+		body    string
+		message string
+	}{
+		{"no provider", nil, `{"sender_id":106,"receiver_id":7001,"account_number":270011234,"amount":100}`, "Transfers from USD to EUR accounts are not available."},
+		{"no rate", mustProvider(t, "USD", map[string]string{"GBP": "0.79"}), `{"sender_id":106,"receiver_id":7001,"account_number":270011234,"amount":100}`, "No exchange rate from USD to EUR."},
+		{"nothing left to convert", mustProvider(t, "USD", map[string]string{"EUR": "0.001"}), `{"sender_id":106,"receiver_id":7001,"account_number":270011234,"amount":0.01}`, "Amount is too small to convert."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, store := newFXTestServer(t, tt.rates)
+
+			res, err := http.Post(server.URL+"/transaction", "application/json", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer res.Body.Close()
+
+			var response handlers.Transaction
+			if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			if res.StatusCode != http.StatusBadRequest || response.Code != handlers.CodeRejected {
+				t.Errorf("Expected status %d and code %q, got %d and %q", http.StatusBadRequest, handlers.CodeRejected, res.StatusCode, response.Code)
+			}
+			if response.Message != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, response.Message)
+			}
+
+			if got := balanceOf(t, store, 106); got != dollars(50000) {
+				t.Errorf("Expected sender balance to be unchanged, got %s", got)
+			}
+			if got := balanceOf(t, store, 7001); got != eurBalance {
+				t.Errorf("Expected receiver balance to be unchanged, got %s", got)
+			}
+		})
+	}
+}
+
+func mustProvider(t *testing.T, base string, rates map[string]string) *fx.StaticProvider {
+	t.Helper()
+
+	provider, err := fx.NewStaticProvider(base, rates)
+	if err != nil {
+		t.Fatalf("Error creating provider: %v", err)
+	}
+	return provider
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"cse512/datamodels"
+	"cse512/generator"
+	"cse512/repository"
+	"cse512/seed"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func generatorOptions() generator.Options {
+	return generator.Options{
+		Seed:         42,
+		Users:        40,
+		Transactions: 2000,
+		FirstUserID:  100,
+		Start:        time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC),
+		End:          time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Distribution: generator.Zipf,
+		ZipfS:        1.2,
+		BcryptCost:   bcrypt.MinCost,
+	}
+}
+
+func TestGeneratorIsDeterministic(t *testing.T) {
+	first, err := generator.Generate(generatorOptions())
+	if err != nil {
+		t.Fatalf("Error generating data: %v", err)
+	}
+	second, err := generator.Generate(generatorOptions())
+	if err != nil {
+		t.Fatalf("Error generating data: %v", err)
+	}
+
+	for i := range first.Transactions {
+		if !reflect.DeepEqual(first.Transactions[i], second.Transactions[i]) {
+			t.Fatalf("Transaction %d differs between runs: %+v != %+v", i, first.Transactions[i], second.Transactions[i])
+		}
+	}
+
+	for i := range first.Users {
+		a, b := first.Users[i], second.Users[i]
+		// Hashes are salted randomly, everything else must match
+		a.PassHash, b.PassHash = "", ""
+		if a != b {
+			t.Fatalf("User %d differs between runs: %+v != %+v", i, a, b)
+		}
+		if first.Credentials[i] != second.Credentials[i] {
+			t.Fatalf("Credential %d differs between runs", i)
+		}
+	}
+
+	options := generatorOptions()
+	options.Seed = 43
+	other, _ := generator.Generate(options)
+	if other.Credentials[0] == first.Credentials[0] {
+		t.Error("Expected a different seed to produce different data")
+	}
+}
+
+func TestGeneratorBalancesMatchLedger(t *testing.T) {
+	dataset, err := generator.Generate(generatorOptions())
+	if err != nil {
+		t.Fatalf("Error generating data: %v", err)
+	}
+
+	ledger := make(map[int64]datamodels.Money)
+	last := int64(0)
+	for _, transaction := range dataset.Transactions {
+		if transaction.DateTimeStamp < last {
+			t.Fatalf("Transaction %d is out of chronological order", transaction.TransactionID)
+		}
+		last = transaction.DateTimeStamp
+
+		if err := transaction.CheckBalanced(); err != nil {
+			t.Fatalf("Transaction %d: %v", transaction.TransactionID, err)
+		}
+		if !transaction.IsPosted() {
+			continue
+		}
+		for _, posting := range transaction.Postings {
+			if posting.UserID == 0 {
+				continue
+			}
+			if ledger[posting.AccountNumber], err = ledger[posting.AccountNumber].Add(posting.Amount); err != nil {
+				t.Fatalf("Transaction %d: %v", transaction.TransactionID, err)
+			}
+		}
+	}
+
+	for i, user := range dataset.Users {
+		account := dataset.Accounts[i]
+		if account.UserID != user.UserID || account.AccountNumber != user.AccountNumber {
+			t.Errorf("User %d has account %+v", user.UserID, account)
+		}
+		if account.Balance != ledger[account.AccountNumber] {
+			t.Errorf("Account %d has balance %s but ledger sums to %s", account.AccountNumber, account.Balance, ledger[account.AccountNumber])
+		}
+		if account.Balance.Sign() < 0 {
+			t.Errorf("Account %d is overdrawn", account.AccountNumber)
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.PassHash), []byte(dataset.Credentials[i].Password)) != nil {
+			t.Errorf("User %d password hash does not match the credential", user.UserID)
+		}
+	}
+}
+
+func TestGeneratorOutputLoadsWithSeed(t *testing.T) {
+	dataset, err := generator.Generate(generatorOptions())
+	if err != nil {
+		t.Fatalf("Error generating data: %v", err)
+	}
+
+	for _, format := range []string{generator.JSON, generator.NDJSON} {
+		var users, accounts, transactions bytes.Buffer
+		if err := generator.Write(&users, dataset.Users, format); err != nil {
+			t.Fatalf("Error writing users: %v", err)
+		}
+		if err := generator.Write(&accounts, dataset.Accounts, format); err != nil {
+			t.Fatalf("Error writing accounts: %v", err)
+		}
+		if err := generator.Write(&transactions, dataset.Transactions, format); err != nil {
+			t.Fatalf("Error writing transactions: %v", err)
+		}
+
+		store := repository.NewMemoryStore()
+		userStats, err := seed.LoadUsers(context.Background(), &users, store.Users(), store.Accounts(), seed.Options{})
+		if err != nil || userStats.Inserted != int64(len(dataset.Users)) {
+			t.Errorf("%s: loaded %d users, err %v", format, userStats.Inserted, err)
+		}
+		accountStats, err := seed.LoadAccounts(context.Background(), &accounts, store.Accounts(), seed.Options{})
+		if err != nil || accountStats.Inserted != int64(len(dataset.Accounts)) {
+			t.Errorf("%s: loaded %d accounts, err %v", format, accountStats.Inserted, err)
+		}
+		transactionStats, err := seed.LoadTransactions(context.Background(), &transactions, store.Transactions(), seed.Options{})
+		if err != nil || transactionStats.Inserted != int64(len(dataset.Transactions)) {
+			t.Errorf("%s: loaded %d transactions, err %v", format, transactionStats.Inserted, err)
+		}
+	}
+}
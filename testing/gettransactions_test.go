@@ -9,6 +9,7 @@ import (
 )
 
 func TestGetTransaction(t *testing.T) {
+	server, _ := newTestServer(t)
 
 	users := []int{106}
 
@@ -28,9 +29,9 @@ func TestGetTransaction(t *testing.T) {
 
 	for _, user := range users {
 
-		res, err := http.Get(fmt.Sprintf("http://localhost:8080/transactions?sender_id=%d", user))
+		res, err := http.Get(fmt.Sprintf("%s/transactions?sender_id=%d", server.URL, user))
 		if err != nil {
-			t.Errorf("Request failed: %v", err)
+			t.Fatalf("Request failed: %v", err)
 		}
 
 		defer res.Body.Close()
@@ -47,8 +48,8 @@ func TestGetTransaction(t *testing.T) {
 				break
 			}
 
-			if response.Amount != results[idx].amount {
-				t.Errorf("Expected amount %d, got %d", results[idx].amount, response.Amount)
+			if response.Amount != dollars(results[idx].amount) {
+				t.Errorf("Expected amount %d, got %s", results[idx].amount, response.Amount)
 			}
 
 			if response.Status != results[idx].status {
@@ -59,3 +60,47 @@ func TestGetTransaction(t *testing.T) {
 
 	}
 }
+
+func TestGetTransactionPagination(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	res, err := http.Get(server.URL + "/transactions?sender_id=106")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var transactions []handlers.TransactionResponse
+	if err := json.NewDecoder(res.Body).Decode(&transactions); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	// 14 fixtures exist for user 106; only the newest 10 are returned
+	if len(transactions) != 10 {
+		t.Fatalf("Expected 10 transactions, got %d", len(transactions))
+	}
+
+	for idx := 1; idx < len(transactions); idx++ {
+		if transactions[idx].TimeStamp > transactions[idx-1].TimeStamp {
+			t.Errorf("Transactions not sorted newest first at index %d", idx)
+		}
+	}
+}
+
+func TestGetTransactionInvalidSender(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	queries := []string{"", "?sender_id=", "?sender_id=abc"}
+
+	for _, query := range queries {
+		res, err := http.Get(server.URL + "/transactions" + query)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Query %q: expected status code %d, got %d", query, http.StatusBadRequest, res.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"cse512/audit"
+	"cse512/datamodels"
+	"cse512/repository"
+	"errors"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSearchUsers(t *testing.T) {
+	store := repository.NewMongoStore(newDatabase(t))
+	ctx := context.Background()
+
+	tests := []struct {
+		query string
+		users []int
+	}{
+		{"humberto BERNHARD", []int{101}},
+		{"gmail.com", []int{100, 101}},
+		{"100000102", []int{102}},
+		{"100", []int{100}},
+		{"a.b", nil}, // Not a pattern
+	}
+	for _, test := range tests {
+		users, err := store.Users().Search(ctx, test.query, 10)
+		if err != nil {
+			t.Fatalf("Error searching %q: %v", test.query, err)
+		}
+		var ids []int
+		for _, user := range users {
+			ids = append(ids, user.UserID)
+		}
+		if len(ids) != len(test.users) || (len(ids) > 0 && ids[0] != test.users[0]) {
+			t.Errorf("Expected %q to find users %v, got %v", test.query, test.users, ids)
+		}
+	}
+
+	if err := store.Users().SetRole(ctx, 999, datamodels.RoleAdmin); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound setting the role of an unknown user, got %v", err)
+	}
+}
+
+func TestAuditEventsRollBackWithTheirAction(t *testing.T) {
+	store := repository.NewMongoStore(newDatabase(t))
+	ctx := context.Background()
+
+	failed := errors.New("action failed")
+	err := store.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := store.Audit().Append(ctx, datamodels.AuditEvent{At: 10, ActorID: 1, Action: datamodels.AuditFreeze}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Expected the unit of work to fail, got %v", err)
+	}
+	if err := store.Audit().Append(ctx, datamodels.AuditEvent{At: 20, ActorID: 1, Action: datamodels.AuditUnfreeze}); err != nil {
+		t.Fatalf("Error recording event: %v", err)
+	}
+	if chained, err := audit.Flush(ctx, store.Audit(), audit.Options{}); err != nil || chained != 1 {
+		t.Fatalf("Expected 1 event to be chained, got %d and %v", chained, err)
+	}
+
+	events, err := store.Audit().Find(ctx, repository.AuditQuery{From: 0, To: 100})
+	if err != nil {
+		t.Fatalf("Error fetching events: %v", err)
+	}
+	if len(events) != 1 || events[0].Action != datamodels.AuditUnfreeze || events[0].Seq != 1 {
+		t.Errorf("Expected only the committed event, got %+v", events)
+	}
+}
+
+func TestAuditChainHoldsUnderConcurrentChainers(t *testing.T) {
+	database := newDatabase(t)
+	store := repository.NewMongoStore(database)
+	ctx := context.Background()
+
+	const appends = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, appends)
+	for userID := 1; userID <= appends; userID++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- audit.Record(ctx, store.Audit(), datamodels.AuditEvent{ActorID: 1, Action: datamodels.AuditFreeze, UserID: userID})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Error recording event: %v", err)
+		}
+	}
+
+	// Instances chaining at once take turns on the head, a few events each
+	flushed := make(chan int, 3)
+	for range cap(flushed) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			chained, err := audit.Flush(ctx, store.Audit(), audit.Options{Batch: 3})
+			if err != nil {
+				t.Errorf("Error chaining events: %v", err)
+			}
+			flushed <- chained
+		}()
+	}
+	wg.Wait()
+	close(flushed)
+	total := 0
+	for chained := range flushed {
+		total += chained
+	}
+	if total != appends {
+		t.Errorf("Expected %d events to be chained, got %d", appends, total)
+	}
+
+	verified, err := audit.Verify(ctx, store.Audit())
+	if err != nil || verified != appends {
+		t.Fatalf("Expected %d events to verify, got %d and %v", appends, verified, err)
+	}
+
+	// Editing an event in the database breaks the chain
+	_, err = database.Collection("audit_events").UpdateOne(ctx, bson.M{"seq": 4}, bson.M{"$set": bson.M{"user_id": 42}})
+	if err != nil {
+		t.Fatalf("Error editing event: %v", err)
+	}
+	if _, err := audit.Verify(ctx, store.Audit()); !errors.Is(err, audit.ErrTampered) {
+		t.Errorf("Expected ErrTampered after an edit, got %v", err)
+	}
+}
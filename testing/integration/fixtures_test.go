@@ -0,0 +1,99 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/db"
+	"cse512/handlers"
+	"cse512/repository"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fixtureUsers are loaded into every test database. All of them log in with fixturePassword.
+var fixtureUsers = []datamodels.User{
+	{UserID: 100, FirstName: "Patrick", LastName: "Hackett", Email: "Patrick_Hackett31@gmail.com", AccountNumber: 100000100},
+	{UserID: 101, FirstName: "Humberto", LastName: "Bernhard", Email: "Humberto.Bernhard@gmail.com", AccountNumber: 100000101},
+	{UserID: 102, FirstName: "Joe", LastName: "Wilderman", Email: "Joe.Wilderman@hotmail.com", AccountNumber: 100000102},
+}
+
+// fixtureBalances are the balances of the fixture users' primary accounts
+var fixtureBalances = map[int]datamodels.Money{100: dollars(1000), 101: dollars(500), 102: dollars(0)}
+
+const fixturePassword = "WHeI1fEFjuDoi3o"
+
+// newDatabase creates an empty, migrated bank database with fixtures,
+// dropped when the test ends
+func newDatabase(t *testing.T) *mongo.Database {
+	t.Helper()
+	ctx := context.Background()
+
+	database := client.Database(fmt.Sprintf("bank_test_%d", time.Now().UnixNano()))
+	t.Cleanup(func() { database.Drop(context.Background()) })
+
+	// Collections must exist before they can be written in a transaction
+	if _, err := db.Migrate(ctx, database); err != nil {
+		t.Fatalf("Error migrating database: %v", err)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(fixturePassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Error hashing password: %v", err)
+	}
+
+	store := repository.NewMongoStore(database)
+	for _, user := range fixtureUsers {
+		user.PassHash = string(hash)
+		if err := store.Users().Insert(ctx, user); err != nil {
+			t.Fatalf("Error loading user %d: %v", user.UserID, err)
+		}
+		account := datamodels.Account{
+			AccountNumber: user.AccountNumber,
+			UserID:        user.UserID,
+			Type:          datamodels.AccountChecking,
+			Balance:       fixtureBalances[user.UserID],
+		}
+		if err := store.Accounts().Insert(ctx, account); err != nil {
+			t.Fatalf("Error loading account of user %d: %v", user.UserID, err)
+		}
+	}
+
+	return database
+}
+
+// newServer starts the API on top of database
+func newServer(t *testing.T, database *mongo.Database) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(handlers.NewRouter(handlers.New(repository.NewMongoStore(database))))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// dollars returns a whole number of US dollars
+func dollars(amount int) datamodels.Money {
+	return datamodels.NewMoney(int64(amount)*100, "USD")
+}
+
+// balanceOf returns the stored balance of a user's primary account
+func balanceOf(t *testing.T, database *mongo.Database, userID int) datamodels.Money {
+	t.Helper()
+
+	store := repository.NewMongoStore(database)
+	user, err := store.Users().FindByID(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("Error fetching user %d: %v", userID, err)
+	}
+	account, err := store.Accounts().FindByNumber(context.Background(), user.AccountNumber)
+	if err != nil {
+		t.Fatalf("Error fetching account %d: %v", user.AccountNumber, err)
+	}
+	return account.Balance
+}
@@ -0,0 +1,170 @@
+//go:build integration
+
+// Package integration runs the API against a real single-node MongoDB replica
+// set so that multi-document transactions are exercised.
+//
+// Set MONGODB_URI to use an existing replica set, otherwise a mongod found on
+// PATH (or at MONGOD_PATH) is started in a temporary directory. Run with:
+//
+//	go test -tags integration ./testing/integration/...
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const replicaSetName = "rs0"
+
+// client is connected to the replica set for the duration of the test run
+var client *mongo.Client
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	uri := os.Getenv("MONGODB_URI")
+
+	if uri == "" {
+		mongod := os.Getenv("MONGOD_PATH")
+		if mongod == "" {
+			path, err := exec.LookPath("mongod")
+			if err != nil {
+				fmt.Println("Skipping integration tests: set MONGODB_URI or put mongod on PATH")
+				return 0
+			}
+			mongod = path
+		}
+
+		stop, startedURI, err := startReplicaSet(mongod)
+		if err != nil {
+			fmt.Printf("Failed to start mongod: %v\n", err)
+			return 1
+		}
+		defer stop()
+		uri = startedURI
+	}
+
+	var err error
+	client, err = connect(uri)
+	if err != nil {
+		fmt.Printf("Failed to connect to %s: %v\n", uri, err)
+		return 1
+	}
+	defer client.Disconnect(context.Background())
+
+	return m.Run()
+}
+
+// startReplicaSet launches mongod on a free port with a temporary data
+// directory and initiates a single-node replica set on it
+func startReplicaSet(mongod string) (func(), string, error) {
+	dir, err := os.MkdirTemp("", "cse512-mongod-")
+	if err != nil {
+		return nil, "", err
+	}
+
+	port, err := freePort()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, "", err
+	}
+
+	cmd := exec.Command(mongod,
+		"--replSet", replicaSetName,
+		"--port", fmt.Sprint(port),
+		"--bind_ip", "127.0.0.1",
+		"--dbpath", dir,
+		"--logpath", filepath.Join(dir, "mongod.log"),
+	)
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, "", err
+	}
+
+	stop := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		os.RemoveAll(dir)
+	}
+
+	address := fmt.Sprintf("127.0.0.1:%d", port)
+	direct, err := connect(fmt.Sprintf("mongodb://%s/?directConnection=true", address))
+	if err != nil {
+		stop()
+		return nil, "", err
+	}
+	defer direct.Disconnect(context.Background())
+
+	config := bson.D{
+		{Key: "_id", Value: replicaSetName},
+		{Key: "members", Value: bson.A{bson.D{{Key: "_id", Value: 0}, {Key: "host", Value: address}}}},
+	}
+	err = direct.Database("admin").RunCommand(context.Background(), bson.D{{Key: "replSetInitiate", Value: config}}).Err()
+	if err != nil {
+		stop()
+		return nil, "", err
+	}
+
+	// Wait for the node to become primary
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		var hello struct {
+			IsWritablePrimary bool `bson:"isWritablePrimary"`
+		}
+		err := direct.Database("admin").RunCommand(context.Background(), bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+		if err == nil && hello.IsWritablePrimary {
+			break
+		}
+		if time.Now().After(deadline) {
+			stop()
+			return nil, "", fmt.Errorf("replica set did not elect a primary")
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	return stop, fmt.Sprintf("mongodb://%s/?replicaSet=%s", address, replicaSetName), nil
+}
+
+// connect opens a client and waits until the server answers a ping
+func connect(uri string) (*mongo.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	c, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if err = c.Ping(ctx, nil); err == nil {
+			return c, nil
+		}
+		select {
+		case <-ctx.Done():
+			c.Disconnect(context.Background())
+			return nil, err
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
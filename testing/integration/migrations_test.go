@@ -0,0 +1,189 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/db"
+	"cse512/repository"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	database := newDatabase(t)
+
+	ran, err := db.Migrate(context.Background(), database)
+	if err != nil {
+		t.Fatalf("Error migrating database: %v", err)
+	}
+	if len(ran) != 0 {
+		t.Errorf("Expected no pending migrations, %d were applied", len(ran))
+	}
+
+	_, records, err := db.MigrationStatus(context.Background(), database)
+	if err != nil {
+		t.Fatalf("Error reading migration status: %v", err)
+	}
+	for i, record := range records {
+		if record == nil {
+			t.Errorf("Migration at index %d is not recorded as applied", i)
+		}
+	}
+}
+
+func TestMigrateEnforcesUniqueAccountNumber(t *testing.T) {
+	database := newDatabase(t)
+
+	duplicate := fixtureUsers[0]
+	duplicate.UserID = 999
+	duplicate.Email = "someone.else@gmail.com"
+	duplicate.PassHash = "hash"
+
+	_, err := database.Collection("users").InsertOne(context.Background(), duplicate)
+	if !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("Expected a duplicate key error, got %v", err)
+	}
+}
+
+func TestMigrateValidatesTransactions(t *testing.T) {
+	database := newDatabase(t)
+
+	_, err := database.Collection("transactions").InsertOne(context.Background(), bson.M{"sender_id": "not a number"})
+	if err == nil {
+		t.Error("Expected the validator to reject an invalid transaction")
+	}
+}
+
+func TestBackfillMoneyConvertsLegacyDocuments(t *testing.T) {
+	database := newDatabase(t)
+	ctx := context.Background()
+
+	// Documents as written before balances and amounts were money
+	_, err := database.Collection("users").InsertOne(ctx, bson.M{
+		"user_id": 500, "email": "legacy@gmail.com", "password": "hash", "current_balance": 1452, "account_number": 100000500,
+	})
+	if err != nil {
+		t.Fatalf("Error inserting legacy user: %v", err)
+	}
+	_, err = database.Collection("transactions").InsertOne(ctx, bson.M{
+		"sender_id": 500, "receiver_id": 500, "amount": 12.5, "dateTimeStamp": 1, "status": "completed",
+	})
+	if err != nil {
+		t.Fatalf("Error inserting legacy transaction: %v", err)
+	}
+
+	for _, backfill := range []func(context.Context, *mongo.Database) error{db.BackfillPostings, db.BackfillTypes, db.BackfillMoney} {
+		if err := backfill(ctx, database); err != nil {
+			t.Fatalf("Error backfilling: %v", err)
+		}
+	}
+
+	var user bson.M
+	database.Collection("users").FindOne(ctx, bson.M{"user_id": 500}).Decode(&user)
+	if balance, _ := user["current_balance"].(bson.M); balance["minor_units"] != int64(145200) || balance["currency"] != "USD" {
+		t.Errorf("Unexpected balance %v", user["current_balance"])
+	}
+
+	var transaction datamodels.Transaction
+	database.Collection("transactions").FindOne(ctx, bson.M{"sender_id": 500}).Decode(&transaction)
+	if effect, err := transaction.EffectOn(500); err != nil || transaction.Amount != datamodels.NewMoney(1250, "USD") || effect != datamodels.NewMoney(1250, "USD") {
+		t.Errorf("Unexpected transaction %+v", transaction)
+	}
+}
+
+func TestBackfillAccountsMovesBalances(t *testing.T) {
+	database := newDatabase(t)
+	ctx := context.Background()
+
+	// A user and transfer as imported from the mock data files
+	_, err := database.Collection("users").InsertOne(ctx, bson.M{
+		"user_id": 500, "email": "legacy@gmail.com", "password": "hash", "current_balance": 1452, "account_number": 100000500,
+	})
+	if err != nil {
+		t.Fatalf("Error inserting legacy user: %v", err)
+	}
+	_, err = database.Collection("transactions").InsertOne(ctx, bson.M{
+		"sender_id": 500, "receiver_id": 100, "amount": 12.5, "dateTimeStamp": 1, "status": "completed",
+	})
+	if err != nil {
+		t.Fatalf("Error inserting legacy transaction: %v", err)
+	}
+
+	for _, backfill := range []func(context.Context, *mongo.Database) error{db.BackfillPostings, db.BackfillTypes, db.BackfillMoney, db.BackfillAccounts, db.BackfillAccounts} {
+		if err := backfill(ctx, database); err != nil {
+			t.Fatalf("Error backfilling: %v", err)
+		}
+	}
+
+	var user bson.M
+	database.Collection("users").FindOne(ctx, bson.M{"user_id": 500}).Decode(&user)
+	if _, ok := user["current_balance"]; ok {
+		t.Errorf("Expected current_balance to be removed, got %v", user)
+	}
+
+	var account datamodels.Account
+	if err := database.Collection("accounts").FindOne(ctx, bson.M{"account_number": 100000500}).Decode(&account); err != nil {
+		t.Fatalf("Error fetching account: %v", err)
+	}
+	if account.UserID != 500 || account.Type != datamodels.AccountChecking || account.Balance != datamodels.NewMoney(145200, "USD") {
+		t.Errorf("Unexpected account %+v", account)
+	}
+
+	var transaction datamodels.Transaction
+	database.Collection("transactions").FindOne(ctx, bson.M{"sender_id": 500}).Decode(&transaction)
+	if transaction.SenderAccount != 100000500 || transaction.ReceiverAccount != fixtureUsers[0].AccountNumber {
+		t.Errorf("Unexpected accounts on %+v", transaction)
+	}
+	sent, err := transaction.EffectOnAccount(100000500)
+	if err != nil {
+		t.Fatalf("Error reading postings: %v", err)
+	}
+	received, err := transaction.EffectOnAccount(fixtureUsers[0].AccountNumber)
+	if err != nil {
+		t.Fatalf("Error reading postings: %v", err)
+	}
+	if sent != datamodels.NewMoney(-1250, "USD") || received != datamodels.NewMoney(1250, "USD") {
+		t.Errorf("Unexpected postings %+v", transaction.Postings)
+	}
+}
+
+func TestMoveFailedAttemptsLeavesHolds(t *testing.T) {
+	database := newDatabase(t)
+	ctx := context.Background()
+
+	// A refused transfer as logged before attempts were kept apart, and a
+	// voided authorization whose hold was on the ledger
+	refused := datamodels.Transaction{
+		SenderID: 500, SenderAccount: 100000500, ReceiverID: fixtureUsers[0].UserID, ReceiverAccount: fixtureUsers[0].AccountNumber,
+		Amount: datamodels.NewMoney(1250, "USD"), DateTimeStamp: 1, Status: datamodels.StatusFailed, Type: datamodels.TypeTransfer,
+	}
+	voided := refused
+	voided.Hold = &datamodels.Hold{AccountNumber: 100000500, Amount: refused.Amount, Released: datamodels.HoldVoided}
+	for _, transaction := range []datamodels.Transaction{refused, voided} {
+		if _, err := database.Collection("transactions").InsertOne(ctx, transaction); err != nil {
+			t.Fatalf("Error inserting transaction: %v", err)
+		}
+	}
+
+	// Moving again finds nothing left to move
+	for i := 0; i < 2; i++ {
+		if err := db.MoveFailedAttempts(ctx, database); err != nil {
+			t.Fatalf("Error moving attempts: %v", err)
+		}
+	}
+
+	if count, _ := database.Collection("transactions").CountDocuments(ctx, bson.M{"sender_id": 500}); count != 1 {
+		t.Errorf("Expected only the voided authorization to stay, %d transactions left", count)
+	}
+	attempts, err := repository.NewMongoStore(database).Attempts().FindRecent(ctx, 500, 0, 10)
+	if err != nil || len(attempts) != 1 {
+		t.Fatalf("Expected one attempt, got %+v %v", attempts, err)
+	}
+	if attempt := attempts[0]; attempt.Code != datamodels.AttemptCodeUnknown || attempt.Amount != refused.Amount || attempt.ReceiverAccount != refused.ReceiverAccount {
+		t.Errorf("Unexpected attempt %+v", attempt)
+	}
+}
@@ -0,0 +1,238 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"cse512/datamodels"
+	"cse512/holds"
+	"cse512/ledger"
+	"cse512/limits"
+	"cse512/repository"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func postTransfer(t *testing.T, url string, senderID, receiverID int, accountNumber int64, amount int) int {
+	t.Helper()
+
+	data, _ := json.Marshal(map[string]any{
+		"sender_id":      senderID,
+		"receiver_id":    receiverID,
+		"account_number": accountNumber,
+		"amount":         amount,
+		"remarks":        "integration test",
+	})
+
+	res, err := http.Post(url+"/transaction", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Errorf("Request failed: %v", err)
+		return 0
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func TestTransferUpdatesBothBalances(t *testing.T) {
+	database := newDatabase(t)
+	server := newServer(t, database)
+
+	if status := postTransfer(t, server.URL, 100, 101, 100000101, 250); status != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	if got := balanceOf(t, database, 100); got != dollars(750) {
+		t.Errorf("Expected sender balance 750, got %s", got)
+	}
+	if got := balanceOf(t, database, 101); got != dollars(750) {
+		t.Errorf("Expected receiver balance 750, got %s", got)
+	}
+
+	count, err := database.Collection("transactions").CountDocuments(context.Background(), map[string]any{"status": "settled"})
+	if err != nil {
+		t.Fatalf("Error counting transactions: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 settled transaction, got %d", count)
+	}
+}
+
+func TestTransactionRollsBackOnFailure(t *testing.T) {
+	database := newDatabase(t)
+	store := repository.NewMongoStore(database)
+	failure := errors.New("receiver update failed")
+
+	// Debit the sender, then fail before the receiver is credited
+	err := store.WithTransaction(context.Background(), func(ctx context.Context) error {
+		if err := store.Accounts().Debit(ctx, 100000100, dollars(400)); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected %v, got %v", failure, err)
+	}
+
+	if got := balanceOf(t, database, 100); got != dollars(1000) {
+		t.Errorf("Expected sender balance to be rolled back to 1000, got %s", got)
+	}
+}
+
+func TestConcurrentTransfersNeverOverdraw(t *testing.T) {
+	database := newDatabase(t)
+	server := newServer(t, database)
+
+	// 20 transfers of 100 race for a balance of 1000
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(receiverID int, accountNumber int64) {
+			defer wg.Done()
+			if postTransfer(t, server.URL, 100, receiverID, accountNumber, 100) == http.StatusOK {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}(101+i%2, int64(100000101+i%2))
+	}
+	wg.Wait()
+
+	if succeeded != 10 {
+		t.Errorf("Expected exactly 10 transfers to succeed, got %d", succeeded)
+	}
+
+	sender := balanceOf(t, database, 100)
+	if !sender.IsZero() {
+		t.Errorf("Expected sender balance 0, got %s", sender)
+	}
+
+	// Money is neither created nor destroyed
+	total := sender
+	for _, userID := range []int{101, 102} {
+		total, _ = total.Add(balanceOf(t, database, userID))
+	}
+	if total != dollars(1500) {
+		t.Errorf("Expected total balance 1500, got %s", total)
+	}
+}
+
+func TestAuthorizationHoldsUntilCaptured(t *testing.T) {
+	database := newDatabase(t)
+	store := repository.NewMongoStore(database)
+	ctx := context.Background()
+
+	from, _ := store.Accounts().FindByNumber(ctx, 100000100)
+	to, _ := store.Accounts().FindByNumber(ctx, 100000101)
+	transfer := func(amount int) datamodels.Transaction {
+		return datamodels.Transaction{
+			SenderID:        100,
+			SenderAccount:   from.AccountNumber,
+			ReceiverID:      101,
+			ReceiverAccount: to.AccountNumber,
+			Amount:          dollars(amount),
+			Type:            datamodels.TypeTransfer,
+			Postings:        datamodels.TransferPostings(from, to, dollars(amount)),
+		}
+	}
+
+	authorization, err := ledger.Authorize(ctx, store, transfer(600), time.Now().Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatalf("Error authorizing transfer: %v", err)
+	}
+
+	// The hold leaves 400 available
+	if _, err := ledger.Authorize(ctx, store, transfer(500), time.Now().Add(time.Hour).Unix()); !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Errorf("Expected a second hold to fail with ErrInsufficientFunds, got %v", err)
+	}
+	if err := store.Accounts().Debit(ctx, from.AccountNumber, dollars(500)); !errors.Is(err, repository.ErrInsufficientFunds) {
+		t.Errorf("Expected a debit of held money to fail with ErrInsufficientFunds, got %v", err)
+	}
+	held, _ := store.Accounts().FindByNumber(ctx, from.AccountNumber)
+	if held.Balance != dollars(1000) || held.Available() != dollars(400) {
+		t.Errorf("Expected balance 1000 with 400 available, got %s with %s available", held.Balance, held.Available())
+	}
+
+	if _, err := ledger.Capture(ctx, store, authorization); err != nil {
+		t.Fatalf("Error capturing transfer: %v", err)
+	}
+	if _, err := ledger.Capture(ctx, store, authorization); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("Expected capturing twice to fail with ErrConflict, got %v", err)
+	}
+
+	settled, _ := store.Accounts().FindByNumber(ctx, from.AccountNumber)
+	if settled.Balance != dollars(400) || settled.Available() != dollars(400) {
+		t.Errorf("Expected balance and available balance 400, got %s and %s", settled.Balance, settled.Available())
+	}
+	if got := balanceOf(t, database, 101); got != dollars(1100) {
+		t.Errorf("Expected receiver balance 1100, got %s", got)
+	}
+	stored, err := store.Transactions().FindByID(ctx, authorization.TransactionID)
+	if err != nil || stored.Status != datamodels.StatusSettled || stored.Hold.Released != datamodels.HoldCaptured {
+		t.Errorf("Expected a settled transaction, got %+v: %v", stored, err)
+	}
+
+	// An uncaptured hold is released once it expires
+	if _, err := ledger.Authorize(ctx, store, transfer(300), 1); err != nil {
+		t.Fatalf("Error authorizing transfer: %v", err)
+	}
+	if expired, err := holds.ExpireDue(ctx, store, holds.Options{}); err != nil || expired != 1 {
+		t.Fatalf("Expected one hold to expire, got %d: %v", expired, err)
+	}
+	released, _ := store.Accounts().FindByNumber(ctx, from.AccountNumber)
+	if released.Available() != dollars(400) {
+		t.Errorf("Expected 400 available after the hold expired, got %s", released.Available())
+	}
+}
+
+func TestLimitsHoldAcrossAccounts(t *testing.T) {
+	database := newDatabase(t)
+	store := repository.NewMongoStore(database)
+	ctx := context.Background()
+
+	// A second account of the sender, so concurrent transfers debit different documents
+	second := datamodels.Account{AccountNumber: 100000200, UserID: 100, Type: datamodels.AccountSavings, Balance: dollars(1000)}
+	if err := store.Accounts().Insert(ctx, second); err != nil {
+		t.Fatalf("Error opening account: %v", err)
+	}
+	first, _ := store.Accounts().FindByNumber(ctx, 100000100)
+	to, _ := store.Accounts().FindByNumber(ctx, 100000101)
+
+	// 10 transfers of 100 race for a daily limit of 500
+	now := time.Now()
+	daily := datamodels.TransferLimits{Daily: 500}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		from := []datamodels.Account{first, second}[i%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			transfer := datamodels.Transaction{
+				SenderID:        100,
+				SenderAccount:   from.AccountNumber,
+				ReceiverID:      101,
+				ReceiverAccount: to.AccountNumber,
+				Amount:          dollars(100),
+				DateTimeStamp:   now.Unix(),
+				Status:          datamodels.StatusSettled,
+				Type:            datamodels.TypeTransfer,
+				Postings:        datamodels.TransferPostings(from, to, dollars(100)),
+			}
+			_, err := ledger.Post(ctx, store, transfer, limits.Enforce(store, daily, transfer, now))
+			if err != nil && !errors.Is(err, limits.ErrLimitExceeded) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := balanceOf(t, database, 101); got != dollars(1000) {
+		t.Errorf("Expected exactly 500 to be received, receiver balance is %s", got)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/handlers"
+	"cse512/ledger"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestPostingsBalance(t *testing.T) {
+	first := datamodels.Account{AccountNumber: 11, UserID: 1}
+	second := datamodels.Account{AccountNumber: 12, UserID: 2}
+	transactions := []datamodels.Transaction{
+		{SenderID: 1, ReceiverID: 2, Amount: dollars(50), Postings: datamodels.TransferPostings(first, second, dollars(50))},
+		{SenderID: 1, ReceiverID: 1, Amount: dollars(50), Postings: datamodels.CashPostings(first, dollars(50))},
+		{SenderID: 1, ReceiverID: 1, Amount: dollars(-50), Postings: datamodels.CashPostings(first, dollars(-50))},
+		{SenderID: 1, ReceiverID: 1, Amount: dollars(7), Postings: datamodels.AdjustmentPostings(first, dollars(7))},
+	}
+	for _, transaction := range transactions {
+		if err := transaction.CheckBalanced(); err != nil {
+			t.Errorf("Expected %+v to balance: %v", transaction.Postings, err)
+		}
+	}
+
+	unbalanced := datamodels.Transaction{Postings: []datamodels.Posting{
+		{Account: datamodels.UserAccount(1), UserID: 1, Amount: dollars(-50)},
+		{Account: datamodels.UserAccount(2), UserID: 2, Amount: dollars(60)},
+	}}
+	if err := unbalanced.CheckBalanced(); !errors.Is(err, datamodels.ErrUnbalanced) {
+		t.Errorf("Expected ErrUnbalanced, got %v", err)
+	}
+
+	single := datamodels.Transaction{Postings: datamodels.TransferPostings(first, second, dollars(50))[:1]}
+	if err := single.CheckBalanced(); err == nil {
+		t.Error("Expected a single posting to be rejected")
+	}
+}
+
+func TestLegacyTransactionsDerivePostings(t *testing.T) {
+	withdrawal := datamodels.Transaction{SenderID: 106, ReceiverID: 106, Amount: dollars(-5969)}
+	if effect := effectOf(t, withdrawal, 106); effect != dollars(-5969) {
+		t.Errorf("Expected withdrawal effect -5969, got %s", effect)
+	}
+
+	transfer := datamodels.Transaction{SenderID: 106, ReceiverID: 50664, Amount: dollars(20)}
+	if effectOf(t, transfer, 106) != dollars(-20) || effectOf(t, transfer, 50664) != dollars(20) || !effectOf(t, transfer, 7).IsZero() {
+		t.Errorf("Unexpected transfer effects %s, %s", effectOf(t, transfer, 106), effectOf(t, transfer, 50664))
+	}
+	if err := (datamodels.Transaction{Postings: transfer.LedgerPostings()}).CheckBalanced(); err != nil {
+		t.Errorf("Expected derived postings to balance: %v", err)
+	}
+}
+
+func TestPostRejectsUnbalancedTransaction(t *testing.T) {
+	_, store := newTestServer(t)
+
+	transaction := datamodels.Transaction{
+		SenderID:   106,
+		ReceiverID: 50664,
+		Amount:     dollars(20),
+		Status:     datamodels.StatusSuccess,
+		Postings: []datamodels.Posting{
+			{Account: datamodels.UserAccount(106), UserID: 106, Amount: dollars(-20)},
+			{Account: datamodels.UserAccount(50664), UserID: 50664, Amount: dollars(200)},
+		},
+	}
+
+	if _, err := ledger.Post(context.Background(), store, transaction); !errors.Is(err, datamodels.ErrUnbalanced) {
+		t.Fatalf("Expected ErrUnbalanced, got %v", err)
+	}
+	if got := balanceOf(t, store, 50664); got != dollars(20000) {
+		t.Errorf("Expected receiver balance to be unchanged, got %s", got)
+	}
+}
+
+func TestTakenTransactionIDRetriesTheUnitOfWork(t *testing.T) {
+	_, store := newTestServer(t)
+	ctx := context.Background()
+
+	account, err := store.Accounts().FindByNumber(ctx, 482913374)
+	if err != nil {
+		t.Fatalf("Error fetching account: %v", err)
+	}
+	adjustment := datamodels.Transaction{
+		SenderID:        106,
+		SenderAccount:   account.AccountNumber,
+		ReceiverID:      106,
+		ReceiverAccount: account.AccountNumber,
+		Amount:          dollars(5),
+		Status:          datamodels.StatusSettled,
+		Type:            datamodels.TypeAdjustment,
+		Postings:        datamodels.AdjustmentPostings(account, dollars(5)),
+	}
+
+	var tried []int
+	posted, err := ledger.WithTransactionID(adjustment, func(adjustment datamodels.Transaction) error {
+		tried = append(tried, adjustment.TransactionID)
+		if len(tried) == 1 {
+			// Another transaction takes the ID first
+			if err := store.Transactions().Insert(ctx, datamodels.Transaction{TransactionID: adjustment.TransactionID}); err != nil {
+				return err
+			}
+		}
+		return store.WithTransaction(ctx, func(ctx context.Context) error {
+			_, err := ledger.Post(ctx, store, adjustment)
+			return err
+		})
+	})
+	if err != nil || len(tried) != 2 || tried[0] == tried[1] || posted.TransactionID != tried[1] {
+		t.Fatalf("Expected the unit of work to be retried with another ID, tried %v and got %d: %v", tried, posted.TransactionID, err)
+	}
+	if got := balanceOf(t, store, 106); got != dollars(50005) {
+		t.Errorf("Expected the adjustment to be posted once, got balance %s", got)
+	}
+}
+
+func TestTransferAppearsOnBothSides(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	postTransaction(t, server, TransactionRequest{SenderID: 106, ReceiverID: 50664, AccountNumber: 694332936, Amount: 20})
+
+	expected := map[int]int{106: -20, 50664: 20}
+	for userID, amount := range expected {
+		res, err := http.Get(server.URL + "/transactions?sender_id=" + strconv.Itoa(userID))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer res.Body.Close()
+
+		var transactions []handlers.TransactionResponse
+		if err := json.NewDecoder(res.Body).Decode(&transactions); err != nil {
+			t.Fatalf("Error decoding response: %v", err)
+		}
+		if len(transactions) == 0 || transactions[0].Amount != dollars(amount) {
+			t.Errorf("Expected newest amount %d for user %d, got %+v", amount, userID, transactions)
+		}
+	}
+}
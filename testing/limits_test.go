@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/handlers"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// allowance returns what userID can still send in USD according to /limits
+func allowance(t *testing.T, server *httptest.Server, userID int) handlers.LimitsResponse {
+	t.Helper()
+
+	res, err := http.Get(server.URL + "/limits?user_id=" + strconv.Itoa(userID))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, res.StatusCode)
+	}
+
+	var response struct {
+		Data handlers.LimitsResponse `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if len(response.Data.Allowances) != 1 {
+		t.Fatalf("Expected one allowance, got %+v", response.Data)
+	}
+	return response.Data
+}
+
+func TestTransferLimits(t *testing.T) {
+	now := time.Date(2030, time.March, 15, 12, 0, 0, 0, time.UTC)
+	server, store, handler := newClockedServer(t, &now)
+	handler.SetTransferLimits(datamodels.TransferLimits{Single: 1000, Daily: 1500, Monthly: 2000})
+
+	transfer := TransactionRequest{SenderID: 106, ReceiverID: 50664, AccountNumber: 694332936}
+
+	transfer.Amount = 1200
+	if status, response := postTransaction(t, server, transfer); status != http.StatusForbidden || response.Code != handlers.CodeLimitExceeded || response.Message != "Transfers are limited to 1000.00 USD each." {
+		t.Errorf("Expected the single limit to be exceeded, got %d %+v", status, response)
+	}
+	transfer.Amount = 1000
+	if status, response := postTransaction(t, server, transfer); status != http.StatusOK {
+		t.Fatalf("Expected the transfer to succeed, got %d %+v", status, response)
+	}
+	transfer.Amount = 600
+	if status, response := postTransaction(t, server, transfer); status != http.StatusForbidden || response.Message != "Transfer exceeds the daily limit, 500.00 USD can still be sent today." {
+		t.Errorf("Expected the daily limit to be exceeded, got %d %+v", status, response)
+	}
+
+	limits := allowance(t, server, 106)
+	if remaining := limits.Allowances[0]; *remaining.Daily != dollars(500) || *remaining.Monthly != dollars(1000) || remaining.Transfers != nil {
+		t.Errorf("Unexpected allowance %+v", remaining)
+	}
+
+	// Deposits and withdrawals are not transfers
+	if status, response := postTransaction(t, server, TransactionRequest{SenderID: 106, ReceiverID: 106, AccountNumber: 482913374, Amount: -2000}); status != http.StatusOK {
+		t.Errorf("Expected the withdrawal to succeed, got %d %+v", status, response)
+	}
+
+	// The day rolls over but the month does not
+	now = now.Add(25 * time.Hour)
+	if status, response := postTransaction(t, server, transfer); status != http.StatusOK {
+		t.Errorf("Expected the transfer to succeed the next day, got %d %+v", status, response)
+	}
+	transfer.Amount = 500
+	if status, response := postTransaction(t, server, transfer); status != http.StatusForbidden || response.Message != "Transfer exceeds the monthly limit, 400.00 USD can still be sent this month." {
+		t.Errorf("Expected the monthly limit to be exceeded, got %d %+v", status, response)
+	}
+
+	if got := balanceOf(t, store, 106); got != dollars(50000-1000-2000-600) {
+		t.Errorf("Expected sender balance %d, got %s", 50000-1000-2000-600, got)
+	}
+	attempts, err := store.Attempts().FindRecent(context.Background(), 106, 0, 1)
+	if err != nil || len(attempts) != 1 || attempts[0].Code != handlers.CodeLimitExceeded {
+		t.Errorf("Expected the refused transfer to be recorded as an attempt, got %+v %v", attempts, err)
+	}
+}
+
+func TestTransferVelocityAndUserLimits(t *testing.T) {
+	now := time.Date(2030, time.March, 15, 12, 0, 0, 0, time.UTC)
+	server, _, handler := newClockedServer(t, &now)
+	handler.SetTransferLimits(datamodels.TransferLimits{Single: 100, Velocity: 2})
+
+	transfer := TransactionRequest{SenderID: 106, ReceiverID: 50664, AccountNumber: 694332936, Amount: 10}
+	for i := 0; i < 2; i++ {
+		postTransaction(t, server, transfer)
+	}
+	if status, response := postTransaction(t, server, transfer); status != http.StatusForbidden || response.Message != "Too many transfers, try again later." {
+		t.Errorf("Expected the velocity limit to be exceeded, got %d %+v", status, response)
+	}
+
+	// Limits set for the user replace the defaults they name
+	res := adminRequest(t, server, http.MethodPut, "/admin/limits/106", map[string]int{"single": 5000, "velocity": 5})
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, res.StatusCode)
+	}
+
+	transfer.Amount = 4000
+	if status, response := postTransaction(t, server, transfer); status != http.StatusOK {
+		t.Errorf("Expected the user's own limits to allow the transfer, got %d %+v", status, response)
+	}
+	limits := allowance(t, server, 106)
+	if limits.Limits.Single != 5000 || limits.Limits.Daily != 0 || *limits.Allowances[0].Transfers != 2 {
+		t.Errorf("Unexpected limits %+v", limits)
+	}
+
+	// Other users keep the defaults
+	if status, _ := postTransaction(t, server, TransactionRequest{SenderID: 50664, ReceiverID: 106, AccountNumber: 482913374, Amount: 4000}); status != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, status)
+	}
+}
+
+func TestAuthorizationsCountTowardLimits(t *testing.T) {
+	now := time.Date(2030, time.March, 15, 12, 0, 0, 0, time.UTC)
+	server, _, handler := newClockedServer(t, &now)
+	handler.SetTransferLimits(datamodels.TransferLimits{Daily: 1000})
+
+	_, authorized := postTransaction(t, server, TransactionRequest{SenderID: 106, ReceiverID: 50664, AccountNumber: 694332936, Amount: 800, Authorize: true})
+	transfer := TransactionRequest{SenderID: 106, ReceiverID: 50664, AccountNumber: 694332936, Amount: 300}
+	if status, _ := postTransaction(t, server, transfer); status != http.StatusForbidden {
+		t.Errorf("Expected the held amount to count toward the limit, got %d", status)
+	}
+
+	// Voided authorizations no longer count
+	releaseAuthorization(t, server, "void", authorized.TransactionID, 106)
+	if status, response := postTransaction(t, server, transfer); status != http.StatusOK {
+		t.Errorf("Expected the transfer to succeed once the authorization was voided, got %d %+v", status, response)
+	}
+}
+
+func TestConcurrentTransfersRespectLimits(t *testing.T) {
+	now := time.Date(2030, time.March, 15, 12, 0, 0, 0, time.UTC)
+	server, store, handler := newClockedServer(t, &now)
+	handler.SetTransferLimits(datamodels.TransferLimits{Daily: 1000})
+
+	// 10 transfers of 300 race for a daily limit of 1000
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			postTransaction(t, server, TransactionRequest{SenderID: 106, ReceiverID: 50664, AccountNumber: 694332936, Amount: 300})
+		}()
+	}
+	wg.Wait()
+
+	if got := balanceOf(t, store, 106); got != dollars(50000-900) {
+		t.Errorf("Expected exactly 3 transfers to succeed, sender balance is %s", got)
+	}
+}
@@ -14,13 +14,9 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
-type TestUser struct {
-	UserID   int    `json:"user_id"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
-}
-
 func TestLogin(t *testing.T) {
+	server, _ := newTestServer(t)
+
 	users := []TestUser{
 		{
 			UserID:   106,
@@ -37,9 +33,24 @@ func TestLogin(t *testing.T) {
 			Email:    "wronguser@gmail.com",
 			Password: "password",
 		},
+		{
+			UserID:   106,
+			Email:    "Joe.Wilderman@hotmail.com",
+			Password: "wrong-password",
+		},
+		{
+			UserID:   110,
+			Email:    "Joe.Wilderman@hotmail.com",
+			Password: "qfKH89aXG9QFcOW",
+		},
+		{
+			UserID:   110,
+			Email:    "",
+			Password: "qfKH89aXG9QFcOW",
+		},
 	}
 
-	results := []int{200, 200, 401}
+	results := []int{200, 200, 401, 401, 401, 400}
 
 	for idx, user := range users {
 		payload := LoginRequest{
@@ -50,23 +61,25 @@ func TestLogin(t *testing.T) {
 
 		data, err := json.Marshal(payload)
 		if err != nil {
-			t.Errorf("Error marshalling JSON: %v", err)
+			t.Fatalf("Error marshalling JSON: %v", err)
 		}
 
-		res, err := http.Post("http://localhost:8080/login", "application/json", bytes.NewBuffer(data))
+		res, err := http.Post(server.URL+"/login", "application/json", bytes.NewBuffer(data))
 		if err != nil {
-			t.Errorf("Request failed: %v", err)
+			t.Fatalf("Request failed: %v", err)
 		}
-
 		defer res.Body.Close()
 
 		if res.StatusCode != results[idx] {
-			t.Errorf("Expected status code %d, got %d", results[idx], res.StatusCode)
+			t.Errorf("User %d: expected status code %d, got %d", user.UserID, results[idx], res.StatusCode)
 		}
 
 		if res.StatusCode == 200 {
 			type Response struct {
 				Status string `json:"status"`
+				Data   struct {
+					UserID string `json:"user_id"`
+				} `json:"data"`
 			}
 
 			var response Response
@@ -79,6 +92,24 @@ func TestLogin(t *testing.T) {
 			if response.Status != "success" {
 				t.Errorf("Expected status 'success', got '%s'", response.Status)
 			}
+
+			if response.Data.UserID != payload.UserID {
+				t.Errorf("Expected user_id %s, got %s", payload.UserID, response.Data.UserID)
+			}
 		}
 	}
 }
+
+func TestLoginMalformedBody(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	res, err := http.Post(server.URL+"/login", "application/json", bytes.NewBufferString("{"))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, res.StatusCode)
+	}
+}
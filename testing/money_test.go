@@ -0,0 +1,167 @@
+package main
+
+import (
+	"cse512/datamodels"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/text/language"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input    string
+		currency string
+		minor    int64
+		valid    bool
+	}{
+		{"12.34", "USD", 1234, true},
+		{"-0.05", "USD", -5, true},
+		{"20", "USD", 2000, true},
+		{"7.5", "EUR", 750, true},
+		{"500", "JPY", 500, true},
+		{"92233720368547758.07", "USD", math.MaxInt64, true},
+		{"1.005", "USD", 0, false},
+		{"1.5", "JPY", 0, false},
+		{"92233720368547758.08", "USD", 0, false},
+		{"1e3", "USD", 0, false},
+		{"1.", "USD", 0, false},
+		{"", "USD", 0, false},
+		{"12", "XYZ", 0, false},
+	}
+
+	for _, test := range tests {
+		money, err := datamodels.ParseMoney(test.input, test.currency)
+		if (err == nil) != test.valid {
+			t.Errorf("ParseMoney(%q, %s): unexpected error %v", test.input, test.currency, err)
+			continue
+		}
+		if test.valid && money != datamodels.NewMoney(test.minor, test.currency) {
+			t.Errorf("ParseMoney(%q, %s) = %+v, expected %d minor units", test.input, test.currency, money, test.minor)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	sum, err := dollars(10).Add(datamodels.NewMoney(5, "USD"))
+	if err != nil || sum != datamodels.NewMoney(1005, "USD") {
+		t.Errorf("Expected 10.05 USD, got %s, %v", sum, err)
+	}
+
+	// The zero value takes on the other currency
+	if sum, err := (datamodels.Money{}).Add(dollars(3)); err != nil || sum != dollars(3) {
+		t.Errorf("Expected 3.00 USD, got %s, %v", sum, err)
+	}
+
+	if _, err := dollars(1).Add(datamodels.NewMoney(100, "EUR")); !errors.Is(err, datamodels.ErrCurrencyMismatch) {
+		t.Errorf("Expected ErrCurrencyMismatch, got %v", err)
+	}
+
+	max := datamodels.NewMoney(math.MaxInt64, "USD")
+	if _, err := max.Add(datamodels.NewMoney(1, "USD")); !errors.Is(err, datamodels.ErrOverflow) {
+		t.Errorf("Expected ErrOverflow adding to the maximum, got %v", err)
+	}
+	min := datamodels.NewMoney(math.MinInt64, "USD")
+	if _, err := min.Sub(datamodels.NewMoney(1, "USD")); !errors.Is(err, datamodels.ErrOverflow) {
+		t.Errorf("Expected ErrOverflow subtracting from the minimum, got %v", err)
+	}
+	if _, err := min.Neg(); !errors.Is(err, datamodels.ErrOverflow) {
+		t.Errorf("Expected ErrOverflow negating the minimum, got %v", err)
+	}
+	if _, err := datamodels.FromMajor(math.MaxInt64/10, "USD"); !errors.Is(err, datamodels.ErrOverflow) {
+		t.Errorf("Expected ErrOverflow converting whole units, got %v", err)
+	}
+}
+
+func TestMoneyFormat(t *testing.T) {
+	tests := []struct {
+		money    datamodels.Money
+		tag      language.Tag
+		expected string
+	}{
+		{datamodels.NewMoney(123450, "USD"), language.English, "$1,234.50"},
+		{datamodels.NewMoney(-10000, "USD"), language.English, "-$100.00"},
+		{datamodels.NewMoney(123450, "EUR"), language.German, "€1.234,50"},
+		{datamodels.NewMoney(1234, "JPY"), language.Japanese, "￥1,234"},
+		{datamodels.NewMoney(5, "USD"), language.English, "$0.05"},
+	}
+
+	for _, test := range tests {
+		if got := test.money.Format(test.tag); got != test.expected {
+			t.Errorf("Format(%s, %s) = %q, expected %q", test.money, test.tag, got, test.expected)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(datamodels.NewMoney(-1050, "USD"))
+	if err != nil || string(data) != "-10.50" {
+		t.Errorf("Expected -10.50, got %s, %v", data, err)
+	}
+
+	var money datamodels.Money
+	if err := json.Unmarshal([]byte(`{"amount": 7.25, "currency": "EUR"}`), &money); err != nil || money != datamodels.NewMoney(725, "EUR") {
+		t.Errorf("Expected 7.25 EUR, got %s, %v", money, err)
+	}
+	if err := json.Unmarshal([]byte(`"20"`), &money); !errors.Is(err, datamodels.ErrInvalidMoney) {
+		t.Errorf("Expected a quoted amount to be rejected, got %v", err)
+	}
+}
+
+func TestMoneyBSON(t *testing.T) {
+	type document struct {
+		Amount datamodels.Money `bson:"amount"`
+	}
+
+	data, err := bson.Marshal(document{Amount: datamodels.NewMoney(1234, "EUR")})
+	if err != nil {
+		t.Fatalf("Error marshalling: %v", err)
+	}
+	var stored bson.M
+	bson.Unmarshal(data, &stored)
+	amount, _ := stored["amount"].(bson.M)
+	if amount["minor_units"] != int64(1234) || amount["currency"] != "EUR" {
+		t.Errorf("Unexpected stored form %v", stored)
+	}
+
+	var decoded document
+	if err := bson.Unmarshal(data, &decoded); err != nil || decoded.Amount != datamodels.NewMoney(1234, "EUR") {
+		t.Errorf("Expected 12.34 EUR, got %s, %v", decoded.Amount, err)
+	}
+
+	// Documents written before Money existed hold whole dollars
+	legacy := []any{int32(-5969), int64(1452), 12.5}
+	expected := []datamodels.Money{dollars(-5969), dollars(1452), datamodels.NewMoney(1250, "USD")}
+	for i, value := range legacy {
+		data, _ := bson.Marshal(bson.M{"amount": value})
+		var decoded document
+		if err := bson.Unmarshal(data, &decoded); err != nil || decoded.Amount != expected[i] {
+			t.Errorf("Expected legacy %v to decode as %s, got %s, %v", value, expected[i], decoded.Amount, err)
+		}
+	}
+}
+
+func TestTransferOfCents(t *testing.T) {
+	server, store := newTestServer(t)
+
+	res, err := http.Post(server.URL+"/transaction", "application/json", strings.NewReader(`{"sender_id":106,"receiver_id":50664,"account_number":694332936,"amount":10.05}`))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+
+	if got := balanceOf(t, store, 106); got != datamodels.NewMoney(4998995, "USD") {
+		t.Errorf("Expected sender balance 49989.95, got %s", got)
+	}
+	if got := balanceOf(t, store, 50664); got != datamodels.NewMoney(2001005, "USD") {
+		t.Errorf("Expected receiver balance 20010.05, got %s", got)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"cse512/handlers"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetMonthData(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	res, err := http.Get(server.URL + "/monthdata?user_id=106&month=8&year=2022")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, res.StatusCode)
+	}
+
+	if contentType := res.Header.Get("Content-Type"); contentType != "text/csv" {
+		t.Errorf("Expected Content-Type text/csv, got %s", contentType)
+	}
+
+	rows, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Error reading CSV: %v", err)
+	}
+
+	header := []string{"Sender ID", "Receiver ID", "Amount", "Remarks", "Date", "Status", "Type", "Original Amount", "Converted Amount", "Exchange Rate", "Fee", "Transaction ID", "Reversal Of", "Reversed By", "Failure Code"}
+	if strings.Join(rows[0], ",") != strings.Join(header, ",") {
+		t.Errorf("Expected header %v, got %v", header, rows[0])
+	}
+
+	// All 12 August fixtures, none of the 2023 ones
+	if len(rows) != 13 {
+		t.Fatalf("Expected 12 data rows, got %d", len(rows)-1)
+	}
+
+	// Amounts are signed from the point of view of the user
+	first := rows[1]
+	if first[0] != "106" || first[1] != "50664" || first[2] != "-$100.00" || first[5] != "completed" || first[6] != "transfer" {
+		t.Errorf("Unexpected first row %v", first)
+	}
+}
+
+func TestGetMonthDataEmpty(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	res, err := http.Get(server.URL + "/monthdata?user_id=110&month=8&year=2022")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	if !strings.Contains(string(body), "You have not made any transactions this month.") {
+		t.Errorf("Unexpected body %s", body)
+	}
+}
+
+func TestGetMonthDataIncludesFailed(t *testing.T) {
+	now := time.Date(2030, time.March, 15, 12, 0, 0, 0, time.UTC)
+	server, _, _ := newClockedServer(t, &now)
+
+	postTransaction(t, server, TransactionRequest{SenderID: 110, ReceiverID: 50664, AccountNumber: 694332936, Amount: 5000})
+	now = now.Add(time.Minute)
+	postTransaction(t, server, TransactionRequest{SenderID: 110, ReceiverID: 50664, AccountNumber: 694332936, Amount: 300})
+
+	statement := func(query string) [][]string {
+		t.Helper()
+		res, err := http.Get(server.URL + "/monthdata?user_id=110&month=3&year=2030" + query)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer res.Body.Close()
+		rows, err := csv.NewReader(res.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("Error reading CSV: %v", err)
+		}
+		return rows
+	}
+
+	if rows := statement(""); len(rows) != 2 || rows[1][5] != "settled" || rows[1][14] != "" {
+		t.Errorf("Expected only the settled transfer, got %v", rows)
+	}
+
+	// Attempts are listed in time order with the code they were refused with
+	rows := statement("&include_failed=true")
+	if len(rows) != 3 {
+		t.Fatalf("Expected 2 data rows, got %v", rows)
+	}
+	if failed := rows[1]; failed[2] != "-$5,000.00" || failed[5] != "failed" || failed[14] != handlers.CodeInsufficientFunds {
+		t.Errorf("Unexpected failed row %v", failed)
+	}
+	if rows[2][5] != "settled" {
+		t.Errorf("Expected the settled transfer last, got %v", rows[2])
+	}
+}
+
+func TestGetMonthDataInvalidParams(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	queries := []string{
+		"month=8&year=2022",
+		"user_id=106&year=2022",
+		"user_id=106&month=8",
+		"user_id=106&month=13&year=2022",
+		"user_id=106&month=8&year=-1",
+		"user_id=abc&month=8&year=2022",
+		"user_id=106&month=8&year=2022&include_failed=maybe",
+	}
+
+	for _, query := range queries {
+		res, err := http.Get(server.URL + "/monthdata?" + query)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Query %q: expected status code %d, got %d", query, http.StatusBadRequest, res.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"cse512/datamodels"
+	"cse512/handlers"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// payeeResponse is the body returned by the payee endpoints
+type payeeResponse struct {
+	Status  string                 `json:"status"`
+	Message string                 `json:"message"`
+	Data    handlers.PayeeResponse `json:"data"`
+}
+
+// sendPayeeRequest sends payload to a payee route and decodes the response
+func sendPayeeRequest(t *testing.T, server *httptest.Server, method, route string, payload any) (int, payeeResponse) {
+	t.Helper()
+
+	data, _ := json.Marshal(payload)
+	req, err := http.NewRequest(method, server.URL+route, bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("Error creating request: %v", err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response payeeResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	return res.StatusCode, response
+}
+
+// addPayee saves a payee for userID and returns it
+func addPayee(t *testing.T, server *httptest.Server, userID int, name string, accountNumber int64) datamodels.Payee {
+	t.Helper()
+
+	status, response := sendPayeeRequest(t, server, http.MethodPost, "/payees", map[string]any{
+		"user_id": userID, "name": name, "account_number": accountNumber,
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, status, response.Message)
+	}
+	return response.Data.Payee
+}
+
+func TestPayeeManagement(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	payee := addPayee(t, server, 106, "  humberto  BERNHARD ", 694332936)
+	if !payee.Verified || payee.Name != "humberto  BERNHARD" {
+		t.Errorf("Expected the payee to be verified, got %+v", payee)
+	}
+
+	unverified := addPayee(t, server, 106, "Tom Kuhn", 310557821)
+	if unverified.Verified {
+		t.Errorf("Expected a payee with another name to be unverified, got %+v", unverified)
+	}
+
+	tests := []struct {
+		name    string
+		payload map[string]any
+		status  int
+		message string
+	}{
+		{"duplicate", map[string]any{"user_id": 106, "name": "Humberto Bernhard", "account_number": 694332936}, http.StatusConflict, "Payee already saved."},
+		{"own account", map[string]any{"user_id": 106, "name": "Joe Wilderman", "account_number": 482913374}, http.StatusBadRequest, "Cannot save your own account as a payee."},
+		{"unknown account", map[string]any{"user_id": 106, "name": "Nobody", "account_number": 999999999}, http.StatusNotFound, "Account not found."},
+		{"missing name", map[string]any{"user_id": 106, "account_number": 694332936}, http.StatusBadRequest, "name and account_number are required."},
+		{"unknown user", map[string]any{"user_id": 9, "name": "Humberto Bernhard", "account_number": 694332936}, http.StatusNotFound, "User not found."},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, response := sendPayeeRequest(t, server, http.MethodPost, "/payees", test.payload)
+			if status != test.status || response.Message != test.message {
+				t.Errorf("Expected %d %q, got %d %q", test.status, test.message, status, response.Message)
+			}
+		})
+	}
+
+	// Renaming verifies the payee again
+	route := "/payees/" + strconv.FormatInt(unverified.PayeeID, 10)
+	status, response := sendPayeeRequest(t, server, http.MethodPut, route, map[string]any{"user_id": 106, "name": "Thomas Kuhn", "nickname": "Tom"})
+	if status != http.StatusOK || !response.Data.Verified || response.Data.Nickname != "Tom" {
+		t.Errorf("Unexpected update response %d %+v", status, response)
+	}
+
+	status, response = sendPayeeRequest(t, server, http.MethodPost, route+"/verify", map[string]any{"user_id": 106})
+	if status != http.StatusOK || response.Message != "Payee verified." {
+		t.Errorf("Unexpected verify response %d %+v", status, response)
+	}
+
+	// Other users cannot see or change the payee
+	if status, _ := sendPayeeRequest(t, server, http.MethodPut, route, map[string]any{"user_id": 110, "nickname": "Mine"}); status != http.StatusNotFound {
+		t.Errorf("Expected status code %d for another user's payee, got %d", http.StatusNotFound, status)
+	}
+	if status, _ := sendPayeeRequest(t, server, http.MethodDelete, route+"?user_id=110", nil); status != http.StatusNotFound {
+		t.Errorf("Expected status code %d for another user's payee, got %d", http.StatusNotFound, status)
+	}
+
+	if status, _ := sendPayeeRequest(t, server, http.MethodDelete, route+"?user_id=106", nil); status != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	res, err := http.Get(server.URL + "/payees?user_id=106")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var list struct {
+		Data []handlers.PayeeResponse `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if len(list.Data) != 1 || list.Data[0].PayeeID != payee.PayeeID {
+		t.Errorf("Expected only the first payee to be left, got %+v", list.Data)
+	}
+}
+
+func TestTransferToPayee(t *testing.T) {
+	server, store := newTestServer(t)
+
+	payee := addPayee(t, server, 106, "Humberto Bernhard", 694332936)
+	unverified := addPayee(t, server, 106, "Someone Else", 310557821)
+
+	send := func(payload map[string]any) (int, handlers.Transaction) {
+		data, _ := json.Marshal(payload)
+		res, err := http.Post(server.URL+"/transaction", "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer res.Body.Close()
+
+		var response handlers.Transaction
+		if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+			t.Fatalf("Error decoding response: %v", err)
+		}
+		return res.StatusCode, response
+	}
+
+	status, response := send(map[string]any{"sender_id": 106, "payee_id": payee.PayeeID, "amount": 50})
+	if status != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, status, response.Message)
+	}
+	if got := balanceOf(t, store, 50664); got != dollars(20050) {
+		t.Errorf("Expected receiver balance 20050, got %s", got)
+	}
+
+	tests := []struct {
+		name    string
+		payload map[string]any
+		status  int
+		code    string
+	}{
+		{"unverified payee", map[string]any{"sender_id": 106, "payee_id": unverified.PayeeID, "amount": 50}, http.StatusBadRequest, handlers.CodeAccountMismatch},
+		{"another user's payee", map[string]any{"sender_id": 110, "payee_id": payee.PayeeID, "amount": 50}, http.StatusNotFound, handlers.CodeNotFound},
+		{"conflicting account", map[string]any{"sender_id": 106, "payee_id": payee.PayeeID, "account_number": 310557821, "amount": 50}, http.StatusBadRequest, handlers.CodeRejected},
+		{"conflicting receiver", map[string]any{"sender_id": 106, "payee_id": payee.PayeeID, "receiver_id": 110, "amount": 50}, http.StatusBadRequest, handlers.CodeAccountMismatch},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, response := send(test.payload)
+			if status != test.status || response.Code != test.code {
+				t.Errorf("Expected %d %q, got %d %q: %s", test.status, test.code, status, response.Code, response.Message)
+			}
+		})
+	}
+}
+
+func TestNewPayeeCoolingOff(t *testing.T) {
+	_, store := newTestServer(t)
+	handler := handlers.New(store)
+	handler.SetPayeeCoolingOff(24 * time.Hour)
+	server := httptest.NewServer(handlers.NewRouter(handler))
+	defer server.Close()
+
+	payee := addPayee(t, server, 106, "Humberto Bernhard", 694332936)
+
+	// A payee saved two days ago is past its cooling-off period
+	settled := datamodels.Payee{
+		PayeeID:       1,
+		UserID:        106,
+		Name:          "Thomas Kuhn",
+		AccountNumber: 310557821,
+		Verified:      true,
+		CreatedAt:     time.Now().Add(-48 * time.Hour).Unix(),
+	}
+	if err := store.Payees().Insert(context.Background(), settled); err != nil {
+		t.Fatalf("Error saving payee: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		payeeID int64
+		amount  int
+		status  int
+		code    string
+	}{
+		{"over the limit", payee.PayeeID, int(handlers.NewPayeeLimit) + 1, http.StatusForbidden, handlers.CodeCoolingOff},
+		{"at the limit", payee.PayeeID, int(handlers.NewPayeeLimit), http.StatusOK, ""},
+		{"after cooling off", settled.PayeeID, 5000, http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, _ := json.Marshal(map[string]any{"sender_id": 106, "payee_id": test.payeeID, "amount": test.amount})
+			res, err := http.Post(server.URL+"/transaction", "application/json", bytes.NewBuffer(data))
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer res.Body.Close()
+
+			var response handlers.Transaction
+			if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			if res.StatusCode != test.status || response.Code != test.code {
+				t.Errorf("Expected %d %q, got %d %q: %s", test.status, test.code, res.StatusCode, response.Code, response.Message)
+			}
+		})
+	}
+}
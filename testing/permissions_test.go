@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/handlers"
+	"cse512/repository"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// newSecuredServer starts the API on the fixtures with tokens required on
+// every route but /login
+func newSecuredServer(t *testing.T) (*httptest.Server, *repository.MemoryStore) {
+	t.Helper()
+
+	_, store := newTestServer(t)
+	handler := handlers.New(store)
+	handler.SetRequireTokens(true)
+	server := httptest.NewServer(handlers.NewRouter(handler))
+	t.Cleanup(server.Close)
+
+	return server, store
+}
+
+// fixtureToken logs in the fixture user with userID
+func fixtureToken(t *testing.T, server *httptest.Server, userID int) string {
+	t.Helper()
+
+	for _, fixture := range fixtureUsers {
+		if fixture.user.UserID == userID {
+			return loginToken(t, server, fixture.user, fixture.password)
+		}
+	}
+	t.Fatalf("No fixture user %d", userID)
+	return ""
+}
+
+func TestEveryRouteHasPermissions(t *testing.T) {
+	router := handlers.NewRouter(handlers.New(repository.NewMemoryStore()))
+
+	named := map[string]bool{}
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || route.GetHandler() == nil {
+			return nil // Subrouter prefixes
+		}
+		name := route.GetName()
+		if _, ok := handlers.Permissions[name]; !ok {
+			t.Errorf("Route %s named %q is missing from the permission matrix", path, name)
+		}
+		named[name] = true
+		return nil
+	})
+	for name := range handlers.Permissions {
+		if !named[name] {
+			t.Errorf("Permission for %q names no route", name)
+		}
+	}
+}
+
+func TestCustomersActOnlyForThemselves(t *testing.T) {
+	server, store := newSecuredServer(t)
+	token := fixtureToken(t, server, 106)
+
+	tests := []struct {
+		name    string
+		token   string
+		method  string
+		path    string
+		payload any
+		status  int
+	}{
+		{"no token", "", http.MethodGet, "/transactions?sender_id=106", nil, http.StatusUnauthorized},
+		{"forged token", token + "x", http.MethodGet, "/transactions?sender_id=106", nil, http.StatusUnauthorized},
+		{"own statement", token, http.MethodGet, "/transactions?sender_id=106", nil, http.StatusOK},
+		{"other user's statement", token, http.MethodGet, "/transactions?sender_id=110", nil, http.StatusForbidden},
+		{"other user's accounts", token, http.MethodGet, "/accounts?user_id=110", nil, http.StatusForbidden},
+		{"transfer as another user", token, http.MethodPost, "/transaction", TransactionRequest{SenderID: 110, ReceiverID: 106, AccountNumber: 482913374, Amount: 100}, http.StatusForbidden},
+		{"own user in query, other in body", token, http.MethodPost, "/transaction?user_id=106", TransactionRequest{SenderID: 110, ReceiverID: 106, AccountNumber: 482913374, Amount: 100}, http.StatusForbidden},
+		{"deposit as another user", token, http.MethodPost, "/deposit", CashRequest{UserID: 110, Amount: 100}, http.StatusForbidden},
+		{"admin route", token, http.MethodGet, "/admin/users?q=joe", nil, http.StatusForbidden},
+		{"own transfer", token, http.MethodPost, "/transaction", TransactionRequest{SenderID: 106, ReceiverID: 110, AccountNumber: 310557821, Amount: 100}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := authorizedRequest(t, server, test.token, test.method, test.path, test.payload)
+			res.Body.Close()
+			if res.StatusCode != test.status {
+				t.Errorf("Expected status code %d, got %d", test.status, res.StatusCode)
+			}
+		})
+	}
+
+	// Only the transfer made as the sender moved money
+	if got := balanceOf(t, store, 110); got != dollars(1100) {
+		t.Errorf("Expected balance 1100, got %s", got)
+	}
+}
+
+func TestBodiesAreReadLikeTheHandlers(t *testing.T) {
+	server, store := newSecuredServer(t)
+	token := fixtureToken(t, server, 110)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"another user's transfer", `{"sender_id": 106, "receiver_id": 110, "account_number": 310557821, "amount": 50}`, http.StatusForbidden},
+		{"another user's transfer with trailing data", `{"sender_id": 106, "receiver_id": 110, "account_number": 310557821, "amount": 50} x`, http.StatusForbidden},
+		{"own transfer followed by another user's", `{"sender_id": 110, "receiver_id": 106, "account_number": 482913374, "amount": 50} {"sender_id": 106}`, http.StatusOK},
+		{"malformed body", `{"sender_id": 106, "receiver_id"`, http.StatusBadRequest},
+		{"sender as a string", `{"sender_id": "106", "receiver_id": 110, "account_number": 310557821, "amount": 50}`, http.StatusBadRequest},
+		{"not an object", `[106]`, http.StatusBadRequest},
+		{"no user named", `{"receiver_id": 110, "account_number": 310557821, "amount": 50}`, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, server.URL+"/transaction", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			res.Body.Close()
+			if res.StatusCode != test.status {
+				t.Errorf("Expected status code %d, got %d", test.status, res.StatusCode)
+			}
+		})
+	}
+
+	// Only the first value of a body is read, by the check and the handler alike
+	if got := balanceOf(t, store, 106); got != dollars(50050) {
+		t.Errorf("Expected the other user's balance to only receive the own transfer, got %s", got)
+	}
+}
+
+func TestTokensAreCheckedWhenOptional(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	// Requests without a token still work until tokens are required
+	res := authorizedRequest(t, server, "", http.MethodGet, "/transactions?sender_id=110", nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected status code %d without a token, got %d", http.StatusOK, res.StatusCode)
+	}
+
+	// A token that is sent must allow the request
+	res = authorizedRequest(t, server, fixtureToken(t, server, 106), http.MethodGet, "/transactions?sender_id=110", nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status code %d for another user's token, got %d", http.StatusForbidden, res.StatusCode)
+	}
+}
+
+func TestStaffReadStatements(t *testing.T) {
+	server, store := newSecuredServer(t)
+	ctx := context.Background()
+	if err := store.Users().SetRole(ctx, 50664, datamodels.RoleSupport); err != nil {
+		t.Fatalf("Error setting role: %v", err)
+	}
+	if err := store.Users().SetRole(ctx, 110, datamodels.RoleAuditor); err != nil {
+		t.Fatalf("Error setting role: %v", err)
+	}
+	support := fixtureToken(t, server, 50664)
+	auditor := fixtureToken(t, server, 110)
+
+	tests := []struct {
+		name    string
+		token   string
+		method  string
+		path    string
+		payload any
+		status  int
+	}{
+		{"support reads a statement", support, http.MethodGet, "/transactions?sender_id=106", nil, http.StatusOK},
+		{"support reads a monthly statement", support, http.MethodGet, "/monthdata?user_id=106&month=8&year=2022", nil, http.StatusOK},
+		{"support finds a user", support, http.MethodGet, "/admin/users?q=joe", nil, http.StatusOK},
+		{"support moves a user's money", support, http.MethodPost, "/transaction", TransactionRequest{SenderID: 106, ReceiverID: 50664, AccountNumber: 694332936, Amount: 100}, http.StatusForbidden},
+		{"support saves a payee for a user", support, http.MethodPost, "/payees", map[string]any{"user_id": 106, "account_number": 694332936}, http.StatusForbidden},
+		{"support exports the audit log", support, http.MethodGet, "/admin/audit", nil, http.StatusForbidden},
+		{"support freezes an account", support, http.MethodPost, "/admin/accounts/482913374/freeze", nil, http.StatusForbidden},
+		{"auditor reads accounts", auditor, http.MethodGet, "/accounts?user_id=106", nil, http.StatusOK},
+		{"auditor reconciles", auditor, http.MethodGet, "/admin/reconcile", nil, http.StatusOK},
+		{"auditor adjusts a balance", auditor, http.MethodPost, "/admin/accounts/482913374/adjust", map[string]any{"amount": 10, "reason": "Test"}, http.StatusForbidden},
+		{"auditor sends own money", auditor, http.MethodPost, "/transaction", TransactionRequest{SenderID: 110, ReceiverID: 106, AccountNumber: 482913374, Amount: 100}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := authorizedRequest(t, server, test.token, test.method, test.path, test.payload)
+			res.Body.Close()
+			if res.StatusCode != test.status {
+				t.Errorf("Expected status code %d, got %d", test.status, res.StatusCode)
+			}
+		})
+	}
+
+	// Every read of another user's data is in the audit log, acting as
+	// oneself is not
+	res := authorizedRequest(t, server, auditor, http.MethodGet, "/admin/audit", nil)
+	defer res.Body.Close()
+	records, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Error reading CSV: %v", err)
+	}
+	accesses := map[string]string{}
+	for _, record := range records[1:] {
+		if record[2] == datamodels.AuditAccess {
+			accesses[record[7]] = record[1] + " on " + record[3]
+		}
+	}
+	expected := map[string]string{
+		"GET /transactions?sender_id=106":              "50664 on 106",
+		"GET /monthdata?user_id=106&month=8&year=2022": "50664 on 106",
+		"GET /admin/users?q=joe":                       "50664 on ",
+		"GET /accounts?user_id=106":                    "110 on 106",
+		"GET /admin/reconcile":                         "110 on ",
+		"GET /admin/audit":                             "110 on ",
+	}
+	if len(accesses) != len(expected) {
+		t.Errorf("Expected %d accesses to be recorded, got %v", len(expected), accesses)
+	}
+	for detail, access := range expected {
+		if accesses[detail] != access {
+			t.Errorf("Expected %s to be recorded as %q, got %q", detail, access, accesses[detail])
+		}
+	}
+}
+
+func TestChangedRoleTakesEffectAtOnce(t *testing.T) {
+	server, _ := newSecuredServer(t)
+
+	res := adminRequest(t, server, http.MethodPut, "/admin/users/50664/role", map[string]string{"role": datamodels.RoleSupport, "reason": "Joined the help desk"})
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, res.StatusCode)
+	}
+	support := fixtureToken(t, server, 50664)
+	res = authorizedRequest(t, server, support, http.MethodGet, "/transactions?sender_id=106", nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d as support, got %d", http.StatusOK, res.StatusCode)
+	}
+
+	// The token issued as support is refused once the role is taken away
+	res = adminRequest(t, server, http.MethodPut, "/admin/users/50664/role", map[string]string{"role": datamodels.RoleCustomer})
+	res.Body.Close()
+	res = authorizedRequest(t, server, support, http.MethodGet, "/transactions?sender_id=106", nil)
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status code %d as customer, got %d", http.StatusForbidden, res.StatusCode)
+	}
+
+	res = adminRequest(t, server, http.MethodPut, "/admin/users/50664/role", map[string]string{"role": "superuser"})
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an unknown role, got %d", http.StatusBadRequest, res.StatusCode)
+	}
+	res = adminRequest(t, server, http.MethodPut, "/admin/users/12345/role", map[string]string{"role": datamodels.RoleSupport})
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status code %d for an unknown user, got %d", http.StatusNotFound, res.StatusCode)
+	}
+}
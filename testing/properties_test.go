@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"cse512/datamodels"
+	"cse512/handlers"
+	"cse512/ledger"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+func TestRejectedTransactionRequests(t *testing.T) {
+	server, store := newTestServer(t)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		body    string
+		message string
+	}{
+		{"negative transfer", `{"sender_id":106,"receiver_id":50664,"account_number":694332936,"amount":-500}`, "Transfer amount must be positive and at most 1000000000."},
+		{"transfer over limit", `{"sender_id":106,"receiver_id":50664,"account_number":694332936,"amount":1000000001}`, "Transfer amount must be positive and at most 1000000000."},
+		{"fraction of a cent", `{"sender_id":106,"receiver_id":50664,"account_number":694332936,"amount":10.505}`, "Invalid value for amount."},
+		{"exponent amount", `{"sender_id":106,"receiver_id":50664,"account_number":694332936,"amount":1e3}`, "Invalid value for amount."},
+		{"unknown currency", `{"sender_id":106,"receiver_id":50664,"account_number":694332936,"amount":{"amount":20,"currency":"XYZ"}}`, "Invalid value for amount."},
+		{"other currency", `{"sender_id":106,"receiver_id":50664,"account_number":694332936,"amount":{"amount":20,"currency":"EUR"}}`, "Amount must be in USD."},
+		{"overflowing amount", `{"sender_id":106,"receiver_id":50664,"account_number":694332936,"amount":99999999999999999999}`, "Invalid value for amount."},
+		{"quoted amount", `{"sender_id":106,"receiver_id":50664,"account_number":694332936,"amount":"20"}`, "Invalid value for amount."},
+		{"negative sender", `{"sender_id":-106,"receiver_id":50664,"account_number":694332936,"amount":20}`, "sender_id and receiver_id must be positive."},
+		{"self withdrawal over limit", `{"sender_id":106,"receiver_id":106,"account_number":482913374,"amount":-10001}`, "Withdrawals are limited to 10000."},
+		{"self deposit over limit", `{"sender_id":106,"receiver_id":106,"account_number":482913374,"amount":1000000001}`, "Deposits are limited to 1000000000."},
+		{"malformed body", `{"sender_id":106,`, "Failed to parse JSON."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := http.Post(server.URL+"/transaction", "application/json", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer res.Body.Close()
+
+			var response handlers.Transaction
+			if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+
+			if res.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, res.StatusCode)
+			}
+			if response.Code != handlers.CodeRejected {
+				t.Errorf("Expected code %q, got %q", handlers.CodeRejected, response.Code)
+			}
+			if response.Message != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, response.Message)
+			}
+		})
+	}
+
+	// Rejected requests never touch balances
+	for _, fixture := range fixtureUsers {
+		if got := balanceOf(t, store, fixture.user.UserID); got != fixture.balance {
+			t.Errorf("Expected balance of %d to stay %s, got %s", fixture.user.UserID, fixture.balance, got)
+		}
+	}
+}
+
+// moneyRequest is a randomly generated call to one of the money endpoints
+type moneyRequest struct {
+	Route   string
+	Caller  int // sender_id or user_id, the only user whose balance may go down
+	Payload []byte
+}
+
+// Generate produces requests mixing valid and hostile values: unknown users,
+// wrong account numbers, negative, zero, huge and boundary amounts.
+func (moneyRequest) Generate(r *rand.Rand, size int) reflect.Value {
+	ids := []int{106, 110, 50664, 9, 0, -106}
+	accounts := []int{482913374, 310557821, 694332936, 111111111, 0}
+	amounts := []int{
+		1, 20, 999, 1000, 1001, 10000, 10001, 50000,
+		0, -1, -20, -10000, -10001, -50000,
+		ledger.MaxAmount, ledger.MaxAmount + 1, -ledger.MaxAmount - 1,
+		math.MaxInt, math.MinInt, math.MaxInt32 + 1,
+	}
+	amount := amounts[r.Intn(len(amounts))]
+	if r.Intn(2) == 0 {
+		amount = r.Intn(2*size+1) - size
+	}
+	caller := ids[r.Intn(len(ids))]
+
+	var route string
+	var payload any
+	switch r.Intn(3) {
+	case 0:
+		route = "/transaction"
+		receiver := ids[r.Intn(len(ids))]
+		if r.Intn(4) == 0 {
+			receiver = caller
+		}
+		payload = TransactionRequest{SenderID: caller, ReceiverID: receiver, AccountNumber: accounts[r.Intn(len(accounts))], Amount: amount}
+	case 1:
+		route = "/deposit"
+		payload = CashRequest{UserID: caller, Amount: amount}
+	default:
+		route = "/withdraw"
+		payload = CashRequest{UserID: caller, Amount: amount}
+	}
+
+	data, _ := json.Marshal(payload)
+	return reflect.ValueOf(moneyRequest{Route: route, Caller: caller, Payload: data})
+}
+
+// TestNoRequestDebitsAnotherUser checks that whatever is sent to the money
+// endpoints, only the calling user's balance can go down and every balance
+// stays non-negative.
+func TestNoRequestDebitsAnotherUser(t *testing.T) {
+	server, store := newTestServer(t)
+	defer server.Close()
+
+	balances := map[int]datamodels.Money{}
+	for _, fixture := range fixtureUsers {
+		balances[fixture.user.UserID] = fixture.balance
+	}
+
+	property := func(request moneyRequest) bool {
+		res, err := http.Post(server.URL+request.Route, "application/json", bytes.NewReader(request.Payload))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		res.Body.Close()
+
+		ok := true
+		for id, before := range balances {
+			after := balanceOf(t, store, id)
+			if after.Sign() < 0 {
+				t.Logf("%s %s left user %d with balance %s", request.Route, request.Payload, id, after)
+				ok = false
+			}
+			if after.Cmp(before) < 0 && id != request.Caller {
+				t.Logf("%s %s decreased balance of user %d from %s to %s", request.Route, request.Payload, id, before, after)
+				ok = false
+			}
+			balances[id] = after
+		}
+		return ok
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 500, Rand: rand.New(rand.NewSource(35))}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"cse512/audit"
+	"cse512/datamodels"
+	"cse512/reconcile"
+	"cse512/repository"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newLedgerStore returns a store where user 2 agrees with their ledger, user 1
+// has 200 more than theirs and user 3 was credited by a transfer that was then
+// recorded as a refused attempt
+func newLedgerStore(t *testing.T) *repository.MemoryStore {
+	t.Helper()
+	ctx := context.Background()
+	store := repository.NewMemoryStore()
+
+	// Each user holds account 10 + their id
+	accounts := []datamodels.Account{
+		{AccountNumber: 11, UserID: 1, Balance: dollars(700)},
+		{AccountNumber: 12, UserID: 2, Balance: dollars(300)},
+		{AccountNumber: 13, UserID: 3, Balance: dollars(250)},
+	}
+	for _, account := range accounts {
+		store.Users().Insert(ctx, datamodels.User{UserID: account.UserID, AccountNumber: account.AccountNumber})
+		store.Accounts().Insert(ctx, account)
+	}
+
+	transfer := func(from, to int, amount datamodels.Money, at int64, status string) datamodels.Transaction {
+		return datamodels.Transaction{
+			SenderID:        from,
+			SenderAccount:   int64(10 + from),
+			ReceiverID:      to,
+			ReceiverAccount: int64(10 + to),
+			Amount:          amount,
+			DateTimeStamp:   at,
+			Status:          status,
+		}
+	}
+	transactions := []datamodels.Transaction{
+		transfer(1, 1, dollars(1000), 1, datamodels.StatusCompleted),
+		transfer(1, 2, dollars(400), 2, datamodels.StatusSuccess),
+		transfer(2, 2, dollars(-100), 3, datamodels.StatusSuccess),
+		transfer(1, 2, dollars(5000), 4, datamodels.StatusFailed),
+		transfer(1, 3, dollars(100), 5, datamodels.StatusSuccess),
+	}
+	for _, transaction := range transactions {
+		store.Transactions().Insert(ctx, transaction)
+	}
+	store.Attempts().Insert(ctx, datamodels.AttemptOf(transfer(2, 3, dollars(150), 6, datamodels.StatusFailed), datamodels.AttemptCodeUnknown, ""))
+
+	return store
+}
+
+func TestReconcileReportsDiscrepancies(t *testing.T) {
+	store := newLedgerStore(t)
+
+	report, err := reconcile.Run(context.Background(), store, reconcile.Options{Shards: 2})
+	if err != nil {
+		t.Fatalf("Error reconciling: %v", err)
+	}
+
+	if report.AccountsChecked != 3 {
+		t.Errorf("Expected 3 accounts checked, got %d", report.AccountsChecked)
+	}
+	if len(report.Discrepancies) != 2 {
+		t.Fatalf("Expected 2 discrepancies, got %+v", report.Discrepancies)
+	}
+
+	first := report.Discrepancies[0]
+	if first.UserID != 1 || first.AccountNumber != 11 || first.LedgerBalance != dollars(500) || first.Difference != dollars(200) {
+		t.Errorf("Unexpected discrepancy %+v", first)
+	}
+
+	third := report.Discrepancies[1]
+	if third.UserID != 3 || third.AccountNumber != 13 || third.LedgerBalance != dollars(100) || third.Difference != dollars(150) {
+		t.Errorf("Unexpected discrepancy %+v", third)
+	}
+	if len(third.Suspects) != 1 || third.Suspects[0].Amount != dollars(150) {
+		t.Errorf("Expected the refused 150 transfer as the only suspect, got %+v", third.Suspects)
+	}
+	if third.Adjusted {
+		t.Error("Expected no adjustment without Fix")
+	}
+}
+
+func TestReconcileFixWritesAdjustments(t *testing.T) {
+	store := newLedgerStore(t)
+	ctx := context.Background()
+	now := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+	report, err := reconcile.Run(ctx, store, reconcile.Options{Shards: 3, Fix: true, Now: func() time.Time { return now }})
+	if err != nil {
+		t.Fatalf("Error reconciling: %v", err)
+	}
+	for _, d := range report.Discrepancies {
+		if !d.Adjusted {
+			t.Errorf("Expected account %d to be adjusted", d.AccountNumber)
+		}
+	}
+
+	// The adjustment of user 3 can be looked up by its ID and is on record
+	// with the balance and ledger it reconciled
+	if _, err := audit.Flush(ctx, store.Audit(), audit.Options{}); err != nil {
+		t.Fatalf("Error chaining events: %v", err)
+	}
+	events, err := store.Audit().Find(ctx, repository.AuditQuery{Action: datamodels.AuditAdjustBalance, UserID: 3})
+	if err != nil || len(events) != 1 {
+		t.Fatalf("Expected one adjustment of user 3 on record, got %+v: %v", events, err)
+	}
+	event := events[0]
+	if event.TransactionID == 0 || event.AccountNumber != 13 ||
+		event.Before != `{"balance":"250.00 USD","ledger":"100.00 USD"}` || event.After != `{"balance":"250.00 USD","ledger":"250.00 USD"}` {
+		t.Errorf("Unexpected audit event %+v", event)
+	}
+	adjustment, err := store.Transactions().FindByID(ctx, event.TransactionID)
+	if err != nil || adjustment.EffectiveType() != datamodels.TypeAdjustment || adjustment.Amount != dollars(150) {
+		t.Errorf("Expected the adjustment to be found by its ID, got %+v: %v", adjustment, err)
+	}
+
+	// Balances are untouched and the ledger now agrees with them
+	if got := balanceOf(t, store, 3); got != dollars(250) {
+		t.Errorf("Expected balance of user 3 to stay 250, got %s", got)
+	}
+
+	report, err = reconcile.Run(context.Background(), store, reconcile.Options{Shards: 3})
+	if err != nil {
+		t.Fatalf("Error reconciling: %v", err)
+	}
+	if len(report.Discrepancies) != 0 {
+		t.Errorf("Expected no discrepancies after fixing, got %+v", report.Discrepancies)
+	}
+}
+
+func TestReconcileEndpoint(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	res := adminRequest(t, server, http.MethodGet, "/admin/reconcile?shards=2", nil)
+	defer res.Body.Close()
+
+	var response struct {
+		Status string           `json:"status"`
+		Data   reconcile.Report `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	if response.Status != "success" || response.Data.AccountsChecked != len(fixtureUsers) {
+		t.Errorf("Unexpected response %+v", response)
+	}
+
+	res = adminRequest(t, server, http.MethodGet, "/admin/reconcile?shards=0", nil)
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, res.StatusCode)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"cse512/datamodels"
+	"cse512/handlers"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// reverseTransaction asks to reverse amount of a transaction as userID, the
+// whole remainder if amount is 0
+func reverseTransaction(t *testing.T, server *httptest.Server, transactionID int, userID int, amount int) (int, handlers.Transaction) {
+	t.Helper()
+
+	payload := map[string]any{"user_id": userID}
+	if amount != 0 {
+		payload["amount"] = amount
+	}
+	data, _ := json.Marshal(payload)
+	res, err := http.Post(server.URL+"/transaction/"+strconv.Itoa(transactionID)+"/reverse", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response handlers.Transaction
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	return res.StatusCode, response
+}
+
+func TestReverseTransfer(t *testing.T) {
+	now := time.Date(2030, time.March, 15, 12, 0, 0, 0, time.UTC)
+	server, store, _ := newClockedServer(t, &now)
+
+	_, sent := postTransaction(t, server, TransactionRequest{SenderID: 106, ReceiverID: 50664, AccountNumber: 694332936, Amount: 100})
+
+	// The sender cannot take the money back themselves
+	if status, _ := reverseTransaction(t, server, sent.TransactionID, 106, 0); status != http.StatusNotFound {
+		t.Errorf("Expected status code %d reversing as the sender, got %d", http.StatusNotFound, status)
+	}
+
+	status, partial := reverseTransaction(t, server, sent.TransactionID, 50664, 30)
+	if status != http.StatusOK || partial.UpdatedBalance != dollars(20070) {
+		t.Fatalf("Expected the partial reversal to succeed, got %d %+v", status, partial)
+	}
+	if status, response := reverseTransaction(t, server, sent.TransactionID, 50664, 80); status != http.StatusBadRequest || response.Message != "Amount must be positive and at most the 70.00 USD not yet reversed." {
+		t.Errorf("Expected reversing more than remains to fail, got %d %+v", status, response)
+	}
+
+	status, rest := reverseTransaction(t, server, sent.TransactionID, 50664, 0)
+	if status != http.StatusOK || rest.UpdatedBalance != dollars(20000) {
+		t.Fatalf("Expected the rest to be reversed, got %d %+v", status, rest)
+	}
+	if status, response := reverseTransaction(t, server, sent.TransactionID, 50664, 0); status != http.StatusConflict || response.Code != handlers.CodeInvalidState {
+		t.Errorf("Expected a reversed transfer not to be reversed again, got %d %+v", status, response)
+	}
+	if got := balanceOf(t, store, 106); got != dollars(50000) {
+		t.Errorf("Expected sender balance 50000, got %s", got)
+	}
+
+	original, _ := store.Transactions().FindByID(context.Background(), sent.TransactionID)
+	if original.Status != datamodels.StatusReversed || original.ReversedAmount != dollars(100) || len(original.Reversals) != 2 {
+		t.Errorf("Unexpected reversed transfer %+v", original)
+	}
+
+	// Both sides see the link
+	transactions := recentTransactions(t, server, 106)
+	if len(transactions) < 3 || transactions[0].ReversalOf != sent.TransactionID || transactions[0].Amount != dollars(70) || len(transactions[2].Reversals) != 2 {
+		t.Errorf("Expected the reversals above the transfer, got %+v", transactions[:min(3, len(transactions))])
+	}
+
+	res, err := http.Get(server.URL + "/monthdata?user_id=50664&month=3&year=2030")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+	rows, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Error reading CSV: %v", err)
+	}
+	expected := strconv.Itoa(partial.TransactionID) + " " + strconv.Itoa(rest.TransactionID)
+	if len(rows) != 4 || rows[1][13] != expected || rows[2][12] != strconv.Itoa(sent.TransactionID) || rows[2][6] != datamodels.TypeReversal {
+		t.Errorf("Expected the statement to link the reversals, got %v", rows)
+	}
+}
+
+func TestReverseRequiresSettledTransfer(t *testing.T) {
+	server, store := newTestServer(t)
+
+	_, authorized := postTransaction(t, server, TransactionRequest{SenderID: 110, ReceiverID: 50664, AccountNumber: 694332936, Amount: 100, Authorize: true})
+	if status, response := reverseTransaction(t, server, authorized.TransactionID, 50664, 0); status != http.StatusConflict || response.Code != handlers.CodeInvalidState {
+		t.Errorf("Expected an authorization not to be reversible, got %d %+v", status, response)
+	}
+	if status, _ := reverseTransaction(t, server, 14, 106, 0); status != http.StatusConflict {
+		t.Errorf("Expected a deposit not to be reversible, got %d", status)
+	}
+
+	// Transfers from before statuses settled can be reversed too
+	if status, response := reverseTransaction(t, server, 1, 50664, 0); status != http.StatusOK {
+		t.Errorf("Expected a completed transfer to be reversed, got %d %+v", status, response)
+	}
+	if original, _ := store.Transactions().FindByID(context.Background(), 1); original.Status != datamodels.StatusReversed {
+		t.Errorf("Expected the completed transfer to be reversed, got %s", original.Status)
+	}
+
+	// The receiver must still have the money, less what the authorization holds
+	_, sent := postTransaction(t, server, TransactionRequest{SenderID: 106, ReceiverID: 110, AccountNumber: 310557821, Amount: 500})
+	postTransaction(t, server, TransactionRequest{SenderID: 110, ReceiverID: 50664, AccountNumber: 694332936, Amount: 1400})
+	if status, response := reverseTransaction(t, server, sent.TransactionID, 110, 0); status != http.StatusBadRequest || response.Code != handlers.CodeInsufficientFunds {
+		t.Errorf("Expected the reversal to fail for lack of funds, got %d %+v", status, response)
+	}
+}
+
+func TestConcurrentReversalsNeverExceedTransfer(t *testing.T) {
+	server, store := newTestServer(t)
+
+	_, sent := postTransaction(t, server, TransactionRequest{SenderID: 106, ReceiverID: 50664, AccountNumber: 694332936, Amount: 100})
+
+	// 20 reversals of 10 race for a transfer of 100
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if status, _ := reverseTransaction(t, server, sent.TransactionID, 50664, 10); status == http.StatusOK {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != 10 {
+		t.Errorf("Expected exactly 10 reversals to succeed, got %d", succeeded)
+	}
+	if got := balanceOf(t, store, 106); got != dollars(50000) {
+		t.Errorf("Expected sender balance 50000, got %s", got)
+	}
+}
+
+func TestReversalPostings(t *testing.T) {
+	from := datamodels.Account{AccountNumber: 1, UserID: 1}
+	to := datamodels.Account{AccountNumber: 2, UserID: 2}
+	fee := datamodels.NewMoney(50, "USD")
+	converted := datamodels.NewMoney(9150, "EUR")
+	transfer := datamodels.Transaction{
+		SenderID:        1,
+		SenderAccount:   1,
+		ReceiverID:      2,
+		ReceiverAccount: 2,
+		Amount:          dollars(100),
+		Status:          datamodels.StatusSettled,
+		Type:            datamodels.TypeTransfer,
+		Postings:        datamodels.ConversionPostings(from, to, dollars(100), fee, converted),
+		FX:              &datamodels.Conversion{Rate: "0.92", Fee: fee, Converted: converted},
+	}
+
+	// A full reversal undoes the fee and the conversion too
+	postings, err := transfer.ReversalPostings(dollars(100))
+	if err != nil {
+		t.Fatalf("Error reversing transfer: %v", err)
+	}
+	reversal := datamodels.Transaction{Postings: postings}
+	if err := reversal.CheckBalanced(); err != nil || effectOf(t, reversal, 1) != dollars(100) || effectOf(t, reversal, 2) != datamodels.NewMoney(-9150, "EUR") {
+		t.Errorf("Unexpected full reversal %+v: %v", postings, err)
+	}
+
+	if _, err := transfer.ReversalPostings(dollars(40)); !errors.Is(err, datamodels.ErrPartialConversion) {
+		t.Errorf("Expected ErrPartialConversion, got %v", err)
+	}
+	if _, err := transfer.ReversalPostings(datamodels.NewMoney(100, "EUR")); !errors.Is(err, datamodels.ErrInvalidMoney) {
+		t.Errorf("Expected ErrInvalidMoney for another currency, got %v", err)
+	}
+}
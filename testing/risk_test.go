@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/handlers"
+	"cse512/repository"
+	"cse512/risk"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTransfersHeldForReview(t *testing.T) {
+	now := time.Date(2030, time.March, 15, 12, 0, 0, 0, time.UTC)
+	server, store, handler := newClockedServer(t, &now)
+	handler.SetRiskEngine(risk.NewEngine(risk.NewPayee{Amount: 1000, Age: 24 * time.Hour, Lookback: 30 * 24 * time.Hour}))
+
+	transfer := TransactionRequest{SenderID: 106, ReceiverID: 50664, AccountNumber: 694332936, Amount: 2000}
+	status, held := postTransaction(t, server, transfer)
+	if status != http.StatusAccepted || held.Status != datamodels.StatusPending || held.TransactionID == 0 {
+		t.Fatalf("Expected the transfer to be held for review, got %d %+v", status, held)
+	}
+	sender, _ := store.Accounts().FindByNumber(context.Background(), 482913374)
+	if sender.Balance != dollars(50000) || sender.Available() != dollars(48000) {
+		t.Errorf("Expected the amount to be held, got balance %s available %s", sender.Balance, sender.Available())
+	}
+
+	// Small transfers go ahead
+	transfer.Amount = 500
+	if status, response := postTransaction(t, server, transfer); status != http.StatusOK {
+		t.Errorf("Expected a small transfer to succeed, got %d %+v", status, response)
+	}
+
+	res := adminRequest(t, server, http.MethodGet, "/admin/reviews", nil)
+	defer res.Body.Close()
+	var reviews struct {
+		Data []datamodels.Transaction `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&reviews); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if len(reviews.Data) != 1 || reviews.Data[0].TransactionID != held.TransactionID || reviews.Data[0].Risk.Reasons[0].Rule != "new_payee" {
+		t.Fatalf("Expected the held transfer to be listed with its reason, got %+v", reviews.Data)
+	}
+
+	if status, _ := releaseReview(t, server, "approve", held.TransactionID); status != http.StatusOK {
+		t.Fatalf("Expected the transfer to be approved, got %d", status)
+	}
+	if status, response := releaseReview(t, server, "approve", held.TransactionID); status != http.StatusConflict || response.Code != handlers.CodeInvalidState {
+		t.Errorf("Expected a decided transfer not to be approved again, got %d %+v", status, response)
+	}
+	if got := balanceOf(t, store, 50664); got != dollars(22500) {
+		t.Errorf("Expected receiver balance 22500, got %s", got)
+	}
+	approved, _ := store.Transactions().FindByID(context.Background(), held.TransactionID)
+	if approved.Status != datamodels.StatusSettled || approved.Hold.Released != datamodels.HoldApproved {
+		t.Errorf("Unexpected approved transfer %+v", approved)
+	}
+
+	// A rejected transfer gives the held amount back
+	transfer.Amount = 3000
+	_, held = postTransaction(t, server, transfer)
+	if status, _ := releaseReview(t, server, "reject", held.TransactionID); status != http.StatusOK {
+		t.Fatalf("Expected the transfer to be rejected, got %d", status)
+	}
+	sender, _ = store.Accounts().FindByNumber(context.Background(), 482913374)
+	if sender.Balance != dollars(47500) || !sender.Held.IsZero() {
+		t.Errorf("Expected the hold to be released, got balance %s held %s", sender.Balance, sender.Held)
+	}
+
+	// The account is known once it was first paid long enough ago
+	now = now.Add(25 * time.Hour)
+	if status, response := postTransaction(t, server, transfer); status != http.StatusOK {
+		t.Errorf("Expected a large transfer to a known account to succeed, got %d %+v", status, response)
+	}
+}
+
+func TestInboundBurstDeclinesTransfers(t *testing.T) {
+	now := time.Date(2030, time.March, 15, 12, 0, 0, 0, time.UTC)
+	server, store, handler := newClockedServer(t, &now)
+	handler.SetRiskEngine(risk.NewEngine(risk.InboundBurst{Window: time.Hour, Review: 2, Deny: 3}))
+
+	expected := []int{http.StatusOK, http.StatusOK, http.StatusAccepted, http.StatusForbidden}
+	for i, want := range expected {
+		senderID := []int{106, 110}[i%2]
+		status, response := postTransaction(t, server, TransactionRequest{SenderID: senderID, ReceiverID: 50664, AccountNumber: 694332936, Amount: 10})
+		if status != want {
+			t.Errorf("Transfer %d: expected status code %d, got %d %+v", i+1, want, status, response)
+		}
+		if want == http.StatusForbidden && response.Code != handlers.CodeDeclined {
+			t.Errorf("Expected code %s, got %s", handlers.CodeDeclined, response.Code)
+		}
+	}
+
+	// The reasons are kept on the declined attempt
+	declined, err := store.Attempts().FindRecent(context.Background(), 110, 0, 1)
+	if err != nil || len(declined) != 1 {
+		t.Fatalf("Error fetching attempts: %v", err)
+	}
+	if declined[0].Code != handlers.CodeDeclined || declined[0].Risk == nil || declined[0].Risk.Decision != datamodels.RiskDeny {
+		t.Errorf("Expected a declined attempt with a deny assessment, got %+v", declined[0])
+	}
+
+	// Deposits are not screened
+	if status, _ := postTransaction(t, server, TransactionRequest{SenderID: 50664, ReceiverID: 50664, AccountNumber: 694332936, Amount: 10}); status != http.StatusOK {
+		t.Errorf("Expected the deposit to succeed, got %d", status)
+	}
+}
+
+func TestRiskRules(t *testing.T) {
+	store := repository.NewMemoryStore()
+	ctx := context.Background()
+	now := time.Date(2030, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+	// A transfer of 1000 a day for a week, then three in the last hour
+	var sent []datamodels.Transaction
+	for i := 1; i <= 7; i++ {
+		sent = append(sent, sentTransfer(i, 1000, now.Add(-time.Duration(i)*24*time.Hour)))
+	}
+	for i := 1; i <= 3; i++ {
+		sent = append(sent, sentTransfer(100+i, 250, now.Add(-time.Duration(i)*time.Minute)))
+	}
+	if _, err := store.Transactions().InsertMany(ctx, sent); err != nil {
+		t.Fatalf("Error inserting transfers: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		rule     risk.Rule
+		amount   int
+		decision string
+	}{
+		{"velocity spike", risk.VelocitySpike{Window: time.Hour, Baseline: 30 * 24 * time.Hour, MinCount: 4, Factor: 3}, 250, datamodels.RiskReview},
+		{"velocity below minimum", risk.VelocitySpike{Window: time.Hour, Baseline: 30 * 24 * time.Hour, MinCount: 5, Factor: 3}, 250, datamodels.RiskAllow},
+		{"no other round amount recently", risk.RoundAmounts{Unit: 1000, Count: 2, Window: 12 * time.Hour}, 2000, datamodels.RiskAllow},
+		{"round amounts over two days", risk.RoundAmounts{Unit: 1000, Count: 2, Window: 49 * time.Hour}, 2000, datamodels.RiskReview},
+		{"amount not round", risk.RoundAmounts{Unit: 1000, Count: 1, Window: 49 * time.Hour}, 2500, datamodels.RiskAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := risk.NewEngine(tt.rule)
+			assessment, err := engine.Assess(ctx, store, risk.Transfer{Transaction: sentTransfer(0, tt.amount, now), Now: now})
+			if err != nil {
+				t.Fatalf("Error assessing transfer: %v", err)
+			}
+			if assessment.Decision != tt.decision {
+				t.Errorf("Expected decision %s, got %+v", tt.decision, assessment)
+			}
+			if tt.decision != datamodels.RiskAllow && (len(assessment.Reasons) != 1 || assessment.Reasons[0].Rule != tt.rule.Name()) {
+				t.Errorf("Expected the rule's reason, got %+v", assessment.Reasons)
+			}
+		})
+	}
+}
+
+// sentTransfer is a settled transfer of amount dollars from user 1 to user 2 at when
+func sentTransfer(transactionID int, amount int, when time.Time) datamodels.Transaction {
+	return datamodels.Transaction{
+		TransactionID:   transactionID,
+		SenderID:        1,
+		SenderAccount:   100000001,
+		ReceiverID:      2,
+		ReceiverAccount: 100000002,
+		Amount:          dollars(amount),
+		DateTimeStamp:   when.Unix(),
+		Status:          datamodels.StatusSettled,
+		Type:            datamodels.TypeTransfer,
+	}
+}
+
+// releaseReview approves or rejects a transfer held for review
+func releaseReview(t *testing.T, server *httptest.Server, action string, transactionID int) (int, handlers.Transaction) {
+	t.Helper()
+
+	res := adminRequest(t, server, http.MethodPost, "/admin/reviews/"+strconv.Itoa(transactionID)+"/"+action, nil)
+	defer res.Body.Close()
+
+	var response handlers.Transaction
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	return res.StatusCode, response
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"cse512/datamodels"
+	"cse512/handlers"
+	"cse512/repository"
+	"cse512/scheduler"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOccurrenceAt(t *testing.T) {
+	start := time.Date(2024, time.January, 31, 9, 0, 0, 0, time.UTC)
+	monthly := datamodels.ScheduledTransfer{Frequency: datamodels.FrequencyMonthly, StartAt: start.Unix()}
+	weekly := datamodels.ScheduledTransfer{Frequency: datamodels.FrequencyWeekly, StartAt: start.Unix()}
+
+	tests := []struct {
+		schedule   datamodels.ScheduledTransfer
+		occurrence int
+		expected   time.Time
+	}{
+		{monthly, 0, start},
+		{monthly, 1, time.Date(2024, time.February, 29, 9, 0, 0, 0, time.UTC)},
+		{monthly, 2, time.Date(2024, time.March, 31, 9, 0, 0, 0, time.UTC)},
+		{monthly, 3, time.Date(2024, time.April, 30, 9, 0, 0, 0, time.UTC)},
+		{monthly, 12, time.Date(2025, time.January, 31, 9, 0, 0, 0, time.UTC)},
+		{weekly, 1, time.Date(2024, time.February, 7, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		if got := test.schedule.OccurrenceAt(test.occurrence); !got.Equal(test.expected) {
+			t.Errorf("%s occurrence %d: expected %s, got %s", test.schedule.Frequency, test.occurrence, test.expected, got)
+		}
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	start := time.Date(2024, time.May, 1, 9, 0, 0, 0, time.UTC)
+	schedule := datamodels.ScheduledTransfer{
+		Frequency: datamodels.FrequencyWeekly,
+		StartAt:   start.Unix(),
+		EndAt:     start.AddDate(0, 0, 30).Unix(),
+		Status:    datamodels.ScheduleActive,
+	}
+
+	// Occurrences missed while no scheduler ran are skipped
+	schedule.Advance(start.AddDate(0, 0, 15))
+	if schedule.Occurrence != 3 || schedule.NextRunAt != start.AddDate(0, 0, 21).Unix() {
+		t.Errorf("Expected occurrence 3 on May 22, got %d at %s", schedule.Occurrence, time.Unix(schedule.NextRunAt, 0).UTC())
+	}
+
+	schedule.Advance(start.AddDate(0, 0, 21))
+	if schedule.Occurrence != 4 || schedule.Status != datamodels.ScheduleActive {
+		t.Errorf("Expected occurrence 4 on May 29, got %+v", schedule)
+	}
+
+	// The next occurrence would be after the end date
+	schedule.Advance(start.AddDate(0, 0, 28))
+	if schedule.Status != datamodels.ScheduleCompleted || schedule.NextRunAt != 0 {
+		t.Errorf("Expected the schedule to complete, got %+v", schedule)
+	}
+
+	once := datamodels.ScheduledTransfer{Frequency: datamodels.FrequencyOnce, StartAt: start.Unix(), Status: datamodels.ScheduleActive}
+	once.Advance(start)
+	if once.Status != datamodels.ScheduleCompleted {
+		t.Errorf("Expected a one-off transfer to complete, got %+v", once)
+	}
+}
+
+// scheduleResponse is the body returned when a transfer is scheduled
+type scheduleResponse struct {
+	Status  string                       `json:"status"`
+	Message string                       `json:"message"`
+	Data    datamodels.ScheduledTransfer `json:"data"`
+}
+
+// scheduleTransfer posts payload to /scheduled-transfers and decodes the response
+func scheduleTransfer(t *testing.T, server *httptest.Server, payload map[string]any) (int, scheduleResponse) {
+	t.Helper()
+
+	data, _ := json.Marshal(payload)
+	res, err := http.Post(server.URL+"/scheduled-transfers", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response scheduleResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	return res.StatusCode, response
+}
+
+// cancelSchedule cancels a scheduled transfer as userID and returns the status code
+func cancelSchedule(t *testing.T, server *httptest.Server, scheduleID int64, userID int) int {
+	t.Helper()
+
+	route := server.URL + "/scheduled-transfers/" + strconv.FormatInt(scheduleID, 10) + "?user_id=" + strconv.Itoa(userID)
+	req, _ := http.NewRequest(http.MethodDelete, route, nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func TestScheduledTransferEndpoints(t *testing.T) {
+	server, _ := newTestServer(t)
+	start := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name    string
+		payload map[string]any
+		status  int
+		message string
+	}{
+		{"past start", map[string]any{"user_id": 106, "account_number": 694332936, "amount": 10, "start_at": time.Now().Unix() - 60}, http.StatusBadRequest, "start_at must be in the future."},
+		{"unknown frequency", map[string]any{"user_id": 106, "account_number": 694332936, "amount": 10, "start_at": start, "frequency": "daily"}, http.StatusBadRequest, "frequency must be once, weekly or monthly."},
+		{"end before start", map[string]any{"user_id": 106, "account_number": 694332936, "amount": 10, "start_at": start, "frequency": "weekly", "end_at": start - 1}, http.StatusBadRequest, "end_at must not be before start_at."},
+		{"negative amount", map[string]any{"user_id": 106, "account_number": 694332936, "amount": -10, "start_at": start}, http.StatusBadRequest, "Transfer amount must be positive and at most 1000000000."},
+		{"unknown account", map[string]any{"user_id": 106, "account_number": 999999999, "amount": 10, "start_at": start}, http.StatusNotFound, "Receiver's account not found."},
+		{"another user's account", map[string]any{"user_id": 106, "from_account": 694332936, "account_number": 310557821, "amount": 10, "start_at": start}, http.StatusBadRequest, "Sender's account number does not match."},
+		{"monthly", map[string]any{"user_id": 106, "account_number": 694332936, "amount": 10, "start_at": start, "frequency": "monthly"}, http.StatusCreated, "Transfer scheduled successfully."},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, response := scheduleTransfer(t, server, test.payload)
+			if status != test.status || response.Message != test.message {
+				t.Errorf("Expected %d %q, got %d %q", test.status, test.message, status, response.Message)
+			}
+		})
+	}
+
+	_, created := scheduleTransfer(t, server, map[string]any{"user_id": 106, "account_number": 694332936, "amount": 25, "start_at": start})
+	schedule := created.Data
+	if schedule.FromAccount != 482913374 || schedule.NextRunAt != start || schedule.Status != datamodels.ScheduleActive {
+		t.Errorf("Unexpected scheduled transfer %+v", schedule)
+	}
+
+	if status := cancelSchedule(t, server, schedule.ScheduleID, 110); status != http.StatusNotFound {
+		t.Errorf("Expected status code %d for another user's transfer, got %d", http.StatusNotFound, status)
+	}
+	if status := cancelSchedule(t, server, schedule.ScheduleID, 106); status != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, status)
+	}
+	if status := cancelSchedule(t, server, schedule.ScheduleID, 106); status != http.StatusConflict {
+		t.Errorf("Expected status code %d cancelling twice, got %d", http.StatusConflict, status)
+	}
+
+	res, err := http.Get(server.URL + "/scheduled-transfers?user_id=106")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var list struct {
+		Data []datamodels.ScheduledTransfer `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	statuses := map[string]int{}
+	for _, listed := range list.Data {
+		statuses[listed.Status]++
+	}
+	if len(list.Data) != 2 || statuses[datamodels.ScheduleActive] != 1 || statuses[datamodels.ScheduleCancelled] != 1 {
+		t.Errorf("Expected the monthly and the cancelled transfer, got %+v", list.Data)
+	}
+}
+
+// newSchedulerTest starts the API and returns a handler on the same store to run scheduled transfers with
+func newSchedulerTest(t *testing.T) (*httptest.Server, *repository.MemoryStore, *handlers.Handler) {
+	t.Helper()
+
+	server, store := newTestServer(t)
+	return server, store, handlers.New(store)
+}
+
+func TestSchedulerRunsDueTransfers(t *testing.T) {
+	server, store, handler := newSchedulerTest(t)
+	ctx := context.Background()
+
+	start := time.Now().Add(time.Hour)
+	_, weekly := scheduleTransfer(t, server, map[string]any{"user_id": 110, "account_number": 694332936, "amount": 400, "start_at": start.Unix(), "frequency": "weekly", "remarks": "Allowance"})
+	_, cancelled := scheduleTransfer(t, server, map[string]any{"user_id": 110, "account_number": 694332936, "amount": 1, "start_at": start.Unix()})
+	cancelSchedule(t, server, cancelled.Data.ScheduleID, 110)
+
+	// Nothing is due yet
+	now := time.Now()
+	opts := scheduler.Options{Owner: "test", Now: func() time.Time { return now }}
+	if ran, err := scheduler.RunDue(ctx, store, handler.ExecuteScheduledTransfer, opts); err != nil || ran != 0 {
+		t.Fatalf("Expected nothing to run, ran %d: %v", ran, err)
+	}
+
+	// The first two occurrences succeed, the third overdraws
+	for week := 0; week < 3; week++ {
+		now = start.AddDate(0, 0, 7*week).Add(time.Minute)
+		if ran, err := scheduler.RunDue(ctx, store, handler.ExecuteScheduledTransfer, opts); err != nil || ran != 1 {
+			t.Fatalf("Week %d: expected one transfer to run, ran %d: %v", week, ran, err)
+		}
+	}
+
+	if got := balanceOf(t, store, 110); got != dollars(200) {
+		t.Errorf("Expected sender balance 200, got %s", got)
+	}
+	if got := balanceOf(t, store, 50664); got != dollars(20800) {
+		t.Errorf("Expected receiver balance 20800, got %s", got)
+	}
+
+	schedule, err := store.Schedules().FindByID(ctx, weekly.Data.ScheduleID)
+	if err != nil {
+		t.Fatalf("Error fetching scheduled transfer: %v", err)
+	}
+	if schedule.Runs != 3 || schedule.Occurrence != 3 || schedule.LastStatus != datamodels.StatusFailed || schedule.LastMessage != "Insufficient balance." {
+		t.Errorf("Unexpected scheduled transfer after three runs %+v", schedule)
+	}
+
+	// Every occurrence is recorded once, on the ledger if it moved money and
+	// as an attempt if it failed
+	for occurrence := 0; occurrence < 2; occurrence++ {
+		transaction, err := store.Transactions().FindScheduleRun(ctx, datamodels.ScheduleRun{ScheduleID: schedule.ScheduleID, Occurrence: occurrence})
+		if err != nil {
+			t.Fatalf("Expected a transaction for occurrence %d: %v", occurrence, err)
+		}
+		if transaction.Remarks != "Allowance" {
+			t.Errorf("Unexpected transaction %+v", transaction)
+		}
+	}
+	failedRun := datamodels.ScheduleRun{ScheduleID: schedule.ScheduleID, Occurrence: 2}
+	if _, err := store.Transactions().FindScheduleRun(ctx, failedRun); err == nil {
+		t.Error("Expected the failed occurrence not to be on the ledger")
+	}
+	attempt, err := store.Attempts().FindScheduleRun(ctx, failedRun)
+	if err != nil || attempt.Remarks != "Allowance" || attempt.Code != handlers.CodeInsufficientFunds {
+		t.Errorf("Expected an attempt for the failed occurrence, got %+v %v", attempt, err)
+	}
+	if _, err := store.Transactions().FindScheduleRun(ctx, datamodels.ScheduleRun{ScheduleID: cancelled.Data.ScheduleID}); err == nil {
+		t.Error("Expected the cancelled transfer not to run")
+	}
+}
+
+func TestSchedulerRespectsLeases(t *testing.T) {
+	server, store, handler := newSchedulerTest(t)
+	ctx := context.Background()
+
+	start := time.Now().Add(time.Hour)
+	_, created := scheduleTransfer(t, server, map[string]any{"user_id": 110, "account_number": 694332936, "amount": 100, "start_at": start.Unix()})
+	now := start.Add(time.Minute)
+
+	// Another instance holds the lease, so nothing runs here until it expires
+	claimed, err := store.Schedules().ClaimDue(ctx, now.Unix(), "other", now.Add(time.Minute).Unix())
+	if err != nil || claimed.ScheduleID != created.Data.ScheduleID {
+		t.Fatalf("Expected to claim the transfer, got %+v: %v", claimed, err)
+	}
+	opts := scheduler.Options{Owner: "test", Now: func() time.Time { return now }}
+	if ran, _ := scheduler.RunDue(ctx, store, handler.ExecuteScheduledTransfer, opts); ran != 0 {
+		t.Fatalf("Expected a leased transfer not to run, ran %d", ran)
+	}
+
+	// The other instance made the transaction, then stopped before recording it
+	made := datamodels.Transaction{
+		SenderID:        110,
+		SenderAccount:   310557821,
+		ReceiverID:      50664,
+		ReceiverAccount: 694332936,
+		Amount:          dollars(100),
+		Status:          datamodels.StatusSettled,
+		Schedule:        &datamodels.ScheduleRun{ScheduleID: claimed.ScheduleID},
+	}
+	store.Transactions().Insert(ctx, made)
+
+	now = now.Add(2 * time.Minute)
+	if ran, err := scheduler.RunDue(ctx, store, handler.ExecuteScheduledTransfer, opts); err != nil || ran != 1 {
+		t.Fatalf("Expected the expired lease to be taken over, ran %d: %v", ran, err)
+	}
+	if got := balanceOf(t, store, 110); got != dollars(1000) {
+		t.Errorf("Expected the occurrence not to be made again, balance %s", got)
+	}
+
+	schedule, _ := store.Schedules().FindByID(ctx, claimed.ScheduleID)
+	if schedule.Status != datamodels.ScheduleCompleted || schedule.LastStatus != datamodels.StatusSettled {
+		t.Errorf("Expected the transfer to complete, got %+v", schedule)
+	}
+}
+
+func TestRacingRunsMakeAnOccurrenceOnce(t *testing.T) {
+	server, store, handler := newSchedulerTest(t)
+	ctx := context.Background()
+
+	_, created := scheduleTransfer(t, server, map[string]any{"user_id": 110, "account_number": 694332936, "amount": 100, "start_at": time.Now().Add(time.Hour).Unix()})
+	schedule, err := store.Schedules().FindByID(ctx, created.Data.ScheduleID)
+	if err != nil {
+		t.Fatalf("Error fetching scheduled transfer: %v", err)
+	}
+
+	// An instance takes over the occurrence after the lease expired while the
+	// first is still making it
+	run := datamodels.ScheduleRun{ScheduleID: schedule.ScheduleID}
+	outcomes := make([]scheduler.Outcome, 2)
+	var wg sync.WaitGroup
+	for i := range outcomes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outcomes[i] = handler.ExecuteScheduledTransfer(ctx, schedule, run)
+		}()
+	}
+	wg.Wait()
+
+	for i, outcome := range outcomes {
+		if outcome.Status != datamodels.StatusSettled {
+			t.Errorf("Expected run %d to report the occurrence settled, got %+v", i, outcome)
+		}
+	}
+	if got := balanceOf(t, store, 110); got != dollars(900) {
+		t.Errorf("Expected the occurrence to be made once, balance %s", got)
+	}
+	if _, err := store.Transactions().FindScheduleRun(ctx, run); err != nil {
+		t.Errorf("Expected a transaction for the occurrence: %v", err)
+	}
+	if attempt, err := store.Attempts().FindScheduleRun(ctx, run); err == nil {
+		t.Errorf("Expected no failed attempt for a made occurrence, got %+v", attempt)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"cse512/datamodels"
+	"cse512/repository"
+	"cse512/seed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestSeedUsersFromJSONArray(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+
+	input := fmt.Sprintf(`[
+  {"_id": {"$oid": "6740d1d6c9f3a1b2c3d4e5f6"}, "user_id": 100, "first_name": "Patrick", "last_name": "Hackett", "email": "Patrick_Hackett31@gmail.com", "current_balance": 1000, "password": %q, "account_number": {"$numberLong": "694332936"}},
+  {"user_id": 101, "first_name": "Plain", "last_name": "Text", "email": "plain@gmail.com", "current_balance": 10, "password": "WHeI1fEFjuDoi3o", "account_number": 123456789},
+  {"user_id": 102, "first_name": "Joe", "last_name": "Wilderman", "email": "Joe.Wilderman@hotmail.com", "current_balance": 50, "password": %q, "account_number": 223456789}
+]`, hash, hash)
+
+	store := repository.NewMemoryStore()
+	stats, err := seed.LoadUsers(context.Background(), strings.NewReader(input), store.Users(), store.Accounts(), seed.Options{BatchSize: 2})
+	if err != nil {
+		t.Fatalf("Error loading users: %v", err)
+	}
+
+	if stats.Read != 3 || stats.Inserted != 2 || stats.Invalid != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	user, err := store.Users().FindByID(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("Error fetching user: %v", err)
+	}
+	if user.AccountNumber != 694332936 {
+		t.Errorf("Unexpected user %+v", user)
+	}
+
+	// The current_balance becomes the user's primary checking account
+	account, err := store.Accounts().FindByNumber(context.Background(), 694332936)
+	if err != nil {
+		t.Fatalf("Error fetching account: %v", err)
+	}
+	if account.UserID != 100 || account.Type != datamodels.AccountChecking || account.Balance != dollars(1000) {
+		t.Errorf("Unexpected account %+v", account)
+	}
+
+	// Loading the same file again inserts nothing
+	stats, err = seed.LoadUsers(context.Background(), strings.NewReader(input), store.Users(), store.Accounts(), seed.Options{})
+	if err != nil {
+		t.Fatalf("Error reloading users: %v", err)
+	}
+	if stats.Inserted != 0 || stats.Existing != 2 {
+		t.Errorf("Unexpected stats on reload %+v", stats)
+	}
+}
+
+func TestSeedTransactionsFromNDJSON(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 25; i++ {
+		lines = append(lines, fmt.Sprintf(`{"transaction_id": %d, "sender_id": 100, "amount": %d, "receiver_id": 101, "remarks": "Transfer", "dateTimeStamp": %d, "status": "completed"}`, i, i*10, 1660000000+i))
+	}
+	lines = append(lines, `{"transaction_id": 26, "sender_id": 100, "amount": 0, "receiver_id": 101, "dateTimeStamp": 1660000000, "status": "completed"}`)
+
+	store := repository.NewMemoryStore()
+	stats, err := seed.LoadTransactions(context.Background(), strings.NewReader(strings.Join(lines, "\n")), store.Transactions(), seed.Options{BatchSize: 4, Workers: 3})
+	if err != nil {
+		t.Fatalf("Error loading transactions: %v", err)
+	}
+
+	if stats.Read != 26 || stats.Inserted != 25 || stats.Invalid != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	transactions, _ := store.Transactions().FindRecent(context.Background(), 100, 0, nil, 100)
+	if len(transactions) != 25 {
+		t.Errorf("Expected 25 stored transactions, got %d", len(transactions))
+	}
+}
+
+func TestSeedResumesFromCheckpoint(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 10; i++ {
+		lines = append(lines, fmt.Sprintf(`{"transaction_id": %d, "sender_id": 100, "amount": 10, "receiver_id": 101, "dateTimeStamp": %d, "status": "completed"}`, i, 1660000000+i))
+	}
+
+	checkpoint := filepath.Join(t.TempDir(), "transactions.checkpoint")
+	if err := os.WriteFile(checkpoint, []byte(`{"records": 6}`), 0o644); err != nil {
+		t.Fatalf("Error writing checkpoint: %v", err)
+	}
+
+	store := repository.NewMemoryStore()
+	stats, err := seed.LoadTransactions(context.Background(), strings.NewReader(strings.Join(lines, "\n")), store.Transactions(), seed.Options{Checkpoint: checkpoint})
+	if err != nil {
+		t.Fatalf("Error loading transactions: %v", err)
+	}
+
+	if stats.Resumed != 6 || stats.Inserted != 4 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	if _, err := os.Stat(checkpoint); !os.IsNotExist(err) {
+		t.Errorf("Expected checkpoint to be removed after a complete load")
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"cse512/handlers"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type TransactionRequest struct {
+	SenderID      int    `json:"sender_id"`
+	ReceiverID    int    `json:"receiver_id"`
+	AccountNumber int    `json:"account_number"`
+	FromAccount   int    `json:"from_account,omitempty"`
+	Amount        int    `json:"amount"`
+	Remarks       string `json:"remarks"`
+	RequestedAt   int64  `json:"requested_at,omitempty"`
+	Authorize     bool   `json:"authorize,omitempty"`
+}
+
+// postTransaction sends payload to /transaction and decodes the response
+func postTransaction(t *testing.T, server *httptest.Server, payload TransactionRequest) (int, handlers.Transaction) {
+	t.Helper()
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("Error marshalling JSON: %v", err)
+	}
+
+	res, err := http.Post(server.URL+"/transaction", "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var response handlers.Transaction
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	return res.StatusCode, response
+}
+
+func TestPerformTransaction(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  TransactionRequest
+		status   int
+		message  string
+		balances map[int]int
+	}{
+		{
+			name:     "transfer",
+			payload:  TransactionRequest{SenderID: 106, ReceiverID: 50664, AccountNumber: 694332936, Amount: 20},
+			status:   http.StatusOK,
+			message:  "Transaction completed successfully.",
+			balances: map[int]int{106: 49980, 50664: 20020},
+		},
+		{
+			name:     "insufficient funds",
+			payload:  TransactionRequest{SenderID: 110, ReceiverID: 50664, AccountNumber: 694332936, Amount: 1001},
+			status:   http.StatusBadRequest,
+			message:  "Insufficient balance.",
+			balances: map[int]int{110: 1000, 50664: 20000},
+		},
+		{
+			name:     "account mismatch",
+			payload:  TransactionRequest{SenderID: 106, ReceiverID: 50664, AccountNumber: 111111111, Amount: 20},
+			status:   http.StatusBadRequest,
+			message:  "Receiver's account number does not match.",
+			balances: map[int]int{106: 50000, 50664: 20000},
+		},
+		{
+			name:     "unknown receiver",
+			payload:  TransactionRequest{SenderID: 106, ReceiverID: 9, AccountNumber: 694332936, Amount: 20},
+			status:   http.StatusNotFound,
+			message:  "Receiver not found.",
+			balances: map[int]int{106: 50000},
+		},
+		{
+			name:     "unknown sender",
+			payload:  TransactionRequest{SenderID: 9, ReceiverID: 50664, AccountNumber: 694332936, Amount: 20},
+			status:   http.StatusNotFound,
+			message:  "Sender not found.",
+			balances: map[int]int{50664: 20000},
+		},
+		{
+			name:     "self deposit",
+			payload:  TransactionRequest{SenderID: 110, ReceiverID: 110, AccountNumber: 310557821, Amount: 500},
+			status:   http.StatusOK,
+			message:  "Transaction completed successfully.",
+			balances: map[int]int{110: 1500},
+		},
+		{
+			name:     "self withdrawal",
+			payload:  TransactionRequest{SenderID: 110, ReceiverID: 110, AccountNumber: 310557821, Amount: -400},
+			status:   http.StatusOK,
+			message:  "Transaction completed successfully.",
+			balances: map[int]int{110: 600},
+		},
+		{
+			name:     "missing amount",
+			payload:  TransactionRequest{SenderID: 106, ReceiverID: 50664, AccountNumber: 694332936},
+			status:   http.StatusBadRequest,
+			message:  "Amount is required.",
+			balances: map[int]int{106: 50000, 50664: 20000},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, store := newTestServer(t)
+
+			status, response := postTransaction(t, server, test.payload)
+
+			if status != test.status {
+				t.Errorf("Expected status code %d, got %d", test.status, status)
+			}
+
+			if response.Message != test.message {
+				t.Errorf("Expected message %q, got %q", test.message, response.Message)
+			}
+
+			if status == http.StatusOK && response.UpdatedBalance != dollars(test.balances[test.payload.SenderID]) {
+				t.Errorf("Expected updated balance %d, got %s", test.balances[test.payload.SenderID], response.UpdatedBalance)
+			}
+
+			for userID, balance := range test.balances {
+				if got := balanceOf(t, store, userID); got != dollars(balance) {
+					t.Errorf("Expected balance of user %d to be %d, got %s", userID, balance, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPerformTransactionRecordsHistory(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	postTransaction(t, server, TransactionRequest{SenderID: 110, ReceiverID: 50664, AccountNumber: 694332936, Amount: 5000})
+	postTransaction(t, server, TransactionRequest{SenderID: 110, ReceiverID: 50664, AccountNumber: 694332936, Amount: 300})
+
+	type row struct {
+		status string
+		amount int
+		code   string
+	}
+	tests := []struct {
+		query    string
+		expected []row
+	}{
+		// Only the ledger by default, refused attempts on request
+		{"", []row{{"settled", -300, ""}}},
+		{"&include_failed=true", []row{{"settled", -300, ""}, {"failed", -5000, handlers.CodeInsufficientFunds}}},
+	}
+
+	for _, test := range tests {
+		res, err := http.Get(server.URL + "/transactions?sender_id=110" + test.query)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var transactions []handlers.TransactionResponse
+		err = json.NewDecoder(res.Body).Decode(&transactions)
+		res.Body.Close()
+		if err != nil {
+			t.Fatalf("Error decoding response: %v", err)
+		}
+
+		if len(transactions) != len(test.expected) {
+			t.Fatalf("Expected %d transactions for %q, got %d", len(test.expected), test.query, len(transactions))
+		}
+		for idx, transaction := range transactions {
+			expected := test.expected[idx]
+			if transaction.Status != expected.status || transaction.Amount != dollars(expected.amount) || transaction.Code != expected.code {
+				t.Errorf("Expected %s/%d/%q at index %d for %q, got %s/%s/%q", expected.status, expected.amount, expected.code, idx, test.query, transaction.Status, transaction.Amount, transaction.Code)
+			}
+		}
+	}
+
+	res, err := http.Get(server.URL + "/transactions?sender_id=110&include_failed=maybe")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an invalid include_failed, got %d", http.StatusBadRequest, res.StatusCode)
+	}
+}
+
+func TestPerformTransactionRecordsRefusedAttempts(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	// The amount is not in the currency of the account it comes from
+	res, err := http.Post(server.URL+"/transaction", "application/json", strings.NewReader(`{"sender_id":110,"receiver_id":50664,"account_number":694332936,"amount":{"amount":10,"currency":"EUR"}}`))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var response handlers.Transaction
+	err = json.NewDecoder(res.Body).Decode(&response)
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if res.StatusCode != http.StatusBadRequest || response.Message != "Amount must be in USD." || response.Code != handlers.CodeRejected {
+		t.Errorf("Expected an amount in another currency to be rejected, got %d %q %q", res.StatusCode, response.Message, response.Code)
+	}
+
+	// The money would go back into the account it comes from
+	status, response := postTransaction(t, server, TransactionRequest{SenderID: 110, AccountNumber: 310557821, Amount: 20})
+	if status != http.StatusBadRequest || response.Message != "Cannot transfer to the account the money comes from." || response.Code != handlers.CodeRejected {
+		t.Errorf("Expected a transfer into the same account to be rejected, got %d %q %q", status, response.Message, response.Code)
+	}
+
+	res, err = http.Get(server.URL + "/transactions?sender_id=110&include_failed=true")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var transactions []handlers.TransactionResponse
+	err = json.NewDecoder(res.Body).Decode(&transactions)
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	if len(transactions) != 2 {
+		t.Fatalf("Expected both refusals to be listed as attempts, got %d transactions", len(transactions))
+	}
+	for idx, transaction := range transactions {
+		if transaction.Status != "failed" || transaction.Code != handlers.CodeRejected {
+			t.Errorf("Expected a failed attempt with code %s at index %d, got %s/%q", handlers.CodeRejected, idx, transaction.Status, transaction.Code)
+		}
+	}
+}